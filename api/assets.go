@@ -9,7 +9,9 @@ import (
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/vjeantet/bitfan/api/models"
 	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/entrypoint/parser/lint"
 	"github.com/vjeantet/bitfan/entrypoint/parser/logstash"
+	"github.com/vjeantet/bitfan/processors/doc"
 )
 
 type AssetApiController struct {
@@ -43,6 +45,57 @@ func (a *AssetApiController) CheckSyntax(c *gin.Context) {
 
 }
 
+// Format returns the value of the posted asset in its canonical form
+func (a *AssetApiController) Format(c *gin.Context) {
+	var asset models.Asset
+	err := c.BindJSON(&asset)
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+
+	value, err := logstash.Format(asset.Value)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, models.FormattedAsset{
+		Uuid:    c.Param("uuid"),
+		Value:   value,
+		Changed: !bytes.Equal(value, asset.Value),
+	})
+}
+
+// Lint returns the issues found in the value of the posted asset
+func (a *AssetApiController) Lint(c *gin.Context) {
+	var asset models.Asset
+	err := c.BindJSON(&asset)
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+
+	issues, err := lint.Content(asset.Value, func(code string) *doc.Processor {
+		return core.ProcessorsDocs(code)[code]
+	})
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	report := models.LintReport{
+		Uuid:   c.Param("uuid"),
+		Issues: make([]models.LintIssue, len(issues)),
+	}
+	for i, issue := range issues {
+		report.Issues[i] = models.LintIssue{
+			Line:    issue.Line,
+			Rule:    issue.Rule,
+			Message: issue.Message,
+		}
+	}
+	c.JSON(200, report)
+}
+
 func (a *AssetApiController) Create(c *gin.Context) {
 	var asset models.Asset
 	err := c.BindJSON(&asset)
@@ -61,7 +114,9 @@ func (a *AssetApiController) Create(c *gin.Context) {
 	}
 	asset.ContentType = http.DetectContentType(asset.Value[:n])
 
+	ensureVersioned(asset.PipelineUUID)
 	core.Storage().CreateAsset(&asset)
+	recordVersion(c, asset.PipelineUUID, "asset "+asset.Name+" created")
 
 	c.Redirect(302, fmt.Sprintf("/%s/assets/%s", a.path, asset.Uuid))
 }
@@ -105,7 +160,9 @@ func (a *AssetApiController) UpdateByUUID(c *gin.Context) {
 		return
 	}
 
+	ensureVersioned(asset.PipelineUUID)
 	core.Storage().SaveAsset(&asset)
+	recordVersion(c, asset.PipelineUUID, "asset "+asset.Name+" updated")
 
 	// c.Redirect(201, fmt.Sprintf("/%s/assets/%s", a.path, asset.Uuid))
 	c.JSON(200, asset)
@@ -120,7 +177,9 @@ func (a *AssetApiController) DeleteByUUID(c *gin.Context) {
 		return
 	}
 
+	ensureVersioned(asset.PipelineUUID)
 	core.Storage().DeleteAsset(&asset)
+	recordVersion(c, asset.PipelineUUID, "asset "+asset.Name+" deleted")
 
 	c.JSON(204, "")
 }
@@ -149,7 +208,9 @@ func (a *AssetApiController) ReplaceByUUID(c *gin.Context) {
 	}
 	asset.ContentType = http.DetectContentType(asset.Value[:n])
 
+	ensureVersioned(asset.PipelineUUID)
 	core.Storage().SaveAsset(&asset)
+	recordVersion(c, asset.PipelineUUID, "asset "+asset.Name+" updated")
 
 	c.Redirect(302, fmt.Sprintf("/%s/assets/%s", a.path, asset.Uuid))
 }
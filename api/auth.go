@@ -0,0 +1,209 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+)
+
+// Options of the API handler
+type Options struct {
+	// Auth enables authentication, requests must provide a user's token or
+	// its name and password
+	Auth bool
+	// AdminToken is always granted the admin role, use it to create the first users
+	AdminToken string
+	// CORSOrigins are the origins allowed to call the API from a browser, "*" allows all
+	CORSOrigins []string
+	// MaxEventsSize is the maximum size in bytes of the events injected by a
+	// request, 10MB when 0
+	MaxEventsSize int64
+	// Syncer syncs stored pipelines with a manifest, nil when sync is disabled
+	Syncer *Syncer
+}
+
+const userContextKey = "bitfan.user"
+
+// ticketTTL is how long a websocket ticket can be used
+const ticketTTL = 30 * time.Second
+
+// users authenticates the tokens and the credentials of the API users
+type users interface {
+	AuthenticateToken(token string) (models.User, error)
+	AuthenticateBasic(name, password string) (models.User, error)
+}
+
+// userStore returns the users of the API
+var userStore = func() users {
+	return core.Storage()
+}
+
+type ticket struct {
+	user    models.User
+	expires time.Time
+}
+
+// tickets are short lived and single use credentials of websockets
+var tickets = struct {
+	sync.Mutex
+	m map[string]ticket
+}{m: map[string]ticket{}}
+
+// issueTicket returns a ticket of the user valid for ticketTTL
+func issueTicket(user models.User, now time.Time) (models.Ticket, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return models.Ticket{}, err
+	}
+	t := models.Ticket{Ticket: hex.EncodeToString(b), ExpiresAt: now.Add(ticketTTL)}
+
+	tickets.Lock()
+	defer tickets.Unlock()
+	for k, v := range tickets.m {
+		if now.After(v.expires) {
+			delete(tickets.m, k)
+		}
+	}
+	tickets.m[t.Ticket] = ticket{user: user, expires: t.ExpiresAt}
+	return t, nil
+}
+
+// redeemTicket returns the user of the ticket and revokes it
+func redeemTicket(value string, now time.Time) (models.User, bool) {
+	tickets.Lock()
+	defer tickets.Unlock()
+	t, ok := tickets.m[value]
+	if !ok {
+		return models.User{}, false
+	}
+	delete(tickets.m, value)
+	if now.After(t.expires) {
+		return models.User{}, false
+	}
+	return t.user, true
+}
+
+// authenticate identifies the user with a bearer token or basic auth
+// credentials, websockets may use a ticket query parameter instead
+func authenticate(opt Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !opt.Auth {
+			c.Next()
+			return
+		}
+
+		var user models.User
+		var err error
+
+		var token string
+		if h := c.Request.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimPrefix(h, "Bearer ")
+		}
+
+		if name, password, ok := c.Request.BasicAuth(); ok && token == "" {
+			user, err = userStore().AuthenticateBasic(name, password)
+		} else if token != "" {
+			if opt.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(opt.AdminToken)) == 1 {
+				user = models.User{Name: "admin", Role: models.ROLE_ADMIN}
+			} else {
+				user, err = userStore().AuthenticateToken(token)
+			}
+		} else if value := c.Query("ticket"); value != "" && websocket.IsWebSocketUpgrade(c.Request) {
+			var ok bool
+			if user, ok = redeemTicket(value, time.Now()); !ok {
+				apiLogger.Warnf("authentication failed from %s : invalid ticket", c.ClientIP())
+				c.AbortWithStatusJSON(http.StatusUnauthorized, models.Error{Message: "invalid or expired ticket"})
+				return
+			}
+		} else {
+			c.Header("WWW-Authenticate", `Basic realm="bitfan"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Error{Message: "authentication required"})
+			return
+		}
+
+		if err != nil {
+			apiLogger.Warnf("authentication failed from %s : %v", c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Error{Message: err.Error()})
+			return
+		}
+
+		c.Set(userContextKey, user)
+		c.Next()
+	}
+}
+
+// requireRole rejects requests of users not granted the role
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.Error{Message: "role " + role + " required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// hasRole returns true when authentication is disabled or when the
+// authenticated user is granted the role
+func hasRole(c *gin.Context, role string) bool {
+	v, ok := c.Get(userContextKey)
+	if !ok {
+		// authentication disabled
+		return true
+	}
+	user := v.(models.User)
+	return user.HasRole(role)
+}
+
+// author returns the name of the authenticated user, the client ip when
+// authentication is disabled
+func author(c *gin.Context) string {
+	v, ok := c.Get(userContextKey)
+	if !ok {
+		return c.ClientIP()
+	}
+	return v.(models.User).Name
+}
+
+// cors sets the CORS headers allowing the configured origins
+func cors(origins []string) gin.HandlerFunc {
+	allowAll := false
+	allowed := map[string]bool{}
+	for _, o := range origins {
+		if o == "*" {
+			allowAll = true
+		}
+		allowed[strings.TrimSuffix(o, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.Request.Header.Get("Origin")
+		if allowAll {
+			c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && allowed[origin] {
+			c.Writer.Header().Add("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Access-Control-Allow-Credentials", "true")
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		c.Writer.Header().Add("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE, PATCH")
+		if c.Request.Method == "OPTIONS" {
+			headers := c.Request.Header.Get("Access-Control-Request-Headers")
+			if headers == "" {
+				headers = "Authorization, Content-Type"
+			}
+			c.Writer.Header().Add("Access-Control-Allow-Headers", headers)
+			c.AbortWithStatusJSON(http.StatusOK, struct{}{})
+			return
+		}
+		c.Next()
+	}
+}
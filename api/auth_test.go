@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+)
+
+// fakeUsers authenticates the token "<role>-token" and the user "<role>"
+// with the password "secret"
+type fakeUsers struct{}
+
+func (fakeUsers) AuthenticateToken(token string) (models.User, error) {
+	role := strings.TrimSuffix(token, "-token")
+	if !models.ValidRole(role) || role == token {
+		return models.User{}, fmt.Errorf("invalid token")
+	}
+	return models.User{Name: role, Role: role}, nil
+}
+
+func (fakeUsers) AuthenticateBasic(name, password string) (models.User, error) {
+	if !models.ValidRole(name) || password != "secret" {
+		return models.User{}, fmt.Errorf("invalid user or password")
+	}
+	return models.User{Name: name, Role: name}, nil
+}
+
+func withFakeUsers(t *testing.T) {
+	previous := userStore
+	userStore = func() users { return fakeUsers{} }
+	t.Cleanup(func() { userStore = previous })
+}
+
+func serve(h http.Handler, method, path string, header http.Header, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func websocketHeader() http.Header {
+	return http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}}
+}
+
+func TestAuthenticate(t *testing.T) {
+	withFakeUsers(t)
+	apiLogger = core.NewLogger("api", nil)
+
+	r := gin.New()
+	r.Use(authenticate(Options{Auth: true, AdminToken: "root-token"}))
+	r.GET("/whoami", func(c *gin.Context) {
+		v, _ := c.Get(userContextKey)
+		user := v.(models.User)
+		c.String(200, user.Name+":"+user.Role)
+	})
+
+	basic := func(name, password string) http.Header {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(name, password)
+		return req.Header
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		code   int
+		body   string
+	}{
+		{"no credentials", "/whoami", nil, 401, ""},
+		{"bearer token", "/whoami", bearer("operator-token"), 200, "operator:operator"},
+		{"invalid token", "/whoami", bearer("unknown"), 401, ""},
+		{"admin token", "/whoami", bearer("root-token"), 200, "admin:admin"},
+		{"not bearer scheme", "/whoami", http.Header{"Authorization": {"Token viewer-token"}}, 401, ""},
+		{"basic auth", "/whoami", basic("viewer", "secret"), 200, "viewer:viewer"},
+		{"basic auth wrong password", "/whoami", basic("viewer", "wrong"), 401, ""},
+		{"token query parameter", "/whoami?token=root-token", nil, 401, ""},
+		{"ticket without websocket", "/whoami?ticket=abc", nil, 401, ""},
+		{"unknown ticket", "/whoami?ticket=abc", websocketHeader(), 401, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, "GET", tt.path, tt.header, "")
+			assert.Equal(t, tt.code, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	r := gin.New()
+	r.Use(authenticate(Options{Auth: false}), requireRole(models.ROLE_ADMIN))
+	r.GET("/", func(c *gin.Context) { c.String(200, author(c)) })
+
+	w := serve(r, "GET", "/", nil, "")
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestTicket(t *testing.T) {
+	withFakeUsers(t)
+	apiLogger = core.NewLogger("api", nil)
+
+	r := gin.New()
+	r.Use(authenticate(Options{Auth: true}))
+	r.POST("/tickets", (&UserApiController{}).Ticket)
+	r.GET("/ws", func(c *gin.Context) { c.String(200, author(c)) })
+
+	w := serve(r, "POST", "/tickets", bearer("viewer-token"), "")
+	assert.Equal(t, 200, w.Code)
+	var ticket models.Ticket
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &ticket))
+	assert.NotEmpty(t, ticket.Ticket)
+	assert.WithinDuration(t, time.Now().Add(ticketTTL), ticket.ExpiresAt, 5*time.Second)
+
+	// only accepted by websocket upgrades
+	w = serve(r, "GET", "/ws?ticket="+ticket.Ticket, nil, "")
+	assert.Equal(t, 401, w.Code)
+
+	w = serve(r, "GET", "/ws?ticket="+ticket.Ticket, websocketHeader(), "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "viewer", w.Body.String())
+
+	// single use
+	w = serve(r, "GET", "/ws?ticket="+ticket.Ticket, websocketHeader(), "")
+	assert.Equal(t, 401, w.Code)
+}
+
+func TestTicketExpires(t *testing.T) {
+	now := time.Now()
+	ticket, err := issueTicket(models.User{Name: "bob", Role: models.ROLE_VIEWER}, now)
+	assert.NoError(t, err)
+
+	_, ok := redeemTicket(ticket.Ticket, now.Add(ticketTTL+time.Second))
+	assert.False(t, ok)
+
+	// expired tickets are dropped when a new ticket is issued
+	expired, _ := issueTicket(models.User{Name: "bob"}, now)
+	issueTicket(models.User{Name: "bob"}, now.Add(ticketTTL+time.Second))
+	tickets.Lock()
+	_, found := tickets.m[expired.Ticket]
+	tickets.Unlock()
+	assert.False(t, found)
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		user     string
+		required string
+		code     int
+	}{
+		{models.ROLE_VIEWER, models.ROLE_VIEWER, 200},
+		{models.ROLE_VIEWER, models.ROLE_OPERATOR, 403},
+		{models.ROLE_VIEWER, models.ROLE_ADMIN, 403},
+		{models.ROLE_OPERATOR, models.ROLE_VIEWER, 200},
+		{models.ROLE_OPERATOR, models.ROLE_OPERATOR, 200},
+		{models.ROLE_OPERATOR, models.ROLE_ADMIN, 403},
+		{models.ROLE_ADMIN, models.ROLE_ADMIN, 200},
+		{"unknown", models.ROLE_VIEWER, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.required, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set(userContextKey, models.User{Name: tt.user, Role: tt.user})
+			}, requireRole(tt.required))
+			r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+
+			w := serve(r, "GET", "/", nil, "")
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestHandlerRoles(t *testing.T) {
+	withFakeUsers(t)
+	h := Handler("api/v2", Options{Auth: true, AdminToken: "root-token"})
+
+	// invalid bodies are rejected by the handlers once the role is granted
+	routes := []struct {
+		method string
+		path   string
+		body   string
+		role   string
+	}{
+		{"GET", "/api/v2/log-level", "", models.ROLE_VIEWER},
+		{"POST", "/api/v2/tickets", "", models.ROLE_VIEWER},
+		{"PUT", "/api/v2/log-level", "{", models.ROLE_OPERATOR},
+		{"PUT", "/api/v2/pipelines/none/agents/x/trace", "{", models.ROLE_OPERATOR},
+		{"POST", "/api/v2/debug", "{", models.ROLE_ADMIN},
+		{"POST", "/api/v2/users", "{", models.ROLE_ADMIN},
+		{"POST", "/api/v2/env", "{", models.ROLE_ADMIN},
+	}
+	tokens := []string{models.ROLE_VIEWER, models.ROLE_OPERATOR, models.ROLE_ADMIN}
+
+	for _, route := range routes {
+		for _, role := range tokens {
+			t.Run(route.method+" "+route.path+" as "+role, func(t *testing.T) {
+				w := serve(h, route.method, route.path, bearer(role+"-token"), route.body)
+				user := models.User{Role: role}
+				if user.HasRole(route.role) {
+					assert.NotContains(t, []int{401, 403}, w.Code)
+				} else {
+					assert.Equal(t, 403, w.Code)
+				}
+			})
+		}
+		w := serve(h, route.method, route.path, nil, route.body)
+		assert.Equal(t, 401, w.Code, route.path)
+
+		w = serve(h, route.method, route.path, bearer("root-token"), route.body)
+		assert.NotContains(t, []int{401, 403}, w.Code, route.path)
+	}
+}
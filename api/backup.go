@@ -0,0 +1,323 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/store"
+)
+
+// BACKUP_INDEX is the file of a pipelines.zip archive describing its pipelines,
+// envs and xprocessors, asset values are the other files of the archive
+const BACKUP_INDEX = "bitfan.json"
+
+// Limits of a restored archive
+const (
+	// maxUploadSize is the maximum size of an uploaded archive
+	maxUploadSize = 256 << 20
+	// maxArchiveSize is the maximum size of the files of an archive once uncompressed
+	maxArchiveSize = 512 << 20
+)
+
+// backupFolder returns the folder of the pipeline's assets in a pipelines.zip archive
+func backupFolder(p models.Pipeline) string {
+	return slugify(p.Label) + "_" + p.Uuid
+}
+
+// writeBackupIndex adds the index of the backup to the archive
+func writeBackupIndex(zipWriter *zip.Writer, b models.Backup) error {
+	for i := range b.Pipelines {
+		assets := make([]models.Asset, len(b.Pipelines[i].Assets))
+		for j, a := range b.Pipelines[i].Assets {
+			a.Value = nil
+			assets[j] = a
+		}
+		b.Pipelines[i].Assets = assets
+	}
+	content, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	zipFile, err := zipWriter.Create(BACKUP_INDEX)
+	if err != nil {
+		return err
+	}
+	_, err = zipFile.Write(content)
+	return err
+}
+
+// readPipelinesArchive returns the backup of a pipelines.zip archive, archives
+// without index only restore pipelines, their entrypoint is the first .conf file
+// of their folder
+func readPipelinesArchive(data []byte) (models.Backup, error) {
+	b := models.Backup{}
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return b, fmt.Errorf("invalid archive - %v", err)
+	}
+
+	files := map[string][]byte{}
+	var size int64
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		content, err := readZipFile(f, maxArchiveSize-size)
+		if err != nil {
+			return b, err
+		}
+		size += int64(len(content))
+		files[f.Name] = content
+	}
+
+	if index, ok := files[BACKUP_INDEX]; ok {
+		if err := json.Unmarshal(index, &b); err != nil {
+			return b, fmt.Errorf("invalid %s - %v", BACKUP_INDEX, err)
+		}
+		for i, p := range b.Pipelines {
+			for j, a := range p.Assets {
+				value, ok := files[backupFolder(p)+"/"+a.Name]
+				if !ok {
+					return b, fmt.Errorf("pipeline %s : asset %s not found in archive", p.Uuid, a.Name)
+				}
+				b.Pipelines[i].Assets[j].Value = value
+			}
+		}
+		return b, nil
+	}
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pipelines := map[string]*models.Pipeline{}
+	for _, name := range names {
+		parts := strings.SplitN(name, "/", 2)
+		sep := strings.LastIndex(parts[0], "_")
+		if len(parts) != 2 || sep < 0 {
+			return b, fmt.Errorf("unexpected file %s in archive", name)
+		}
+		folder := parts[0]
+		p, ok := pipelines[folder]
+		if !ok {
+			b.Pipelines = append(b.Pipelines, models.Pipeline{
+				Uuid:  folder[sep+1:],
+				Label: folder[:sep],
+			})
+			p = &b.Pipelines[len(b.Pipelines)-1]
+			pipelines[folder] = p
+		}
+		p.Assets = append(p.Assets, models.Asset{
+			Name:        parts[1],
+			Value:       files[name],
+			ContentType: http.DetectContentType(files[name]),
+		})
+	}
+	for i := range b.Pipelines {
+		for j, a := range b.Pipelines[i].Assets {
+			if path.Ext(a.Name) == ".conf" && !strings.Contains(a.Name, "/") {
+				b.Pipelines[i].Assets[j].Type = models.ASSET_TYPE_ENTRYPOINT
+				break
+			}
+		}
+	}
+	return b, nil
+}
+
+// readDatabaseArchive returns the backup of a db.zip archive
+func readDatabaseArchive(data []byte) (models.Backup, error) {
+	b := models.Backup{}
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return b, fmt.Errorf("invalid archive - %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "bitfan-restore")
+	if err != nil {
+		return b, err
+	}
+	defer os.RemoveAll(dir)
+
+	found := false
+	for _, f := range zipReader.File {
+		if f.Name != "bitfan.bolt.db" {
+			continue
+		}
+		content, err := readZipFile(f, maxArchiveSize)
+		if err != nil {
+			return b, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, f.Name), content, 0600); err != nil {
+			return b, err
+		}
+		found = true
+	}
+	if !found {
+		return b, fmt.Errorf("bitfan.bolt.db not found in archive")
+	}
+
+	db, err := store.New(dir, apiLogger)
+	if err != nil {
+		return b, fmt.Errorf("invalid database - %v", err)
+	}
+	defer db.Close()
+	return db.Backup(), nil
+}
+
+// readZipFile returns the content of a file of an archive, an error when it
+// is larger than max bytes once uncompressed
+func readZipFile(f *zip.File, max int64) ([]byte, error) {
+	tooLarge := fmt.Errorf("archive too large, its files exceed %d bytes once uncompressed", maxArchiveSize)
+	if f.UncompressedSize64 > uint64(max) {
+		return nil, tooLarge
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// the declared size may lie
+	content, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > max {
+		return nil, tooLarge
+	}
+	return content, nil
+}
+
+// readUpload returns the uploaded archive, sent as the "file" field of a
+// multipart form or as the request body, up to maxUploadSize bytes
+func readUpload(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+	content, err := readUploadBody(c)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, fmt.Errorf("archive too large, it exceeds %d bytes", maxUploadSize)
+	}
+	return content, err
+}
+
+func readUploadBody(c *gin.Context) ([]byte, error) {
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return ioutil.ReadAll(r)
+}
+
+// restore restores the backup, the query sets the mode (merge or replace), the
+// handling of conflicts (overwrite, skip or rename), dry_run to only validate
+// the backup and restart to restart the running pipelines restored
+func restore(c *gin.Context, b models.Backup) {
+	mode := c.DefaultQuery("mode", models.RESTORE_MERGE)
+	conflict := c.DefaultQuery("conflict", models.CONFLICT_OVERWRITE)
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	restart, _ := strconv.ParseBool(c.Query("restart"))
+
+	report, err := core.Storage().Restore(b, mode, conflict, true)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	if dryRun {
+		c.JSON(200, report)
+		return
+	}
+
+	// stop deleted pipelines
+	for _, change := range report.Changes {
+		if _, running := core.GetPipeline(change.Uuid); running && change.Kind == models.RESTORE_KIND_PIPELINE && change.Action == models.RESTORE_DELETE {
+			if err := core.StopPipeline(change.Uuid); err != nil {
+				c.JSON(500, models.Error{Message: fmt.Sprintf("can not stop pipeline %s - %v", change.Label, err)})
+				return
+			}
+		}
+	}
+
+	report, err = core.Storage().Restore(b, mode, conflict, false)
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+
+	pipelines := &PipelineApiController{}
+	for _, change := range report.Changes {
+		if change.Kind != models.RESTORE_KIND_PIPELINE {
+			continue
+		}
+		switch change.Action {
+		case models.RESTORE_CREATE:
+			recordVersion(c, change.Uuid, "restored from backup")
+		case models.RESTORE_RENAME:
+			recordVersion(c, change.NewUuid, "restored from backup of "+change.Uuid)
+		case models.RESTORE_UPDATE:
+			recordVersion(c, change.Uuid, "restored from backup")
+			// the pipelines depending on it are restarted too
+			if _, running := core.GetPipeline(change.Uuid); running && restart {
+				if err := pipelines.restartPipelineByUUID(change.Uuid); err != nil {
+					apiLogger.Errorf("restore : can not restart pipeline %s - %v", change.Label, err)
+				}
+			}
+		}
+	}
+
+	c.JSON(200, report)
+}
+
+// RestoreAll restores a pipelines.zip archive
+func (p *PipelineApiController) RestoreAll(c *gin.Context) {
+	data, err := readUpload(c)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	b, err := readPipelinesArchive(data)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	restore(c, b)
+}
+
+// Restore restores pipelines, envs and xprocessors of a db.zip archive
+func (d *DatabaseController) Restore(c *gin.Context) {
+	data, err := readUpload(c)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	b, err := readDatabaseArchive(data)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	restore(c, b)
+}
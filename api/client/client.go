@@ -1,25 +1,80 @@
 package client
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/dghubble/sling"
 	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/processors/doc"
 )
 
 type RestClient struct {
-	host string
+	host        string
+	credentials Credentials
+	transport   http.RoundTripper
 }
 
+// Credentials authenticates requests to the API, with a token or with a user's name and password
+type Credentials struct {
+	Token    string
+	Username string
+	Password string
+}
+
+// New returns a client of the bitfan api served on bitfanHost (host:port),
+// prefix it with https:// when the api is served over TLS
 func New(bitfanHost string) *RestClient {
+	if !strings.Contains(bitfanHost, "://") {
+		bitfanHost = "http://" + bitfanHost
+	}
 	cli := &RestClient{
-		host: "http://" + bitfanHost + "/api/v2/",
+		host: strings.TrimSuffix(bitfanHost, "/") + "/api/v2/",
 	}
 	return cli
 }
 
+// WithCredentials sets credentials sent with each request
+func (r *RestClient) WithCredentials(credentials Credentials) *RestClient {
+	r.credentials = credentials
+	return r
+}
+
+// WithTLS sets the TLS configuration of the connections to an API served
+// over TLS : trusted CAs and the client certificate of mutual TLS
+func (r *RestClient) WithTLS(conf *tls.Config) *RestClient {
+	if conf == nil {
+		r.transport = nil
+		return r
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+	r.transport = transport
+	return r
+}
+
+// Transport returns the transport of the requests to the API
+func (r *RestClient) Transport() http.RoundTripper {
+	if r.transport == nil {
+		return http.DefaultTransport
+	}
+	return r.transport
+}
+
 func (r *RestClient) client() *sling.Sling {
-	return sling.New().Base(r.host)
+	s := sling.New().Client(&http.Client{Transport: r.Transport()}).Base(r.host)
+	if r.credentials.Token != "" {
+		s = s.Set("Authorization", "Bearer "+r.credentials.Token)
+	} else if r.credentials.Username != "" {
+		s = s.SetBasicAuth(r.credentials.Username, r.credentials.Password)
+	}
+	return s
 }
 
 func (r *RestClient) Envs() ([]models.Env, error) {
@@ -95,6 +150,157 @@ func (r *RestClient) Pipeline(ID string) (*models.Pipeline, error) {
 	return pipeline, err
 }
 
+func (r *RestClient) PipelineVersions(ID string) ([]models.PipelineVersion, error) {
+	versions := []models.PipelineVersion{}
+	apierror := new(models.Error)
+
+	resp, err := r.client().Get("pipelines/"+ID+"/versions").Receive(&versions, apierror)
+
+	if err != nil {
+		return versions, err
+	} else if resp.StatusCode > 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return versions, err
+}
+
+func (r *RestClient) PipelineVersion(ID string, number int) (*models.PipelineVersion, error) {
+	version := &models.PipelineVersion{}
+	apierror := new(models.Error)
+
+	resp, err := r.client().Get(fmt.Sprintf("pipelines/%s/versions/%d", ID, number)).Receive(version, apierror)
+
+	if err != nil {
+		return version, err
+	} else if resp.StatusCode > 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return version, err
+}
+
+// PipelineDiff compares two versions of a pipeline, from 0 is an empty
+// pipeline, to 0 compares the latest version with the previous one
+func (r *RestClient) PipelineDiff(ID string, from int, to int) (*models.VersionDiff, error) {
+	diff := &models.VersionDiff{}
+	apierror := new(models.Error)
+
+	path := "pipelines/" + ID + "/diff"
+	if to > 0 {
+		path = fmt.Sprintf("%s?from=%d&to=%d", path, from, to)
+	}
+	resp, err := r.client().Get(path).Receive(diff, apierror)
+
+	if err != nil {
+		return diff, err
+	} else if resp.StatusCode > 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return diff, err
+}
+
+func (r *RestClient) RollbackPipeline(ID string, number int, restart bool) (*models.Pipeline, error) {
+	pipeline := &models.Pipeline{}
+	apierror := new(models.Error)
+
+	var data = map[string]interface{}{
+		"restart": restart,
+	}
+
+	resp, err := r.client().Post(fmt.Sprintf("pipelines/%s/versions/%d/rollback", ID, number)).BodyJSON(data).Receive(pipeline, apierror)
+	if err != nil {
+		return pipeline, err
+	} else if resp.StatusCode > 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return pipeline, err
+}
+
+// Sync syncs stored pipelines with the manifest of the bitfan server, nothing is changed when dryRun is true
+func (r *RestClient) Sync(dryRun bool) (*models.SyncPlan, error) {
+	plan := &models.SyncPlan{}
+	apierror := new(models.Error)
+
+	resp, err := r.client().Post(fmt.Sprintf("sync?dry_run=%t", dryRun)).Receive(plan, apierror)
+	if err != nil {
+		return plan, err
+	} else if resp.StatusCode > 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return plan, err
+}
+
+// Backup returns the pipelines.zip archive of pipelines, envs and xprocessors, or
+// the db.zip archive of the database when db is true
+func (r *RestClient) Backup(db bool) ([]byte, error) {
+	name := "pipelines.zip"
+	if db {
+		name = "db.zip"
+	}
+	return r.raw(name)
+}
+
+// PipelineGraph returns the graph of a pipeline in the dot, mermaid or json
+// format, with the events of its agents when events is true and the pipeline
+// is running
+func (r *RestClient) PipelineGraph(ID string, format string, events bool) ([]byte, error) {
+	return r.raw(fmt.Sprintf("pipelines/%s/graph?format=%s&events=%t", ID, url.QueryEscape(format), events))
+}
+
+// raw returns the body of a GET request as is
+func (r *RestClient) raw(path string) ([]byte, error) {
+	req, err := r.client().Get(path).Request()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Transport: r.Transport()}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode >= 400 {
+		apierror := new(models.Error)
+		if json.Unmarshal(data, apierror) != nil || apierror.Message == "" {
+			apierror.Message = resp.Status
+		}
+		return nil, fmt.Errorf(apierror.Message)
+	}
+	return data, nil
+}
+
+// RestoreOptions of a Restore
+type RestoreOptions struct {
+	// Mode is merge or replace
+	Mode string `url:"mode,omitempty"`
+	// Conflict is overwrite, skip or rename
+	Conflict string `url:"conflict,omitempty"`
+	// DryRun only validates the archive and returns the changes
+	DryRun bool `url:"dry_run,omitempty"`
+	// Restart restarts the running pipelines restored
+	Restart bool `url:"restart,omitempty"`
+}
+
+// Restore restores a pipelines.zip archive, or a db.zip archive when db is true
+func (r *RestClient) Restore(archive []byte, db bool, opt RestoreOptions) (*models.RestoreReport, error) {
+	name := "pipelines.zip"
+	if db {
+		name = "db.zip"
+	}
+	report := &models.RestoreReport{}
+	apierror := new(models.Error)
+
+	resp, err := r.client().Post(name).QueryStruct(opt).Set("Content-Type", "application/zip").Body(bytes.NewReader(archive)).Receive(report, apierror)
+	if err != nil {
+		return report, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return report, err
+}
+
 func (r *RestClient) NewPipeline(pipeline *models.Pipeline) (*models.Pipeline, error) {
 	newPipeline := new(models.Pipeline)
 	apierror := new(models.Error)
@@ -188,6 +394,85 @@ func (r *RestClient) StopPipeline(UUID string) (*models.Pipeline, error) {
 	return newPipeline, err
 }
 
+// PausePipeline holds the events of the inputs of a running pipeline
+func (r *RestClient) PausePipeline(UUID string) (*models.Pipeline, error) {
+	return r.lifecycle("pipelines/" + UUID + "/pause")
+}
+
+// ResumePipeline releases the inputs of a running pipeline
+func (r *RestClient) ResumePipeline(UUID string) (*models.Pipeline, error) {
+	return r.lifecycle("pipelines/" + UUID + "/resume")
+}
+
+// PauseAgent holds the events of an input of a running pipeline
+func (r *RestClient) PauseAgent(UUID string, agentID int) (*models.Pipeline, error) {
+	return r.lifecycle(fmt.Sprintf("pipelines/%s/agents/%d/pause", UUID, agentID))
+}
+
+// ResumeAgent releases an input of a running pipeline
+func (r *RestClient) ResumeAgent(UUID string, agentID int) (*models.Pipeline, error) {
+	return r.lifecycle(fmt.Sprintf("pipelines/%s/agents/%d/resume", UUID, agentID))
+}
+
+func (r *RestClient) lifecycle(path string) (*models.Pipeline, error) {
+	pipeline := new(models.Pipeline)
+	apierror := new(models.Error)
+
+	resp, err := r.client().Post(path).Receive(pipeline, apierror)
+	if err != nil {
+		return pipeline, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return pipeline, err
+}
+
+// LogLevels returns the global log level and the levels of the pipelines
+func (r *RestClient) LogLevels() (*models.LogLevels, error) {
+	levels := new(models.LogLevels)
+	apierror := new(models.Error)
+
+	resp, err := r.client().Get("log-level").Receive(levels, apierror)
+	if err != nil {
+		return levels, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return levels, err
+}
+
+// SetLogLevel changes the log level of a pipeline, or the global one when
+// pipelineUUID is empty
+func (r *RestClient) SetLogLevel(pipelineUUID string, level *models.LogLevel) (*models.LogLevels, error) {
+	levels := new(models.LogLevels)
+	apierror := new(models.Error)
+
+	path := "log-level"
+	if pipelineUUID != "" {
+		path = "pipelines/" + pipelineUUID + "/log-level"
+	}
+	resp, err := r.client().Put(path).BodyJSON(level).Receive(levels, apierror)
+	if err != nil {
+		return levels, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return levels, err
+}
+
+// SetTrace toggles the trace of the events of an agent of a running pipeline
+func (r *RestClient) SetTrace(UUID string, agentID int, trace *models.Trace) error {
+	apierror := new(models.Error)
+
+	resp, err := r.client().Put(fmt.Sprintf("pipelines/%s/agents/%d/trace", UUID, agentID)).BodyJSON(trace).Receive(nil, apierror)
+	if err != nil {
+		return err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return err
+}
+
 func (r *RestClient) DeleteXProcessor(UUID string) error {
 	apierror := new(models.Error)
 
@@ -297,6 +582,77 @@ func (r *RestClient) CheckSyntax(asset *models.Asset) (map[string]interface{}, e
 	return *syntaxCheckResult, nil
 }
 
+// Debug runs a sample event through filters and returns the event after
+// each of them
+func (r *RestClient) Debug(req *models.DebugRequest) (map[string]interface{}, error) {
+	apierror := new(models.Error)
+
+	report := map[string]interface{}{}
+	resp, err := r.client().Post("debug").BodyJSON(req).Receive(&report, apierror)
+	if err != nil {
+		return report, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return report, err
+}
+
+// Inject pushes events into an agent of a running pipeline and returns the
+// number of events pushed
+func (r *RestClient) Inject(ID string, agentID int, events []map[string]interface{}) (int, error) {
+	report := new(models.InjectReport)
+	apierror := new(models.Error)
+
+	resp, err := r.client().Post(fmt.Sprintf("pipelines/%s/agents/%d/events", ID, agentID)).BodyJSON(events).Receive(report, apierror)
+	if err != nil {
+		return report.Injected, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return report.Injected, err
+}
+
+// FormatAsset returns the value of the asset in its canonical form
+func (r *RestClient) FormatAsset(asset *models.Asset) (*models.FormattedAsset, error) {
+	formatted := new(models.FormattedAsset)
+	apierror := new(models.Error)
+
+	resp, err := r.client().Post("assets/0/format").BodyJSON(asset).Receive(formatted, apierror)
+	if err != nil {
+		return formatted, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return formatted, err
+}
+
+// LintAsset returns the issues found in the value of the asset
+func (r *RestClient) LintAsset(asset *models.Asset) (*models.LintReport, error) {
+	report := new(models.LintReport)
+	apierror := new(models.Error)
+
+	resp, err := r.client().Post("assets/0/lint").BodyJSON(asset).Receive(report, apierror)
+	if err != nil {
+		return report, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return report, err
+}
+
+func (r *RestClient) ProcessorSchema(code string) (*doc.Schema, error) {
+	schema := new(doc.Schema)
+	apierror := new(models.Error)
+
+	resp, err := r.client().Get("docs/processors/"+code+"/schema").Receive(schema, apierror)
+	if err != nil {
+		return schema, err
+	} else if resp.StatusCode >= 400 {
+		err = fmt.Errorf(apierror.Message)
+	}
+	return schema, err
+}
+
 // func debug(r io.ReadCloser) string {
 // 	buf := new(bytes.Buffer)
 // 	buf.ReadFrom(r)
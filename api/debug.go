@@ -0,0 +1,72 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/entrypoint"
+)
+
+type DebugApiController struct {
+}
+
+// Debug runs a sample event through filters and returns the event after each
+// of them
+func (d *DebugApiController) Debug(c *gin.Context) {
+	var req models.DebugRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+
+	// filters may use the assets of a pipeline
+	cwl := ""
+	if req.PipelineUUID != "" {
+		tPipeline, err := core.Storage().FindOnePipelineByUUID(req.PipelineUUID, true)
+		if err != nil {
+			c.JSON(404, models.Error{Message: err.Error()})
+			return
+		}
+		// the stage is only used by this request
+		stage, err := ioutil.TempDir("", "bitfan-debug-")
+		if err != nil {
+			c.JSON(500, models.Error{Message: err.Error()})
+			return
+		}
+		defer os.RemoveAll(stage)
+		entryPointPath, err := core.Storage().PreparePipelineExecutionStageIn(stage, &tPipeline)
+		if err != nil {
+			c.JSON(500, models.Error{Message: err.Error()})
+			return
+		}
+		cwl = filepath.Dir(entryPointPath)
+	}
+
+	// the filter is kept on the first line for the lines of the steps to be
+	// the ones of the filter section content
+	loc, err := entrypoint.New("filter {"+req.Filter+"\n}", cwl, entrypoint.CONTENT_INLINE)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	ppl, err := loc.Pipeline()
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	ppl.Label = "debug-" + ppl.Uuid
+
+	if req.Event == nil {
+		req.Event = map[string]interface{}{}
+	}
+	report, err := ppl.Debug(req.Event)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, report)
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"fmt"
+
 	"github.com/gin-gonic/gin"
+	"github.com/vjeantet/bitfan/api/models"
 	"github.com/vjeantet/bitfan/core"
 )
 
@@ -17,3 +20,12 @@ func (d *DocsController) FindOneProcessorByCode(c *gin.Context) {
 	docs := core.ProcessorsDocs(c.Param("code"))
 	c.JSON(200, docs)
 }
+
+func (d *DocsController) FindOneProcessorSchemaByCode(c *gin.Context) {
+	schema := core.ProcessorSchema(c.Param("code"))
+	if schema == nil {
+		c.JSON(404, models.Error{Message: fmt.Sprintf("unknown processor %s", c.Param("code"))})
+		return
+	}
+	c.JSON(200, schema)
+}
@@ -20,7 +20,7 @@ func (x *EnvApiController) Find(c *gin.Context) {
 
 	for i, _ := range envs {
 		if envs[i].Secret == true {
-			envs[i].Value = "********"
+			envs[i].Value = core.REDACTED
 		}
 	}
 
@@ -58,6 +58,9 @@ func (p *EnvApiController) Create(c *gin.Context) {
 
 	core.Storage().CreateEnv(&varenv)
 	os.Setenv(varenv.Name, varenv.Value)
+	if varenv.Secret {
+		core.Redact(varenv.Value)
+	}
 	c.Redirect(302, fmt.Sprintf("/%s/env/%s", p.path, varenv.Uuid))
 }
 
@@ -69,7 +72,7 @@ func (p *EnvApiController) FindOneByUUID(c *gin.Context) {
 		return
 	}
 	if varenv.Secret == true {
-		varenv.Value = "********"
+		varenv.Value = core.REDACTED
 	}
 	c.JSON(200, varenv)
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+)
+
+// defaultMaxEventsSize is the maximum size of the events of a request when
+// Options.MaxEventsSize is not set
+const defaultMaxEventsSize = 10 << 20
+
+type EventApiController struct {
+	// maximum size of the events of a request
+	maxSize int64
+}
+
+// Inject pushes the events of the body, a JSON event or an array of events,
+// into an agent of a running pipeline as if they were sent by its sources
+func (e *EventApiController) Inject(c *gin.Context) {
+	uuid := c.Param("uuid")
+	pipeline, found := core.GetPipeline(uuid)
+	if !found {
+		c.JSON(404, models.Error{Message: "pipeline " + uuid + " is not running"})
+		return
+	}
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, models.Error{Message: "invalid agent id " + c.Param("id")})
+		return
+	}
+	if _, ok := pipeline.Agents()[agentID]; !ok {
+		c.JSON(404, models.Error{Message: fmt.Sprintf("agent %d not found in pipeline %s", agentID, uuid)})
+		return
+	}
+
+	events, code, err := readEvents(c, e.maxSize)
+	if err != nil {
+		c.JSON(code, models.Error{Message: err.Error()})
+		return
+	}
+
+	injected, err := pipeline.Inject(agentID, events)
+	if err != nil && injected > 0 {
+		c.JSON(409, models.Error{Message: fmt.Sprintf("%v, %d event(s) injected", err, injected)})
+		return
+	} else if err != nil {
+		c.JSON(409, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, models.InjectReport{Injected: injected})
+}
+
+// readEvents decodes the events of the request body, up to maxSize bytes, and
+// returns the status code of an error
+func readEvents(c *gin.Context, maxSize int64) ([]map[string]interface{}, int, error) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxEventsSize
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, 413, fmt.Errorf("events too large, they exceed %d bytes", maxSize)
+	}
+	if err != nil {
+		return nil, 400, err
+	}
+	events, err := decodeEvents(body)
+	if err != nil {
+		return nil, 400, err
+	}
+	return events, 200, nil
+}
+
+// decodeEvents decodes a JSON event or an array of JSON events
+func decodeEvents(data []byte) ([]map[string]interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("invalid JSON : %v", err)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, nil
+	case []interface{}:
+		events := []map[string]interface{}{}
+		for i, item := range v {
+			fields, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("item %d is not a JSON object", i)
+			}
+			events = append(events, fields)
+		}
+		if len(events) == 0 {
+			return nil, fmt.Errorf("no event")
+		}
+		return events, nil
+	}
+	return nil, fmt.Errorf("expected a JSON object or an array of JSON objects")
+}
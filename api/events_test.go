@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		events []map[string]interface{}
+		err    string
+	}{
+		{"event", `{"message":"a"}`, []map[string]interface{}{{"message": "a"}}, ""},
+		{"array", `[{"message":"a"},{"message":"b"}]`, []map[string]interface{}{{"message": "a"}, {"message": "b"}}, ""},
+		{"malformed", `{"message":`, nil, "invalid JSON : unexpected end of JSON input"},
+		{"not an object", `[{"message":"a"},"b"]`, nil, "item 1 is not a JSON object"},
+		{"empty array", `[]`, nil, "no event"},
+		{"scalar", `"a"`, nil, "expected a JSON object or an array of JSON objects"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := decodeEvents([]byte(tt.body))
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.events, events)
+		})
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	read := func(body string, maxSize int64) ([]map[string]interface{}, int, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/", strings.NewReader(body))
+		return readEvents(c, maxSize)
+	}
+
+	events, code, err := read(`{"message":"a"}`, 15)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Len(t, events, 1)
+
+	_, code, err = read(`{"message":"ab"}`, 15)
+	assert.EqualError(t, err, "events too large, they exceed 15 bytes")
+	assert.Equal(t, 413, code)
+
+	_, code, err = read(`{`, 0)
+	assert.Error(t, err)
+	assert.Equal(t, 400, code)
+}
+
+func TestInjectNotRunning(t *testing.T) {
+	h := Handler("api/v2", Options{})
+	w := serve(h, "POST", "/api/v2/pipelines/none/agents/2/events", nil, `{"message":"a"}`)
+	assert.Equal(t, 404, w.Code)
+	assert.Contains(t, w.Body.String(), "pipeline none is not running")
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/vjeantet/bitfan/api/models"
 	"github.com/vjeantet/bitfan/core"
 )
 
@@ -15,28 +16,28 @@ func init() {
 
 var apiLogger *core.Logger
 
-func Handler(path string) http.Handler {
+func Handler(path string, opt Options) http.Handler {
 
 	apiLogger = core.NewLogger("api", nil)
 
 	logs, _ := newHook(hookConfig{Size: 100})
 	logrus.AddHook(logs)
 
+	if opt.Auth {
+		apiLogger.Infof("API authentication enabled")
+	}
+
 	r := gin.New()
 	r.Use(
 		gin.Recovery(),
-		func(c *gin.Context) {
-			c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
-			c.Writer.Header().Add("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE, PATCH")
-			c.Writer.Header().Add("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE, PATCH")
-			if c.Request.Method == "OPTIONS" {
-				c.Writer.Header().Add("Access-Control-Allow-Headers", "*")
-				c.JSON(http.StatusOK, struct{}{})
-				return
-			}
-			c.Next()
-		},
+		cors(opt.CORSOrigins),
+		authenticate(opt),
 	)
+
+	viewer := requireRole(models.ROLE_VIEWER)
+	operator := requireRole(models.ROLE_OPERATOR)
+	admin := requireRole(models.ROLE_ADMIN)
+
 	v2 := r.Group(path)
 	{
 
@@ -52,10 +53,19 @@ func Handler(path string) http.Handler {
 			path: path,
 		}
 
+		versionCtrl := &VersionApiController{
+			path:      path,
+			pipelines: pipelineCtrl,
+		}
+
 		envvariablesCtrl := &EnvApiController{
 			path: path,
 		}
 
+		syncCtrl := &SyncApiController{
+			syncer: opt.Syncer,
+		}
+
 		dbCtrl := &DatabaseController{}
 
 		logsCtrl := &LogApiController{
@@ -66,40 +76,83 @@ func Handler(path string) http.Handler {
 
 		docsCtrl := &DocsController{}
 
-		v2.GET("/logs", logsCtrl.Stream) // Websocket
+		healthCtrl := &HealthApiController{}
+
+		tapCtrl := &TapApiController{}
+
+		eventCtrl := &EventApiController{
+			maxSize: opt.MaxEventsSize,
+		}
+
+		logLevelCtrl := &LogLevelApiController{}
+
+		debugCtrl := &DebugApiController{}
+
+		userCtrl := &UserApiController{
+			path: path,
+		}
+
+		v2.POST("/tickets", viewer, userCtrl.Ticket) // single use credential of a websocket ?ticket=
+
+		v2.GET("/logs", viewer, logsCtrl.Stream) // Websocket
+		v2.GET("/log-level", viewer, logLevelCtrl.Find)
+		v2.PUT("/log-level", operator, logLevelCtrl.Update) // change the global log level, revert it after revert_after
 
 		// curl -i -X POST http://localhost:5123/api/v2/pipelines
-		v2.POST("/pipelines", pipelineCtrl.Create) // créer pipeline
+		v2.POST("/pipelines", admin, pipelineCtrl.Create) // créer pipeline
 
-		v2.GET("/xprocessors", xprocessorCtrl.Find)                  // list xprocessors
-		v2.POST("/xprocessors", xprocessorCtrl.Create)               // list xprocessors
-		v2.GET("/xprocessors/:uuid", xprocessorCtrl.FindOneByUUID)   // show xprocessors
-		v2.PATCH("/xprocessors/:uuid", xprocessorCtrl.UpdateByUUID)  // update xprocessors
-		v2.DELETE("/xprocessors/:uuid", xprocessorCtrl.DeleteByUUID) // delete xprocessors
+		v2.GET("/xprocessors", viewer, xprocessorCtrl.Find)                 // list xprocessors
+		v2.POST("/xprocessors", admin, xprocessorCtrl.Create)               // list xprocessors
+		v2.GET("/xprocessors/:uuid", viewer, xprocessorCtrl.FindOneByUUID)  // show xprocessors
+		v2.PATCH("/xprocessors/:uuid", admin, xprocessorCtrl.UpdateByUUID)  // update xprocessors
+		v2.DELETE("/xprocessors/:uuid", admin, xprocessorCtrl.DeleteByUUID) // delete xprocessors
 
 		// curl -i -X GET http://localhost:5123/api/v2/pipelines
-		v2.GET("/pipelines", pipelineCtrl.Find)            // list pipelines
-		v2.GET("/pipelines.zip", pipelineCtrl.DownloadAll) // backup
+		v2.GET("/pipelines", viewer, pipelineCtrl.Find)           // list pipelines
+		v2.GET("/pipelines.zip", admin, pipelineCtrl.DownloadAll) // backup
+		v2.POST("/pipelines.zip", admin, pipelineCtrl.RestoreAll) // restore ?mode=merge|replace&conflict=overwrite|skip|rename&dry_run=true
 		// curl -i -X GET http://localhost:5123/api/v2/pipelines/408b9a7b-933e-4d3d-6df1-65324a0a5315
-		v2.GET("/pipelines/:uuid", pipelineCtrl.FindOneByUUID) // show pipeline
+		v2.GET("/pipelines/:uuid", viewer, pipelineCtrl.FindOneByUUID) // show pipeline
+
+		v2.GET("/pipelines/:uuid/health", viewer, healthCtrl.FindOneByPipelineUUID) // show pipeline's agents health
+		v2.GET("/pipelines/:uuid/graph", viewer, pipelineCtrl.Graph)                // pipeline's agents graph ?format=dot|mermaid|json&events=true
+		v2.GET("/pipelines/:uuid/agents/:id/tap", operator, tapCtrl.Stream)         // Websocket, events sent by an agent ?filter=expression&rate=100
+		v2.POST("/pipelines/:uuid/agents/:id/events", operator, eventCtrl.Inject)   // push events into an agent
+		v2.PUT("/pipelines/:uuid/agents/:id/trace", operator, logLevelCtrl.Trace)   // toggle the trace of an agent
+		v2.PUT("/pipelines/:uuid/log-level", operator, logLevelCtrl.UpdateByPipelineUUID)
+
+		v2.GET("/pipelines/:uuid/versions", viewer, versionCtrl.FindByPipelineUUID)        // list pipeline's versions
+		v2.GET("/pipelines/:uuid/versions/:number", viewer, versionCtrl.FindOneByNumber)   // show a version with its assets
+		v2.POST("/pipelines/:uuid/versions/:number/rollback", admin, versionCtrl.Rollback) // restore a version
+		v2.GET("/pipelines/:uuid/diff", viewer, versionCtrl.Diff)                          // compare two versions ?from=1&to=2
 
 		// curl -i -X PATCH http://localhost:5123/api/v2/pipelines/408b9a7b-933e-4d3d-6df1-65324a0a5315
-		v2.PATCH("/pipelines/:uuid", pipelineCtrl.UpdateByUUID) // update pipeline / stop / start / restart
+		v2.PATCH("/pipelines/:uuid", operator, pipelineCtrl.UpdateByUUID) // update pipeline / stop / start / restart
+
+		v2.POST("/pipelines/:uuid/pause", operator, pipelineCtrl.Pause)              // hold the events of the inputs
+		v2.POST("/pipelines/:uuid/resume", operator, pipelineCtrl.Resume)            // release the inputs
+		v2.POST("/pipelines/:uuid/agents/:id/pause", operator, pipelineCtrl.Pause)   // hold the events of an input
+		v2.POST("/pipelines/:uuid/agents/:id/resume", operator, pipelineCtrl.Resume) // release an input
 
 		// curl -i -X DELETE http://localhost:5123/api/v2/pipelines/408b9a7b-933e-4d3d-6df1-65324a0a5315
-		v2.DELETE("/pipelines/:uuid", pipelineCtrl.DeleteByUUID) // delete pipeline
+		v2.DELETE("/pipelines/:uuid", admin, pipelineCtrl.DeleteByUUID) // delete pipeline
+
+		v2.POST("/assets", admin, assetCtrl.Create)                          // create asset
+		v2.GET("/assets/:uuid", viewer, assetCtrl.FindOneByUUID)             // show asset
+		v2.GET("/assets/:uuid/content", viewer, assetCtrl.DownloadOneByUUID) // dl asset
+		v2.PUT("/assets/:uuid", admin, assetCtrl.ReplaceByUUID)              // replace asset
+		v2.PATCH("/assets/:uuid", admin, assetCtrl.UpdateByUUID)             // update asset
+		v2.DELETE("/assets/:uuid", admin, assetCtrl.DeleteByUUID)            // delete asset
 
-		v2.POST("/assets", assetCtrl.Create)                         // create asset
-		v2.GET("/assets/:uuid", assetCtrl.FindOneByUUID)             // show asset
-		v2.GET("/assets/:uuid/content", assetCtrl.DownloadOneByUUID) // dl asset
-		v2.PUT("/assets/:uuid", assetCtrl.ReplaceByUUID)             // replace asset
-		v2.PATCH("/assets/:uuid", assetCtrl.UpdateByUUID)            // update asset
-		v2.DELETE("/assets/:uuid", assetCtrl.DeleteByUUID)           // delete asset
+		v2.POST("/assets/:uuid/syntax-check", viewer, assetCtrl.CheckSyntax) // check syntax
+		v2.POST("/assets/:uuid/format", viewer, assetCtrl.Format)            // format configuration
+		v2.POST("/assets/:uuid/lint", viewer, assetCtrl.Lint)                // lint configuration
 
-		v2.POST("/assets/:uuid/syntax-check", assetCtrl.CheckSyntax) // check syntax
+		v2.GET("/assets/:uuid/versions", viewer, versionCtrl.FindByAssetUUID) // list asset's versions
 
-		v2.GET("/docs/processors", docsCtrl.FindAllProcessors)
-		v2.GET("/docs/processors/:code", docsCtrl.FindOneProcessorByCode)
+		v2.GET("/docs/processors", viewer, docsCtrl.FindAllProcessors)
+		v2.GET("/docs/processors/:code", viewer, docsCtrl.FindOneProcessorByCode)
+		v2.GET("/docs/processors/:code/schema", viewer, docsCtrl.FindOneProcessorSchemaByCode)
 		// v1.GET("/docs/inputs", getDocsInputs)
 		// v1.GET("/docs/inputs/:name", getDocsInputsByName)
 		// v1.GET("/docs/filters", getDocsFilters)
@@ -107,12 +160,26 @@ func Handler(path string) http.Handler {
 		// v1.GET("/docs/outputs", getDocsOutputs)
 		// v1.GET("/docs/outputs/:name", getDocsOutputsByName)
 
-		v2.GET("/env", envvariablesCtrl.Find)
-		v2.POST("/env", envvariablesCtrl.Create)
-		v2.GET("/env/:uuid", envvariablesCtrl.FindOneByUUID)
-		v2.DELETE("/env/:uuid", envvariablesCtrl.DeleteByUUID)
+		v2.GET("/env", viewer, envvariablesCtrl.Find)
+		v2.POST("/env", admin, envvariablesCtrl.Create)
+		v2.GET("/env/:uuid", viewer, envvariablesCtrl.FindOneByUUID)
+		v2.DELETE("/env/:uuid", admin, envvariablesCtrl.DeleteByUUID)
+
+		v2.GET("/db.zip", admin, dbCtrl.Download)
+		v2.POST("/db.zip", admin, dbCtrl.Restore) // restore pipelines, envs and xprocessors
+
+		v2.GET("/sync", viewer, syncCtrl.Find) // changes to apply and drifts
+		v2.POST("/sync", admin, syncCtrl.Sync) // sync pipelines with the manifest ?dry_run=true
+
+		v2.GET("/health", viewer, healthCtrl.Find)
+
+		v2.POST("/debug", admin, debugCtrl.Debug) // run a sample event through filters, step by step
 
-		v2.GET("/db.zip", dbCtrl.Download)
+		v2.GET("/users", admin, userCtrl.Find)
+		v2.POST("/users", admin, userCtrl.Create)
+		v2.GET("/users/:uuid", admin, userCtrl.FindOneByUUID)
+		v2.PATCH("/users/:uuid", admin, userCtrl.UpdateByUUID) // update user / renew its token
+		v2.DELETE("/users/:uuid", admin, userCtrl.DeleteByUUID)
 	}
 
 	apiLogger.Debugf("Serving API on /%s/ ", path)
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+)
+
+type HealthApiController struct {
+}
+
+func (h *HealthApiController) Find(c *gin.Context) {
+	c.JSON(200, core.Health())
+}
+
+func (h *HealthApiController) FindOneByPipelineUUID(c *gin.Context) {
+	uuid := c.Param("uuid")
+	runningPipeline, found := core.GetPipeline(uuid)
+	if !found {
+		c.JSON(404, models.Error{Message: "pipeline " + uuid + " is not running"})
+		return
+	}
+	c.JSON(200, runningPipeline.Health())
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+)
+
+type LogLevelApiController struct {
+}
+
+// Find returns the global log level and the levels of the pipelines
+func (l *LogLevelApiController) Find(c *gin.Context) {
+	c.JSON(200, logLevels())
+}
+
+// Update changes the global log level
+func (l *LogLevelApiController) Update(c *gin.Context) {
+	l.setLevel(c, "")
+}
+
+// UpdateByPipelineUUID changes the log level of a pipeline, running or not
+func (l *LogLevelApiController) UpdateByPipelineUUID(c *gin.Context) {
+	uuid := c.Param("uuid")
+	if _, running := core.GetPipeline(uuid); !running {
+		if _, err := core.Storage().FindOnePipelineByUUID(uuid, false); err != nil {
+			c.JSON(404, models.Error{Message: err.Error()})
+			return
+		}
+	}
+	l.setLevel(c, uuid)
+}
+
+func (l *LogLevelApiController) setLevel(c *gin.Context, pipelineUUID string) {
+	var data models.LogLevel
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	revertAfter, err := parseRevertAfter(data.RevertAfter)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	if err := core.SetLogLevel(pipelineUUID, data.Level, revertAfter); err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, logLevels())
+}
+
+// Trace toggles the trace of the events of an agent of a running pipeline
+func (l *LogLevelApiController) Trace(c *gin.Context) {
+	uuid := c.Param("uuid")
+	pipeline, found := core.GetPipeline(uuid)
+	if !found {
+		c.JSON(428, models.Error{Message: "pipeline " + uuid + " is not running"})
+		return
+	}
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, models.Error{Message: "invalid agent id " + c.Param("id")})
+		return
+	}
+
+	var data models.Trace
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	revertAfter, err := parseRevertAfter(data.RevertAfter)
+	if err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+	if err := pipeline.SetTrace(agentID, data.Trace, revertAfter); err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, data)
+}
+
+func parseRevertAfter(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid revert_after %s, expected a duration as 10m", value)
+	}
+	return d, nil
+}
+
+func logLevels() models.LogLevels {
+	levels := core.GetLogLevels()
+	return models.LogLevels{Level: levels.Level, Pipelines: levels.Pipelines}
+}
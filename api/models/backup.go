@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Restore modes
+const (
+	// RESTORE_MERGE keeps stored items missing from the backup
+	RESTORE_MERGE = "merge"
+	// RESTORE_REPLACE deletes stored items missing from the backup
+	RESTORE_REPLACE = "replace"
+)
+
+// Handling of items of a backup already stored with the same UUID
+const (
+	CONFLICT_OVERWRITE = "overwrite"
+	CONFLICT_SKIP      = "skip"
+	// CONFLICT_RENAME imports conflicting pipelines with a new UUID
+	CONFLICT_RENAME = "rename"
+)
+
+// Actions of a restore
+const (
+	RESTORE_CREATE = "create"
+	RESTORE_UPDATE = "update"
+	RESTORE_DELETE = "delete"
+	RESTORE_SKIP   = "skip"
+	RESTORE_RENAME = "rename"
+)
+
+// Kinds of restored items
+const (
+	RESTORE_KIND_PIPELINE   = "pipeline"
+	RESTORE_KIND_ENV        = "env"
+	RESTORE_KIND_XPROCESSOR = "xprocessor"
+)
+
+// validPipelineUUID matches the UUIDs generated by bitfan and the ids of the
+// pipelines of a manifest, a pipeline UUID names its folders in the data location
+var validPipelineUUID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-.]*$`)
+
+// Backup holds pipelines with their assets, envs and xprocessors
+type Backup struct {
+	Version     int          `json:"version"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Pipelines   []Pipeline   `json:"pipelines"`
+	Envs        []Env        `json:"envs"`
+	XProcessors []XProcessor `json:"xprocessors"`
+}
+
+// Validate checks the backup can be restored
+func (b Backup) Validate() error {
+	uuids := map[string]bool{}
+	for _, p := range b.Pipelines {
+		if p.Uuid == "" {
+			return fmt.Errorf("pipeline %s has no uuid", p.Label)
+		}
+		if !validPipelineUUID.MatchString(p.Uuid) {
+			return fmt.Errorf("pipeline %s : invalid uuid %q", p.Label, p.Uuid)
+		}
+		if uuids[p.Uuid] {
+			return fmt.Errorf("pipeline %s is declared twice", p.Uuid)
+		}
+		uuids[p.Uuid] = true
+
+		entrypoints := 0
+		names := map[string]bool{}
+		for _, a := range p.Assets {
+			if a.Name == "" || path.IsAbs(a.Name) || strings.HasPrefix(path.Clean(a.Name), "..") {
+				return fmt.Errorf("pipeline %s : invalid asset name %q", p.Uuid, a.Name)
+			}
+			if names[a.Name] {
+				return fmt.Errorf("pipeline %s : asset %s is declared twice", p.Uuid, a.Name)
+			}
+			names[a.Name] = true
+			if a.Type == ASSET_TYPE_ENTRYPOINT {
+				entrypoints++
+			}
+		}
+		if entrypoints != 1 {
+			return fmt.Errorf("pipeline %s : %d entrypoints found, expected 1", p.Uuid, entrypoints)
+		}
+	}
+
+	for _, e := range b.Envs {
+		if e.Uuid == "" || e.Name == "" {
+			return fmt.Errorf("env %s has no uuid or no name", e.Uuid+e.Name)
+		}
+	}
+	for _, xp := range b.XProcessors {
+		if xp.Uuid == "" || xp.Label == "" {
+			return fmt.Errorf("xprocessor %s has no uuid or no label", xp.Uuid+xp.Label)
+		}
+	}
+	return nil
+}
+
+// RestoreChange is the change of a stored item restored from a backup
+type RestoreChange struct {
+	Kind   string `json:"kind"`
+	Uuid   string `json:"uuid"`
+	Label  string `json:"label"`
+	Action string `json:"action"`
+	// NewUuid is the UUID of a renamed pipeline
+	NewUuid string `json:"new_uuid,omitempty"`
+}
+
+// RestoreReport lists the changes of a restore
+type RestoreReport struct {
+	Mode     string          `json:"mode"`
+	Conflict string          `json:"conflict"`
+	DryRun   bool            `json:"dry_run"`
+	Changes  []RestoreChange `json:"changes"`
+}
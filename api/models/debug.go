@@ -0,0 +1,11 @@
+package models
+
+// DebugRequest is a sample event to run through filters
+type DebugRequest struct {
+	// Filter is the content of the filter section
+	Filter string `json:"filter"`
+	// Event is the sample event
+	Event map[string]interface{} `json:"event"`
+	// PipelineUUID is the pipeline whose assets are usable by the filters
+	PipelineUUID string `json:"pipeline_uuid,omitempty"`
+}
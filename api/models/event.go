@@ -0,0 +1,6 @@
+package models
+
+// InjectReport is the number of events pushed into an agent
+type InjectReport struct {
+	Injected int `json:"injected"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// LintIssue is a mistake found in a configuration
+type LintIssue struct {
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// LintReport lists the issues of an asset
+type LintReport struct {
+	Uuid   string      `json:"uuid"`
+	Issues []LintIssue `json:"issues"`
+}
+
+// FormattedAsset holds the value of an asset in its canonical form
+type FormattedAsset struct {
+	Uuid  string `json:"uuid"`
+	Value []byte `json:"value"`
+	// Changed is true when the value was not in its canonical form
+	Changed bool `json:"changed"`
+}
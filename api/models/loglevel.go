@@ -0,0 +1,25 @@
+package models
+
+// LogLevels are the global log level and the levels of the pipelines
+type LogLevels struct {
+	Level string `json:"level"`
+	// Pipelines are the levels of the pipelines, by uuid
+	Pipelines map[string]string `json:"pipelines"`
+}
+
+// LogLevel changes a log level, an empty level removes the level of a
+// pipeline
+type LogLevel struct {
+	Level string `json:"level"`
+	// RevertAfter is a duration, as 10m, after which the previous level is
+	// restored
+	RevertAfter string `json:"revert_after,omitempty"`
+}
+
+// Trace toggles the trace of the events of an agent
+type Trace struct {
+	Trace bool `json:"trace"`
+	// RevertAfter is a duration, as 10m, after which the previous state is
+	// restored
+	RevertAfter string `json:"revert_after,omitempty"`
+}
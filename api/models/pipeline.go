@@ -32,11 +32,30 @@ type Pipeline struct {
 	Active       bool
 	LocationPath string
 
+	// worst health status of the running pipeline's agents
+	Health string `json:"health,omitempty"`
+
+	// all inputs of the running pipeline are paused
+	Paused bool `json:"paused,omitempty"`
+	// ids of the paused inputs of the running pipeline
+	PausedAgents []int `json:"paused_agents,omitempty"`
+
+	// restarts of the pipeline and of its agents by the supervisor
+	Restarts int `json:"restarts,omitempty"`
+	// restarts in a row, reset once the pipeline stays healthy
+	RestartAttempts int        `json:"restart_attempts,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+	// the supervisor stopped restarting the pipeline
+	GaveUp bool `json:"gave_up,omitempty"`
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	StartedAt time.Time `json:"started_at"`
 
 	AutoStart bool `json:"auto_start" mapstructure:"auto_start"`
+	// uuids of the pipelines started before this one and stopped after it
+	DependsOn []string `json:"depends_on,omitempty" mapstructure:"depends_on"`
 
 	Webhooks   []Webhook
 	Schedulers []Scheduler
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Actions of a sync plan
+const (
+	SYNC_CREATE    = "create"
+	SYNC_UPDATE    = "update"
+	SYNC_DELETE    = "delete"
+	SYNC_UNCHANGED = "unchanged"
+)
+
+// SyncChange is the planned change of a stored pipeline to match the manifest
+type SyncChange struct {
+	PipelineUUID string `json:"pipeline_uuid"`
+	Label        string `json:"label"`
+	Action       string `json:"action"`
+	// Drift is true when the stored pipeline was edited since the last sync
+	Drift   bool     `json:"drift"`
+	Details []string `json:"details"`
+
+	// Pipeline is the pipeline as declared in the manifest
+	Pipeline Pipeline `json:"-"`
+}
+
+// SyncPlan lists the changes to apply to stored pipelines to match a manifest
+type SyncPlan struct {
+	Source   string       `json:"source"`
+	Revision string       `json:"revision,omitempty"`
+	DryRun   bool         `json:"dry_run"`
+	Applied  bool         `json:"applied"`
+	At       time.Time    `json:"at"`
+	Changes  []SyncChange `json:"changes"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Pending returns true when the plan has changes to apply
+func (p SyncPlan) Pending() bool {
+	for _, c := range p.Changes {
+		if c.Action != SYNC_UNCHANGED {
+			return true
+		}
+	}
+	return false
+}
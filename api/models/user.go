@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// User can access the API with its token or with its name and password
+type User struct {
+	Uuid string `json:"uuid"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+
+	// Password enables basic auth for the user, it is never returned
+	Password string `json:"password,omitempty"`
+	// Token is only returned when the user is created or when its token is renewed
+	Token string `json:"token,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Roles, each role is granted the rights of the previous ones
+const (
+	ROLE_VIEWER   = "viewer"   // read only access
+	ROLE_OPERATOR = "operator" // start / stop / restart pipelines
+	ROLE_ADMIN    = "admin"    // edit pipelines, assets, env, xprocessors and users
+)
+
+var roleLevels = map[string]int{
+	ROLE_VIEWER:   1,
+	ROLE_OPERATOR: 2,
+	ROLE_ADMIN:    3,
+}
+
+// ValidRole returns true when role is a known role
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole returns true when the user is granted the rights of role
+func (u *User) HasRole(role string) bool {
+	return roleLevels[u.Role] >= roleLevels[role] && roleLevels[role] > 0
+}
+
+// Ticket authenticates a single websocket connection, browsers can not set
+// the Authorization header of websockets
+type Ticket struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
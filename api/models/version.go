@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// PipelineVersion is a snapshot of a pipeline and its assets, one is recorded
+// on each change of the pipeline or of one of its assets
+type PipelineVersion struct {
+	PipelineUUID string    `json:"pipeline_uuid"`
+	Number       int       `json:"number"`
+	CreatedAt    time.Time `json:"created_at"`
+	Author       string    `json:"author"`
+	Action       string    `json:"action"`
+
+	Label       string  `json:"label"`
+	Description string  `json:"description"`
+	Assets      []Asset `json:"assets"`
+}
+
+// Status of an asset between two versions
+const (
+	DIFF_ADDED     = "added"
+	DIFF_REMOVED   = "removed"
+	DIFF_MODIFIED  = "modified"
+	DIFF_RENAMED   = "renamed"
+	DIFF_UNCHANGED = "unchanged"
+)
+
+// AssetDiff is the unified diff of an asset between two versions
+type AssetDiff struct {
+	Uuid   string `json:"uuid"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Diff   string `json:"diff"`
+}
+
+// VersionDiff lists changes of assets from a version to another
+type VersionDiff struct {
+	PipelineUUID string      `json:"pipeline_uuid"`
+	From         int         `json:"from"`
+	To           int         `json:"to"`
+	Assets       []AssetDiff `json:"assets"`
+}
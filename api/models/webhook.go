@@ -4,4 +4,8 @@ type Webhook struct {
 	Description string
 	Namespace   string
 	Url         string
+	// Href is the advertised absolute URL of the hook
+	Href string
+	// Protections guarding the hook (hmac, bearer, basic, ip_allow, rate_limit)
+	Protections []string
 }
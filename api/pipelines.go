@@ -11,7 +11,9 @@ import (
 	"github.com/mitchellh/mapstructure"
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/commons/depgraph"
 	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/core/webhook"
 	"github.com/vjeantet/bitfan/entrypoint"
 	"github.com/vjeantet/jodaTime"
 )
@@ -26,11 +28,11 @@ func (b *PipelineApiController) DownloadAll(c *gin.Context) {
 	buf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(buf)
 
-	// Find all Pipelines
-	pipelines := core.Storage().FindPipelines(true)
+	// Find all Pipelines, envs and xprocessors
+	backup := core.Storage().Backup()
 
-	for _, p := range pipelines {
-		folderName := slugify(p.Label) + "_" + p.Uuid
+	for _, p := range backup.Pipelines {
+		folderName := backupFolder(p)
 		for _, a := range p.Assets {
 			zipFile, err := zipWriter.Create(folderName + "/" + a.Name)
 			if err != nil {
@@ -45,6 +47,11 @@ func (b *PipelineApiController) DownloadAll(c *gin.Context) {
 		}
 	}
 
+	if err := writeBackupIndex(zipWriter, backup); err != nil {
+		c.String(500, err.Error())
+		return
+	}
+
 	// Make sure to check the error on Close.
 	err := zipWriter.Close()
 	if err != nil {
@@ -80,8 +87,14 @@ func (p *PipelineApiController) Create(c *gin.Context) {
 		pipeline.Assets[i].Uuid = uid.String()
 	}
 
+	if err := checkDependencies(&pipeline); err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+
 	if pipeline.Playground == false {
 		core.Storage().CreatePipeline(&pipeline)
+		recordVersion(c, pipeline.Uuid, "pipeline created")
 	}
 
 	// Handle optinal Start
@@ -105,32 +118,93 @@ func (p *PipelineApiController) startPipelineByUUID(UUID string) error {
 	return p.startPipeline(&tPipeline)
 }
 
+// restartPipelineByUUID restarts a stored pipeline with its current
+// configuration, the pipelines depending on it are restarted too
+func (p *PipelineApiController) restartPipelineByUUID(UUID string) error {
+	tPipeline, err := core.Storage().FindOnePipelineByUUID(UUID, true)
+	if err != nil {
+		return err
+	}
+
+	ppl, err := p.buildPipeline(&tPipeline)
+	if err != nil {
+		return err
+	}
+	return core.RestartPipeline(ppl)
+}
+
 func (p *PipelineApiController) startPipeline(tPipeline *models.Pipeline) error {
-	entryPointPath, err := core.Storage().PreparePipelineExecutionStage(tPipeline)
+	ppl, err := p.buildPipeline(tPipeline)
 	if err != nil {
 		return err
 	}
 
+	nUUID, err := ppl.Start()
+	if err != nil {
+		return err
+	}
+
+	apiLogger.Debugf("Pipeline %s started UUID=%s", tPipeline.Label, nUUID)
+	return nil
+}
+
+// buildPipeline returns the agents of a stored pipeline, ready to start
+func (p *PipelineApiController) buildPipeline(tPipeline *models.Pipeline) (*core.Pipeline, error) {
+	entryPointPath, err := core.Storage().PreparePipelineExecutionStage(tPipeline)
+	if err != nil {
+		return nil, err
+	}
+
 	var loc *entrypoint.Entrypoint
 	loc, err = entrypoint.New(entryPointPath, "", entrypoint.CONTENT_REF)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ppl, err := loc.Pipeline()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ppl.Label = tPipeline.Label
 	ppl.Uuid = tPipeline.Uuid
+	ppl.DependsOn = tPipeline.DependsOn
+	return ppl, nil
+}
 
-	nUUID, err := ppl.Start()
-	if err != nil {
-		return err
+// checkDependencies checks the pipelines a pipeline depends on exist and do
+// not depend on it
+func checkDependencies(pipeline *models.Pipeline) error {
+	if len(pipeline.DependsOn) == 0 {
+		return nil
 	}
 
-	apiLogger.Debugf("Pipeline %s started UUID=%s", tPipeline.Label, nUUID)
+	uuids := []string{}
+	deps := map[string][]string{}
+	for _, sp := range core.Storage().FindPipelines(false) {
+		uuids = append(uuids, sp.Uuid)
+		deps[sp.Uuid] = sp.DependsOn
+	}
+	for uuid, rp := range core.Pipelines() {
+		if _, ok := deps[uuid]; !ok {
+			uuids = append(uuids, uuid)
+			deps[uuid] = rp.DependsOn
+		}
+	}
+
+	for _, uuid := range pipeline.DependsOn {
+		if _, ok := deps[uuid]; !ok && uuid != pipeline.Uuid {
+			return fmt.Errorf("depends_on : pipeline %s not found", uuid)
+		}
+	}
+	if _, ok := deps[pipeline.Uuid]; !ok {
+		uuids = append(uuids, pipeline.Uuid)
+	}
+	deps[pipeline.Uuid] = pipeline.DependsOn
+
+	if _, err := depgraph.Sort(uuids, deps); err != nil {
+		return fmt.Errorf("depends_on : %v", err)
+	}
 	return nil
 }
 
@@ -143,12 +217,17 @@ func (p *PipelineApiController) Find(c *gin.Context) {
 		if pup, ok := runningPipelines[p.Uuid]; ok {
 			pipelines[i].Active = true
 			pipelines[i].LocationPath = pup.ConfigLocation
-			pipelines[i].StartedAt = pup.StartedAt
+			pipelines[i].StartedAt = pup.Started()
+			pipelines[i].Health = pup.Health().Status
+			pipelines[i].Paused = pup.Paused()
+			pipelines[i].PausedAgents = pup.PausedAgents()
 			for _, h := range pup.Webhooks {
 				pipelines[i].Webhooks = append(pipelines[i].Webhooks, models.Webhook{
 					Description: h.Description,
 					Namespace:   h.Namespace,
 					Url:         h.Url,
+					Href:        webhook.BaseURL() + h.Url,
+					Protections: h.Protections,
 				})
 			}
 			for _, s := range pup.Schedulers {
@@ -160,6 +239,7 @@ func (p *PipelineApiController) Find(c *gin.Context) {
 			}
 
 		}
+		setSupervisorState(&pipelines[i], p.Uuid)
 	}
 
 	c.JSON(200, pipelines)
@@ -171,7 +251,9 @@ func (p *PipelineApiController) FindOneByUUID(c *gin.Context) {
 	mPipeline, err := core.Storage().FindOnePipelineByUUID(uuid, false)
 	if err != nil {
 
-		if _, active := core.GetPipeline(uuid); !active {
+		_, active := core.GetPipeline(uuid)
+		// a pipeline whose restart failed is still supervised
+		if _, supervised := core.GetSupervisorState(uuid); !active && !supervised {
 			c.JSON(404, models.Error{Message: err.Error()})
 			return
 		}
@@ -182,15 +264,20 @@ func (p *PipelineApiController) FindOneByUUID(c *gin.Context) {
 
 	runningPipeline, found := core.GetPipeline(uuid)
 	if found == true {
-		mPipeline.StartedAt = runningPipeline.StartedAt
+		mPipeline.StartedAt = runningPipeline.Started()
 		mPipeline.Active = true
 		mPipeline.LocationPath = runningPipeline.ConfigLocation
+		mPipeline.Health = runningPipeline.Health().Status
+		mPipeline.Paused = runningPipeline.Paused()
+		mPipeline.PausedAgents = runningPipeline.PausedAgents()
 
 		for _, h := range runningPipeline.Webhooks {
 			mPipeline.Webhooks = append(mPipeline.Webhooks, models.Webhook{
 				Description: h.Description,
 				Namespace:   h.Namespace,
 				Url:         h.Url,
+				Href:        webhook.BaseURL() + h.Url,
+				Protections: h.Protections,
 			})
 		}
 		for _, s := range runningPipeline.Schedulers {
@@ -202,10 +289,62 @@ func (p *PipelineApiController) FindOneByUUID(c *gin.Context) {
 		}
 
 	}
+	setSupervisorState(&mPipeline, uuid)
 
 	c.JSON(200, mPipeline)
 }
 
+// setSupervisorState sets the restarts of a pipeline, running or whose
+// restart failed
+func setSupervisorState(mPipeline *models.Pipeline, uuid string) {
+	state, ok := core.GetSupervisorState(uuid)
+	if !ok {
+		return
+	}
+	mPipeline.Restarts = state.Restarts
+	mPipeline.RestartAttempts = state.Attempts
+	mPipeline.LastError = state.LastError
+	if !state.LastErrorAt.IsZero() {
+		mPipeline.LastErrorAt = &state.LastErrorAt
+	}
+	mPipeline.GaveUp = state.GaveUp
+}
+
+// Graph renders the agents of a pipeline and their connections,
+// ?format=dot|mermaid|json, json by default. The graph of a running pipeline
+// tells the events each agent received and sent with ?events=true
+func (p *PipelineApiController) Graph(c *gin.Context) {
+	uuid := c.Param("uuid")
+
+	var graph *core.Graph
+	if runningPipeline, found := core.GetPipeline(uuid); found {
+		graph = runningPipeline.Graph(c.Query("events") == "true")
+	} else {
+		tPipeline, err := core.Storage().FindOnePipelineByUUID(uuid, true)
+		if err != nil {
+			c.JSON(404, models.Error{Message: err.Error()})
+			return
+		}
+		ppl, err := p.buildPipeline(&tPipeline)
+		if err != nil {
+			c.JSON(400, models.Error{Message: err.Error()})
+			return
+		}
+		graph = ppl.Graph(false)
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "dot":
+		c.Data(200, "text/vnd.graphviz; charset=utf-8", []byte(graph.Dot()))
+	case "mermaid":
+		c.Data(200, "text/plain; charset=utf-8", []byte(graph.Mermaid()))
+	case "json":
+		c.JSON(200, graph)
+	default:
+		c.JSON(400, models.Error{Message: "unknown format " + c.Query("format") + ", expected dot, mermaid or json"})
+	}
+}
+
 func (p *PipelineApiController) UpdateByUUID(c *gin.Context) {
 	uuid := c.Param("uuid")
 	mPipeline, err := core.Storage().FindOnePipelineByUUID(uuid, false)
@@ -226,13 +365,36 @@ func (p *PipelineApiController) UpdateByUUID(c *gin.Context) {
 		return
 	}
 
+	// a start, stop or restart does not edit the stored pipeline
+	edited := false
+	for k := range data {
+		if k != "active" {
+			edited = true
+		}
+	}
+
+	// operators can only start, stop or restart pipelines
+	if edited && !hasRole(c, models.ROLE_ADMIN) {
+		c.JSON(403, models.Error{Message: "role " + models.ROLE_ADMIN + " required to edit a pipeline"})
+		return
+	}
+
 	if err := mapstructure.WeakDecode(data, &mPipeline); err != nil {
 		c.JSON(500, models.Error{Message: err.Error()})
 		return
 	}
 
-	if !mPipeline.Playground { // Ignore playground pipelines
+	if _, ok := data["depends_on"]; ok {
+		if err := checkDependencies(&mPipeline); err != nil {
+			c.JSON(400, models.Error{Message: err.Error()})
+			return
+		}
+	}
+
+	if edited && !mPipeline.Playground { // Ignore playground pipelines
+		ensureVersioned(uuid)
 		core.Storage().SavePipeline(&mPipeline)
+		recordVersion(c, uuid, "pipeline updated")
 	}
 
 	// handle Start / Stop / Restart
@@ -244,12 +406,7 @@ func (p *PipelineApiController) UpdateByUUID(c *gin.Context) {
 			switch nextActive {
 			case true: // restart
 				apiLogger.Debugf("restarting pipeline %s", uuid)
-				err := core.StopPipeline(uuid)
-				if err != nil {
-					c.JSON(500, models.Error{Message: err.Error()})
-					return
-				}
-				err = p.startPipelineByUUID(uuid)
+				err := p.restartPipelineByUUID(uuid)
 				if err != nil {
 					c.JSON(500, models.Error{Message: err.Error()})
 					return
@@ -282,6 +439,51 @@ func (p *PipelineApiController) UpdateByUUID(c *gin.Context) {
 	c.Redirect(302, fmt.Sprintf("/%s/pipelines/%s", p.path, uuid))
 }
 
+// Pause holds the events of the inputs of a running pipeline, or of one of
+// its inputs, until they are resumed
+func (p *PipelineApiController) Pause(c *gin.Context) {
+	p.setPaused(c, true)
+}
+
+// Resume releases the inputs of a running pipeline, or one of its inputs
+func (p *PipelineApiController) Resume(c *gin.Context) {
+	p.setPaused(c, false)
+}
+
+func (p *PipelineApiController) setPaused(c *gin.Context, paused bool) {
+	uuid := c.Param("uuid")
+	pipeline, found := core.GetPipeline(uuid)
+	if !found {
+		c.JSON(428, models.Error{Message: "pipeline " + uuid + " is not running"})
+		return
+	}
+
+	if c.Param("id") == "" {
+		if paused {
+			pipeline.Pause()
+		} else {
+			pipeline.Resume()
+		}
+	} else {
+		agentID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(400, models.Error{Message: "invalid agent id " + c.Param("id")})
+			return
+		}
+		if paused {
+			err = pipeline.PauseAgent(agentID)
+		} else {
+			err = pipeline.ResumeAgent(agentID)
+		}
+		if err != nil {
+			c.JSON(400, models.Error{Message: err.Error()})
+			return
+		}
+	}
+
+	c.Redirect(302, fmt.Sprintf("/%s/pipelines/%s", p.path, uuid))
+}
+
 func (p *PipelineApiController) DeleteByUUID(c *gin.Context) {
 	uuid := c.Param("uuid")
 
@@ -292,6 +494,7 @@ func (p *PipelineApiController) DeleteByUUID(c *gin.Context) {
 	}
 
 	core.Storage().DeletePipeline(&mPipeline)
+	core.ClosePipelineLog(uuid)
 
 	c.JSON(204, "")
 }
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/commons/depgraph"
+	"github.com/vjeantet/bitfan/commons/manifest"
+	"github.com/vjeantet/bitfan/core"
+)
+
+// SYNC_AUTHOR is the author of pipelines versions recorded by a sync
+const SYNC_AUTHOR = "sync"
+
+// Syncer keeps stored pipelines in sync with a pipelines.yml manifest and
+// its assets, from a directory or a git working tree
+type Syncer struct {
+	// Path of the manifest or of its directory
+	Path string
+	// DryRun only reports the changes, stored pipelines are left untouched
+	DryRun bool
+	// Interval between two syncs, 0 disables Watch
+	Interval time.Duration
+
+	mu        sync.Mutex
+	pipelines *PipelineApiController
+}
+
+// NewSyncer returns a Syncer of the manifest found at path
+func NewSyncer(path string, interval time.Duration, dryRun bool) *Syncer {
+	return &Syncer{
+		Path:      path,
+		DryRun:    dryRun,
+		Interval:  interval,
+		pipelines: &PipelineApiController{},
+	}
+}
+
+// Plan returns the changes to apply to stored pipelines
+func (s *Syncer) Plan() (models.SyncPlan, error) {
+	m, err := manifest.Load(s.Path)
+	if err != nil {
+		return models.SyncPlan{Source: s.Path, At: time.Now(), Changes: []models.SyncChange{}}, err
+	}
+	return core.Storage().PlanSync(m)
+}
+
+// Sync applies the changes to stored pipelines, running pipelines which changed are
+// restarted, new auto started ones are started when start is true.
+// Nothing is applied when dryRun is true.
+func (s *Syncer) Sync(dryRun bool, start bool) (models.SyncPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan, err := s.Plan()
+	plan.DryRun = dryRun
+	if err != nil {
+		plan.Error = err.Error()
+		return plan, err
+	}
+	s.report(plan)
+	if dryRun || !plan.Pending() {
+		return plan, nil
+	}
+
+	// stop removed pipelines before deleting them
+	for _, c := range plan.Changes {
+		if _, running := core.GetPipeline(c.PipelineUUID); running && c.Action == models.SYNC_DELETE {
+			if err := core.StopPipeline(c.PipelineUUID); err != nil {
+				apiLogger.Errorf("sync : can not stop pipeline %s - %v", c.Label, err)
+			}
+		}
+	}
+
+	if err := core.Storage().ApplySync(plan); err != nil {
+		plan.Error = err.Error()
+		return plan, err
+	}
+	plan.Applied = true
+
+	action := "synced from " + plan.Source
+	if plan.Revision != "" {
+		action += "@" + plan.Revision
+	}
+	for _, c := range plan.Changes {
+		if c.Action == models.SYNC_CREATE || c.Action == models.SYNC_UPDATE {
+			if _, err := core.Storage().SavePipelineVersion(c.PipelineUUID, SYNC_AUTHOR, action); err != nil {
+				apiLogger.Errorf("sync : can not record version of pipeline %s - %v", c.Label, err)
+			}
+		}
+	}
+
+	// pipelines start after the pipelines they depend on
+	for _, c := range sortChanges(plan.Changes) {
+		_, running := core.GetPipeline(c.PipelineUUID)
+		switch {
+		case c.Action == models.SYNC_UPDATE && running:
+			apiLogger.Infof("sync : restarting pipeline %s", c.Label)
+			if err := s.pipelines.restartPipelineByUUID(c.PipelineUUID); err != nil {
+				apiLogger.Errorf("sync : can not restart pipeline %s - %v", c.Label, err)
+			}
+		case c.Action == models.SYNC_CREATE && c.Pipeline.AutoStart && start:
+			if err := s.pipelines.startPipelineByUUID(c.PipelineUUID); err != nil {
+				apiLogger.Errorf("sync : can not start pipeline %s - %v", c.Label, err)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// sortChanges orders the changes, each pipeline after the pipelines it
+// depends on
+func sortChanges(changes []models.SyncChange) []models.SyncChange {
+	uuids := []string{}
+	deps := map[string][]string{}
+	byUUID := map[string]models.SyncChange{}
+	for _, c := range changes {
+		uuids = append(uuids, c.PipelineUUID)
+		deps[c.PipelineUUID] = c.Pipeline.DependsOn
+		byUUID[c.PipelineUUID] = c
+	}
+	sorted, err := depgraph.Sort(uuids, deps)
+	if err != nil {
+		// the manifest rejects cycles
+		return changes
+	}
+	ordered := make([]models.SyncChange, len(sorted))
+	for i, uuid := range sorted {
+		ordered[i] = byUUID[uuid]
+	}
+	return ordered
+}
+
+// report logs the changes of the plan and the pipelines changed in the store since the last sync
+func (s *Syncer) report(plan models.SyncPlan) {
+	for _, c := range plan.Changes {
+		if c.Drift {
+			apiLogger.Warnf("sync : pipeline %s was changed in bitfan since its last sync from %s", c.Label, plan.Source)
+		}
+		if c.Action != models.SYNC_UNCHANGED {
+			verb := "will"
+			if plan.DryRun {
+				verb = "would"
+			}
+			apiLogger.Infof("sync : %s %s pipeline %s : %s", verb, c.Action, c.Label, strings.Join(c.Details, ", "))
+		}
+	}
+}
+
+// Watch syncs every Interval until stop is closed, nothing is done when Interval is 0
+func (s *Syncer) Watch(stop chan struct{}) {
+	if s.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := s.Sync(s.DryRun, true); err != nil {
+				apiLogger.Errorf("sync : %v", err)
+			}
+		}
+	}
+}
+
+type SyncApiController struct {
+	syncer *Syncer
+}
+
+// Find returns the changes a sync would apply, it reports drifts
+func (x *SyncApiController) Find(c *gin.Context) {
+	if x.syncer == nil {
+		c.JSON(404, models.Error{Message: "sync is not enabled"})
+		return
+	}
+	plan, err := x.syncer.Plan()
+	plan.DryRun = true
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, plan)
+}
+
+// Sync applies the changes, ?dry_run=true only reports them
+func (x *SyncApiController) Sync(c *gin.Context) {
+	if x.syncer == nil {
+		c.JSON(404, models.Error{Message: "sync is not enabled"})
+		return
+	}
+	dryRun := x.syncer.DryRun
+	if v, err := strconv.ParseBool(c.Query("dry_run")); err == nil {
+		dryRun = dryRun || v
+	}
+	plan, err := x.syncer.Sync(dryRun, true)
+	if err != nil {
+		c.JSON(500, models.Error{Message: fmt.Sprintf("sync failed - %v", err)})
+		return
+	}
+	c.JSON(200, plan)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/commons/expression"
+	"github.com/vjeantet/bitfan/core"
+)
+
+type TapApiController struct {
+}
+
+// Stream sends the events leaving an agent of a running pipeline as JSON
+// messages through a websocket, ?filter=expression keeps the matching events
+// and ?rate=N sends N events by second at most, 100 by default, 0 for no
+// limit. The agent is observed until the client disconnects
+func (t *TapApiController) Stream(c *gin.Context) {
+	uuid := c.Param("uuid")
+	pipeline, found := core.GetPipeline(uuid)
+	if !found {
+		c.JSON(404, models.Error{Message: "pipeline " + uuid + " is not running"})
+		return
+	}
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, models.Error{Message: "invalid agent id " + c.Param("id")})
+		return
+	}
+
+	opt := core.TapOptions{}
+	if opt.Rate, err = strconv.Atoi(c.DefaultQuery("rate", "100")); err != nil || opt.Rate < 0 {
+		c.JSON(400, models.Error{Message: "invalid rate " + c.Query("rate")})
+		return
+	}
+	if filter := c.Query("filter"); filter != "" {
+		if opt.Filter, err = expression.Compile(filter, 0); err != nil {
+			c.JSON(400, models.Error{Message: err.Error()})
+			return
+		}
+	}
+
+	tap, err := pipeline.Tap(agentID, opt)
+	if err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+
+	conn, err := wsupgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		tap.Close()
+		apiLogger.Errorf("tap on agent %d of pipeline %s : %v", agentID, uuid, err)
+		return
+	}
+	apiLogger.Debugf("tap on agent %d of pipeline %s attached", agentID, uuid)
+
+	go tapReadPump(conn, tap)
+	go tapWritePump(conn, tap)
+}
+
+// tapReadPump discards the messages of the client and detaches the observer
+// when the client disconnects
+func tapReadPump(conn *websocket.Conn, tap *core.Tap) {
+	defer func() {
+		tap.Close()
+		conn.Close()
+	}()
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// tapWritePump sends the events of the observer to the client
+func tapWritePump(conn *websocket.Conn, tap *core.Tap) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	for {
+		select {
+		case e, ok := <-tap.Events():
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// the tap or the agent is closed
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			e.Dropped = tap.Dropped()
+			message, err := json.Marshal(e)
+			if err != nil {
+				apiLogger.Errorf("tap : %v", err)
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	uuid "github.com/nu7hatch/gouuid"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+)
+
+type UserApiController struct {
+	path string
+}
+
+func (u *UserApiController) Find(c *gin.Context) {
+	c.JSON(200, core.Storage().FindUsers())
+}
+
+// Create returns the new user with its token, the token can not be retrieved later
+func (u *UserApiController) Create(c *gin.Context) {
+	var user models.User
+	err := c.BindJSON(&user)
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+
+	user.Name = strings.TrimSpace(user.Name)
+	if user.Name == "" {
+		c.JSON(400, models.Error{Message: "user name can not be empty"})
+		return
+	}
+	if user.Role == "" {
+		user.Role = models.ROLE_VIEWER
+	}
+	if !models.ValidRole(user.Role) {
+		c.JSON(400, models.Error{Message: "unknown role " + user.Role})
+		return
+	}
+
+	uid, _ := uuid.NewV4()
+	user.Uuid = uid.String()
+
+	if err := core.Storage().CreateUser(&user); err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+
+	c.JSON(201, user)
+}
+
+func (u *UserApiController) FindOneByUUID(c *gin.Context) {
+	user, err := core.Storage().FindOneUserByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, user)
+}
+
+// UpdateByUUID changes the user's name, role or password, set "renew_token"
+// to true to get a new token
+func (u *UserApiController) UpdateByUUID(c *gin.Context) {
+	user, err := core.Storage().FindOneUserByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+
+	data := struct {
+		Name       *string `json:"name"`
+		Role       *string `json:"role"`
+		Password   string  `json:"password"`
+		RenewToken bool    `json:"renew_token"`
+	}{}
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+
+	if data.Name != nil {
+		user.Name = strings.TrimSpace(*data.Name)
+		if user.Name == "" {
+			c.JSON(400, models.Error{Message: "user name can not be empty"})
+			return
+		}
+	}
+	if data.Role != nil {
+		if !models.ValidRole(*data.Role) {
+			c.JSON(400, models.Error{Message: "unknown role " + *data.Role})
+			return
+		}
+		user.Role = *data.Role
+	}
+	user.Password = data.Password
+
+	if err := core.Storage().SaveUser(&user, data.RenewToken); err != nil {
+		c.JSON(400, models.Error{Message: err.Error()})
+		return
+	}
+
+	c.JSON(200, user)
+}
+
+func (u *UserApiController) DeleteByUUID(c *gin.Context) {
+	user, err := core.Storage().FindOneUserByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+
+	core.Storage().DeleteUser(&user)
+	c.JSON(204, "")
+}
+
+// Ticket returns a ticket of the authenticated user to open a websocket
+// with the ticket query parameter
+func (u *UserApiController) Ticket(c *gin.Context) {
+	user := models.User{Name: c.ClientIP(), Role: models.ROLE_ADMIN}
+	if v, ok := c.Get(userContextKey); ok {
+		user = v.(models.User)
+	}
+	t, err := issueTicket(user, time.Now())
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, t)
+}
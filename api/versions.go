@@ -0,0 +1,255 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/core"
+)
+
+type VersionApiController struct {
+	path      string
+	pipelines *PipelineApiController
+}
+
+// ensureVersioned records the current state of pipelines created before
+// versioning, so their first change can be rolled back. It is called before
+// changes only, reads never write versions
+func ensureVersioned(pipelineUUID string) {
+	versions, err := core.Storage().FindPipelineVersions(pipelineUUID, false)
+	if err != nil || len(versions) > 0 {
+		return
+	}
+	if _, err := core.Storage().SavePipelineVersion(pipelineUUID, "", "initial version"); err != nil {
+		apiLogger.Errorf("can not record initial version of pipeline %s - %v", pipelineUUID, err)
+	}
+}
+
+// recordVersion records the state of the pipeline after a change
+func recordVersion(c *gin.Context, pipelineUUID string, action string) {
+	if _, err := core.Storage().SavePipelineVersion(pipelineUUID, author(c), action); err != nil {
+		apiLogger.Errorf("can not record version of pipeline %s - %v", pipelineUUID, err)
+	}
+}
+
+func (v *VersionApiController) FindByPipelineUUID(c *gin.Context) {
+	uuid := c.Param("uuid")
+	if _, err := core.Storage().FindOnePipelineByUUID(uuid, false); err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+
+	versions, err := core.Storage().FindPipelineVersions(uuid, false)
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, versions)
+}
+
+func (v *VersionApiController) FindOneByNumber(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(400, models.Error{Message: "invalid version number " + c.Param("number")})
+		return
+	}
+
+	version, err := core.Storage().FindOnePipelineVersion(c.Param("uuid"), number, true)
+	if err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, version)
+}
+
+func (v *VersionApiController) FindByAssetUUID(c *gin.Context) {
+	uuid := c.Param("uuid")
+	if _, err := core.Storage().FindOneAssetByUUID(uuid); err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+
+	versions, err := core.Storage().FindAssetVersions(uuid)
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+	c.JSON(200, versions)
+}
+
+// Diff compares the version "from" to the version "to" of a pipeline, "to"
+// defaults to the latest version and "from" to the version before "to"
+func (v *VersionApiController) Diff(c *gin.Context) {
+	uuid := c.Param("uuid")
+	versions, err := core.Storage().FindPipelineVersions(uuid, false)
+	if err != nil {
+		c.JSON(500, models.Error{Message: err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(404, models.Error{Message: "pipeline " + uuid + " has no version"})
+		return
+	}
+
+	to := versions[0].Number
+	if s := c.Query("to"); s != "" {
+		if to, err = strconv.Atoi(s); err != nil {
+			c.JSON(400, models.Error{Message: "invalid version number " + s})
+			return
+		}
+	}
+	from := to - 1
+	if s := c.Query("from"); s != "" {
+		if from, err = strconv.Atoi(s); err != nil {
+			c.JSON(400, models.Error{Message: "invalid version number " + s})
+			return
+		}
+	}
+
+	toVersion, err := core.Storage().FindOnePipelineVersion(uuid, to, true)
+	if err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+	// the first version is compared to an empty pipeline
+	fromVersion := models.PipelineVersion{PipelineUUID: uuid}
+	if from > 0 {
+		fromVersion, err = core.Storage().FindOnePipelineVersion(uuid, from, true)
+		if err != nil {
+			c.JSON(404, models.Error{Message: err.Error()})
+			return
+		}
+	}
+
+	c.JSON(200, models.VersionDiff{
+		PipelineUUID: uuid,
+		From:         from,
+		To:           to,
+		Assets:       diffVersions(fromVersion, toVersion),
+	})
+}
+
+// diffVersions returns a diff of each asset of both versions
+func diffVersions(from, to models.PipelineVersion) []models.AssetDiff {
+	diffs := []models.AssetDiff{}
+
+	fromAssets := map[string]models.Asset{}
+	for _, a := range from.Assets {
+		fromAssets[a.Uuid] = a
+	}
+	toAssets := map[string]bool{}
+
+	for _, a := range to.Assets {
+		toAssets[a.Uuid] = true
+		previous, found := fromAssets[a.Uuid]
+		d := models.AssetDiff{Uuid: a.Uuid, Name: a.Name}
+		switch {
+		case !found:
+			d.Status = models.DIFF_ADDED
+			d.Diff = unifiedDiff(models.Asset{}, a, from.Number, to.Number)
+		case string(previous.Value) != string(a.Value):
+			d.Status = models.DIFF_MODIFIED
+			d.Diff = unifiedDiff(previous, a, from.Number, to.Number)
+		case previous.Name != a.Name:
+			d.Status = models.DIFF_RENAMED
+			d.Diff = fmt.Sprintf("renamed from %s to %s\n", previous.Name, a.Name)
+		default:
+			d.Status = models.DIFF_UNCHANGED
+		}
+		diffs = append(diffs, d)
+	}
+
+	for _, a := range from.Assets {
+		if !toAssets[a.Uuid] {
+			diffs = append(diffs, models.AssetDiff{
+				Uuid:   a.Uuid,
+				Name:   a.Name,
+				Status: models.DIFF_REMOVED,
+				Diff:   unifiedDiff(a, models.Asset{}, from.Number, to.Number),
+			})
+		}
+	}
+	return diffs
+}
+
+func unifiedDiff(a, b models.Asset, fromNumber, toNumber int) string {
+	if !utf8.Valid(a.Value) || !utf8.Valid(b.Value) {
+		return "binary content differs\n"
+	}
+	name := b.Name
+	if name == "" {
+		name = a.Name
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(a.Value)),
+		B:        splitLines(string(b.Value)),
+		FromFile: fmt.Sprintf("v%d/%s", fromNumber, name),
+		ToFile:   fmt.Sprintf("v%d/%s", toNumber, name),
+		Context:  3,
+	})
+	if err != nil {
+		return err.Error()
+	}
+	return diff
+}
+
+// splitLines splits s after each newline, unlike difflib.SplitLines a final
+// newline does not add an empty line and an empty content has no line
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n"
+	}
+	return lines
+}
+
+// Rollback restores the pipeline and its assets as they were in a version,
+// the running pipeline is restarted when restart is true
+func (v *VersionApiController) Rollback(c *gin.Context) {
+	uuid := c.Param("uuid")
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(400, models.Error{Message: "invalid version number " + c.Param("number")})
+		return
+	}
+
+	data := struct {
+		Restart bool `json:"restart"`
+	}{}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&data); err != nil {
+			c.JSON(400, models.Error{Message: err.Error()})
+			return
+		}
+	}
+	if restart, err := strconv.ParseBool(c.Query("restart")); err == nil {
+		data.Restart = restart
+	}
+
+	ensureVersioned(uuid)
+	if _, err := core.Storage().RestorePipelineVersion(uuid, number); err != nil {
+		c.JSON(404, models.Error{Message: err.Error()})
+		return
+	}
+	recordVersion(c, uuid, fmt.Sprintf("rollback to version %d", number))
+
+	if _, active := core.GetPipeline(uuid); active && data.Restart {
+		apiLogger.Debugf("restarting pipeline %s rolled back to version %d", uuid, number)
+		if err := v.pipelines.restartPipelineByUUID(uuid); err != nil {
+			c.JSON(500, models.Error{Message: err.Error()})
+			return
+		}
+	}
+
+	c.Redirect(302, fmt.Sprintf("/%s/pipelines/%s", v.path, uuid))
+}
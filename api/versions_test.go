@@ -0,0 +1,85 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+func version(number int, assets ...models.Asset) models.PipelineVersion {
+	return models.PipelineVersion{PipelineUUID: "p1", Number: number, Assets: assets}
+}
+
+func asset(uuid, name, value string) models.Asset {
+	return models.Asset{Uuid: uuid, Name: name, Value: []byte(value)}
+}
+
+func TestDiffVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to models.PipelineVersion
+		diffs    []models.AssetDiff
+	}{
+		{
+			"first version",
+			version(0),
+			version(1, asset("a", "main.conf", "input {}\n")),
+			[]models.AssetDiff{{Uuid: "a", Name: "main.conf", Status: models.DIFF_ADDED, Diff: "--- v0/main.conf\n+++ v1/main.conf\n@@ -0,0 +1 @@\n+input {}\n"}},
+		},
+		{
+			"unchanged",
+			version(1, asset("a", "main.conf", "input {}\n")),
+			version(2, asset("a", "main.conf", "input {}\n")),
+			[]models.AssetDiff{{Uuid: "a", Name: "main.conf", Status: models.DIFF_UNCHANGED}},
+		},
+		{
+			"modified",
+			version(1, asset("a", "main.conf", "input {}\nfilter {}\noutput {}\n")),
+			version(2, asset("a", "main.conf", "input {}\nfilter { mutate {} }\noutput {}\n")),
+			[]models.AssetDiff{{Uuid: "a", Name: "main.conf", Status: models.DIFF_MODIFIED, Diff: "--- v1/main.conf\n+++ v2/main.conf\n" +
+				"@@ -1,3 +1,3 @@\n input {}\n-filter {}\n+filter { mutate {} }\n output {}\n"}},
+		},
+		{
+			"renamed",
+			version(1, asset("a", "main.conf", "input {}\n")),
+			version(2, asset("a", "web.conf", "input {}\n")),
+			[]models.AssetDiff{{Uuid: "a", Name: "web.conf", Status: models.DIFF_RENAMED, Diff: "renamed from main.conf to web.conf\n"}},
+		},
+		{
+			"renamed and modified",
+			version(1, asset("a", "main.conf", "input {}\n")),
+			version(2, asset("a", "web.conf", "output {}\n")),
+			[]models.AssetDiff{{Uuid: "a", Name: "web.conf", Status: models.DIFF_MODIFIED, Diff: "--- v1/web.conf\n+++ v2/web.conf\n@@ -1 +1 @@\n-input {}\n+output {}\n"}},
+		},
+		{
+			"added and removed",
+			version(3, asset("a", "main.conf", "input {}\n"), asset("b", "old.conf", "filter {}\n")),
+			version(4, asset("a", "main.conf", "input {}\n"), asset("c", "new.conf", "output {}\n")),
+			[]models.AssetDiff{
+				{Uuid: "a", Name: "main.conf", Status: models.DIFF_UNCHANGED},
+				{Uuid: "c", Name: "new.conf", Status: models.DIFF_ADDED, Diff: "--- v3/new.conf\n+++ v4/new.conf\n@@ -0,0 +1 @@\n+output {}\n"},
+				{Uuid: "b", Name: "old.conf", Status: models.DIFF_REMOVED, Diff: "--- v3/old.conf\n+++ v4/old.conf\n@@ -1 +0,0 @@\n-filter {}\n"},
+			},
+		},
+		{
+			"without final newline",
+			version(1, asset("a", "main.conf", "input {}\nfilter {}")),
+			version(2, asset("a", "main.conf", "input {}\noutput {}")),
+			[]models.AssetDiff{{Uuid: "a", Name: "main.conf", Status: models.DIFF_MODIFIED, Diff: "--- v1/main.conf\n+++ v2/main.conf\n" +
+				"@@ -1,2 +1,2 @@\n input {}\n-filter {}\n+output {}\n"}},
+		},
+		{
+			"binary",
+			version(1, asset("a", "geo.mmdb", "\xff\xfe\x00")),
+			version(2, asset("a", "geo.mmdb", "\xff\xfe\x01")),
+			[]models.AssetDiff{{Uuid: "a", Name: "geo.mmdb", Status: models.DIFF_MODIFIED, Diff: "binary content differs\n"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.diffs, diffVersions(tt.from, tt.to))
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/jodaTime"
+)
+
+func init() {
+	RootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+	backupCmd.Flags().Bool("db", false, "Backup the whole database (db.zip) instead of pipelines, envs and xprocessors (pipelines.zip)")
+}
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup [file.zip]",
+	Short: "Save pipelines, envs and xprocessors of a running bitfan to a zip archive",
+	Long: `Save pipelines with their assets, envs and xprocessors of a running bitfan to a
+zip archive, restore it with the restore command.
+
+Default file is bitfan_pipelines_<date>.zip (bitfan_db_<date>.zip with --db) in the current directory.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			cmd.Help()
+			os.Exit(1)
+		}
+		db, _ := cmd.Flags().GetBool("db")
+
+		file := jodaTime.Format("'bitfan_pipelines_'YYYYMMdd-HHmmss'.zip'", time.Now())
+		if db {
+			file = jodaTime.Format("'bitfan_db_'YYYYMMdd-HHmmss'.zip'", time.Now())
+		}
+		if len(args) == 1 {
+			file = args[0]
+		}
+
+		cli := newApiClient(viper.GetString("host"))
+		archive, err := cli.Backup(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(file, archive, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "backup error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(file)
+	},
+}
@@ -15,12 +15,16 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"github.com/vjeantet/bitfan/codecs"
+	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/processors/doc"
 )
 
 // docCmd represents the doc command
@@ -41,9 +45,27 @@ Display list of only available filters
 
 Display documentation about the "file" plugin (the output one)
 	doc file --type=output
+
+Display the JSON Schema of the "date" plugin settings
+	doc date --format=jsonschema
+
+Display the JSON Schemas of all codecs
+	doc --type=codec --format=jsonschema
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		kind, _ := cmd.Flags().GetString("type")
+		format, _ := cmd.Flags().GetString("format")
+		if format == "jsonschema" {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			if err := displaySchema(kind, name); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
 		if len(args) == 0 {
 			switch kind {
 			case "input":
@@ -128,8 +150,69 @@ func displaydoc(kind string, name string, tplOnly bool) error {
 	return nil
 }
 
+// displaySchema prints the JSON Schema of a plugin or of all plugins of a kind
+// by code, codecs are listed with the codec kind
+func displaySchema(kind string, name string) error {
+	var schema interface{}
+	switch {
+	case kind == "codec" && name == "":
+		schemas := map[string]*doc.Schema{}
+		for name, d := range codecs.Docs() {
+			schemas[name] = d.JSONSchema()
+		}
+		schema = schemas
+	case kind == "codec":
+		d, ok := codecs.Docs()[name]
+		if !ok {
+			return fmt.Errorf("Unknow codec %s \n", name)
+		}
+		schema = d.JSONSchema()
+	case name == "":
+		schemas := core.ProcessorsSchemas()
+		if kind != "" {
+			for code := range schemas {
+				codeKind := "filter"
+				if strings.HasPrefix(code, "input_") {
+					codeKind = "input"
+				} else if strings.HasPrefix(code, "output_") {
+					codeKind = "output"
+				}
+				if codeKind != kind {
+					delete(schemas, code)
+				}
+			}
+		}
+		schema = schemas
+	default:
+		if kind == "" {
+			for _, k := range []string{"input", "filter", "output"} {
+				if _, ok := plugins[k][name]; ok {
+					kind = k
+					break
+				}
+			}
+		}
+		if _, ok := plugins[kind][name]; !ok {
+			return fmt.Errorf("Unknow plugin %s in %s \n", name, kind)
+		}
+		code := name
+		if kind != "filter" {
+			code = kind + "_" + name
+		}
+		schema = core.ProcessorSchema(code)
+	}
+
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
 func init() {
 	RootCmd.AddCommand(docCmd)
 	docCmd.Flags().BoolP("template", "t", false, "show only a template")
-	docCmd.Flags().String("type", "", "input ? output ? filter ? (plugin may have the same name in multiple sections)")
+	docCmd.Flags().String("type", "", "input ? output ? filter ? codec ? (plugin may have the same name in multiple sections)")
+	docCmd.Flags().String("format", "markdown", "markdown or jsonschema")
 }
@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/vjeantet/bitfan/entrypoint/parser/logstash"
+)
+
+func init() {
+	RootCmd.AddCommand(fmtCmd)
+	fmtCmd.Flags().BoolP("check", "c", false, "List files whose formatting differs, exit with an error when there is one")
+	fmtCmd.Flags().BoolP("write", "w", false, "Write the formatted configuration to the file instead of stdout")
+}
+
+// fmtCmd represents the fmt command
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [config1] [config2] [config...]",
+	Short: "Format configuration files in the canonical form",
+	Long: `Rewrite configuration files in the canonical form : sections in the input, filter,
+output order, blocks indented with two spaces, strings double quoted and hash keys sorted.
+
+Directories are walked for .conf files, the configuration is read from stdin when
+no file is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		check, _ := cmd.Flags().GetBool("check")
+		write, _ := cmd.Flags().GetBool("write")
+
+		if len(args) == 0 {
+			content, _ := ioutil.ReadAll(os.Stdin)
+			formatted, err := logstash.Format(content)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "<stdin>: %v\n", err)
+				os.Exit(1)
+			}
+			if check && !bytes.Equal(content, formatted) {
+				fmt.Println("<stdin>")
+				os.Exit(1)
+			}
+			if !check {
+				os.Stdout.Write(formatted)
+			}
+			return
+		}
+
+		files, err := configFiles(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fmt error: %v\n", err)
+			os.Exit(1)
+		}
+
+		failed := false
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				failed = true
+				continue
+			}
+			formatted, err := logstash.Format(content)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+				failed = true
+				continue
+			}
+			changed := !bytes.Equal(content, formatted)
+
+			switch {
+			case check:
+				if changed {
+					fmt.Println(file)
+					failed = true
+				}
+			case write:
+				if changed {
+					if err := ioutil.WriteFile(file, formatted, 0644); err != nil {
+						fmt.Fprintf(os.Stderr, "%v\n", err)
+						failed = true
+					}
+				}
+			default:
+				os.Stdout.Write(formatted)
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// configFiles returns the files and the .conf files of the directories
+func configFiles(args []string) ([]string, error) {
+	files := []string{}
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return files, err
+		}
+		if !fi.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && filepath.Ext(path) == ".conf" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/entrypoint"
+)
+
+func init() {
+	RootCmd.AddCommand(graphCmd)
+	graphCmd.Flags().String("format", "dot", "Format of the graph : dot, mermaid or json")
+	graphCmd.Flags().Bool("events", false, "Tell the events each agent received and sent, for a running pipeline")
+	graphCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to, to graph a running pipeline")
+}
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph [config|pipelineUUID]",
+	Short: "Render the agents of a pipeline and their connections",
+	Long: `Render the agents of a configuration, with the ones of its used and routed
+configurations, and their connections as a Graphviz DOT digraph, a Mermaid
+flowchart or JSON.
+
+The graph of a pipeline of a bitfan server is rendered when the argument is not a
+configuration file or url, --events tells the events each agent received and sent
+since the pipeline started.
+
+  bitfan graph pipeline.conf | dot -Tsvg > pipeline.svg`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			os.Exit(1)
+		}
+		format, _ := cmd.Flags().GetString("format")
+		if format != "dot" && format != "mermaid" && format != "json" {
+			fmt.Fprintf(os.Stderr, "graph error: unknown format %s, expected dot, mermaid or json\n", format)
+			os.Exit(1)
+		}
+
+		cwd, _ := os.Getwd()
+		loc, err := entrypoint.New(args[0], cwd, entrypoint.CONTENT_REF)
+		if err != nil {
+			// not a configuration, a pipeline of the bitfan server
+			events, _ := cmd.Flags().GetBool("events")
+			data, err := newApiClient(viper.GetString("host")).PipelineGraph(args[0], format, events)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "graph error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Stdout.Write(data)
+			return
+		}
+
+		ppl, err := loc.Pipeline()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "graph error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(renderGraph(ppl.Graph(false), format))
+	},
+}
+
+func renderGraph(g *core.Graph, format string) string {
+	switch format {
+	case "mermaid":
+		return g.Mermaid()
+	case "json":
+		data, _ := json.MarshalIndent(g, "", "  ")
+		return string(data) + "\n"
+	}
+	return g.Dot()
+}
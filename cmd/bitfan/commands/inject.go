@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	RootCmd.AddCommand(injectCmd)
+	injectCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+}
+
+// injectCmd represents the inject command
+var injectCmd = &cobra.Command{
+	Use:   "inject [pipelineUUID] [agentID] [file...]",
+	Short: "Push JSON events into an agent of a running pipeline",
+	Long: `Push JSON events into an agent of a running pipeline, as if they were sent by
+its sources. Events are read from the files, or from the standard input, as JSON
+objects, arrays of objects or one object by line.
+
+The id of the agent is given by bitfan graph [pipelineUUID] --format=json
+
+  echo '{"message":"GET /index.html 500"}' | bitfan inject 0b5c1d4e-... 3`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 {
+			cmd.Help()
+			os.Exit(1)
+		}
+		agentID, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "inject error: invalid agent id %s\n", args[1])
+			os.Exit(1)
+		}
+
+		events := []map[string]interface{}{}
+		if len(args) == 2 {
+			events, err = readEvents(os.Stdin, events)
+		}
+		for _, path := range args[2:] {
+			f, ferr := os.Open(path)
+			if ferr != nil {
+				err = ferr
+				break
+			}
+			events, err = readEvents(f, events)
+			f.Close()
+			if err != nil {
+				err = fmt.Errorf("%s : %v", path, err)
+				break
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "inject error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(events) == 0 {
+			fmt.Fprintf(os.Stderr, "inject error: no event\n")
+			os.Exit(1)
+		}
+
+		injected, err := newApiClient(viper.GetString("host")).Inject(args[0], agentID, events)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "inject error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d event(s) injected\n", injected)
+	},
+}
+
+// readEvents appends the JSON objects and arrays of objects read from r to
+// events
+func readEvents(r io.Reader, events []map[string]interface{}) ([]map[string]interface{}, error) {
+	dec := json.NewDecoder(r)
+	for {
+		var value interface{}
+		if err := dec.Decode(&value); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			events = append(events, v)
+		case []interface{}:
+			for _, item := range v {
+				fields, ok := item.(map[string]interface{})
+				if !ok {
+					return events, fmt.Errorf("%v is not a JSON object", item)
+				}
+				events = append(events, fields)
+			}
+		default:
+			return events, fmt.Errorf("%v is not a JSON object", v)
+		}
+	}
+}
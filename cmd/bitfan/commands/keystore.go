@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/core/keystore"
+)
+
+func init() {
+	RootCmd.AddCommand(keystoreCmd)
+	cwd, _ := os.Getwd()
+	keystoreCmd.PersistentFlags().String("data", filepath.Join(cwd, ".bitfan"), "Path to data dir")
+	keystoreCmd.PersistentFlags().String("keystore", "", "Path of the keystore file, default is bitfan.keystore in the data dir")
+}
+
+// keystoreCmd represents the keystore command
+var keystoreCmd = &cobra.Command{
+	Use:   "keystore",
+	Short: "Manage secrets usable as ${secret:NAME} in configurations",
+	Long: `Manage secrets of the keystore, a file encrypted with the master password
+set in the ` + keystore.PASSWORD_ENV + ` environment variable.
+
+bitfan needs the same ` + keystore.PASSWORD_ENV + ` environment variable to
+replace ${secret:NAME} in configurations, secrets values are redacted from logs.
+	`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initSettings(cmd)
+		viper.BindPFlag("data", cmd.Flags().Lookup("data"))
+		viper.BindPFlag("keystore", cmd.Flags().Lookup("keystore"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func keystorePath() string {
+	if path := viper.GetString("keystore"); path != "" {
+		return path
+	}
+	return filepath.Join(viper.GetString("data"), "bitfan.keystore")
+}
+
+// openKeystore opens the keystore or exits
+func openKeystore() *keystore.Keystore {
+	k, err := keystore.Open(keystorePath(), os.Getenv(keystore.PASSWORD_ENV))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keystore error: %v\n", err)
+		os.Exit(1)
+	}
+	return k
+}
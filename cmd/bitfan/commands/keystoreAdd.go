@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	keystoreCmd.AddCommand(keystoreAddCmd)
+	keystoreAddCmd.Flags().BoolP("force", "f", false, "Overwrite the secret when it already exists")
+}
+
+// keystoreAddCmd represents the keystore add command
+var keystoreAddCmd = &cobra.Command{
+	Use:   "add NAME",
+	Short: "Add a secret to the keystore, its value is read from stdin",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			os.Exit(1)
+		}
+		name := args[0]
+		k := openKeystore()
+
+		if _, exists := k.Get(name); exists {
+			if force, _ := cmd.Flags().GetBool("force"); !force {
+				fmt.Fprintf(os.Stderr, "secret %s already exists, use --force to overwrite it\n", name)
+				os.Exit(1)
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "Enter value for %s: ", name)
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value == "" {
+			fmt.Fprintf(os.Stderr, "\nno value read from stdin\n")
+			os.Exit(1)
+		}
+		value = strings.TrimRight(value, "\r\n")
+
+		k.Set(name, value)
+		if err := k.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "keystore error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "\nsecret %s added to %s\n", name, k.Path())
+	},
+}
@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	keystoreCmd.AddCommand(keystoreListCmd)
+}
+
+// keystoreListCmd represents the keystore list command
+var keystoreListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List names of the keystore's secrets",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range openKeystore().Names() {
+			fmt.Println(name)
+		}
+	},
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	keystoreCmd.AddCommand(keystoreRemoveCmd)
+}
+
+// keystoreRemoveCmd represents the keystore remove command
+var keystoreRemoveCmd = &cobra.Command{
+	Use:     "remove NAME",
+	Aliases: []string{"rm"},
+	Short:   "Remove a secret from the keystore",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			os.Exit(1)
+		}
+		k := openKeystore()
+		if !k.Remove(args[0]) {
+			fmt.Fprintf(os.Stderr, "secret %s not found\n", args[0])
+			os.Exit(1)
+		}
+		if err := k.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "keystore error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "secret %s removed\n", args[0])
+	},
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/entrypoint/parser/lint"
+)
+
+func init() {
+	RootCmd.AddCommand(lintCmd)
+}
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint [config1] [config2] [config...]",
+	Short: "Report mistakes in configuration files",
+	Long: `Report deprecated options, processors without tag_on_failure, unreachable
+branches of conditionals, duplicate labels and conditionals testing fields never
+set upstream.
+
+Directories are walked for .conf files, exits with an error when an issue is found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Help()
+			os.Exit(1)
+		}
+		files, err := configFiles(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lint error: %v\n", err)
+			os.Exit(1)
+		}
+
+		count := 0
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				count++
+				continue
+			}
+			issues, err := lint.Content(content, core.ProcessorDoc)
+			if err != nil {
+				fmt.Printf("%s: %v\n", file, err)
+				count++
+				continue
+			}
+			for _, issue := range issues {
+				fmt.Printf("%s: %s\n", file, issue)
+			}
+			count += len(issues)
+		}
+		if count > 0 {
+			os.Exit(1)
+		}
+	},
+}
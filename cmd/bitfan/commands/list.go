@@ -22,7 +22,6 @@ import (
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/vjeantet/bitfan/api/client"
 )
 
 func init() {
@@ -40,7 +39,7 @@ var listCmd = &cobra.Command{
 		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		cli := client.New(viper.GetString("host"))
+		cli := newApiClient(viper.GetString("host"))
 		pipelines, err := cli.Pipelines()
 		if err != nil {
 			fmt.Printf("list error: %v\n", err.Error())
@@ -59,9 +58,18 @@ var listCmd = &cobra.Command{
 					host = pipeline.ConfigHostLocation + "@"
 				}
 				active := "stopped"
-				if pipeline.Active {
+				if pipeline.Paused {
+					active = "paused"
+				} else if len(pipeline.PausedAgents) > 0 {
+					active = fmt.Sprintf("running, %d input(s) paused", len(pipeline.PausedAgents))
+				} else if pipeline.Active {
 					active = "running"
 				}
+				if pipeline.GaveUp {
+					active = "failed"
+				} else if pipeline.Restarts > 0 {
+					active = fmt.Sprintf("%s, %d restart(s)", active, pipeline.Restarts)
+				}
 				table.Append([]string{
 					pipeline.Uuid,
 					pipeline.Label,
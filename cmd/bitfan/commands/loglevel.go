@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+func init() {
+	RootCmd.AddCommand(logLevelCmd)
+	logLevelCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+	logLevelCmd.Flags().String("pipeline", "", "UUID of the pipeline whose level changes, instead of the global level")
+	logLevelCmd.Flags().Duration("revert", 0, "Restore the previous level after this duration, as 10m")
+}
+
+// logLevelCmd represents the log-level command
+var logLevelCmd = &cobra.Command{
+	Use:   "log-level [debug|info|warn|error]",
+	Short: "Show or change the log level of a running bitfan or of one of its pipelines",
+	Long: `Show the log levels of a running bitfan without argument, or change the global
+log level, or the level of a pipeline with --pipeline. The level of a pipeline
+applies to the logs of its processors, an empty level "" removes it.
+
+  bitfan log-level debug --pipeline 3f9d5fcc-... --revert 15m`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cli := newApiClient(viper.GetString("host"))
+
+		var levels *models.LogLevels
+		var err error
+		if len(args) == 0 {
+			levels, err = cli.LogLevels()
+		} else {
+			pipeline, _ := cmd.Flags().GetString("pipeline")
+			revert, _ := cmd.Flags().GetDuration("revert")
+			data := &models.LogLevel{Level: args[0]}
+			if revert > 0 {
+				data.RevertAfter = revert.String()
+			}
+			levels, err = cli.SetLogLevel(pipeline, data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log-level error: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("level %s\n", levels.Level)
+		uuids := []string{}
+		for uuid := range levels.Pipelines {
+			uuids = append(uuids, uuid)
+		}
+		sort.Strings(uuids)
+		for _, uuid := range uuids {
+			fmt.Printf("pipeline %s level %s\n", uuid, levels.Pipelines[uuid])
+		}
+	},
+}
@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/entrypoint/lsp"
+)
+
+func init() {
+	RootCmd.AddCommand(lspCmd)
+}
+
+// lspCmd represents the lsp command
+var lspCmd = &cobra.Command{
+	Use:   "lsp",
+	Short: "Run a language server for configuration files on stdio",
+	Long: `Run a Language Server Protocol server on stdin and stdout.
+
+Editors get diagnostics from the parser, the processors options and the linter,
+completion of processors and options, hover documentation, go-to-definition of
+the configurations used by use and route processors, and document symbols.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server := lsp.NewServer(os.Stdin, os.Stdout, core.ProcessorsDocs(""))
+		if err := server.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "lsp error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+// pauseCmd represents the pause command
+var pauseCmd = &cobra.Command{
+	Use:   "pause [pipelineUUID]",
+	Short: "Pause the inputs of a running pipeline",
+	Long: `Pause the inputs of a running pipeline, or one of its inputs with --agent.
+Paused inputs stop pulling or accepting data, their sources wait, and the events
+already queued are still processed by the filters and outputs.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cli := newApiClient(viper.GetString("host"))
+		agentID, _ := cmd.Flags().GetInt("agent")
+
+		for _, uuid := range args {
+			var pipeline *models.Pipeline
+			var err error
+			if agentID > 0 {
+				pipeline, err = cli.PauseAgent(uuid, agentID)
+			} else {
+				pipeline, err = cli.PausePipeline(uuid)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error : %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("Paused (UUID:%s) - %s, paused inputs %v\n", pipeline.Uuid, pipeline.Label, pipeline.PausedAgents)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(pauseCmd)
+	pauseCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+	pauseCmd.Flags().Int("agent", 0, "Id of the input to pause, given by bitfan graph")
+}
@@ -24,6 +24,7 @@ import (
 	inputeventprocessor "github.com/vjeantet/bitfan/processors/input-event"
 	execinput "github.com/vjeantet/bitfan/processors/input-exec"
 	file "github.com/vjeantet/bitfan/processors/input-file"
+	monitoringinput "github.com/vjeantet/bitfan/processors/input-monitoring"
 	rabbitmqinput "github.com/vjeantet/bitfan/processors/input-rabbitmq"
 	stdin "github.com/vjeantet/bitfan/processors/input-stdin"
 	inputstdout "github.com/vjeantet/bitfan/processors/input-stdout"
@@ -85,6 +86,7 @@ func init() {
 	initPlugin("input", "event", inputeventprocessor.New)
 	initPlugin("input", "websocket", websocketinput.New)
 	initPlugin("input", "pop3", pop3processor.New)
+	initPlugin("input", "monitoring", monitoringinput.New)
 
 	initPlugin("filter", "eval", evalprocessor.New)
 	initPlugin("filter", "readfile", file.New)
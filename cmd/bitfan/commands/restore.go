@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/api/client"
+)
+
+func init() {
+	RootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+	restoreCmd.Flags().String("mode", "merge", "merge keeps stored items missing from the archive, replace deletes them")
+	restoreCmd.Flags().String("conflict", "overwrite", "In merge mode, items already stored are overwritten, skipped or, for pipelines, renamed with a new UUID (overwrite, skip or rename)")
+	restoreCmd.Flags().Bool("dry-run", false, "Only validate the archive and display the changes")
+	restoreCmd.Flags().Bool("restart", false, "Restart the running pipelines restored")
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore file.zip",
+	Short: "Restore pipelines, envs and xprocessors of a backup to a running bitfan",
+	Long: `Restore pipelines with their assets, envs and xprocessors of a pipelines.zip or a
+db.zip archive, made with the backup command or downloaded from the api, to a running bitfan.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			os.Exit(1)
+		}
+
+		archive, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "restore error: %v\n", err)
+			os.Exit(1)
+		}
+		zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "restore error: %s is not a zip archive - %v\n", args[0], err)
+			os.Exit(1)
+		}
+		db := false
+		for _, f := range zipReader.File {
+			if f.Name == "bitfan.bolt.db" {
+				db = true
+			}
+		}
+
+		opt := client.RestoreOptions{}
+		opt.Mode, _ = cmd.Flags().GetString("mode")
+		opt.Conflict, _ = cmd.Flags().GetString("conflict")
+		opt.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		opt.Restart, _ = cmd.Flags().GetBool("restart")
+
+		cli := newApiClient(viper.GetString("host"))
+		report, err := cli.Restore(archive, db, opt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "restore error: %v\n", err)
+			os.Exit(1)
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{
+			"kind",
+			"UUID",
+			"name",
+			"action",
+			"new UUID",
+		})
+		for _, c := range report.Changes {
+			table.Append([]string{
+				c.Kind,
+				c.Uuid,
+				c.Label,
+				c.Action,
+				c.NewUuid,
+			})
+		}
+		table.SetCenterSeparator("+")
+		table.Render()
+
+		if report.DryRun {
+			fmt.Println("dry run, no change applied")
+		}
+	},
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume [pipelineUUID]",
+	Short: "Resume the paused inputs of a running pipeline",
+	Long:  `Resume the paused inputs of a running pipeline, or one of its inputs with --agent.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cli := newApiClient(viper.GetString("host"))
+		agentID, _ := cmd.Flags().GetInt("agent")
+
+		for _, uuid := range args {
+			var pipeline *models.Pipeline
+			var err error
+			if agentID > 0 {
+				pipeline, err = cli.ResumeAgent(uuid, agentID)
+			} else {
+				pipeline, err = cli.ResumePipeline(uuid)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error : %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("Resumed (UUID:%s) - %s\n", pipeline.Uuid, pipeline.Label)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(resumeCmd)
+	resumeCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+	resumeCmd.Flags().Int("agent", 0, "Id of the input to resume, given by bitfan graph")
+}
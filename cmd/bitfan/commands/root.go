@@ -23,6 +23,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/api/client"
+	"github.com/vjeantet/bitfan/commons/tlsconfig"
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -38,6 +40,12 @@ var RootCmd = &cobra.Command{
 		viper.BindPFlag("debug", cmd.Flags().Lookup("debug"))
 		viper.BindPFlag("data", cmd.Flags().Lookup("data"))
 		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+		viper.BindPFlag("api-token", cmd.Flags().Lookup("api-token"))
+		viper.BindPFlag("api-user", cmd.Flags().Lookup("api-user"))
+		viper.BindPFlag("api-password", cmd.Flags().Lookup("api-password"))
+		viper.BindPFlag("api-ca", cmd.Flags().Lookup("api-ca"))
+		viper.BindPFlag("api-cert", cmd.Flags().Lookup("api-cert"))
+		viper.BindPFlag("api-key", cmd.Flags().Lookup("api-key"))
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -133,6 +141,31 @@ func init() {
 	RootCmd.PersistentFlags().StringP("log", "l", "", "Log to a given path. Default is to log to stdout.")
 	RootCmd.PersistentFlags().Bool("verbose", true, "Increase verbosity of logs")
 	RootCmd.PersistentFlags().Bool("debug", false, "Increase verbosity to the last level (trace)")
+	RootCmd.PersistentFlags().String("api-token", "", "Token used to authenticate to the bitfan Api")
+	RootCmd.PersistentFlags().String("api-user", "", "User used to authenticate to the bitfan Api")
+	RootCmd.PersistentFlags().String("api-password", "", "Password of the api-user")
+	RootCmd.PersistentFlags().String("api-ca", "", "PEM CAs verifying the certificate of the bitfan Api, system CAs by default")
+	RootCmd.PersistentFlags().String("api-cert", "", "PEM client certificate presented to a bitfan Api requiring mutual TLS")
+	RootCmd.PersistentFlags().String("api-key", "", "PEM private key of the api-cert certificate")
+}
+
+// newApiClient returns a client of the bitfan Api running on host, authenticated
+// with the api-token or api-user flags, over TLS with the api-ca and api-cert flags
+func newApiClient(host string) *client.RestClient {
+	tlsConf, err := tlsconfig.Client(tlsconfig.ClientOptions{
+		CAFile:   viper.GetString("api-ca"),
+		CertFile: viper.GetString("api-cert"),
+		KeyFile:  viper.GetString("api-key"),
+	})
+	if err != nil {
+		fmt.Printf("api: %v\n", err)
+		os.Exit(2)
+	}
+	return client.New(host).WithCredentials(client.Credentials{
+		Token:    viper.GetString("api-token"),
+		Username: viper.GetString("api-user"),
+		Password: viper.GetString("api-password"),
+	}).WithTLS(tlsConf)
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -20,12 +20,15 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/kardianos/service"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/vjeantet/bitfan/api"
+	"github.com/vjeantet/bitfan/commons/manifest"
+	"github.com/vjeantet/bitfan/commons/tlsconfig"
 	"github.com/vjeantet/bitfan/core"
 	"github.com/vjeantet/bitfan/entrypoint"
 )
@@ -37,11 +40,13 @@ func init() {
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
-	Use:   "run [config1] [config2] [config...]",
+	Use:   "run [config1] [config2] [config...] [pipelines.yml]",
 	Short: "Run bitfan",
 	Long: `Load and run pipelines configured in configuration files (logstash format)
 you can set multiples files, urls, diretories, or a configuration content as a string (mimic the logstash -e flag)
 
+A .yml file is a pipelines manifest declaring pipelines with their stable ID, label, configuration and settings
+
 When no configuration is passed to the command, bitfan use the config set in global settings file bitfan.(toml|yml|json)
 	`,
 	PreRun: func(cmd *cobra.Command, args []string) {
@@ -54,11 +59,44 @@ When no configuration is passed to the command, bitfan use the config set in glo
 			Debug:        viper.GetBool("debug"),
 			LogFile:      viper.GetString("log"),
 			DataLocation: viper.GetString("data"),
+			Keystore:     viper.GetString("keystore"),
 			Host:         viper.GetString("host"),
+			LogFormat:    viper.GetString("log-format"),
+			LogRotation: core.LogRotation{
+				MaxSize:    int64(viper.GetInt("log-max-size")) * 1024 * 1024,
+				Every:      viper.GetDuration("log-rotate"),
+				MaxAge:     viper.GetDuration("log-max-age"),
+				MaxBackups: viper.GetInt("log-max-backups"),
+				Compress:   viper.GetBool("log-compress"),
+			},
+			LogPipelinesDir: viper.GetString("log-pipelines-dir"),
+			TLS: tlsconfig.Options{
+				CertFile:     viper.GetString("tls.cert"),
+				KeyFile:      viper.GetString("tls.key"),
+				ClientCAFile: viper.GetString("tls.client-ca"),
+				MinVersion:   viper.GetString("tls.min-version"),
+			},
+			Supervisor: core.SupervisorOptions{
+				MaxAttempts: viper.GetInt("supervisor.max-attempts"),
+				Backoff:     viper.GetDuration("supervisor.backoff"),
+				MaxBackoff:  viper.GetDuration("supervisor.max-backoff"),
+			},
+			DependencyTimeout: viper.GetDuration("dependency-timeout"),
+		}
+
+		var syncer *api.Syncer
+		if viper.GetString("sync.dir") != "" {
+			syncer = api.NewSyncer(viper.GetString("sync.dir"), viper.GetDuration("sync.interval"), viper.GetBool("sync.dry-run"))
 		}
 
 		if !viper.GetBool("no-network") {
-			opt.HttpHandlers = append(opt.HttpHandlers, core.HTTPHandler("/api/v2/", api.Handler("api/v2")))
+			opt.HttpHandlers = append(opt.HttpHandlers, core.HTTPHandler("/api/v2/", api.Handler("api/v2", api.Options{
+				Auth:          viper.GetBool("api.auth"),
+				AdminToken:    viper.GetString("api.admin-token"),
+				CORSOrigins:   viper.GetStringSlice("api.cors-origins"),
+				MaxEventsSize: int64(viper.GetInt("api.max-events-size")) * 1024 * 1024,
+				Syncer:        syncer,
+			})))
 			opt.HttpHandlers = append(opt.HttpHandlers, core.HTTPHandler("/public/",
 				http.StripPrefix("/public/", http.FileServer(http.Dir(viper.GetString("commons")+string(os.PathSeparator)+"public"))),
 			))
@@ -68,6 +106,26 @@ When no configuration is passed to the command, bitfan use the config set in glo
 			}
 		}
 
+		// push based metrics do not need the network listener
+		if viper.IsSet("statsd") {
+			opt.Statsd = viper.GetString("statsd.address")
+			opt.StatsdPrefix = viper.GetString("statsd.prefix")
+		}
+
+		if viper.IsSet("graphite") {
+			opt.Graphite = viper.GetString("graphite.address")
+			opt.GraphitePrefix = viper.GetString("graphite.prefix")
+			opt.GraphiteInterval = viper.GetDuration("graphite.interval")
+		}
+
+		if viper.IsSet("openmetrics") {
+			opt.OpenMetricsFile = viper.GetString("openmetrics.path")
+			if opt.OpenMetricsFile == "" {
+				opt.OpenMetricsFile = filepath.Join(opt.DataLocation, "metrics.prom")
+			}
+			opt.OpenMetricsInterval = viper.GetDuration("openmetrics.interval")
+		}
+
 		os.Setenv("BF_COMMONS_PATH", viper.GetString("commons"))
 		os.Setenv("BF_DATA_PATH", opt.DataLocation)
 		os.Setenv("BF_HTTPD_ADDR", opt.Host)
@@ -80,6 +138,14 @@ When no configuration is passed to the command, bitfan use the config set in glo
 			core.Log().Debugf("ENV %s", v)
 		}
 
+		// Sync stored pipelines with the manifest before starting them
+		if syncer != nil {
+			if _, err := syncer.Sync(syncer.DryRun, false); err != nil {
+				core.Log().Errorf("sync : %v", err)
+			}
+			go syncer.Watch(make(chan struct{}))
+		}
+
 		// Start Pipelines
 
 		// Prepare entrypoints
@@ -97,6 +163,7 @@ When no configuration is passed to the command, bitfan use the config set in glo
 				loc, err = entrypoint.New(entryPointPath, "", entrypoint.CONTENT_REF)
 				loc.PipelineName = p.Label
 				loc.PipelineUuid = p.Uuid
+				loc.DependsOn = p.DependsOn
 				if err != nil {
 					core.Log().Fatalln(err)
 				}
@@ -125,9 +192,28 @@ When no configuration is passed to the command, bitfan use the config set in glo
 			}
 		}
 
+		//	From pipelines manifests
+		manifests := []string{}
+		if viper.GetString("manifest") != "" {
+			manifests = append(manifests, viper.GetString("manifest"))
+		}
+		configs := []string{}
+		for _, v := range args {
+			if ext := filepath.Ext(v); ext == ".yml" || ext == ".yaml" {
+				manifests = append(manifests, v)
+			} else {
+				configs = append(configs, v)
+			}
+		}
+		for _, v := range manifests {
+			if err := addManifestEntrypoints(&entrypoints, v); err != nil {
+				core.Log().Fatalln(err)
+			}
+		}
+
 		//	From args when config > 0
-		if len(args) > 0 {
-			for _, v := range args {
+		if len(configs) > 0 {
+			for _, v := range configs {
 				var loc *entrypoint.Entrypoint
 				var err error
 				loc, err = entrypoint.New(v, cwd, entrypoint.CONTENT_REF)
@@ -142,12 +228,22 @@ When no configuration is passed to the command, bitfan use the config set in glo
 			}
 		}
 
+		ppls := []*core.Pipeline{}
 		for _, ep := range entrypoints.Items {
 			ppl, err := ep.Pipeline()
 			if err != nil {
 				core.Log().Fatalln(err)
 			}
+			ppls = append(ppls, ppl)
+		}
 
+		// pipelines start after the pipelines they depend on
+		ppls, err := core.SortPipelines(ppls)
+		if err != nil {
+			core.Log().Fatalln(err)
+		}
+
+		for _, ppl := range ppls {
 			nUUID, err := ppl.Start()
 			if err != nil {
 				core.Log().Errorf("error: %v", err)
@@ -188,15 +284,69 @@ When no configuration is passed to the command, bitfan use the config set in glo
 	},
 }
 
+// addManifestEntrypoints adds the pipelines of the manifest started with bitfan
+func addManifestEntrypoints(entrypoints *entrypoint.EntrypointList, path string) error {
+	m, err := manifest.Load(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range m.Pipelines {
+		if !p.IsAutoStart() {
+			core.Log().Infof("pipeline %s (%s) not started, auto_start is false", p.Label, p.ID)
+			continue
+		}
+		loc, err := entrypoint.FromManifest(m, p)
+		if err != nil {
+			return err
+		}
+		entrypoints.AddEntrypoint(loc)
+	}
+	return nil
+}
+
 func initRunConfig(cmd *cobra.Command) {
 	viper.BindPFlag("api", cmd.Flags().Lookup("api"))
+	viper.BindPFlag("api.auth", cmd.Flags().Lookup("api.auth"))
+	viper.BindPFlag("api.admin-token", cmd.Flags().Lookup("api.admin-token"))
+	viper.BindPFlag("api.cors-origins", cmd.Flags().Lookup("api.cors-origins"))
+	viper.BindPFlag("api.max-events-size", cmd.Flags().Lookup("api.max-events-size"))
 	viper.BindPFlag("prometheus", cmd.Flags().Lookup("prometheus"))
 	viper.BindPFlag("prometheus.listen", cmd.Flags().Lookup("prometheus.listen"))
 	viper.BindPFlag("prometheus.path", cmd.Flags().Lookup("prometheus.path"))
+	viper.BindPFlag("statsd", cmd.Flags().Lookup("statsd"))
+	viper.BindPFlag("statsd.address", cmd.Flags().Lookup("statsd.address"))
+	viper.BindPFlag("statsd.prefix", cmd.Flags().Lookup("statsd.prefix"))
+	viper.BindPFlag("graphite", cmd.Flags().Lookup("graphite"))
+	viper.BindPFlag("graphite.address", cmd.Flags().Lookup("graphite.address"))
+	viper.BindPFlag("graphite.prefix", cmd.Flags().Lookup("graphite.prefix"))
+	viper.BindPFlag("graphite.interval", cmd.Flags().Lookup("graphite.interval"))
+	viper.BindPFlag("openmetrics", cmd.Flags().Lookup("openmetrics"))
+	viper.BindPFlag("openmetrics.path", cmd.Flags().Lookup("openmetrics.path"))
+	viper.BindPFlag("openmetrics.interval", cmd.Flags().Lookup("openmetrics.interval"))
+	viper.BindPFlag("log-format", cmd.Flags().Lookup("log-format"))
+	viper.BindPFlag("log-max-size", cmd.Flags().Lookup("log-max-size"))
+	viper.BindPFlag("log-rotate", cmd.Flags().Lookup("log-rotate"))
+	viper.BindPFlag("log-max-age", cmd.Flags().Lookup("log-max-age"))
+	viper.BindPFlag("log-max-backups", cmd.Flags().Lookup("log-max-backups"))
+	viper.BindPFlag("log-compress", cmd.Flags().Lookup("log-compress"))
+	viper.BindPFlag("log-pipelines-dir", cmd.Flags().Lookup("log-pipelines-dir"))
+	viper.BindPFlag("supervisor.max-attempts", cmd.Flags().Lookup("supervisor.max-attempts"))
+	viper.BindPFlag("supervisor.backoff", cmd.Flags().Lookup("supervisor.backoff"))
+	viper.BindPFlag("supervisor.max-backoff", cmd.Flags().Lookup("supervisor.max-backoff"))
+	viper.BindPFlag("dependency-timeout", cmd.Flags().Lookup("dependency-timeout"))
+	viper.BindPFlag("tls.cert", cmd.Flags().Lookup("tls.cert"))
+	viper.BindPFlag("tls.key", cmd.Flags().Lookup("tls.key"))
+	viper.BindPFlag("tls.client-ca", cmd.Flags().Lookup("tls.client-ca"))
+	viper.BindPFlag("tls.min-version", cmd.Flags().Lookup("tls.min-version"))
+	viper.BindPFlag("manifest", cmd.Flags().Lookup("manifest"))
+	viper.BindPFlag("sync.dir", cmd.Flags().Lookup("sync.dir"))
+	viper.BindPFlag("sync.interval", cmd.Flags().Lookup("sync.interval"))
+	viper.BindPFlag("sync.dry-run", cmd.Flags().Lookup("sync.dry-run"))
 	viper.BindPFlag("webhook.listen", cmd.Flags().Lookup("webhook.listen"))
 	viper.BindPFlag("host", cmd.Flags().Lookup("host"))
 	viper.BindPFlag("no-network", cmd.Flags().Lookup("no-network"))
 	viper.BindPFlag("data", cmd.Flags().Lookup("data"))
+	viper.BindPFlag("keystore", cmd.Flags().Lookup("keystore"))
 	viper.BindPFlag("commons", cmd.Flags().Lookup("commons"))
 }
 
@@ -204,10 +354,44 @@ func initRunFlags(cmd *cobra.Command) {
 	cmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
 
 	cmd.Flags().Bool("no-network", false, "Disable network (api and webhook)")
+	cmd.Flags().String("tls.cert", "", "Serve api and webhooks over https with this PEM certificate, reloaded on SIGHUP")
+	cmd.Flags().String("tls.key", "", "PEM private key of the tls.cert certificate")
+	cmd.Flags().String("tls.client-ca", "", "Require clients certificates signed by a CA of this PEM file (mutual TLS)")
+	cmd.Flags().String("tls.min-version", "1.2", "Minimum TLS version accepted (1.0, 1.1, 1.2 or 1.3)")
 	cwd, _ := os.Getwd()
 	cmd.Flags().String("data", filepath.Join(cwd, ".bitfan"), "Path to data dir")
+	cmd.Flags().String("keystore", "", "Path of the keystore file, default is bitfan.keystore in the data dir")
 	cmd.Flags().String("commons", filepath.Join(cwd, "commons"), "Path to commons dir, its public directory served as /public/")
 	cmd.Flags().Bool("api", true, "Expose REST Api")
+	cmd.Flags().Bool("api.auth", false, "Require a user's token or basic auth credentials to use the REST Api")
+	cmd.Flags().String("api.admin-token", "", "Token granted the admin role, use it to create the first Api users")
+	cmd.Flags().StringSlice("api.cors-origins", []string{"*"}, "Origins allowed to call the REST Api from a browser")
+	cmd.Flags().Int("api.max-events-size", 10, "Maximum size in MB of the events injected by a REST Api request")
+	cmd.Flags().StringP("manifest", "m", "", "Run the pipelines declared in this pipelines.yml manifest")
+	cmd.Flags().String("sync.dir", "", "Sync stored pipelines with the pipelines.yml manifest of this directory or git working tree")
+	cmd.Flags().Duration("sync.interval", 10*time.Second, "Interval between two syncs with sync.dir, 0 to only sync at start")
+	cmd.Flags().Bool("sync.dry-run", false, "Only report the changes a sync would apply and the drifts, stored pipelines are left untouched")
 	cmd.Flags().Bool("prometheus", false, "Export stats using prometheus output")
 	cmd.Flags().String("prometheus.path", "/metrics", "Expose Prometheus metrics at specified path.")
+	cmd.Flags().Bool("statsd", false, "Push stats to a statsd server (UDP)")
+	cmd.Flags().String("statsd.address", "127.0.0.1:8125", "Address of the statsd server")
+	cmd.Flags().String("statsd.prefix", "bitfan", "Prefix of statsd buckets")
+	cmd.Flags().Bool("graphite", false, "Push stats to a graphite server (TCP)")
+	cmd.Flags().String("graphite.address", "127.0.0.1:2003", "Address of the graphite server")
+	cmd.Flags().String("graphite.prefix", "bitfan", "Prefix of graphite metric paths")
+	cmd.Flags().Duration("graphite.interval", 10*time.Second, "Interval between two pushes to graphite")
+	cmd.Flags().Bool("openmetrics", false, "Write stats to a file using the OpenMetrics text format")
+	cmd.Flags().String("openmetrics.path", "", "Path of the OpenMetrics file, default is metrics.prom in the data dir")
+	cmd.Flags().Duration("openmetrics.interval", 10*time.Second, "Interval between two writes of the OpenMetrics file")
+	cmd.Flags().String("log-format", "text", "Log format, text or json")
+	cmd.Flags().Int("log-max-size", 0, "Rotate log files when they grow over this size in megabytes, 0 to disable")
+	cmd.Flags().Duration("log-rotate", 0, "Rotate log files older than this duration (ie: 24h), 0 to disable")
+	cmd.Flags().Duration("log-max-age", 0, "Remove rotated log files older than this duration, 0 to keep them")
+	cmd.Flags().Int("log-max-backups", 0, "Number of rotated log files to keep, 0 to keep them all")
+	cmd.Flags().Bool("log-compress", false, "Compress rotated log files with gzip")
+	cmd.Flags().String("log-pipelines-dir", "", "Also write logs of each pipeline to pipeline-<uuid>.log files in this directory")
+	cmd.Flags().Int("supervisor.max-attempts", 5, "Restarts in a row of a failed agent or pipeline before giving up, 0 to disable the supervisor")
+	cmd.Flags().Duration("supervisor.backoff", time.Second, "Delay before the first restart, doubled after each attempt")
+	cmd.Flags().Duration("supervisor.max-backoff", 5*time.Minute, "Maximum delay between two restarts")
+	cmd.Flags().Duration("dependency-timeout", 30*time.Second, "Time given to the pipelines a pipeline depends on to be ready before it starts")
 }
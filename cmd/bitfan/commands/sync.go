@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	RootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+	syncCmd.Flags().Bool("dry-run", false, "Only report the changes and the drifts")
+}
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync stored pipelines with the manifest of a running bitfan",
+	Long: `Create, update and delete stored pipelines to match the pipelines.yml manifest
+of the directory set with the sync.dir flag of the running bitfan, running pipelines
+which changed are restarted.
+
+A pipeline with a drift was changed in bitfan since its last sync, the sync overwrites
+these changes, use --dry-run to review them.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		cli := newApiClient(viper.GetString("host"))
+		plan, err := cli.Sync(dryRun)
+		if err != nil {
+			fmt.Printf("sync error: %v\n", err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Printf("source: %s\n", plan.Source)
+		if plan.Revision != "" {
+			fmt.Printf("revision: %s\n", plan.Revision)
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{
+			"UUID",
+			"name",
+			"action",
+			"drift",
+			"details",
+		})
+		for _, c := range plan.Changes {
+			drift := ""
+			if c.Drift {
+				drift = "yes"
+			}
+			table.Append([]string{
+				c.PipelineUUID,
+				c.Label,
+				c.Action,
+				drift,
+				strings.Join(c.Details, "\n"),
+			})
+		}
+		table.SetCenterSeparator("+")
+		table.Render()
+
+		switch {
+		case !plan.Pending():
+			fmt.Println("pipelines are in sync")
+		case plan.Applied:
+			fmt.Println("changes applied")
+		default:
+			fmt.Println("dry run, no change applied")
+		}
+	},
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+func init() {
+	RootCmd.AddCommand(traceCmd)
+	traceCmd.Flags().StringP("host", "H", "127.0.0.1:5123", "Service Host to connect to")
+	traceCmd.Flags().Duration("revert", 0, "Restore the previous state after this duration, as 10m")
+}
+
+// traceCmd represents the trace command
+var traceCmd = &cobra.Command{
+	Use:   "trace [pipelineUUID] [agentID] [on|off]",
+	Short: "Toggle the trace of the events of an agent of a running pipeline",
+	Long: `Toggle the trace of the events an agent of a running pipeline receives and
+sends, without restarting the pipeline. Traces are logged at the info level.
+
+The id of the agent is given by bitfan graph [pipelineUUID] --format=json
+
+  bitfan trace 3f9d5fcc-... 2 on --revert 10m`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 3 || (args[2] != "on" && args[2] != "off") {
+			cmd.Help()
+			os.Exit(1)
+		}
+		agentID, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "trace error: invalid agent id %s\n", args[1])
+			os.Exit(1)
+		}
+
+		revert, _ := cmd.Flags().GetDuration("revert")
+		data := &models.Trace{Trace: args[2] == "on"}
+		if revert > 0 {
+			data.RevertAfter = revert.String()
+		}
+		if err := newApiClient(viper.GetString("host")).SetTrace(args[0], agentID, data); err != nil {
+			fmt.Fprintf(os.Stderr, "trace error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("trace %s for agent %d of pipeline %s\n", args[2], agentID, args[0])
+	},
+}
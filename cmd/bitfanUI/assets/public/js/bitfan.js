@@ -39,7 +39,7 @@ $(document).ready(function () {
   return false;
   };
 
-  $('#pipeline-actions button[href]').click(function() {
+  $('#pipeline-actions button[href], #pipeline-pause-actions button[href]').click(function() {
     if ($(this).hasClass('disabled')) {
         return false;
     }    
@@ -13,7 +13,7 @@ $(document).ready(function() {
             var uuid = $(this).attr("uuid")
             $.ajax({
                 type: 'delete',
-                url: 'http://' + baseApiHost + '/api/v2/env/' + uuid,
+                url: '/api/v2/env/' + uuid,
                 success: function(output) {
                     console.log("#env-" + uuid);
                     $("#env-" + uuid).remove()
@@ -36,7 +36,7 @@ $(document).ready(function() {
         type: 'get',
         // url: window.location.href,
         // data: JSON.stringify(sendData),
-        url: 'http://' + baseApiHost + '/api/v2/env',
+        url: '/api/v2/env',
         success: function(envVars) {
             console.log(envVars);
             $.each(envVars, function(i, obj) {
@@ -71,7 +71,7 @@ $(document).ready(function() {
     $("#add_env").submit(function(e) {
         // values = $(this).serializeArray()
         // console.log(values);
-        console.log('http://' + baseApiHost + '/api/v2/env');
+        console.log('/api/v2/env');
 
         var name = $(this).find('input[name="name"]').val()
         var value = $(this).find('input[name="value"]').val()
@@ -83,7 +83,7 @@ $(document).ready(function() {
             data: 'json',
             // url: window.location.href,
             data: JSON.stringify(sendData),
-            url: 'http://' + baseApiHost + '/api/v2/env',
+            url: '/api/v2/env',
             beforeSend: function() {
                 $(e.target).attr("disabled", true)
                 $(e.target).children().attr("disabled", true)
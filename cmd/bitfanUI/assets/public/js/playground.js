@@ -93,7 +93,7 @@ function bitfanProcessorListptions(c) {
         type: 'GET',
         dataType: "json",
         processData: false,
-        url: 'http://' + baseApiHost + '/api/v2/docs/processors/' + c.selected[1],
+        url: '/api/v2/docs/processors/' + c.selected[1],
         success: function(processor_doc) {
             var items = []
             let proc = processor_doc[c.selected[1]]
@@ -236,7 +236,7 @@ function bitfanProcessorInsertTemplate(c) {
         type: 'GET',
         dataType: "json",
         processData: false,
-        url: 'http://' + baseApiHost + '/api/v2/docs/processors/' + c.selected[1],
+        url: '/api/v2/docs/processors/' + c.selected[1],
         success: function(processor_doc) {
             var items = []
             let key = c.selected[1]
@@ -306,7 +306,7 @@ $(document).ready(function() {
             type: 'GET',
             dataType: "json",
             processData: false,
-            url: 'http://' + baseApiHost + '/api/v2/assets/' + contentUUID,
+            url: '/api/v2/assets/' + contentUUID,
             success: function(asset) {
                 testingAsset = asset
                 // console.log(testingAsset)
@@ -345,7 +345,7 @@ $(document).ready(function() {
         type: 'GET',
         dataType: "json",
         processData: false,
-        url: 'http://' + baseApiHost + '/api/v2/docs/processors',
+        url: '/api/v2/docs/processors',
         success: function(processors_docs) {
             for (var key in processors_docs) {
                 var labelStr = "doc filter " + key
@@ -518,7 +518,8 @@ $(document).ready(function() {
     // LOGS
     // #########
     // When page loaded Then connect to the logs websocke
-    var websocketLOGS = new WebSocket("ws://" + baseApiHost + "/api/v2/logs");
+    var logsURI = proxyWsBase + "/api/v2/logs";
+    var websocketLOGS = new WebSocket(logsURI);
     websocketLOGS.onopen = function(event) {
         // console.log("LOGS : Connection established! ");
     }
@@ -596,6 +597,10 @@ $(document).ready(function() {
         if ($(this).attr("id") == "playground-play" || $(this).attr("id") == "playground-replay") {
             play();
         }
+
+        if ($(this).attr("id") == "playground-debug") {
+            debug();
+        }
     });
 
     $('#play-options-autostart').change(function() {
@@ -635,7 +640,7 @@ output{`+output_value+`}`
             type: 'patch',
             contentType: "application/json; charset=utf-8",
             data: JSON.stringify(sendData),
-            url: 'http://' + baseApiHost + '/api/v2/assets/'+assetUUID,
+            url: '/api/v2/assets/'+assetUUID,
             beforeSend: function() {
                 $(e.target).attr("disabled", true)
             },
@@ -722,7 +727,7 @@ function play() {
             playErrorReset();
 
             if (settings.wsout != "") {
-                new_uri = "ws://" + settings.apiHost + settings.wsout;
+                new_uri = baseWsScheme + "://" + settings.apiHost + settings.wsout;
                 websocketOUT = new WebSocket(new_uri);
                 websocketOUT.onopen = function(event) {
                     // console.log("Connection is established!");
@@ -742,7 +747,7 @@ function play() {
             }
 
             if (settings.wsin != "") {
-                new_uri = "ws://" + settings.apiHost + settings.wsin;
+                new_uri = baseWsScheme + "://" + settings.apiHost + settings.wsin;
                 websocketIN = new WebSocket(new_uri);
                 websocketIN.onopen = function(event) {
                     websocketIN.send(dataObject.input_value);
@@ -764,6 +769,96 @@ function play() {
 
 
 
+// debug runs the raw input event through the filters and lists the event
+// after each of them
+function debug() {
+    var dataObject = {
+        'input_value': $("#section-input-raw").val(),
+        'input_codec': $("#section-input-codec").val(),
+        'filter_value': $("#section-filter-configuration").val(),
+    };
+
+    $.ajax({
+        type: 'POST',
+        contentType: "application/json; charset=utf-8",
+        data: JSON.stringify(dataObject),
+        dataType: 'json',
+        url: window.location.pathname + "/debug",
+        success: function(report) {
+            renderDebugReport(report);
+            $('a[href="#pills-output-debug"]').tab('show');
+        },
+        error: function(output) {
+            playError(output.responseJSON);
+            return false;
+        }
+    });
+}
+
+function renderDebugReport(report) {
+    var list = $("#debug-steps").empty();
+    var annotations = [];
+    // lines of the report are the ones of the filter editor content
+    var firstLine = editorFilter.getOption("firstLineNumber");
+
+    $.each(report.steps, function(i, step) {
+        var item = $('<li class="debug-step">');
+        var header = $('<div class="debug-step-header">').appendTo(item);
+        header.append($('<strong>').text("#" + step.step + " " + step.label));
+        if (step.type != step.label) {
+            header.append(" (" + step.type + ")");
+        }
+        if (step.line > 0) {
+            header.append($('<span class="debug-line">').text("line " + (firstLine + step.line - 1)));
+        }
+        if (step.parent > 0) {
+            header.append($('<span class="debug-line">').text("after #" + step.parent));
+        }
+        if (step.error) {
+            item.addClass("error");
+            item.append($('<div class="debug-error">').text(step.error));
+            if (step.line > 0) {
+                annotations.push({ row: step.line - 1, column: 0, text: step.error, type: "error" });
+            }
+        }
+        if (step.dropped) {
+            item.append($('<div class="debug-dropped">').text("event dropped"));
+        }
+
+        $.each(step.outputs, function(j, output) {
+            var out = $('<div class="debug-output">').appendTo(item);
+            if (output.branch) {
+                out.append($('<div class="debug-branch">').text("\u2192 " + output.branch));
+            }
+            var changes = $('<ul class="debug-changes">').appendTo(out);
+            $.each(output.changes || [], function(k, change) {
+                var text = change.field;
+                if (change.kind == "added") {
+                    text = "+ " + text + " = " + JSON.stringify(change.new);
+                } else if (change.kind == "removed") {
+                    text = "- " + text;
+                } else {
+                    text = "~ " + text + " : " + JSON.stringify(change.old) + " \u2192 " + JSON.stringify(change.new);
+                }
+                changes.append($('<li>').addClass(change.kind).text(text));
+            });
+            $.each(output.tags_added || [], function(k, tag) {
+                changes.append($('<li class="added">').text("+ tag " + tag));
+            });
+            $.each(output.tags_removed || [], function(k, tag) {
+                changes.append($('<li class="removed">').text("- tag " + tag));
+            });
+            out.append($('<pre class="debug-event bitfan-packet">').html(syntaxHighlight(output.event)));
+        });
+        list.append(item);
+    });
+
+    if (report.truncated) {
+        list.append($('<li class="debug-step error">').text("too many steps, the report is truncated"));
+    }
+    editorFilter.getSession().setAnnotations(annotations);
+}
+
 function playErrorReset() {
 
     $('#playground-play').hide();
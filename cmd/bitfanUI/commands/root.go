@@ -7,7 +7,9 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/vjeantet/bitfan/api/client"
 	"github.com/vjeantet/bitfan/cmd/bitfanUI/server"
+	"github.com/vjeantet/bitfan/commons/tlsconfig"
 )
 
 var cfgFile string
@@ -21,19 +23,75 @@ var RootCmd = &cobra.Command{
 		viper.BindPFlag("dev", cmd.Flags().Lookup("dev"))
 		viper.BindPFlag("host", cmd.Flags().Lookup("host"))
 		viper.BindPFlag("api", cmd.Flags().Lookup("api"))
+		viper.BindPFlag("api-token", cmd.Flags().Lookup("api-token"))
+		viper.BindPFlag("api-user", cmd.Flags().Lookup("api-user"))
+		viper.BindPFlag("api-password", cmd.Flags().Lookup("api-password"))
+		viper.BindPFlag("api-ca", cmd.Flags().Lookup("api-ca"))
+		viper.BindPFlag("api-cert", cmd.Flags().Lookup("api-cert"))
+		viper.BindPFlag("api-key", cmd.Flags().Lookup("api-key"))
+		viper.BindPFlag("tls.cert", cmd.Flags().Lookup("tls.cert"))
+		viper.BindPFlag("tls.key", cmd.Flags().Lookup("tls.key"))
+		viper.BindPFlag("tls.client-ca", cmd.Flags().Lookup("tls.client-ca"))
+		viper.BindPFlag("tls.min-version", cmd.Flags().Lookup("tls.min-version"))
 	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
+		apiTLS, err := tlsconfig.Client(tlsconfig.ClientOptions{
+			CAFile:   viper.GetString("api-ca"),
+			CertFile: viper.GetString("api-cert"),
+			KeyFile:  viper.GetString("api-key"),
+		})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
 		httpServerMux := http.NewServeMux()
 		httpServerMux.Handle("/", server.Handler(
 			viper.GetString("api"),
+			client.Credentials{
+				Token:    viper.GetString("api-token"),
+				Username: viper.GetString("api-user"),
+				Password: viper.GetString("api-password"),
+			},
+			apiTLS,
 			viper.GetBool("dev"),
 		))
 
 		addr := viper.GetString("host")
-		fmt.Printf("serving on http://%s\n", addr)
-		http.ListenAndServe(addr, httpServerMux)
+		tlsOpt := tlsconfig.Options{
+			CertFile:     viper.GetString("tls.cert"),
+			KeyFile:      viper.GetString("tls.key"),
+			ClientCAFile: viper.GetString("tls.client-ca"),
+			MinVersion:   viper.GetString("tls.min-version"),
+		}
+		if !tlsOpt.Enabled() {
+			fmt.Printf("serving on http://%s\n", addr)
+			http.ListenAndServe(addr, httpServerMux)
+			return
+		}
+
+		certs, err := tlsconfig.New(tlsOpt)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		certs.ReloadOnSIGHUP(func(err error) {
+			if err != nil {
+				fmt.Printf("TLS certificates not reloaded : %v\n", err)
+				return
+			}
+			fmt.Println("TLS certificates reloaded")
+		})
+
+		server := &http.Server{
+			Addr:      addr,
+			Handler:   httpServerMux,
+			TLSConfig: certs.Config(),
+		}
+		fmt.Printf("serving on https://%s\n", addr)
+		fmt.Println(server.ListenAndServeTLS("", ""))
 	},
 }
 
@@ -59,7 +117,17 @@ func init() {
 
 	RootCmd.PersistentFlags().Bool("dev", false, "dev mode (serve asset and templates from disk")
 	RootCmd.PersistentFlags().StringP("host", "H", "127.0.0.1:8081", "Serve UI on Host")
-	RootCmd.PersistentFlags().StringP("api", "a", "127.0.0.1:5123", "Bitfan API to connect to")
+	RootCmd.PersistentFlags().StringP("api", "a", "127.0.0.1:5123", "Bitfan API to connect to, prefix it with https:// when the API is served over TLS")
+	RootCmd.PersistentFlags().String("api-token", "", "Token used to authenticate to the Bitfan API")
+	RootCmd.PersistentFlags().String("api-user", "", "User used to authenticate to the Bitfan API")
+	RootCmd.PersistentFlags().String("api-password", "", "Password of the api-user")
+	RootCmd.PersistentFlags().String("api-ca", "", "PEM CAs verifying the certificate of the Bitfan API, system CAs by default")
+	RootCmd.PersistentFlags().String("api-cert", "", "PEM client certificate presented to a Bitfan API requiring mutual TLS")
+	RootCmd.PersistentFlags().String("api-key", "", "PEM private key of the api-cert certificate")
+	RootCmd.PersistentFlags().String("tls.cert", "", "Serve the UI over https with this PEM certificate, reloaded on SIGHUP")
+	RootCmd.PersistentFlags().String("tls.key", "", "PEM private key of the tls.cert certificate")
+	RootCmd.PersistentFlags().String("tls.client-ca", "", "Require clients certificates signed by a CA of this PEM file (mutual TLS)")
+	RootCmd.PersistentFlags().String("tls.min-version", "1.2", "Minimum TLS version accepted (1.0, 1.1, 1.2 or 1.3)")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"log"
 
 	"github.com/gin-gonic/gin"
@@ -132,3 +133,34 @@ func playgroundsPlayDo(c *gin.Context) {
 		"wsout": wsout,
 	}))
 }
+
+// playgroundsDebug runs the raw input event through the filters, step by step
+func playgroundsDebug(c *gin.Context) {
+	pgReq := playgroundRequest{}
+	if err := c.BindJSON(&pgReq); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+
+	event := map[string]interface{}{}
+	if pgReq.InputCodec == "json" {
+		if err := json.Unmarshal([]byte(pgReq.InputValue), &event); err != nil {
+			c.JSON(400, "input is not a json event : "+err.Error())
+			return
+		}
+	} else {
+		event["message"] = pgReq.InputValue
+	}
+
+	report, err := apiClient.Debug(&models.DebugRequest{
+		Filter:       pgReq.FilterValue,
+		Event:        event,
+		PipelineUUID: c.Param("id"),
+	})
+	if err != nil {
+		c.JSON(400, err.Error())
+		log.Printf("error : %v\n", err)
+		return
+	}
+	c.JSON(200, report)
+}
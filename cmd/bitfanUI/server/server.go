@@ -2,13 +2,17 @@ package server
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httputil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	assetfs "github.com/elazarl/go-bindata-assetfs"
@@ -21,14 +25,18 @@ import (
 
 var apiClient *client.RestClient
 var apiBaseUrl string
+var apiCredentials client.Credentials
+var apiTLS *tls.Config
 
 func init() {
 	gin.SetMode(gin.ReleaseMode)
 }
 
-func Handler(baseURL string, debug bool) http.Handler {
+func Handler(baseURL string, credentials client.Credentials, tlsConf *tls.Config, debug bool) http.Handler {
 	apiBaseUrl = baseURL
-	apiClient = client.New(apiBaseUrl)
+	apiCredentials = credentials
+	apiTLS = tlsConf
+	apiClient = client.New(apiBaseUrl).WithCredentials(apiCredentials).WithTLS(apiTLS)
 
 	r := gin.New()
 	render := NewRender()
@@ -108,9 +116,16 @@ func Handler(baseURL string, debug bool) http.Handler {
 	r.GET("/pipelines/:id/restart", startPipeline)
 	// Stop pipeline
 	r.GET("/pipelines/:id/stop", stopPipeline)
+	// Pause / Resume the inputs of a pipeline
+	r.GET("/pipelines/:id/pause", pausePipeline)
+	r.GET("/pipelines/:id/resume", resumePipeline)
 
 	// Delete asset
 	r.GET("/pipelines/:id/delete", deletePipeline)
+	// Pipeline history
+	r.GET("/pipelines/:id/history", getPipelineHistory)
+	// Rollback pipeline
+	r.POST("/pipelines/:id/history/:number/rollback", rollbackPipeline)
 	// Show asset
 	r.GET("/pipelines/:id/assets/:assetID", showAsset)
 	// Create asset
@@ -128,15 +143,20 @@ func Handler(baseURL string, debug bool) http.Handler {
 	r.GET("/pipelines/:id/play", playgroundPipeline)
 	r.PUT("/pipelines/:id/play", playgroundsPlayDo)
 	r.DELETE("/pipelines/:id/play", playgroundsPlayExit)
+	r.POST("/pipelines/:id/play/debug", playgroundsDebug)
 
 	// Playgrounds
 	r.GET("/playgrounds/play", playgroundsPlay)
 	r.PUT("/playgrounds/play", playgroundsPlayDo)
 	r.DELETE("/playgrounds/play", playgroundsPlayExit)
+	r.POST("/playgrounds/play/debug", playgroundsDebug)
 
 	// Replace asset
 	r.PUT("/settings/api", changeBitfanApiURL)
 
+	// API calls of the browser
+	r.Any("/api/v2/*path", apiProxy)
+
 	return r
 }
 
@@ -157,24 +177,65 @@ func changeBitfanApiURL(c *gin.Context) {
 		return
 	}
 
+	// keep the current scheme when none is given
+	if scheme, _ := splitApiBaseUrl(); !strings.Contains(newURL, "://") && scheme == "https" {
+		newURL = "https://" + newURL
+	}
+
 	apiBaseUrl = newURL
-	apiClient = client.New(apiBaseUrl)
+	apiClient = client.New(apiBaseUrl).WithCredentials(apiCredentials).WithTLS(apiTLS)
 	c.JSON(200, values)
 }
 
 func withCommonValues(c *gin.Context, h gin.H) gin.H {
 	session := sessions.Get(c)
-	h["apiHost"] = apiBaseUrl
+	h["apiScheme"], h["apiHost"] = splitApiBaseUrl()
 	h["flashes"] = session.Flashes()
 	session.Save()
 	return h
 }
 
+// splitApiBaseUrl returns the scheme and the host:port of the API
+func splitApiBaseUrl() (string, string) {
+	if i := strings.Index(apiBaseUrl, "://"); i >= 0 {
+		return apiBaseUrl[:i], strings.TrimSuffix(apiBaseUrl[i+3:], "/")
+	}
+	return "http", apiBaseUrl
+}
+
+// apiProxy forwards the API calls of the browser, websockets included, with
+// the credentials of bitfanUI : they never reach the browser
+func apiProxy(c *gin.Context) {
+	scheme, host := splitApiBaseUrl()
+	proxy := &httputil.ReverseProxy{
+		Transport: apiClient.Transport(),
+		Director: func(r *http.Request) {
+			r.URL.Scheme = scheme
+			r.URL.Host = host
+			r.Host = host
+			r.Header.Del("Cookie")
+			r.Header.Del("Authorization")
+			if auth := apiAuthorization(); auth != "" {
+				r.Header.Set("Authorization", auth)
+			}
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// apiAuthorization returns the Authorization header bitfanUI sends to the API
+func apiAuthorization() string {
+	if apiCredentials.Token != "" {
+		return "Bearer " + apiCredentials.Token
+	}
+	if apiCredentials.Username != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(apiCredentials.Username+":"+apiCredentials.Password))
+	}
+	return ""
+}
+
 func getLogs(c *gin.Context) {
-	// TODO : proxy WS:// github.com/koding/websocketproxy
-	c.HTML(200, "logs/logs", withCommonValues(c, gin.H{
-		"bitfanHost": apiBaseUrl,
-	}))
+	c.HTML(200, "logs/logs", withCommonValues(c, gin.H{}))
 }
 
 func getEnv(c *gin.Context) {
@@ -314,9 +375,13 @@ func editPipeline(c *gin.Context) {
 	id := c.Param("id")
 
 	p, _ := apiClient.Pipeline(id)
+	// agents of the pipeline as a mermaid flowchart, with their events when running
+	graph, err := apiClient.PipelineGraph(id, "mermaid", p.Active)
 
 	c.HTML(200, "pipelines/edit", withCommonValues(c, gin.H{
-		"pipeline": p,
+		"pipeline":   p,
+		"graph":      string(graph),
+		"graphError": err,
 	}))
 
 }
@@ -389,6 +454,30 @@ func stopPipeline(c *gin.Context) {
 	}
 }
 
+func pausePipeline(c *gin.Context) {
+	pipelineUUID := c.Param("id")
+
+	pipeline, err := apiClient.PausePipeline(pipelineUUID)
+	if err != nil {
+		c.JSON(500, err.Error())
+		log.Printf("error : %v\n", err)
+	} else {
+		c.JSON(200, pipeline)
+	}
+}
+
+func resumePipeline(c *gin.Context) {
+	pipelineUUID := c.Param("id")
+
+	pipeline, err := apiClient.ResumePipeline(pipelineUUID)
+	if err != nil {
+		c.JSON(500, err.Error())
+		log.Printf("error : %v\n", err)
+	} else {
+		c.JSON(200, pipeline)
+	}
+}
+
 func deletePipeline(c *gin.Context) {
 	pipelineUUID := c.Param("id")
 
@@ -403,6 +492,84 @@ func deletePipeline(c *gin.Context) {
 	c.Redirect(302, "/pipelines")
 }
 
+// diffLine is a line of an unified diff, Class is "file", "hunk", "add", "del" or ""
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+func diffLines(diff string) []diffLine {
+	lines := []diffLine{}
+	for _, l := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		class := ""
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			class = "file"
+		case strings.HasPrefix(l, "@@"):
+			class = "hunk"
+		case strings.HasPrefix(l, "+"):
+			class = "add"
+		case strings.HasPrefix(l, "-"):
+			class = "del"
+		}
+		lines = append(lines, diffLine{Class: class, Text: l})
+	}
+	return lines
+}
+
+func getPipelineHistory(c *gin.Context) {
+	pipelineUUID := c.Param("id")
+
+	p, _ := apiClient.Pipeline(pipelineUUID)
+	versions, err := apiClient.PipelineVersions(pipelineUUID)
+
+	// show the changes of the selected version, the latest by default
+	number, _ := strconv.Atoi(c.Query("version"))
+	if number == 0 && len(versions) > 0 {
+		number = versions[0].Number
+	}
+
+	changes := []gin.H{}
+	if err == nil && number > 0 {
+		var diff *models.VersionDiff
+		diff, err = apiClient.PipelineDiff(pipelineUUID, number-1, number)
+		if err == nil {
+			for _, a := range diff.Assets {
+				if a.Status == models.DIFF_UNCHANGED {
+					continue
+				}
+				changes = append(changes, gin.H{
+					"asset": a,
+					"lines": diffLines(a.Diff),
+				})
+			}
+		}
+	}
+
+	c.HTML(200, "pipelines/history", withCommonValues(c, gin.H{
+		"pipeline": p,
+		"versions": versions,
+		"number":   number,
+		"changes":  changes,
+		"error":    err,
+	}))
+}
+
+func rollbackPipeline(c *gin.Context) {
+	c.Request.ParseForm()
+	pipelineUUID := c.Param("id")
+	number, _ := strconv.Atoi(c.Param("number"))
+	_, restart := c.Request.PostForm["restart"]
+
+	_, err := apiClient.RollbackPipeline(pipelineUUID, number, restart)
+	if err != nil {
+		flash(c, fmt.Sprintf("Rollback to version %d failed : %v", number, err))
+	} else {
+		flash(c, fmt.Sprintf("Pipeline rolled back to version %d", number))
+	}
+	c.Redirect(302, fmt.Sprintf("/pipelines/%s/history", pipelineUUID))
+}
+
 func createAsset(c *gin.Context) {
 	pipelineUUID := c.Param("id")
 	file, header, err := c.Request.FormFile("file")
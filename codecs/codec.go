@@ -13,10 +13,30 @@ import (
 	"github.com/vjeantet/bitfan/codecs/rubydebug"
 	"github.com/vjeantet/bitfan/codecs/w3c"
 	"github.com/vjeantet/bitfan/commons"
+	"github.com/vjeantet/bitfan/processors/doc"
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/ianaindex"
 )
 
+// Docs returns the docs of the codecs by name, pp is an alias of rubydebug
+func Docs() map[string]*doc.Codec {
+	docs := map[string]*doc.Codec{
+		"csv":        csvcodec.Doc(),
+		"json":       jsoncodec.Doc(),
+		"json_lines": jsonlinescodec.Doc(),
+		"line":       linecodec.Doc(),
+		"multiline":  multilinecodec.Doc(),
+		"plain":      plaincodec.Doc(),
+		"pp":         rubydebugcodec.Doc(),
+		"rubydebug":  rubydebugcodec.Doc(),
+		"w3c":        w3ccodec.Doc(),
+	}
+	for name, d := range docs {
+		d.Name = name
+	}
+	return docs
+}
+
 type CodecCollection struct {
 	Default *Codec
 	Enc     *Codec
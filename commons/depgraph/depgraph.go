@@ -0,0 +1,71 @@
+// Package depgraph orders items, pipelines for example, after the items they
+// depend on and detects dependency cycles.
+package depgraph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CycleError is returned when items depend on each other
+type CycleError struct {
+	// Path is the cycle, its first and last ids are the same
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle %s", strings.Join(e.Path, " -> "))
+}
+
+// Sort returns the ids, each one after the ids it depends on. Dependencies
+// which are not in ids are ignored, ids keep their order when they do not
+// depend on each other
+func Sort(ids []string, deps map[string][]string) ([]string, error) {
+	known := map[string]bool{}
+	for _, id := range ids {
+		known[id] = true
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	sorted := make([]string, 0, len(ids))
+	path := []string{}
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case done:
+			return nil
+		case visiting:
+			for i, p := range path {
+				if p == id {
+					return &CycleError{Path: append(append([]string{}, path[i:]...), id)}
+				}
+			}
+		}
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range deps[id] {
+			if !known[dep] {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = done
+		sorted = append(sorted, id)
+		return nil
+	}
+
+	for _, id := range ids {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
@@ -0,0 +1,45 @@
+package depgraph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSort(t *testing.T) {
+	sorted, err := Sort([]string{"web", "mail", "archive"}, map[string][]string{
+		"web":  {"archive"},
+		"mail": {"archive", "web"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"archive", "web", "mail"}, sorted)
+}
+
+func TestSortKeepsOrder(t *testing.T) {
+	sorted, err := Sort([]string{"c", "a", "b"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "a", "b"}, sorted)
+}
+
+func TestSortIgnoresUnknownDependencies(t *testing.T) {
+	sorted, err := Sort([]string{"web"}, map[string][]string{"web": {"elsewhere"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web"}, sorted)
+}
+
+func TestSortCycle(t *testing.T) {
+	_, err := Sort([]string{"a", "b", "c"}, map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"b"},
+	})
+	assert.EqualError(t, err, "dependency cycle b -> c -> b")
+	if assert.IsType(t, &CycleError{}, err) {
+		assert.Equal(t, []string{"b", "c", "b"}, err.(*CycleError).Path)
+	}
+}
+
+func TestSortSelfDependency(t *testing.T) {
+	_, err := Sort([]string{"a"}, map[string][]string{"a": {"a"}})
+	assert.EqualError(t, err, "dependency cycle a -> a")
+}
@@ -0,0 +1,282 @@
+// Package expression compiles and evaluates the expressions of the when, route
+// and eval processors with the same semantics and function library.
+//
+// Fields are referenced as [field] or [parent.child], [list.0] is the first
+// element of a list. A missing or null field is false in operations, so
+// ! [field] is true and [field] == 1 is false. A field given as a whole
+// argument of a function is passed as is, a missing or null field is nil :
+// exists([field]), is_null([field]) and coalesce([field], 'default') test it
+// explicitly.
+package expression
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"golang.org/x/sync/syncmap"
+	"gopkg.in/Knetic/govaluate.v3"
+)
+
+// rawPrefix marks the variables whose missing value is nil instead of false
+const rawPrefix = "\x00raw:"
+
+// LINES_OPTION is the processor option the pipeline builder sets with the
+// configuration lines of the expressions, by expression key
+const LINES_OPTION = "expression_lines"
+
+// compiled expressions by source, shared by all processors
+var cache = &syncmap.Map{}
+
+// Expression is a compiled expression and the configuration line it comes from
+type Expression struct {
+	Source string
+	// Line is the line of the expression in its configuration, 0 when unknown
+	Line int
+
+	compiled *govaluate.EvaluableExpression
+}
+
+// Error is a syntax or evaluation error of an expression
+type Error struct {
+	Line       int
+	Expression string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d : expression `%s` : %v", e.Line, e.Expression, e.Err)
+	}
+	return fmt.Sprintf("expression `%s` : %v", e.Expression, e.Err)
+}
+
+// Compile returns the expression written at line of a configuration, an
+// expression is parsed once whatever the processor using it
+func Compile(source string, line int) (*Expression, error) {
+	if compiled, ok := cache.Load(source); ok {
+		return &Expression{Source: source, Line: line, compiled: compiled.(*govaluate.EvaluableExpression)}, nil
+	}
+
+	if strings.TrimSpace(source) == "" {
+		return nil, &Error{Line: line, Expression: source, Err: fmt.Errorf("empty expression")}
+	}
+	parsed, err := govaluate.NewEvaluableExpressionWithFunctions(source, functions)
+	if err != nil {
+		return nil, &Error{Line: line, Expression: source, Err: err}
+	}
+	compiled, err := govaluate.NewEvaluableExpressionFromTokens(markRawVariables(parsed.Tokens()))
+	if err != nil {
+		return nil, &Error{Line: line, Expression: source, Err: err}
+	}
+
+	cache.Store(source, compiled)
+	return &Expression{Source: source, Line: line, compiled: compiled}, nil
+}
+
+// Lines removes the lines of expressions from a processor configuration and
+// returns them by expression key
+func Lines(conf map[string]interface{}) map[string]int {
+	lines := map[string]int{}
+	switch v := conf[LINES_OPTION].(type) {
+	case map[string]int:
+		lines = v
+	case map[string]interface{}:
+		for k, l := range v {
+			lines[k] = cast.ToInt(l)
+		}
+	}
+	delete(conf, LINES_OPTION)
+	return lines
+}
+
+// markRawVariables renames the variables given as a whole argument of a
+// function, they get nil when the field is missing
+func markRawVariables(tokens []govaluate.ExpressionToken) []govaluate.ExpressionToken {
+	marked := make([]govaluate.ExpressionToken, len(tokens))
+	copy(marked, tokens)
+
+	// for each opened clause, is it the arguments of a function
+	clauses := []bool{}
+	for i, token := range marked {
+		switch token.Kind {
+		case govaluate.CLAUSE:
+			clauses = append(clauses, i > 0 && marked[i-1].Kind == govaluate.FUNCTION)
+		case govaluate.CLAUSE_CLOSE:
+			if len(clauses) > 0 {
+				clauses = clauses[:len(clauses)-1]
+			}
+		case govaluate.VARIABLE:
+			if len(clauses) == 0 || !clauses[len(clauses)-1] {
+				continue
+			}
+			before, after := marked[i-1].Kind, govaluate.CLAUSE_CLOSE
+			if i+1 < len(marked) {
+				after = marked[i+1].Kind
+			}
+			if (before == govaluate.CLAUSE || before == govaluate.SEPARATOR) &&
+				(after == govaluate.CLAUSE_CLOSE || after == govaluate.SEPARATOR) {
+				marked[i].Value = rawPrefix + token.Value.(string)
+			}
+		}
+	}
+	return marked
+}
+
+// Eval returns the value of the expression for the fields of an event
+func (x *Expression) Eval(fields map[string]interface{}) (interface{}, error) {
+	value, err := x.compiled.Eval(parameters(fields))
+	if err != nil {
+		return nil, &Error{Line: x.Line, Expression: x.Source, Err: err}
+	}
+	if list, ok := value.(List); ok {
+		return []interface{}(list), nil
+	}
+	return value, nil
+}
+
+// Bool returns the truth of the expression, only false and nil values are
+// false
+func (x *Expression) Bool(fields map[string]interface{}) (bool, error) {
+	value, err := x.Eval(fields)
+	if err != nil {
+		return false, err
+	}
+	return truth(value), nil
+}
+
+func truth(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	return true
+}
+
+// Vars returns the fields used by the expression
+func (x *Expression) Vars() []string {
+	vars := []string{}
+	for _, v := range x.compiled.Vars() {
+		vars = append(vars, strings.TrimPrefix(v, rawPrefix))
+	}
+	return vars
+}
+
+// parameters resolves the variables of an expression from the fields of an
+// event
+type parameters map[string]interface{}
+
+func (p parameters) Get(name string) (interface{}, error) {
+	raw := strings.HasPrefix(name, rawPrefix)
+	value, found := Lookup(p, strings.TrimPrefix(name, rawPrefix))
+	if !found || value == nil {
+		if raw {
+			return nil, nil
+		}
+		return false, nil
+	}
+	value = normalize(value)
+	if list, ok := value.([]interface{}); ok && raw {
+		return List(list), nil
+	}
+	return value, nil
+}
+
+// List is a list given as a whole argument of a function, govaluate spreads
+// []interface{} values into the arguments of functions
+type List []interface{}
+
+// Lookup returns the value of a field by its path, parent.child, a numeric
+// part of the path is the index of an element in a list
+func Lookup(fields map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = fields
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		default:
+			index, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, false
+			}
+			rv := reflect.ValueOf(value)
+			if rv.Kind() != reflect.Slice || index < 0 || index >= rv.Len() {
+				return nil, false
+			}
+			value = rv.Index(index).Interface()
+		}
+		// mxj.Map and other named maps
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+			if _, ok := value.(map[string]interface{}); !ok {
+				value = toMap(rv)
+			}
+		}
+	}
+	return value, true
+}
+
+func toMap(rv reflect.Value) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, k := range rv.MapKeys() {
+		m[k.String()] = rv.MapIndex(k).Interface()
+	}
+	return m
+}
+
+// normalize converts values to the types handled by the expressions : numbers
+// are float64, lists are []interface{} and times are unix timestamps in seconds
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return float64(v.UnixNano()) / 1e9
+	case List:
+		return []interface{}(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = normalize(e)
+		}
+		return list
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice {
+		list := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			list[i] = normalize(rv.Index(i).Interface())
+		}
+		return list
+	}
+	return value
+}
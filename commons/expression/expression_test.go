@@ -0,0 +1,168 @@
+package expression
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clbanning/mxj"
+	"github.com/stretchr/testify/assert"
+)
+
+func testFields() map[string]interface{} {
+	return map[string]interface{}{
+		"message": "GET /index.html 200",
+		"status":  200,
+		"ratio":   float32(0.5),
+		"empty":   "",
+		"null":    nil,
+		"ok":      true,
+		"ip":      "10.1.2.3",
+		"tags":    []string{"web", "_grokparsefailure"},
+		"hosts":   []interface{}{"a", "b", "c"},
+		"date":    time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		"user":    mxj.Map{"name": "Bob", "roles": []interface{}{"admin"}},
+	}
+}
+
+func eval(t *testing.T, source string) interface{} {
+	x, err := Compile(source, 0)
+	if !assert.NoError(t, err, source) {
+		return nil
+	}
+	value, err := x.Eval(testFields())
+	assert.NoError(t, err, source)
+	return value
+}
+
+func checkBool(t *testing.T, expected bool, source string) {
+	x, err := Compile(source, 0)
+	if !assert.NoError(t, err, source) {
+		return
+	}
+	result, err := x.Bool(testFields())
+	assert.NoError(t, err, source)
+	assert.Equal(t, expected, result, source)
+}
+
+func TestOperators(t *testing.T) {
+	checkBool(t, true, `[status] == 200`)
+	checkBool(t, true, `[status] >= 100 && [ratio] < 1`)
+	checkBool(t, true, `'_grokparsefailure' in [tags]`)
+	checkBool(t, true, `[message] =~ '^GET'`)
+	checkBool(t, true, `[user.name] == 'Bob'`)
+	checkBool(t, true, `[hosts.1] == 'b'`)
+	checkBool(t, true, `[ok]`)
+	checkBool(t, true, `[empty] == ''`)
+	checkBool(t, false, `[hosts.5] == 'b'`)
+	assert.Equal(t, float64(400), eval(t, `[status] * 2`))
+}
+
+func TestMissingAndNull(t *testing.T) {
+	checkBool(t, false, `[missing]`)
+	checkBool(t, false, `[null]`)
+	checkBool(t, true, `! [missing]`)
+	checkBool(t, false, `[missing] == 1`)
+	checkBool(t, false, `[missing.child] == 1`)
+
+	checkBool(t, true, `exists([status])`)
+	checkBool(t, false, `exists([missing])`)
+	checkBool(t, false, `exists([null])`)
+	checkBool(t, true, `is_null([null]) && is_null([missing])`)
+	checkBool(t, false, `is_null([ok])`)
+	assert.Equal(t, "default", eval(t, `coalesce([missing], [null], [empty], 'default')`))
+	assert.Equal(t, "Bob", eval(t, `coalesce([user.name], 'default')`))
+}
+
+func TestTypes(t *testing.T) {
+	checkBool(t, true, `is_string([message]) && is_number([status]) && is_number([ratio])`)
+	checkBool(t, true, `is_bool([ok]) && is_list([tags]) && is_hash([user])`)
+	checkBool(t, false, `is_string([status]) || is_list([missing])`)
+	assert.Equal(t, "200", eval(t, `string([status])`))
+	assert.Equal(t, float64(12), eval(t, `number('12')`))
+	checkBool(t, true, `bool([message])`)
+	checkBool(t, false, `bool([missing])`)
+}
+
+func TestStringsAndLists(t *testing.T) {
+	assert.Equal(t, float64(19), eval(t, `len([message])`))
+	assert.Equal(t, float64(2), eval(t, `len([tags])`))
+	assert.Equal(t, float64(0), eval(t, `len([missing])`))
+	assert.Equal(t, "get /index.html 200", eval(t, `lower([message])`))
+	assert.Equal(t, "BOB", eval(t, `upper([user.name])`))
+	assert.Equal(t, "a b", eval(t, `trim(' a b ')`))
+	checkBool(t, true, `contains([message], 'index')`)
+	checkBool(t, true, `contains([tags], 'web')`)
+	checkBool(t, false, `contains([tags], 'index')`)
+	checkBool(t, true, `starts_with([message], 'GET') && ends_with([message], '200')`)
+	assert.Equal(t, "POST /index.html 200", eval(t, `replace([message], 'GET', 'POST')`))
+	assert.Equal(t, []interface{}{"a", "b"}, eval(t, `split('a,b', ',')`))
+	assert.Equal(t, "a-b-c", eval(t, `join([hosts], '-')`))
+	assert.Equal(t, float64(2), eval(t, `len(split('a,b', ','))`))
+	assert.Equal(t, "a", eval(t, `first([hosts])`))
+	assert.Equal(t, "c", eval(t, `last([hosts])`))
+	assert.Nil(t, eval(t, `first([missing])`))
+	checkBool(t, true, `'admin' in [user.roles]`)
+}
+
+func TestRegexps(t *testing.T) {
+	checkBool(t, true, `match([message], '^(GET|POST) ')`)
+	assert.Equal(t, "GET", eval(t, `capture([message], '^(\\w+) (\\S+)')`))
+	assert.Equal(t, "/index.html", eval(t, `capture([message], '^(\\w+) (\\S+)', 2)`))
+	assert.Equal(t, "200", eval(t, `capture([message], '(?P<code>\\d+)$', 'code')`))
+	assert.Nil(t, eval(t, `capture([message], '^POST')`))
+}
+
+func TestCidrMatch(t *testing.T) {
+	checkBool(t, true, `cidr_match([ip], '10.0.0.0/8')`)
+	checkBool(t, true, `cidr_match([ip], '192.168.0.0/16', '10.1.0.0/16')`)
+	checkBool(t, false, `cidr_match([ip], '192.168.0.0/16')`)
+	checkBool(t, false, `cidr_match([missing], '10.0.0.0/8')`)
+	checkBool(t, true, `cidr_match('::1', '::1/128')`)
+}
+
+func TestTimes(t *testing.T) {
+	checkBool(t, true, `now() > [date]`)
+	checkBool(t, true, `now() - [date] > duration('1h')`)
+	checkBool(t, true, `[date] == timestamp('2026-10-19T14:00:00+02:00')`)
+	checkBool(t, true, `now() - timestamp('2000-01-01T00:00:00Z') > 86400`)
+	assert.Equal(t, float64(90), eval(t, `duration('1m30s')`))
+}
+
+func TestErrors(t *testing.T) {
+	_, err := Compile(`[status] ==`, 12)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line 12 : expression `[status] ==` :")
+	}
+	_, err = Compile(` `, 3)
+	assert.EqualError(t, err, "line 3 : expression ` ` : empty expression")
+
+	x, err := Compile(`[missing] > 3`, 7)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = x.Bool(testFields())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line 7 :")
+	}
+
+	x, _ = Compile(`cidr_match([ip], 'nope')`, 0)
+	_, err = x.Eval(testFields())
+	assert.Error(t, err)
+}
+
+func TestCompileCache(t *testing.T) {
+	a, _ := Compile(`[status] == 404`, 1)
+	b, _ := Compile(`[status] == 404`, 2)
+	assert.True(t, a.compiled == b.compiled)
+	assert.Equal(t, 2, b.Line)
+	assert.Equal(t, []string{"status"}, b.Vars())
+}
+
+func TestLines(t *testing.T) {
+	conf := map[string]interface{}{
+		"condition":  "[a]",
+		LINES_OPTION: map[string]interface{}{"condition": float64(4)},
+	}
+	assert.Equal(t, map[string]int{"condition": 4}, Lines(conf))
+	assert.NotContains(t, conf, LINES_OPTION)
+}
@@ -0,0 +1,316 @@
+package expression
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"golang.org/x/sync/syncmap"
+	"gopkg.in/Knetic/govaluate.v3"
+)
+
+// functions is the library available to all expressions
+var functions = map[string]govaluate.ExpressionFunction{
+	// types
+	"bool":      boolFunc,
+	"exists":    func(args ...interface{}) (interface{}, error) { return arg(args, 0) != nil, nil },
+	"is_null":   func(args ...interface{}) (interface{}, error) { return arg(args, 0) == nil, nil },
+	"is_string": isKind(reflect.String),
+	"is_number": isKind(reflect.Float64),
+	"is_bool":   isKind(reflect.Bool),
+	"is_list":   isKind(reflect.Slice),
+	"is_hash":   isKind(reflect.Map),
+	"string":    func(args ...interface{}) (interface{}, error) { return cast.ToStringE(arg(args, 0)) },
+	"number":    func(args ...interface{}) (interface{}, error) { return cast.ToFloat64E(arg(args, 0)) },
+	"coalesce":  coalesce,
+
+	// strings and lists
+	"len":         lenFunc,
+	"lower":       stringFunc(strings.ToLower),
+	"upper":       stringFunc(strings.ToUpper),
+	"trim":        stringFunc(strings.TrimSpace),
+	"contains":    contains,
+	"starts_with": stringPredicate(strings.HasPrefix),
+	"ends_with":   stringPredicate(strings.HasSuffix),
+	"replace":     replace,
+	"split":       split,
+	"join":        join,
+	"first":       element(0),
+	"last":        element(-1),
+
+	// regular expressions
+	"match":   match,
+	"capture": capture,
+
+	// networks
+	"cidr_match": cidrMatch,
+
+	// times, unix timestamps in seconds
+	"now":       func(args ...interface{}) (interface{}, error) { return float64(time.Now().UnixNano()) / 1e9, nil },
+	"timestamp": timestamp,
+	"duration":  duration,
+}
+
+func arg(args []interface{}, i int) interface{} {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+func checkArgs(name string, args []interface{}, min int) error {
+	if len(args) < min {
+		return fmt.Errorf("%s expects %d arguments, got %d", name, min, len(args))
+	}
+	return nil
+}
+
+func boolFunc(args ...interface{}) (interface{}, error) {
+	return truth(arg(args, 0)), nil
+}
+
+func isKind(kind reflect.Kind) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		v := arg(args, 0)
+		if v == nil {
+			return false, nil
+		}
+		return reflect.ValueOf(normalize(v)).Kind() == kind, nil
+	}
+}
+
+// coalesce returns the first argument neither nil nor empty
+func coalesce(args ...interface{}) (interface{}, error) {
+	for _, v := range args {
+		if v != nil && v != "" {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func lenFunc(args ...interface{}) (interface{}, error) {
+	v := arg(args, 0)
+	if v == nil {
+		return float64(0), nil
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return float64(rv.Len()), nil
+	case reflect.String:
+		return float64(len([]rune(rv.String()))), nil
+	}
+	return float64(1), nil
+}
+
+func stringFunc(f func(string) string) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		s, err := cast.ToStringE(arg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		return f(s), nil
+	}
+}
+
+func stringPredicate(f func(string, string) bool) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		s, err := cast.ToStringE(arg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		sub, err := cast.ToStringE(arg(args, 1))
+		if err != nil {
+			return nil, err
+		}
+		return f(s, sub), nil
+	}
+}
+
+// contains tells if a string contains a substring or a list an element
+func contains(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("contains", args, 2); err != nil {
+		return nil, err
+	}
+	if list, ok := normalize(args[0]).([]interface{}); ok {
+		needle := normalize(args[1])
+		for _, e := range list {
+			if reflect.DeepEqual(e, needle) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return stringPredicate(strings.Contains)(args...)
+}
+
+func replace(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("replace", args, 3); err != nil {
+		return nil, err
+	}
+	s, old, new := cast.ToString(args[0]), cast.ToString(args[1]), cast.ToString(args[2])
+	return strings.Replace(s, old, new, -1), nil
+}
+
+func split(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("split", args, 2); err != nil {
+		return nil, err
+	}
+	list := List{}
+	for _, e := range strings.Split(cast.ToString(args[0]), cast.ToString(args[1])) {
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+func join(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("join", args, 2); err != nil {
+		return nil, err
+	}
+	list, ok := normalize(args[0]).([]interface{})
+	if !ok {
+		return cast.ToStringE(args[0])
+	}
+	parts := []string{}
+	for _, e := range list {
+		parts = append(parts, cast.ToString(e))
+	}
+	return strings.Join(parts, cast.ToString(args[1])), nil
+}
+
+// element returns the element of a list at index, a negative index counts
+// from the end
+func element(index int) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		list, ok := normalize(arg(args, 0)).([]interface{})
+		if !ok {
+			return arg(args, 0), nil
+		}
+		i := index
+		if i < 0 {
+			i = len(list) + i
+		}
+		if i < 0 || i >= len(list) {
+			return nil, nil
+		}
+		return list[i], nil
+	}
+}
+
+// compiled regular expressions by pattern
+var regexps = &syncmap.Map{}
+
+func compileRegexp(pattern interface{}) (*regexp.Regexp, error) {
+	if re, ok := pattern.(*regexp.Regexp); ok {
+		return re, nil
+	}
+	p := cast.ToString(pattern)
+	if re, ok := regexps.Load(p); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(p, re)
+	return re, nil
+}
+
+func match(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("match", args, 2); err != nil {
+		return nil, err
+	}
+	re, err := compileRegexp(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(cast.ToString(args[0])), nil
+}
+
+// capture returns a group captured by a regular expression, the first one or
+// the one given by its number or its name, nil when the string does not match
+func capture(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("capture", args, 2); err != nil {
+		return nil, err
+	}
+	re, err := compileRegexp(args[1])
+	if err != nil {
+		return nil, err
+	}
+	matches := re.FindStringSubmatch(cast.ToString(args[0]))
+	if matches == nil {
+		return nil, nil
+	}
+
+	group := 1
+	switch g := arg(args, 2).(type) {
+	case nil:
+	case float64:
+		group = int(g)
+	case string:
+		group = re.SubexpIndex(g)
+	}
+	if group < 0 || group >= len(matches) {
+		return nil, fmt.Errorf("capture : no group %v in %s", arg(args, 2), re.String())
+	}
+	return matches[group], nil
+}
+
+// cidrMatch tells if an ip address belongs to one of the networks given as
+// arguments or as a list
+func cidrMatch(args ...interface{}) (interface{}, error) {
+	if err := checkArgs("cidr_match", args, 2); err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(cast.ToString(args[0]))
+	if ip == nil {
+		return false, nil
+	}
+	networks := []interface{}{}
+	for _, a := range args[1:] {
+		if list, ok := normalize(a).([]interface{}); ok {
+			networks = append(networks, list...)
+		} else {
+			networks = append(networks, a)
+		}
+	}
+	for _, n := range networks {
+		_, network, err := net.ParseCIDR(cast.ToString(n))
+		if err != nil {
+			return nil, fmt.Errorf("cidr_match : %v", err)
+		}
+		if network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// timestamp returns the unix timestamp in seconds of a time, a RFC3339 date or
+// a number of seconds
+func timestamp(args ...interface{}) (interface{}, error) {
+	switch v := normalize(arg(args, 0)).(type) {
+	case float64:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("timestamp : %v", err)
+		}
+		return float64(t.UnixNano()) / 1e9, nil
+	}
+	return nil, fmt.Errorf("timestamp : unsupported value %v", arg(args, 0))
+}
+
+// duration returns the number of seconds of a duration as 1h30m or 5s
+func duration(args ...interface{}) (interface{}, error) {
+	d, err := time.ParseDuration(cast.ToString(arg(args, 0)))
+	if err != nil {
+		return nil, fmt.Errorf("duration : %v", err)
+	}
+	return d.Seconds(), nil
+}
@@ -0,0 +1,277 @@
+// Package manifest reads pipelines.yml files declaring pipelines, their
+// stable ID, their configuration files and their settings.
+//
+//	pipelines:
+//	  - id: web-access
+//	    label: Web access logs
+//	    auto_start: true
+//	    config: web/main.conf
+//	    assets:
+//	      - web/patterns/*
+//	    vars:
+//	      ES_INDEX: web
+//	    workers: 4
+//	    buffer_size: 100
+//	    queue: memory
+//	    depends_on: archive
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vjeantet/bitfan/commons/depgraph"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FILENAME is the name of the manifest file looked up in a directory
+const FILENAME = "pipelines.yml"
+
+// Queue types between the processors of a pipeline
+const (
+	// QUEUE_MEMORY buffers up to buffer_size events in memory before each processor
+	QUEUE_MEMORY = "memory"
+	// QUEUE_DIRECT hands events over to the next processor without buffering
+	QUEUE_DIRECT = "direct"
+)
+
+// Manifest declares pipelines
+type Manifest struct {
+	// Path of the manifest file, paths of pipelines are relative to its directory
+	Path      string     `yaml:"-"`
+	Pipelines []Pipeline `yaml:"pipelines"`
+}
+
+// Pipeline declared in a manifest
+type Pipeline struct {
+	// ID is the stable UUID of the pipeline
+	ID          string `yaml:"id"`
+	Label       string `yaml:"label"`
+	Description string `yaml:"description"`
+	// AutoStart starts the pipeline with bitfan, default is true
+	AutoStart *bool `yaml:"auto_start"`
+	// Config are the configuration files, the first one is the entrypoint
+	Config StringList `yaml:"config"`
+	// Assets are files (globs) used by the configuration, default is all the
+	// files of the entrypoint's directory
+	Assets StringList `yaml:"assets"`
+
+	// Vars replace ${NAME} in configurations, before environment variables
+	Vars map[string]string `yaml:"vars"`
+	// Workers is the number of workers of filters and outputs without a workers
+	// option, 0 keeps their default
+	Workers int `yaml:"workers"`
+	// BufferSize is the number of events queued before each processor, 0 keeps the default
+	BufferSize int `yaml:"buffer_size"`
+	// Queue is the type of queue between processors, memory (default) or direct
+	Queue string `yaml:"queue"`
+	// DependsOn are the ids of the pipelines started before this one and
+	// stopped after it
+	DependsOn StringList `yaml:"depends_on"`
+}
+
+// IsAutoStart returns true when the pipeline starts with bitfan
+func (p Pipeline) IsAutoStart() bool {
+	return p.AutoStart == nil || *p.AutoStart
+}
+
+// StringList is a list of strings accepting a single string in yaml
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = StringList(list)
+	return nil
+}
+
+var validID = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
+
+// Load reads the manifest at path, a directory is looked up for a pipelines.yml file
+func Load(path string) (*Manifest, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, FILENAME)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := yaml.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("%s : %v", path, err)
+	}
+	m.Path, _ = filepath.Abs(path)
+
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("%s : %v", path, err)
+	}
+	return m, nil
+}
+
+// Dir returns the directory of the manifest file
+func (m *Manifest) Dir() string {
+	return filepath.Dir(m.Path)
+}
+
+func (m *Manifest) validate() error {
+	ids := map[string]bool{}
+	for i := range m.Pipelines {
+		p := &m.Pipelines[i]
+		if p.ID == "" {
+			return fmt.Errorf("pipeline #%d has no id", i+1)
+		}
+		if !validID.MatchString(p.ID) {
+			return fmt.Errorf("pipeline id %s may only contain letters, digits, '-', '_' and '.'", p.ID)
+		}
+		if ids[p.ID] {
+			return fmt.Errorf("pipeline id %s is declared twice", p.ID)
+		}
+		ids[p.ID] = true
+		if len(p.Config) == 0 {
+			return fmt.Errorf("pipeline %s has no config", p.ID)
+		}
+		if p.Workers < 0 || p.BufferSize < 0 {
+			return fmt.Errorf("pipeline %s : workers and buffer_size can not be negative", p.ID)
+		}
+		if p.Queue != "" && p.Queue != QUEUE_MEMORY && p.Queue != QUEUE_DIRECT {
+			return fmt.Errorf("pipeline %s : unknown queue type %s, expected %s or %s", p.ID, p.Queue, QUEUE_MEMORY, QUEUE_DIRECT)
+		}
+		if p.Label == "" {
+			p.Label = p.ID
+		}
+	}
+
+	order := []string{}
+	deps := map[string][]string{}
+	for _, p := range m.Pipelines {
+		order = append(order, p.ID)
+		deps[p.ID] = p.DependsOn
+	}
+	_, err := depgraph.Sort(order, deps)
+	return err
+}
+
+// Abs returns the absolute location of a path of the manifest
+func (m *Manifest) Abs(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.Dir(), path)
+}
+
+// Files returns the files of the pipeline, their names are relative to the
+// entrypoint's directory, the entrypoint is the first one
+func (m *Manifest) Files(p Pipeline) (base string, names []string, err error) {
+	entrypoint := m.Abs(p.Config[0])
+	base = filepath.Dir(entrypoint)
+	names = []string{filepath.Base(entrypoint)}
+	seen := map[string]bool{names[0]: true}
+
+	add := func(path string) error {
+		name, err := filepath.Rel(base, path)
+		if err != nil || strings.HasPrefix(name, "..") {
+			return fmt.Errorf("pipeline %s : %s is outside of %s", p.ID, path, base)
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return nil
+	}
+
+	patterns := append([]string{}, p.Config[1:]...)
+	patterns = append(patterns, p.Assets...)
+	if len(p.Assets) == 0 {
+		patterns = append(patterns, base)
+	}
+
+	others := []string{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(m.Abs(pattern))
+		if err != nil {
+			return base, names, err
+		}
+		if len(matches) == 0 {
+			return base, names, fmt.Errorf("pipeline %s : no file matches %s", p.ID, pattern)
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				// skip hidden files and directories like .git
+				if path != match && strings.HasPrefix(fi.Name(), ".") {
+					if fi.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if fi.IsDir() || path == m.Path {
+					return nil
+				}
+				others = append(others, path)
+				return nil
+			})
+			if err != nil {
+				return base, names, err
+			}
+		}
+	}
+
+	sort.Strings(others)
+	for _, path := range others {
+		if err := add(path); err != nil {
+			return base, names, err
+		}
+	}
+	return base, names, nil
+}
+
+// Revision returns the git commit checked out in the manifest's working
+// tree, empty when the manifest is not in a git working tree
+func (m *Manifest) Revision() string {
+	for dir := m.Dir(); ; dir = filepath.Dir(dir) {
+		gitDir := filepath.Join(dir, ".git")
+		if head, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD")); err == nil {
+			return resolveRef(gitDir, strings.TrimSpace(string(head)))
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// resolveRef returns the commit of a HEAD content, a commit or a "ref: " line
+func resolveRef(gitDir string, head string) string {
+	if !strings.HasPrefix(head, "ref: ") {
+		return head
+	}
+	ref := strings.TrimPrefix(head, "ref: ")
+	if commit, err := ioutil.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(commit))
+	}
+	// the ref may only be in packed-refs
+	packed, err := ioutil.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(packed), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == ref {
+			return fields[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		FILENAME: `
+pipelines:
+  - id: web
+    label: Web logs
+    auto_start: true
+    config: web/main.conf
+  - id: mail
+    auto_start: false
+    config:
+      - mail/main.conf
+      - mail/filters.conf
+    vars:
+      INDEX: mail
+    workers: 4
+    buffer_size: 100
+    queue: direct
+    depends_on: web
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	m, err := Load(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, filepath.Join(dir, FILENAME), m.Path)
+	assert.Len(t, m.Pipelines, 2)
+	assert.Equal(t, "Web logs", m.Pipelines[0].Label)
+	assert.True(t, m.Pipelines[0].IsAutoStart())
+	assert.Equal(t, StringList{"web/main.conf"}, m.Pipelines[0].Config)
+	assert.Equal(t, "mail", m.Pipelines[1].Label)
+	assert.Equal(t, StringList{"mail/main.conf", "mail/filters.conf"}, m.Pipelines[1].Config)
+	assert.False(t, m.Pipelines[1].IsAutoStart())
+	assert.Equal(t, map[string]string{"INDEX": "mail"}, m.Pipelines[1].Vars)
+	assert.Equal(t, 4, m.Pipelines[1].Workers)
+	assert.Equal(t, 100, m.Pipelines[1].BufferSize)
+	assert.Equal(t, QUEUE_DIRECT, m.Pipelines[1].Queue)
+	assert.Equal(t, StringList{"web"}, m.Pipelines[1].DependsOn)
+}
+
+func TestLoadDefaults(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		FILENAME: "pipelines:\n  - id: web\n    config: web/main.conf\n",
+	})
+	defer os.RemoveAll(dir)
+
+	m, err := Load(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, m.Pipelines[0].IsAutoStart())
+	assert.Equal(t, 0, m.Pipelines[0].Workers)
+	assert.Equal(t, 0, m.Pipelines[0].BufferSize)
+	assert.Equal(t, "", m.Pipelines[0].Queue)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for content, msg := range map[string]string{
+		"pipelines:\n  - config: a.conf\n":                                           "pipeline #1 has no id",
+		"pipelines:\n  - id: a b\n    config: a.conf\n":                              "pipeline id a b may only contain letters, digits, '-', '_' and '.'",
+		"pipelines:\n  - id: a\n    config: a.conf\n  - id: a\n    config: b.conf\n": "pipeline id a is declared twice",
+		"pipelines:\n  - id: a\n":                                                    "pipeline a has no config",
+		"pipelines:\n  - id: a\n    config: a.conf\n    workers: -1\n":               "pipeline a : workers and buffer_size can not be negative",
+		"pipelines:\n  - id: a\n    config: a.conf\n    queue: disk\n":               "pipeline a : unknown queue type disk, expected memory or direct",
+	} {
+		dir := writeFiles(t, map[string]string{FILENAME: content})
+		_, err := Load(dir)
+		assert.EqualError(t, err, filepath.Join(dir, FILENAME)+" : "+msg)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLoadDependencyCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		FILENAME: `
+pipelines:
+  - id: web
+    config: web/main.conf
+    depends_on: archive
+  - id: archive
+    config: archive/main.conf
+    depends_on: [mail, web]
+  - id: mail
+    config: mail/main.conf
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := Load(dir)
+	assert.EqualError(t, err, filepath.Join(dir, FILENAME)+" : dependency cycle web -> archive -> web")
+}
+
+func TestFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		FILENAME:                  "pipelines:\n  - id: web\n    config: web/main.conf\n  - id: mail\n    config: mail/main.conf\n    assets: mail/*.conf\n",
+		"web/main.conf":           "input{}",
+		"web/patterns/apache":     "APACHE .*",
+		"web/.hidden":             "",
+		"mail/main.conf":          "input{}",
+		"mail/filters.conf":       "filter{}",
+		"mail/README.md":          "",
+		"outside/other/main.conf": "",
+	})
+	defer os.RemoveAll(dir)
+
+	m, err := Load(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	base, names, err := m.Files(m.Pipelines[0])
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "web"), base)
+	assert.Equal(t, []string{"main.conf", filepath.Join("patterns", "apache")}, names)
+
+	_, names, err = m.Files(m.Pipelines[1])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.conf", "filters.conf"}, names)
+
+	_, _, err = m.Files(Pipeline{ID: "out", Config: StringList{"web/main.conf"}, Assets: StringList{"outside/other/*"}})
+	assert.Error(t, err)
+
+	_, _, err = m.Files(Pipeline{ID: "none", Config: StringList{"web/main.conf"}, Assets: StringList{"web/*.yml"}})
+	assert.EqualError(t, err, "pipeline none : no file matches web/*.yml")
+}
+
+func TestRevision(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		FILENAME:                 "pipelines: []\n",
+		".git/HEAD":              "ref: refs/heads/master\n",
+		".git/refs/heads/master": "0123456789abcdef\n",
+	})
+	defer os.RemoveAll(dir)
+
+	m, err := Load(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "0123456789abcdef", m.Revision())
+
+	os.Remove(filepath.Join(dir, ".git", "refs", "heads", "master"))
+	ioutil.WriteFile(filepath.Join(dir, ".git", "packed-refs"), []byte("# pack-refs\nfedcba9876543210 refs/heads/master\n"), 0644)
+	assert.Equal(t, "fedcba9876543210", m.Revision())
+}
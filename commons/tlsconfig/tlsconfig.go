@@ -0,0 +1,156 @@
+// Package tlsconfig builds tls.Config of bitfan's HTTP listeners from
+// certificate files, certificates can be reloaded without restarting.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Options of a TLS listener
+type Options struct {
+	CertFile string // PEM certificate, TLS is disabled when empty
+	KeyFile  string // PEM private key
+	// ClientCAFile enables mutual TLS, clients must present a certificate signed by one of its CAs
+	ClientCAFile string
+	// MinVersion is the minimum TLS version accepted : 1.0, 1.1, 1.2 (default) or 1.3
+	MinVersion string
+}
+
+// Enabled returns true when a certificate is set
+func (o Options) Enabled() bool {
+	return o.CertFile != ""
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Certificates holds the certificate and client CAs loaded from Options' files
+type Certificates struct {
+	opt        Options
+	minVersion uint16
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// New loads certificates files
+func New(opt Options) (*Certificates, error) {
+	c := &Certificates{opt: opt, minVersion: tls.VersionTLS12}
+	if opt.MinVersion != "" {
+		v, ok := tlsVersions[opt.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %s", opt.MinVersion)
+		}
+		c.minVersion = v
+	}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads certificates files again, current certificates are kept on error
+func (c *Certificates) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.opt.CertFile, c.opt.KeyFile)
+	if err != nil {
+		return fmt.Errorf("can not load certificate %s : %v", c.opt.CertFile, err)
+	}
+
+	var pool *x509.CertPool
+	if c.opt.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.opt.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("can not read client CA %s : %v", c.opt.ClientCAFile, err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in client CA %s", c.opt.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.clientCAs = pool
+	c.mu.Unlock()
+	return nil
+}
+
+// Config returns a tls.Config always serving the last loaded certificates
+func (c *Certificates) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: c.minVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+
+			conf := &tls.Config{
+				MinVersion:   c.minVersion,
+				Certificates: []tls.Certificate{*c.cert},
+			}
+			if c.clientCAs != nil {
+				conf.ClientCAs = c.clientCAs
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return conf, nil
+		},
+	}
+}
+
+// ReloadOnSIGHUP reloads certificates each time the process receives a
+// SIGHUP, onReload is called with the result of each reload
+func (c *Certificates) ReloadOnSIGHUP(onReload func(error)) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			onReload(c.Reload())
+		}
+	}()
+}
+
+// ClientOptions of a client of a TLS server
+type ClientOptions struct {
+	CAFile   string // PEM CAs verifying the server certificate, system CAs when empty
+	CertFile string // PEM certificate presented to servers requiring mutual TLS
+	KeyFile  string // PEM private key of CertFile
+}
+
+// Client returns the tls.Config of a client, nil when no option is set
+func Client(opt ClientOptions) (*tls.Config, error) {
+	if opt == (ClientOptions{}) {
+		return nil, nil
+	}
+
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opt.CAFile != "" {
+		pem, err := ioutil.ReadFile(opt.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can not read CA %s : %v", opt.CAFile, err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA %s", opt.CAFile)
+		}
+	}
+	if opt.CertFile != "" || opt.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can not load certificate %s : %v", opt.CertFile, err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
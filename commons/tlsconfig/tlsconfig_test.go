@@ -0,0 +1,92 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnabled(t *testing.T) {
+	assert.False(t, Options{}.Enabled())
+	assert.True(t, Options{CertFile: "cert.pem", KeyFile: "key.pem"}.Enabled())
+}
+
+func TestNewUnknownVersion(t *testing.T) {
+	_, err := New(Options{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "2.0"})
+	assert.EqualError(t, err, "unknown TLS version 2.0")
+}
+
+func TestNewMissingCertificate(t *testing.T) {
+	_, err := New(Options{CertFile: "missing.pem", KeyFile: "missing.pem"})
+	assert.Error(t, err)
+}
+
+// writeCertificate writes a self signed PEM certificate and its key to dir
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bitfan"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestClientDisabled(t *testing.T) {
+	conf, err := Client(ClientOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, conf)
+}
+
+func TestClient(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+
+	conf, err := Client(ClientOptions{CAFile: certFile, CertFile: certFile, KeyFile: keyFile})
+	assert.NoError(t, err)
+	assert.NotNil(t, conf.RootCAs)
+	assert.Len(t, conf.Certificates, 1)
+
+	conf, err = Client(ClientOptions{CAFile: certFile})
+	assert.NoError(t, err)
+	assert.NotNil(t, conf.RootCAs)
+	assert.Empty(t, conf.Certificates)
+}
+
+func TestClientErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeCertificate(t, dir)
+	empty := filepath.Join(dir, "empty.pem")
+	assert.NoError(t, ioutil.WriteFile(empty, []byte("nothing"), 0600))
+
+	_, err := Client(ClientOptions{CAFile: filepath.Join(dir, "missing.pem")})
+	assert.Error(t, err)
+
+	_, err = Client(ClientOptions{CAFile: empty})
+	assert.EqualError(t, err, "no certificate found in CA "+empty)
+
+	_, err = Client(ClientOptions{CertFile: certFile})
+	assert.Error(t, err)
+}
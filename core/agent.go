@@ -6,8 +6,11 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/vjeantet/bitfan/core/metrics"
+	"github.com/vjeantet/bitfan/core/monitor"
 	"github.com/vjeantet/bitfan/core/webhook"
 	"github.com/vjeantet/bitfan/processors"
 	"github.com/vjeantet/bitfan/processors/xprocessor"
@@ -16,11 +19,21 @@ import (
 type ProcessorFactory func() processors.Processor
 
 type Agent struct {
+	// events received and sent by the agent, accessed atomically and first
+	// for 64-bit alignment
+	eventsIn  int64
+	eventsOut int64
+	// 1 when the events are traced, set from Trace and at runtime
+	tracing int32
+
 	ID               int
 	Label            string
 	processor        processors.Processor
 	packetChan       chan *event
 	outputs          map[int][]chan *event
+	taps             *agentTaps
+	pauses           *pauseState
+	failure          *startFailure
 	Done             chan bool
 	concurentProcess int
 	// conf             config.Agent
@@ -37,6 +50,10 @@ type Agent struct {
 	Buffer          int `json:"buffer_size"`
 	Options         map[string]interface{}
 	Wd              string
+	// Source is the configuration file the agent is declared in and Line its
+	// line in this file
+	Source string
+	Line   int
 }
 
 var agentIndex int = 0
@@ -50,47 +67,75 @@ func NewAgent() Agent {
 
 // build an agent and return its input chan
 func buildAgent(conf *Agent) error {
+	proc, err := newProcessor(conf.Type)
+	if err != nil {
+		return err
+	}
+
+	conf.packetChan = make(chan *event, conf.Buffer)
+	conf.outputs = map[int][]chan *event{}
+	conf.resetRunState()
+	conf.setTracing(conf.Trace)
+	conf.processor = proc
+	conf.Done = make(chan bool)
+	conf.Options = conf.Options
+
+	// Configure the agent (and its processor)
+	if err := conf.configure(conf.send); err != nil {
+		return fmt.Errorf("Can not configure agent %s : %v", conf.Type, err)
+	}
+
+	return nil
+}
+
+// resetRunState clears the taps and failures of a previous run and restores
+// its pause. They are read by the api and the supervisor while a pipeline
+// restarts, so they are created on the first build, before the pipeline runs,
+// and kept by the next ones
+func (a *Agent) resetRunState() {
+	if a.taps == nil {
+		a.taps = &agentTaps{}
+		a.pauses = &pauseState{}
+		a.failure = &startFailure{}
+	}
+	a.taps.open()
+	a.pauses.restore()
+	a.failure.reset()
+}
+
+// newProcessor returns a new processor of the agent type, a processor or an
+// user XProcessor
+func newProcessor(agentType string) (processors.Processor, error) {
 	// Check that the agent's processor type is supported
 	var proc processors.Processor
 
-	if pfactory, ok := availableProcessorsFactory[conf.Type]; ok {
+	if pfactory, ok := availableProcessorsFactory[agentType]; ok {
 		// Create a new Processor processor
 		proc = pfactory()
 	} else {
 		// Try to find an user XProcessor
-		xProcName := conf.Type
-		if strings.HasPrefix(conf.Type, "input_") {
+		xProcName := agentType
+		if strings.HasPrefix(agentType, "input_") {
 			xProcName = xProcName[6:]
 		}
-		if strings.HasPrefix(conf.Type, "output_") {
+		if strings.HasPrefix(agentType, "output_") {
 			xProcName = xProcName[7:]
 		}
 		if xProcSpec, err := Storage().FindOneXProcessorByName(xProcName); err != nil {
-			return fmt.Errorf("Processor '%s' not found, and %s", conf.Type, err)
+			return nil, fmt.Errorf("Processor '%s' not found, and %s", agentType, err)
 		} else {
 			proc = xprocessor.NewWithSpec(&xProcSpec)
 		}
 	}
 
 	if proc == nil {
-		return fmt.Errorf("Can not build processor %s", conf.Type)
+		return nil, fmt.Errorf("Can not build processor %s", agentType)
 	}
-
-	conf.packetChan = make(chan *event, conf.Buffer)
-	conf.outputs = map[int][]chan *event{}
-	conf.processor = proc
-	conf.Done = make(chan bool)
-	conf.Options = conf.Options
-
-	// Configure the agent (and its processor)
-	if err := conf.configure(); err != nil {
-		return fmt.Errorf("Can not configure agent %s : %v", conf.Type, err)
-	}
-
-	return nil
+	return proc, nil
 }
 
-func (a *Agent) configure() error {
+// configure the agent's processor, sender sends the events of the processor
+func (a *Agent) configure(sender processors.PacketSender) error {
 
 	a.processor.SetPipelineUUID(a.PipelineUUID)
 	a.processor.SetProcessorIdentifiers(a.Type, a.Label)
@@ -105,7 +150,7 @@ func (a *Agent) configure() error {
 		},
 	)
 
-	ctx.packetSender = a.send // 	data["processor_type"] = proc_type
+	ctx.packetSender = sender // 	data["processor_type"] = proc_type
 	// 	data["pipeline_uuid"] = pipelineUUID
 	// 	data["processor_label"] = proc_label
 	ctx.packetBuilder = newPacket
@@ -130,6 +175,8 @@ func (a *Agent) configure() error {
 	return a.processor.Configure(ctx, a.Options)
 }
 
+// traceEvent logs an event the agent receives or sends, traces are logged
+// whatever the log level is
 func (a *Agent) traceEvent(way string, packet processors.IPacket, portNumbers ...int) {
 	verb := "received"
 	if way == "OUT" {
@@ -152,15 +199,26 @@ func (a *Agent) send(packet processors.IPacket, portNumbers ...int) bool {
 		portNumbers = []int{0}
 	}
 
-	if a.Trace {
+	// a paused agent holds its events, its source waits
+	a.pauses.wait()
+
+	if a.Tracing() {
 		a.traceEvent("OUT", packet, portNumbers...)
 	}
 
 	// for each portNumbes
 	// send packet to each a.outputs[portNumber]
 	for _, portNumber := range portNumbers {
+		// without on_failure block failed events follow the main flow
+		if portNumber == processors.PORT_FAILURE && len(a.outputs[portNumber]) == 0 {
+			portNumber = 0
+		}
+		if a.taps.active() {
+			a.taps.send(packet, portNumber)
+		}
 		if len(a.outputs[portNumber]) == 1 {
 			a.outputs[portNumber][0] <- packet.(*event)
+			atomic.AddInt64(&a.eventsOut, 1)
 			myMetrics.Increment(metrics.PROC_OUT, a.PipelineName, a.Label)
 		} else {
 			// do not use go routine nor waitgroup as it slow down the processing
@@ -168,6 +226,7 @@ func (a *Agent) send(packet processors.IPacket, portNumbers ...int) bool {
 				// Clone() is a time killer
 				// TODO : failback if out does not take out packet on x ms (share on a bitfanSlave)
 				out <- packet.Clone().(*event)
+				atomic.AddInt64(&a.eventsOut, 1)
 				myMetrics.Increment(metrics.PROC_OUT, a.PipelineName, a.Label)
 			}
 		}
@@ -183,10 +242,18 @@ func (a *Agent) addOutput(in chan *event, portNumber int) error {
 // Start agent
 func (a *Agent) start() error {
 	// Start processor
-	err := a.processor.Start(newPacket(map[string]interface{}{"message": "start"}))
+	err := a.startProcessor()
+	a.setStartError(err)
 	if err != nil {
 		Log().Errorf("pipeline UUID '%s' agent '%s' not started : %s", a.PipelineUUID, a.Label, err)
-
+		monitor.Publish(monitor.KIND_AGENT, map[string]interface{}{
+			"action":          "failed",
+			"pipeline_uuid":   a.PipelineUUID,
+			"pipeline_label":  a.PipelineName,
+			"processor_label": a.Label,
+			"processor_type":  a.Type,
+			"error":           err.Error(),
+		})
 	}
 
 	// Maximum number of concurent packet consumption ?
@@ -220,8 +287,22 @@ func (a *Agent) start() error {
 	if a.Schedule != "" {
 		Log().Debugf("agent %s : schedule=%s", a.Label, a.Schedule)
 		err := myScheduler.Add(a.PipelineUUID, a.Label, a.Schedule, func() {
-			go a.processor.Tick(newPacket(nil))
+			if a.Paused() {
+				a.processor.B().Logger.Debugf("Scheduler tick skipped, agent paused")
+				return
+			}
+			go func() {
+				defer a.recoverCrash()
+				a.processor.Tick(newPacket(nil))
+			}()
 			a.processor.B().Logger.Debugf("Scheduler ticked")
+			monitor.Publish(monitor.KIND_TICK, map[string]interface{}{
+				"pipeline_uuid":   a.PipelineUUID,
+				"pipeline_label":  a.PipelineName,
+				"processor_label": a.Label,
+				"processor_type":  a.Type,
+				"schedule":        a.Schedule,
+			})
 		})
 		if err != nil {
 			Log().Errorf("schedule start failed - %s : %v", a.Label, err)
@@ -233,31 +314,49 @@ func (a *Agent) start() error {
 	return nil
 }
 
+// Events returns the number of events the agent received and sent
+func (a *Agent) Events() (in int64, out int64) {
+	return atomic.LoadInt64(&a.eventsIn), atomic.LoadInt64(&a.eventsOut)
+}
+
 // Processor return the agent's processor
 func (a *Agent) Processor() processors.Processor {
 	return a.processor
 }
 
-// listen plugs the agent processor to its event chan
+// listen plugs the agent processor to its event chan, a panic of the
+// processor ends the worker and marks the agent as crashed
 func (a *Agent) listen(wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer a.recoverCrash()
 	Log().Debugf("Starting EventLoop on %d-%s", a.ID, a.Label)
 	for e := range a.packetChan {
 		// Receive a work request.
 		myMetrics.Set(metrics.CONNECTION_TRANSIT, a.PipelineName, a.Label, len(a.packetChan))
 
-		if a.Trace {
+		if a.Tracing() {
 			a.traceEvent("IN", e, 0)
 		}
 
+		start := time.Now()
 		if err := a.processor.Receive(e); err != nil {
 			Log().Errorf("agent %s: %v", a.Type, err)
 		}
+		if monitor.Active() {
+			monitor.ObserveLatency(a.PipelineName, a.Label, time.Since(start))
+		}
+		atomic.AddInt64(&a.eventsIn, 1)
 		myMetrics.Increment(metrics.PROC_IN, a.PipelineName, a.Label)
 	}
-	wg.Done()
 }
 
-func (a *Agent) stop() {
+// stop closes the queue of the agent and waits for its workers, run is
+// locked while the queue closes as events may be injected into it
+func (a *Agent) stop(run sync.Locker) {
+	// release the events held by a pause, the agent is paused again when
+	// the supervisor restarts it
+	a.pauses.release()
+
 	myScheduler.Remove(a.PipelineUUID, a.Label)
 	Log().Debugf("agent %d schedule job removed", a.ID)
 
@@ -269,15 +368,34 @@ func (a *Agent) stop() {
 	Log().Debugf("agent %d webhook routes unregistered", a.ID)
 
 	Log().Debugf("Processor '%s' stopping... - %d in pipe ", a.Label, len(a.packetChan))
+	run.Lock()
 	close(a.packetChan)
+	run.Unlock()
 	<-a.Done
+	a.taps.closeAll()
+	a.setTracing(false)
 	Log().Debugf("Processor %s stopped", a.Label)
 }
 
-func (a *Agent) pause() {
-
+// pause holds the events the agent sends and skips its scheduled ticks, it
+// returns false when the agent is already paused
+func (a *Agent) pause() bool {
+	if a.pauses == nil {
+		return false
+	}
+	return a.pauses.pause()
 }
 
-func (a *Agent) resume() {
+// resume releases the events held by pause, it returns false when the agent
+// is not paused
+func (a *Agent) resume() bool {
+	if a.pauses == nil {
+		return false
+	}
+	return a.pauses.resume()
+}
 
+// Paused tells if the agent is paused
+func (a *Agent) Paused() bool {
+	return a.pauses != nil && atomic.LoadInt32(&a.pauses.paused) == 1
 }
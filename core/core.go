@@ -2,14 +2,23 @@ package core
 
 import (
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sync/syncmap"
 
+	"github.com/vjeantet/bitfan/codecs"
+	"github.com/vjeantet/bitfan/commons/tlsconfig"
 	"github.com/vjeantet/bitfan/core/memory"
 	"github.com/vjeantet/bitfan/core/metrics"
+	"github.com/vjeantet/bitfan/core/monitor"
 	"github.com/vjeantet/bitfan/core/webhook"
+	"github.com/vjeantet/bitfan/processors"
 	"github.com/vjeantet/bitfan/processors/doc"
 	"github.com/vjeantet/bitfan/processors/xprocessor"
 	"github.com/vjeantet/bitfan/store"
@@ -32,15 +41,39 @@ type fnMux func(sm *http.ServeMux)
 type Options struct {
 	Host         string
 	HttpHandlers []fnMux
-	Debug        bool
-	VerboseLog   bool
-	LogFile      string
-	DataLocation string
-	Prometheus   string
+	// TLS of the http listener (api, webhooks, metrics)
+	TLS         tlsconfig.Options
+	Debug       bool
+	VerboseLog  bool
+	LogFile     string
+	LogFormat   string
+	LogRotation LogRotation
+	// directory of per pipeline log files, disabled when empty
+	LogPipelinesDir string
+	DataLocation    string
+	// keystore file, default is bitfan.keystore in the data dir
+	Keystore   string
+	Prometheus string
+
+	Statsd       string
+	StatsdPrefix string
+
+	Graphite         string
+	GraphitePrefix   string
+	GraphiteInterval time.Duration
+
+	OpenMetricsFile     string
+	OpenMetricsInterval time.Duration
+
+	// restarts of the failed agents and pipelines
+	Supervisor SupervisorOptions
+	// time given to the pipelines a pipeline depends on to be ready, 30s by
+	// default
+	DependencyTimeout time.Duration
 }
 
 func init() {
-	myMetrics = metrics.New()
+	myMetrics = monitor.Metrics()
 	myScheduler = newScheduler()
 	myScheduler.Start()
 	//Init Store
@@ -93,13 +126,56 @@ func HTTPHandler(path string, s http.Handler) fnMux {
 	}
 }
 
-func listenAndServe(addr string, hs ...fnMux) {
+// listenAndServe binds addr before returning, so that a port already in use
+// or invalid certificates fail the start of bitfan
+func listenAndServe(addr string, tlsOpt tlsconfig.Options, hs ...fnMux) error {
 	httpServerMux := http.NewServeMux()
 	for _, h := range hs {
 		h(httpServerMux)
 	}
-	go http.ListenAndServe(addr, httpServerMux)
-	Log().Infof("Ready to serve on %s", addr)
+
+	if !tlsOpt.Enabled() {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := http.Serve(ln, httpServerMux); err != nil {
+				Log().Errorf("http listener stopped - %v", err)
+			}
+		}()
+		Log().Infof("Ready to serve on %s", addr)
+		return nil
+	}
+
+	certs, err := tlsconfig.New(tlsOpt)
+	if err != nil {
+		return err
+	}
+	certs.ReloadOnSIGHUP(func(err error) {
+		if err != nil {
+			Log().Errorf("TLS certificates not reloaded - %v", err)
+			return
+		}
+		Log().Infof("TLS certificates reloaded")
+	})
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   httpServerMux,
+		TLSConfig: certs.Config(),
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.ServeTLS(ln, "", ""); err != nil {
+			Log().Errorf("https listener stopped - %v", err)
+		}
+	}()
+	Log().Infof("Ready to serve on https://%s", addr)
+	return nil
 }
 
 func Start(opt Options) {
@@ -111,8 +187,16 @@ func Start(opt Options) {
 		setLogDebugMode()
 	}
 
+	if opt.LogFormat != "" {
+		setLogFormat(opt.LogFormat)
+	}
+
 	if opt.LogFile != "" {
-		setLogOutputFile(opt.LogFile)
+		setLogOutputFile(opt.LogFile, opt.LogFormat, opt.LogRotation)
+	}
+
+	if opt.LogPipelinesDir != "" {
+		setLogPipelinesDir(opt.LogPipelinesDir, opt.LogRotation)
 	}
 
 	if err := setDataLocation(opt.DataLocation); err != nil {
@@ -120,34 +204,104 @@ func Start(opt Options) {
 		panic(err.Error())
 	}
 
-	if opt.Prometheus != "" {
-		m := metrics.NewPrometheus(opt.Prometheus)
-		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler(m.Path, m.HTTPHandler()))
-		myMetrics = m
+	if opt.Keystore == "" {
+		opt.Keystore = filepath.Join(opt.DataLocation, "bitfan.keystore")
+	}
+	if err := setKeystore(opt.Keystore); err != nil {
+		Log().Errorf("error with keystore - %v", err)
+		panic(err.Error())
 	}
 
+	setMetrics(&opt)
+
 	// Load env
 	envs := Storage().FindEnvs()
 	for _, v := range envs {
 		os.Setenv(v.Name, v.Value)
+		if v.Secret {
+			Redact(v.Value)
+		}
 	}
 
 	if len(opt.HttpHandlers) > 0 {
 		webhook.Log = logger
-		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler("/h/", webhook.Handler(opt.Host)))
-		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler("/_/", webhook.Handler(opt.Host)))
+		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler("/h/", webhook.Handler(opt.Host, opt.TLS.Enabled())))
+		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler("/_/", webhook.Handler(opt.Host, opt.TLS.Enabled())))
+		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler("/healthz", http.HandlerFunc(healthzHandler)))
+		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler("/readyz", http.HandlerFunc(readyzHandler)))
+
+		if err := listenAndServe(opt.Host, opt.TLS, opt.HttpHandlers...); err != nil {
+			Log().Errorf("error with http listener - %v", err)
+			panic(err.Error())
+		}
+	}
 
-		listenAndServe(opt.Host, opt.HttpHandlers...)
+	if opt.DependencyTimeout > 0 {
+		dependencyTimeout = opt.DependencyTimeout
 	}
+	startSupervisor(opt.Supervisor)
 
+	atomic.StoreInt32(&ready, 1)
 	Log().Debugln("bitfan started")
 }
 
+func setMetrics(opt *Options) {
+	metrics.Log = NewLogger("metrics", nil)
+	exporters := []metrics.Metrics{monitor.Metrics()}
+
+	if opt.Prometheus != "" {
+		m := metrics.NewPrometheus(opt.Prometheus)
+		opt.HttpHandlers = append(opt.HttpHandlers, HTTPHandler(m.Path, m.HTTPHandler()))
+		exporters = append(exporters, m)
+	}
+
+	if opt.Statsd != "" {
+		m, err := metrics.NewStatsd(opt.Statsd, opt.StatsdPrefix)
+		if err != nil {
+			Log().Errorf("statsd metrics not started - %v", err)
+		} else {
+			Log().Infof("pushing metrics to statsd %s", opt.Statsd)
+			exporters = append(exporters, m)
+		}
+	}
+
+	if opt.Graphite != "" {
+		Log().Infof("pushing metrics to graphite %s every %s", opt.Graphite, opt.GraphiteInterval)
+		exporters = append(exporters, metrics.NewGraphite(opt.Graphite, opt.GraphitePrefix, opt.GraphiteInterval))
+	}
+
+	if opt.OpenMetricsFile != "" {
+		Log().Infof("writing metrics to %s every %s", opt.OpenMetricsFile, opt.OpenMetricsInterval)
+		exporters = append(exporters, metrics.NewOpenMetricsFile(opt.OpenMetricsFile, opt.OpenMetricsInterval))
+	}
+
+	if len(exporters) > 1 {
+		myMetrics = metrics.NewMulti(exporters...)
+	}
+}
+
 func StopPipeline(Uuid string) error {
+	// the pipelines depending on it stop first
+	for _, d := range dependents(Uuid) {
+		// already stopped with another dependent it depends on
+		if _, ok := pipelines.Load(d.Uuid); !ok {
+			continue
+		}
+		Log().Infof("stopping pipeline %s, it depends on pipeline %s", d.Label, Uuid)
+		if err := StopPipeline(d.Uuid); err != nil {
+			return err
+		}
+	}
+
 	var err error
+	var label string
+	// no restart while it stops, a pipeline whose restart failed is only
+	// supervised
+	supervised := unsupervise(Uuid)
 	if p, ok := pipelines.Load(Uuid); ok {
+		label = p.(*Pipeline).Label
 		err = p.(*Pipeline).stop()
-	} else {
+	} else if !supervised {
 		err = fmt.Errorf("Pipeline %s not found", Uuid)
 	}
 
@@ -156,21 +310,33 @@ func StopPipeline(Uuid string) error {
 	}
 
 	pipelines.Delete(Uuid)
+	monitor.Publish(monitor.KIND_PIPELINE, map[string]interface{}{
+		"action":         "stopped",
+		"pipeline_uuid":  Uuid,
+		"pipeline_label": label,
+	})
+	ClosePipelineLog(Uuid)
 	return nil
 }
 
 // Stop each pipeline
 func Stop() error {
-	var Uuids = []string{}
+	atomic.StoreInt32(&ready, 0)
+
+	var running = []*Pipeline{}
 	pipelines.Range(func(key, value interface{}) bool {
-		Uuids = append(Uuids, key.(string))
+		running = append(running, value.(*Pipeline))
 		return true
 	})
 
-	for _, Uuid := range Uuids {
-		p, ok := GetPipeline(Uuid)
+	// the pipelines depending on others stop first
+	if sorted, err := SortPipelines(running); err == nil {
+		running = sorted
+	}
+	for i := len(running) - 1; i >= 0; i-- {
+		p, ok := GetPipeline(running[i].Uuid)
 		if !ok {
-			Log().Error("Stop Pipeline - pipeline " + Uuid + " not found")
+			Log().Error("Stop Pipeline - pipeline " + running[i].Uuid + " not found")
 			continue
 		}
 		err := p.Stop()
@@ -179,6 +345,11 @@ func Stop() error {
 		}
 	}
 
+	// flush push based metrics
+	if c, ok := myMetrics.(io.Closer); ok {
+		c.Close()
+	}
+
 	myMemory.Close()
 	myStore.Close()
 	return nil
@@ -210,6 +381,15 @@ func Pipelines() map[string]*Pipeline {
 	return pps
 }
 
+// ProcessorDoc returns the doc of a registered processor, nil when the processor
+// is unknown, xprocessors are not looked up
+func ProcessorDoc(code string) *doc.Processor {
+	if proc, ok := availableProcessorsFactory[code]; ok {
+		return proc().Doc()
+	}
+	return nil
+}
+
 // ProcessorsDocs returns available ProcessorDoc
 func ProcessorsDocs(code string) map[string]*doc.Processor {
 	docs := map[string]*doc.Processor{}
@@ -218,7 +398,10 @@ func ProcessorsDocs(code string) map[string]*doc.Processor {
 			docs[code] = proc().Doc()
 		}
 
-		// get Xprocessors docs
+		// get Xprocessors docs, the storage is not opened by commands working offline
+		if myStore == nil {
+			return docs
+		}
 		if xp, err := Storage().FindOneXProcessorByName(code); err == nil {
 			docs[xp.Label] = xprocessor.NewWithSpec(&xp).Doc()
 			docs[xp.Label].Name = xp.Label
@@ -231,6 +414,9 @@ func ProcessorsDocs(code string) map[string]*doc.Processor {
 		for code, proc := range availableProcessorsFactory {
 			docs[code] = proc().Doc()
 		}
+		if myStore == nil {
+			return docs
+		}
 		// findXprocessors
 		xprocessors := Storage().FindXProcessors("")
 		for _, xp := range xprocessors {
@@ -247,3 +433,30 @@ func ProcessorsDocs(code string) map[string]*doc.Processor {
 
 	return docs
 }
+
+// agentOptionsDoc documents the options bitfan handles for all processors
+var agentOptionsDoc = []*doc.ProcessorOption{
+	{Name: "Workers", Alias: "workers", Type: "int", Doc: "Number of workers processing events in parallel"},
+	{Name: "Interval", Alias: "interval", Type: "interval", Doc: "Schedule of the processor, a number of seconds or a cron expression"},
+	{Name: "Trace", Alias: "trace", Type: "bool", Doc: "Log each event produced by the processor"},
+}
+
+// ProcessorSchema returns the JSON Schema of the settings of a processor or a
+// xprocessor, nil when the processor is unknown
+func ProcessorSchema(code string) *doc.Schema {
+	d, ok := ProcessorsDocs(code)[code]
+	if !ok {
+		return nil
+	}
+	return d.JSONSchema(processors.CommonOptionsDoc(), agentOptionsDoc, codecs.Docs())
+}
+
+// ProcessorsSchemas returns the JSON Schemas of all processors by code
+func ProcessorsSchemas() map[string]*doc.Schema {
+	schemas := map[string]*doc.Schema{}
+	common, codecsDocs := processors.CommonOptionsDoc(), codecs.Docs()
+	for code, d := range ProcessorsDocs("") {
+		schemas[code] = d.JSONSchema(common, agentOptionsDoc, codecsDocs)
+	}
+	return schemas
+}
@@ -0,0 +1,312 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// maximum number of steps of a debugged event, against loops of route
+// processors
+const maxDebugSteps = 1000
+
+// DebugReport is the path of a sample event through the filters of a pipeline
+type DebugReport struct {
+	Steps []*DebugStep `json:"steps"`
+	// Events are the events leaving the filters
+	Events []map[string]interface{} `json:"events"`
+	// Truncated is true when the event went through too many steps
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// DebugStep is an event received by a filter and the events it sent
+type DebugStep struct {
+	Step    int    `json:"step"`
+	AgentID int    `json:"agent_id"`
+	Label   string `json:"label"`
+	Type    string `json:"type"`
+	Source  string `json:"source,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	// Parent is the step which sent the event, 0 for the sample event
+	Parent  int            `json:"parent,omitempty"`
+	Outputs []*DebugOutput `json:"outputs"`
+	// Dropped is true when the filter sent no event
+	Dropped bool   `json:"dropped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DebugOutput is an event sent by a filter, compared with the one it received
+type DebugOutput struct {
+	Ports []int `json:"ports"`
+	// Branch is the condition of the when branch taken, else or on_failure
+	Branch      string                 `json:"branch,omitempty"`
+	Event       map[string]interface{} `json:"event"`
+	Changes     []*FieldChange         `json:"changes,omitempty"`
+	TagsAdded   []string               `json:"tags_added,omitempty"`
+	TagsRemoved []string               `json:"tags_removed,omitempty"`
+}
+
+// FieldChange is a field added, removed or changed by a filter
+type FieldChange struct {
+	Field string      `json:"field"`
+	Kind  string      `json:"kind"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+type debugSent struct {
+	packet processors.IPacket
+	ports  []int
+}
+
+type debugItem struct {
+	agent  *Agent
+	packet processors.IPacket
+	parent int
+}
+
+// Debug runs a sample event through the filters of the pipeline, one filter
+// after the other, and reports the event after each of them. The pipeline is
+// not started, its inputs and outputs are ignored and only the events a
+// filter sends while it receives an event are followed
+func (p *Pipeline) Debug(fields map[string]interface{}) (*DebugReport, error) {
+	filters := map[int]*Agent{}
+	for id, a := range p.agents {
+		if agentKind(a.Type) == "filter" {
+			filters[id] = a
+		}
+	}
+
+	var mu sync.Mutex
+	var sent []debugSent
+	started := []*Agent{}
+	defer func() {
+		for _, a := range started {
+			a.stopProcessor()
+		}
+	}()
+	for _, a := range Sort(filters, SortInputsFirst) {
+		a.PipelineUUID = p.Uuid
+		a.PipelineName = p.Label
+		proc, err := newProcessor(a.Type)
+		if err != nil {
+			return nil, err
+		}
+		a.processor = proc
+		err = a.configure(func(packet processors.IPacket, ports ...int) bool {
+			if len(ports) == 0 {
+				ports = []int{0}
+			}
+			mu.Lock()
+			sent = append(sent, debugSent{packet: packet.Clone(), ports: ports})
+			mu.Unlock()
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("line %d : can not configure agent %s : %v", a.Line, a.Type, err)
+		}
+		if err := proc.Start(newPacket(map[string]interface{}{"message": "start"})); err != nil {
+			return nil, fmt.Errorf("line %d : can not start agent %s : %v", a.Line, a.Type, err)
+		}
+		started = append(started, a)
+	}
+
+	// recipients of the events sent by each filter on each port
+	recipients := map[int]map[int][]*Agent{}
+	sample := newPacket(fields)
+	queue := []debugItem{}
+	for _, a := range Sort(filters, SortInputsFirst) {
+		root := true
+		for _, source := range a.AgentSources {
+			if _, ok := filters[source.AgentID]; !ok {
+				continue
+			}
+			root = false
+			if recipients[source.AgentID] == nil {
+				recipients[source.AgentID] = map[int][]*Agent{}
+			}
+			recipients[source.AgentID][source.PortNumber] = append(recipients[source.AgentID][source.PortNumber], a)
+		}
+		if root {
+			queue = append(queue, debugItem{agent: a, packet: sample.Clone()})
+		}
+	}
+
+	report := &DebugReport{Steps: []*DebugStep{}, Events: []map[string]interface{}{}}
+	if len(queue) == 0 {
+		report.Events = append(report.Events, sample.Fields().Old())
+	}
+	for len(queue) > 0 {
+		if len(report.Steps) >= maxDebugSteps {
+			report.Truncated = true
+			break
+		}
+		item := queue[0]
+		queue = queue[1:]
+		a := item.agent
+
+		step := &DebugStep{
+			Step:    len(report.Steps) + 1,
+			AgentID: a.ID,
+			Label:   a.Label,
+			Type:    a.Type,
+			Source:  a.Source,
+			Line:    a.Line,
+			Parent:  item.parent,
+			Outputs: []*DebugOutput{},
+		}
+		report.Steps = append(report.Steps, step)
+
+		received := item.packet.Clone().Fields().Old()
+		mu.Lock()
+		sent = nil
+		mu.Unlock()
+		if err := receive(a.processor, item.packet); err != nil {
+			step.Error = err.Error()
+		}
+		mu.Lock()
+		outputs := sent
+		sent = nil
+		mu.Unlock()
+
+		step.Dropped = len(outputs) == 0
+		for _, s := range outputs {
+			// the next filters change the packet, the report keeps a copy
+			out := &DebugOutput{Event: s.packet.Clone().Fields().Old()}
+			out.Changes, out.TagsAdded, out.TagsRemoved = diffEvents(received, out.Event)
+
+			next := []*Agent{}
+			for _, port := range s.ports {
+				// without on_failure block failed events follow the main flow
+				if port == processors.PORT_FAILURE && len(recipients[a.ID][port]) == 0 {
+					port = 0
+				}
+				out.Ports = append(out.Ports, port)
+				if label := portLabel(a, port); label != "" && out.Branch == "" && (a.Type == "when" || port == processors.PORT_FAILURE) {
+					out.Branch = label
+				}
+				next = append(next, recipients[a.ID][port]...)
+			}
+			step.Outputs = append(step.Outputs, out)
+
+			if len(next) == 0 {
+				report.Events = append(report.Events, out.Event)
+			}
+			for i, n := range next {
+				packet := s.packet
+				if i > 0 {
+					packet = packet.Clone()
+				}
+				queue = append(queue, debugItem{agent: n, packet: packet, parent: step.Step})
+			}
+		}
+	}
+	return report, nil
+}
+
+// receive gives an event to a processor, a panic of the processor is an error
+func receive(proc processors.Processor, packet processors.IPacket) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic : %v", r)
+		}
+	}()
+	return proc.Receive(packet)
+}
+
+// stopProcessor stops the processor of an agent which was not started
+func (a *Agent) stopProcessor() {
+	if err := a.processor.Stop(newPacket(nil)); err != nil {
+		Log().Errorf("%s %d : %v", a.Type, a.ID, err)
+	}
+	myScheduler.Remove(a.PipelineUUID, a.Label)
+	if wh := a.processor.B().WebHook; wh != nil {
+		wh.Unregister()
+	}
+}
+
+// diffEvents returns the fields changed between two events, tags are
+// compared apart
+func diffEvents(before, after map[string]interface{}) ([]*FieldChange, []string, []string) {
+	changes := diffFields("", before, after)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+
+	tagsBefore, tagsAfter := tagSet(before["tags"]), tagSet(after["tags"])
+	added, removed := []string{}, []string{}
+	for _, t := range tagList(after["tags"]) {
+		if !tagsBefore[t] {
+			added = append(added, t)
+		}
+	}
+	for _, t := range tagList(before["tags"]) {
+		if !tagsAfter[t] {
+			removed = append(removed, t)
+		}
+	}
+	return changes, added, removed
+}
+
+func diffFields(prefix string, before, after map[string]interface{}) []*FieldChange {
+	changes := []*FieldChange{}
+	for k, oldValue := range before {
+		field := prefix + k
+		if field == "tags" {
+			continue
+		}
+		newValue, ok := after[k]
+		if !ok {
+			changes = append(changes, &FieldChange{Field: field, Kind: "removed", Old: oldValue})
+			continue
+		}
+		oldMap, oldIsMap := toFields(oldValue)
+		newMap, newIsMap := toFields(newValue)
+		if oldIsMap && newIsMap {
+			changes = append(changes, diffFields(field+".", oldMap, newMap)...)
+		} else if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, &FieldChange{Field: field, Kind: "changed", Old: oldValue, New: newValue})
+		}
+	}
+	for k, newValue := range after {
+		if _, ok := before[k]; !ok && prefix+k != "tags" {
+			changes = append(changes, &FieldChange{Field: prefix + k, Kind: "added", New: newValue})
+		}
+	}
+	return changes
+}
+
+func toFields(v interface{}) (map[string]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	m := map[string]interface{}{}
+	for _, k := range rv.MapKeys() {
+		m[k.String()] = rv.MapIndex(k).Interface()
+	}
+	return m, true
+}
+
+func tagList(v interface{}) []string {
+	tags := []string{}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			tags = append(tags, fmt.Sprint(rv.Index(i).Interface()))
+		}
+	case reflect.String:
+		tags = append(tags, rv.String())
+	}
+	return tags
+}
+
+func tagSet(v interface{}) map[string]bool {
+	set := map[string]bool{}
+	for _, t := range tagList(v) {
+		set[t] = true
+	}
+	return set
+}
@@ -0,0 +1,293 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+func TestDiffEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  map[string]interface{}
+		after   map[string]interface{}
+		changes []string
+		added   []string
+		removed []string
+	}{
+		{
+			name:   "unchanged",
+			before: map[string]interface{}{"message": "hello", "count": 1},
+			after:  map[string]interface{}{"message": "hello", "count": 1},
+		},
+		{
+			name:    "added, removed and changed fields",
+			before:  map[string]interface{}{"message": "hello", "count": 1, "host": "a"},
+			after:   map[string]interface{}{"message": "hello", "count": 2, "user": "bob"},
+			changes: []string{"count changed 1 2", "host removed a <nil>", "user added <nil> bob"},
+		},
+		{
+			name:    "nested fields",
+			before:  map[string]interface{}{"geo": map[string]interface{}{"city": "Paris", "zip": "75001"}},
+			after:   map[string]interface{}{"geo": map[string]interface{}{"city": "Lyon", "country": "FR"}},
+			changes: []string{"geo.city changed Paris Lyon", "geo.country added <nil> FR", "geo.zip removed 75001 <nil>"},
+		},
+		{
+			name:    "typed nested map",
+			before:  map[string]interface{}{"headers": map[string]string{"a": "1"}},
+			after:   map[string]interface{}{"headers": map[string]string{"a": "2"}},
+			changes: []string{"headers.a changed 1 2"},
+		},
+		{
+			name:    "map replaced by a value",
+			before:  map[string]interface{}{"geo": map[string]interface{}{"city": "Paris"}},
+			after:   map[string]interface{}{"geo": "Paris"},
+			changes: []string{"geo changed map[city:Paris] Paris"},
+		},
+		{
+			name:    "tags",
+			before:  map[string]interface{}{"tags": []string{"a", "b"}},
+			after:   map[string]interface{}{"tags": []interface{}{"b", "c"}},
+			added:   []string{"c"},
+			removed: []string{"a"},
+		},
+		{
+			name:    "tag as a string",
+			before:  map[string]interface{}{"tags": "a"},
+			after:   map[string]interface{}{},
+			removed: []string{"a"},
+		},
+		{
+			name:  "first tags",
+			after: map[string]interface{}{"tags": []string{"a"}},
+			added: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before == nil {
+				tt.before = map[string]interface{}{}
+			}
+			changes, added, removed := diffEvents(tt.before, tt.after)
+			got := []string{}
+			for _, c := range changes {
+				got = append(got, fmt.Sprintf("%s %s %v %v", c.Field, c.Kind, c.Old, c.New))
+			}
+			if tt.changes == nil {
+				tt.changes = []string{}
+			}
+			if tt.added == nil {
+				tt.added = []string{}
+			}
+			if tt.removed == nil {
+				tt.removed = []string{}
+			}
+			assert.Equal(t, tt.changes, got)
+			assert.Equal(t, tt.added, added)
+			assert.Equal(t, tt.removed, removed)
+		})
+	}
+}
+
+func TestDiffFieldsPrefix(t *testing.T) {
+	changes := diffFields("event.", map[string]interface{}{"a": 1}, map[string]interface{}{"a": 1, "b": 2})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, &FieldChange{Field: "event.b", Kind: "added", New: 2}, changes[0])
+}
+
+// debugProcessor tags the events it receives with its label and sends them.
+// The agent labeled "second" routes them according to their message : nothing
+// for "drop", on the failure port without the first tag for "fail",
+// maxDebugSteps copies for "split", a panic for "panic" and on port 1
+// otherwise
+type debugProcessor struct {
+	processors.Base
+	send processors.PacketSender
+}
+
+func (p *debugProcessor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) error {
+	p.send = ctx.PacketSender()
+	return nil
+}
+
+func (p *debugProcessor) Receive(e processors.IPacket) error {
+	e.Fields().SetValueForPath(p.Label, "last")
+	// tags of cloned events are not []string, processors.AddTags would drop them
+	tags := append(tagList((*e.Fields())["tags"]), p.Label)
+	if e.Message() == "fail" && p.Label == "second" {
+		tags = tags[1:]
+	}
+	e.Fields().SetValueForPath(tags, "tags")
+	if p.Label != "second" {
+		p.send(e)
+		return nil
+	}
+	switch e.Message() {
+	case "drop":
+	case "fail":
+		p.send(e, processors.PORT_FAILURE)
+	case "split":
+		for i := 0; i < maxDebugSteps; i++ {
+			p.send(e.Clone(), 1)
+		}
+	case "panic":
+		panic("boom")
+	default:
+		p.send(e, 1)
+	}
+	return nil
+}
+
+func withTestStorage(t *testing.T) {
+	if err := setDataLocation(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		myStore.Close()
+		myStore = nil
+	})
+}
+
+// debugSteps describes the steps of a report
+func debugSteps(report *DebugReport) []string {
+	steps := []string{}
+	for _, s := range report.Steps {
+		step := fmt.Sprintf("%d:%s<-%d", s.Step, s.Label, s.Parent)
+		for _, o := range s.Outputs {
+			step += fmt.Sprintf(" ports=%v", o.Ports)
+			if o.Branch != "" {
+				step += " branch=" + o.Branch
+			}
+			step += fmt.Sprintf(" tags+%v tags-%v", o.TagsAdded, o.TagsRemoved)
+		}
+		if s.Dropped {
+			step += " dropped"
+		}
+		if s.Error != "" {
+			step += " error=" + s.Error
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func TestDebug(t *testing.T) {
+	withTestStorage(t)
+	availableProcessorsFactory["test_debug"] = func() processors.Processor { return &debugProcessor{} }
+	t.Cleanup(func() { delete(availableProcessorsFactory, "test_debug") })
+
+	// first -> second -port 1-> third, second sends its failures to rescue
+	// when onFailure is true
+	newDebugPipeline := func(onFailure bool) *Pipeline {
+		p := &Pipeline{Uuid: t.Name(), Label: t.Name(), agents: map[int]*Agent{}}
+		agents := []*Agent{
+			{ID: 1, Label: "first", Type: "test_debug"},
+			{ID: 2, Label: "second", Type: "test_debug", AgentSources: PortList{{AgentID: 1}}},
+			{ID: 3, Label: "third", Type: "test_debug", AgentSources: PortList{{AgentID: 2, PortNumber: 1}}},
+			{ID: 4, Label: "stdout", Type: "output_stdout", AgentSources: PortList{{AgentID: 3}}},
+		}
+		if onFailure {
+			agents = append(agents, &Agent{ID: 5, Label: "rescue", Type: "test_debug", AgentSources: PortList{{AgentID: 2, PortNumber: processors.PORT_FAILURE}}})
+		}
+		for _, a := range agents {
+			p.agents[a.ID] = a
+		}
+		return p
+	}
+
+	tests := []struct {
+		name      string
+		message   string
+		onFailure bool
+		steps     []string
+		last      []string
+	}{
+		{
+			"main flow", "hello", false,
+			[]string{
+				"1:first<-0 ports=[0] tags+[first] tags-[]",
+				"2:second<-1 ports=[1] tags+[second] tags-[]",
+				"3:third<-2 ports=[0] tags+[third] tags-[]",
+			},
+			[]string{"third"},
+		},
+		{
+			"dropped", "drop", false,
+			[]string{
+				"1:first<-0 ports=[0] tags+[first] tags-[]",
+				"2:second<-1 dropped",
+			},
+			[]string{},
+		},
+		{
+			"on_failure block", "fail", true,
+			[]string{
+				"1:first<-0 ports=[0] tags+[first] tags-[]",
+				"2:second<-1 ports=[-1] branch=on_failure tags+[second] tags-[first]",
+				"3:rescue<-2 ports=[0] tags+[rescue] tags-[]",
+			},
+			[]string{"rescue"},
+		},
+		{
+			// without on_failure block the event follows the main flow
+			"failure without on_failure block", "fail", false,
+			[]string{
+				"1:first<-0 ports=[0] tags+[first] tags-[]",
+				"2:second<-1 ports=[0] tags+[second] tags-[first]",
+			},
+			[]string{"second"},
+		},
+		{
+			"panic", "panic", false,
+			[]string{
+				"1:first<-0 ports=[0] tags+[first] tags-[]",
+				"2:second<-1 dropped error=panic : boom",
+			},
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := newDebugPipeline(tt.onFailure).Debug(map[string]interface{}{"message": tt.message})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.steps, debugSteps(report))
+			last := []string{}
+			for _, e := range report.Events {
+				last = append(last, e["last"].(string))
+			}
+			assert.Equal(t, tt.last, last)
+			assert.False(t, report.Truncated)
+		})
+	}
+
+	t.Run("too many steps", func(t *testing.T) {
+		report, err := newDebugPipeline(false).Debug(map[string]interface{}{"message": "split"})
+		assert.NoError(t, err)
+		assert.True(t, report.Truncated)
+		assert.Len(t, report.Steps, maxDebugSteps)
+		assert.Len(t, report.Events, maxDebugSteps-2)
+	})
+
+	t.Run("without filters", func(t *testing.T) {
+		p := &Pipeline{Uuid: t.Name(), agents: map[int]*Agent{
+			1: {ID: 1, Label: "stdout", Type: "output_stdout"},
+		}}
+		report, err := p.Debug(map[string]interface{}{"message": "hello"})
+		assert.NoError(t, err)
+		assert.Empty(t, report.Steps)
+		assert.Len(t, report.Events, 1)
+		assert.Equal(t, "hello", report.Events[0]["message"])
+	})
+
+	t.Run("unknown processor", func(t *testing.T) {
+		p := &Pipeline{Uuid: t.Name(), agents: map[int]*Agent{
+			1: {ID: 1, Label: "nope", Type: "test_unknown", Line: 3},
+		}}
+		_, err := p.Debug(map[string]interface{}{})
+		assert.Error(t, err)
+	})
+}
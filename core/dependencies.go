@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vjeantet/bitfan/commons/depgraph"
+)
+
+// time given to the pipelines a pipeline depends on to be ready
+var dependencyTimeout = 30 * time.Second
+
+// SortPipelines orders pipelines, each one after the pipelines it depends on,
+// a dependency cycle is an error
+func SortPipelines(ppls []*Pipeline) ([]*Pipeline, error) {
+	byUUID := map[string]*Pipeline{}
+	uuids := []string{}
+	deps := map[string][]string{}
+	for _, p := range ppls {
+		byUUID[p.Uuid] = p
+		uuids = append(uuids, p.Uuid)
+		deps[p.Uuid] = p.DependsOn
+	}
+	sorted, err := depgraph.Sort(uuids, deps)
+	if err != nil {
+		return nil, err
+	}
+	ordered := make([]*Pipeline, len(sorted))
+	for i, uuid := range sorted {
+		ordered[i] = byUUID[uuid]
+	}
+	return ordered, nil
+}
+
+// Ready tells if the pipeline runs with all its agents started and its inputs
+// up
+func (p *Pipeline) Ready() bool {
+	_, _, err := p.failures()
+	return err == nil
+}
+
+// waitDependencies waits until the pipelines p depends on are ready, a
+// dependency which is not running is an error
+func (p *Pipeline) waitDependencies(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, uuid := range p.DependsOn {
+		if uuid == p.Uuid {
+			return fmt.Errorf("pipeline %s depends on itself", p.Label)
+		}
+		for {
+			dep, ok := pipelines.Load(uuid)
+			if !ok {
+				return fmt.Errorf("pipeline %s depends on pipeline %s which is not running", p.Label, uuid)
+			}
+			if dep.(*Pipeline).Ready() {
+				break
+			}
+			if !time.Now().Before(deadline) {
+				return fmt.Errorf("pipeline %s depends on pipeline %s which is not ready after %s", p.Label, dep.(*Pipeline).Label, timeout)
+			}
+			Log().Debugf("pipeline %s waits for pipeline %s", p.Label, dep.(*Pipeline).Label)
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// dependents returns the running pipelines which depend on a pipeline
+func dependents(UUID string) []*Pipeline {
+	list := []*Pipeline{}
+	pipelines.Range(func(key, value interface{}) bool {
+		p := value.(*Pipeline)
+		for _, uuid := range p.DependsOn {
+			if uuid == UUID {
+				list = append(list, p)
+				break
+			}
+		}
+		return true
+	})
+	return list
+}
+
+// allDependents returns the running pipelines which depend on a pipeline,
+// directly or through other pipelines
+func allDependents(UUID string, seen map[string]bool) []*Pipeline {
+	list := []*Pipeline{}
+	for _, p := range dependents(UUID) {
+		if seen[p.Uuid] {
+			continue
+		}
+		seen[p.Uuid] = true
+		list = append(list, p)
+		list = append(list, allDependents(p.Uuid, seen)...)
+	}
+	return list
+}
+
+// RestartPipeline stops the running pipeline p replaces and the pipelines
+// depending on it, then starts p and the dependents again, in dependency
+// order. A failed start does not prevent the next ones, the errors are
+// returned together
+func RestartPipeline(p *Pipeline) error {
+	restarted, err := SortPipelines(allDependents(p.Uuid, map[string]bool{p.Uuid: true}))
+	if err != nil {
+		return err
+	}
+	// the dependents stop first
+	if err := StopPipeline(p.Uuid); err != nil {
+		return err
+	}
+	failures := []string{}
+	if _, err := p.Start(); err != nil {
+		failures = append(failures, fmt.Sprintf("pipeline %s : %v", p.Label, err))
+	}
+	for _, d := range restarted {
+		Log().Infof("starting pipeline %s again after pipeline %s", d.Label, p.Label)
+		if _, err := d.Start(); err != nil {
+			failures = append(failures, fmt.Sprintf("pipeline %s : %v", d.Label, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("restart failed - %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// depProcessor records the starts and stops of the agents, the ones labeled
+// in failing fail to start
+type depProcessor struct {
+	processors.Base
+}
+
+var depRecords = struct {
+	sync.Mutex
+	list    []string
+	failing map[string]bool
+}{}
+
+func (p *depProcessor) Start(e processors.IPacket) error {
+	depRecords.Lock()
+	defer depRecords.Unlock()
+	depRecords.list = append(depRecords.list, "start "+p.Label)
+	if depRecords.failing[p.Label] {
+		return errors.New("refused")
+	}
+	return nil
+}
+
+func (p *depProcessor) Stop(e processors.IPacket) error {
+	depRecords.Lock()
+	defer depRecords.Unlock()
+	depRecords.list = append(depRecords.list, "stop "+p.Label)
+	return nil
+}
+
+// records returns and forgets the starts and stops
+func records() []string {
+	depRecords.Lock()
+	defer depRecords.Unlock()
+	list := depRecords.list
+	depRecords.list = nil
+	return list
+}
+
+// withDependencies registers the depProcessor and cleans the running
+// pipelines up
+func withDependencies(t *testing.T) {
+	withTestStorage(t)
+	availableProcessorsFactory["test_dep"] = func() processors.Processor { return &depProcessor{} }
+	depRecords.failing = map[string]bool{}
+	records()
+	t.Cleanup(func() {
+		for _, p := range Pipelines() {
+			StopPipeline(p.Uuid)
+		}
+		delete(availableProcessorsFactory, "test_dep")
+	})
+}
+
+func depPipeline(label string, dependsOn ...string) *Pipeline {
+	return &Pipeline{Uuid: label, Label: label, DependsOn: dependsOn, agents: map[int]*Agent{
+		1: {ID: 1, Label: label, Type: "test_dep", PoolSize: 1},
+	}}
+}
+
+func labels(ppls []*Pipeline) []string {
+	l := []string{}
+	for _, p := range ppls {
+		l = append(l, p.Label)
+	}
+	return l
+}
+
+// running returns the labels of the running pipelines
+func running() []string {
+	l := []string{}
+	for _, p := range Pipelines() {
+		l = append(l, p.Label)
+	}
+	sort.Strings(l)
+	return l
+}
+
+func TestSortPipelines(t *testing.T) {
+	sorted, err := SortPipelines([]*Pipeline{depPipeline("c", "b"), depPipeline("a"), depPipeline("b", "a")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, labels(sorted))
+
+	_, err = SortPipelines([]*Pipeline{depPipeline("a", "b"), depPipeline("b", "a")})
+	assert.Error(t, err)
+}
+
+func TestWaitDependencies(t *testing.T) {
+	withDependencies(t)
+
+	assert.EqualError(t, depPipeline("b", "b").waitDependencies(0), "pipeline b depends on itself")
+	assert.EqualError(t, depPipeline("b", "a").waitDependencies(0), "pipeline b depends on pipeline a which is not running")
+
+	depRecords.failing["a"] = true
+	a := depPipeline("a")
+	_, err := a.Start()
+	assert.NoError(t, err)
+	assert.False(t, a.Ready())
+	assert.EqualError(t, depPipeline("b", "a").waitDependencies(100*time.Millisecond),
+		"pipeline b depends on pipeline a which is not ready after 100ms")
+
+	// a starts while b waits
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		a.agents[1].setStartError(nil)
+	}()
+	assert.NoError(t, depPipeline("b", "a").waitDependencies(5*time.Second))
+	assert.True(t, a.Ready())
+}
+
+func TestStopPipelineStopsDependents(t *testing.T) {
+	withDependencies(t)
+	for _, p := range []*Pipeline{depPipeline("a"), depPipeline("b", "a"), depPipeline("c", "b"), depPipeline("d")} {
+		_, err := p.Start()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"start a", "start b", "start c", "start d"}, records())
+	assert.Equal(t, []string{"b"}, labels(dependents("a")))
+	assert.Equal(t, []string{"b", "c"}, labels(allDependents("a", map[string]bool{"a": true})))
+
+	assert.NoError(t, StopPipeline("a"))
+	assert.Equal(t, []string{"stop c", "stop b", "stop a"}, records())
+	assert.Equal(t, []string{"d"}, running())
+}
+
+func TestRestartPipeline(t *testing.T) {
+	withDependencies(t)
+	for _, p := range []*Pipeline{depPipeline("a"), depPipeline("b", "a"), depPipeline("c", "b", "a")} {
+		_, err := p.Start()
+		assert.NoError(t, err)
+	}
+	records()
+
+	// the dependents stop first and start again after the new a
+	assert.NoError(t, RestartPipeline(depPipeline("a")))
+	assert.Equal(t, []string{"stop c", "stop b", "stop a", "start a", "start b", "start c"}, records())
+	assert.Equal(t, []string{"a", "b", "c"}, running())
+
+	// a failed start does not prevent the next ones
+	defer func(d time.Duration) { dependencyTimeout = d }(dependencyTimeout)
+	dependencyTimeout = 100 * time.Millisecond
+	depRecords.failing["b"] = true
+	err := RestartPipeline(depPipeline("a"))
+	assert.EqualError(t, err, "restart failed - pipeline c : pipeline c depends on pipeline b which is not ready after 100ms")
+	assert.Equal(t, []string{"stop c", "stop b", "stop a", "start a", "start b"}, records())
+	assert.Equal(t, []string{"a", "b"}, running())
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// ready is set to 1 once the core is started
+var ready int32
+
+// AgentHealth is the health of an agent, Details are set when its processor
+// implements processors.HealthChecker
+type AgentHealth struct {
+	ID          int    `json:"id"`
+	Label       string `json:"label"`
+	Type        string `json:"type"`
+	Status      string `json:"status"`
+	QueueLength int    `json:"queue_length"`
+	QueueSize   int    `json:"queue_size"`
+	Paused      bool   `json:"paused,omitempty"`
+	// Error of the last failed start of the agent, or the panic of one of its workers
+	Error   string             `json:"error,omitempty"`
+	Details *processors.Health `json:"details,omitempty"`
+}
+
+// PipelineHealth is the health of a pipeline, its status is the worst status of its agents
+type PipelineHealth struct {
+	Uuid   string        `json:"uuid"`
+	Label  string        `json:"label"`
+	Status string        `json:"status"`
+	Paused bool          `json:"paused,omitempty"`
+	Agents []AgentHealth `json:"agents"`
+}
+
+// HealthReport is the health of all running pipelines
+type HealthReport struct {
+	Status    string           `json:"status"`
+	Ready     bool             `json:"ready"`
+	Pipelines []PipelineHealth `json:"pipelines"`
+}
+
+var healthSeverity = map[string]int{
+	processors.HEALTH_UP:       0,
+	processors.HEALTH_DEGRADED: 1,
+	processors.HEALTH_DOWN:     2,
+}
+
+func worstHealth(a, b string) string {
+	if healthSeverity[b] > healthSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// Health returns the agent's health, the run state of its pipeline must be
+// locked
+func (a *Agent) Health() AgentHealth {
+	h := AgentHealth{
+		ID:          a.ID,
+		Label:       a.Label,
+		Type:        a.Type,
+		Status:      processors.HEALTH_UP,
+		QueueLength: len(a.packetChan),
+		QueueSize:   cap(a.packetChan),
+		Paused:      a.Paused(),
+	}
+
+	if err := a.Crash(); err != nil {
+		h.Status = processors.HEALTH_DOWN
+		h.Error = err.Error()
+		return h
+	}
+
+	if err := a.StartError(); err != nil {
+		h.Status = processors.HEALTH_DOWN
+		h.Error = err.Error()
+		return h
+	}
+
+	// agent's workers are gone
+	select {
+	case <-a.Done:
+		h.Status = processors.HEALTH_DOWN
+		return h
+	default:
+	}
+
+	if hc, ok := a.processor.(processors.HealthChecker); ok {
+		details := hc.Health()
+		h.Details = &details
+		h.Status = details.Status
+	}
+
+	return h
+}
+
+// Health returns the pipeline's health and the health of each of its agents
+func (p *Pipeline) Health() PipelineHealth {
+	h := PipelineHealth{
+		Uuid:   p.Uuid,
+		Label:  p.Label,
+		Status: processors.HEALTH_UP,
+		Paused: p.Paused(),
+		Agents: []AgentHealth{},
+	}
+	p.run.RLock()
+	defer p.run.RUnlock()
+	for _, a := range p.agents {
+		ah := a.Health()
+		h.Status = worstHealth(h.Status, ah.Status)
+		h.Agents = append(h.Agents, ah)
+	}
+	sort.Slice(h.Agents, func(i, j int) bool { return h.Agents[i].ID < h.Agents[j].ID })
+	return h
+}
+
+// Health returns the health of bitfan and of all its running pipelines
+func Health() HealthReport {
+	r := HealthReport{
+		Status:    processors.HEALTH_UP,
+		Ready:     atomic.LoadInt32(&ready) == 1,
+		Pipelines: []PipelineHealth{},
+	}
+	for _, p := range Pipelines() {
+		ph := p.Health()
+		r.Status = worstHealth(r.Status, ph.Status)
+		r.Pipelines = append(r.Pipelines, ph)
+	}
+	sort.Slice(r.Pipelines, func(i, j int) bool { return r.Pipelines[i].Label < r.Pipelines[j].Label })
+	return r
+}
+
+// healthzHandler fails only when an agent is down
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	report := Health()
+	code := http.StatusOK
+	if report.Status == processors.HEALTH_DOWN {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, code, report)
+}
+
+// readyzHandler fails until bitfan is started and while an agent is degraded or down
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := Health()
+	code := http.StatusOK
+	if !report.Ready || report.Status != processors.HEALTH_UP {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, code, report)
+}
+
+func writeHealth(w http.ResponseWriter, code int, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// healthAgent returns an agent whose processor failed failures times in a row
+func healthAgent(id int, agentType string, failures int) *Agent {
+	proc := &fakeProcessor{}
+	for i := 0; i < failures; i++ {
+		proc.Failure(errors.New("connection refused"))
+	}
+	return newTestAgent(id, agentType, proc)
+}
+
+// healthPipeline registers a pipeline made of agents, without running it
+func healthPipeline(t *testing.T, label string, agents ...*Agent) *Pipeline {
+	p := &Pipeline{Uuid: label, Label: label, agents: map[int]*Agent{}}
+	for _, a := range agents {
+		p.agents[a.ID] = a
+	}
+	pipelines.Store(p.Uuid, p)
+	t.Cleanup(func() { pipelines.Delete(p.Uuid) })
+	return p
+}
+
+// withReady sets whether the core is started for the test
+func withReady(t *testing.T, started bool) {
+	previous := atomic.LoadInt32(&ready)
+	if started {
+		atomic.StoreInt32(&ready, 1)
+	} else {
+		atomic.StoreInt32(&ready, 0)
+	}
+	t.Cleanup(func() { atomic.StoreInt32(&ready, previous) })
+}
+
+func TestAgentHealth(t *testing.T) {
+	queued := newTestAgent(1, "test", &depProcessor{})
+	queued.packetChan = make(chan *event, 10)
+	queued.packetChan <- &event{}
+	queued.packetChan <- &event{}
+
+	paused := healthAgent(1, "input_test", 0)
+	paused.pauses = &pauseState{}
+	paused.pauses.pause()
+
+	startFailed := healthAgent(1, "test", 0)
+	startFailed.setStartError(errors.New("can not connect"))
+
+	crashed := healthAgent(1, "test", 0)
+	crashed.failure.crash = errors.New("boom")
+
+	stopped := healthAgent(1, "test", 0)
+	close(stopped.Done)
+
+	tests := []struct {
+		name    string
+		agent   *Agent
+		status  string
+		err     string
+		details bool
+	}{
+		{"without health checker", queued, processors.HEALTH_UP, "", false},
+		{"up", healthAgent(1, "test", 0), processors.HEALTH_UP, "", true},
+		{"degraded", healthAgent(1, "test", 1), processors.HEALTH_DEGRADED, "", true},
+		{"down", healthAgent(1, "test", 5), processors.HEALTH_DOWN, "", true},
+		{"paused", paused, processors.HEALTH_UP, "", true},
+		{"start failed", startFailed, processors.HEALTH_DOWN, "can not connect", false},
+		{"crashed", crashed, processors.HEALTH_DOWN, "boom", false},
+		{"workers gone", stopped, processors.HEALTH_DOWN, "", false},
+	}
+	for _, tt := range tests {
+		h := tt.agent.Health()
+		assert.Equal(t, tt.status, h.Status, tt.name)
+		assert.Equal(t, tt.err, h.Error, tt.name)
+		assert.Equal(t, tt.details, h.Details != nil, tt.name)
+		assert.Equal(t, tt.agent == paused, h.Paused, tt.name)
+	}
+
+	h := queued.Health()
+	assert.Equal(t, 2, h.QueueLength)
+	assert.Equal(t, 10, h.QueueSize)
+}
+
+func TestPipelineHealth(t *testing.T) {
+	p := healthPipeline(t, "web",
+		healthAgent(3, "output_test", 1),
+		healthAgent(1, "input_test", 0),
+		healthAgent(2, "test", 0),
+	)
+	h := p.Health()
+	assert.Equal(t, processors.HEALTH_DEGRADED, h.Status)
+	assert.False(t, h.Paused)
+	if assert.Len(t, h.Agents, 3) {
+		assert.Equal(t, []int{1, 2, 3}, []int{h.Agents[0].ID, h.Agents[1].ID, h.Agents[2].ID})
+	}
+
+	// a down agent makes the pipeline down, whatever the other agents
+	p.agents[4] = healthAgent(4, "output_test", 5)
+	assert.Equal(t, processors.HEALTH_DOWN, p.Health().Status)
+
+	assert.Equal(t, processors.HEALTH_UP, healthPipeline(t, "empty").Health().Status)
+}
+
+func TestHealth(t *testing.T) {
+	withReady(t, true)
+	healthPipeline(t, "web", healthAgent(1, "input_test", 0))
+	healthPipeline(t, "mail", healthAgent(1, "input_test", 1))
+	healthPipeline(t, "audit", healthAgent(1, "input_test", 0))
+
+	r := Health()
+	assert.True(t, r.Ready)
+	assert.Equal(t, processors.HEALTH_DEGRADED, r.Status)
+	labels := []string{}
+	for _, ph := range r.Pipelines {
+		labels = append(labels, ph.Label)
+	}
+	assert.Equal(t, []string{"audit", "mail", "web"}, labels)
+}
+
+func TestHealthHandlers(t *testing.T) {
+	tests := []struct {
+		name     string
+		started  bool
+		failures int
+		healthz  int
+		readyz   int
+	}{
+		{"up", true, 0, http.StatusOK, http.StatusOK},
+		{"starting", false, 0, http.StatusOK, http.StatusServiceUnavailable},
+		{"degraded", true, 1, http.StatusOK, http.StatusServiceUnavailable},
+		{"down", true, 5, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withReady(t, tt.started)
+			healthPipeline(t, "web", healthAgent(1, "input_test", tt.failures))
+
+			for path, handler := range map[string]http.HandlerFunc{"/healthz": healthzHandler, "/readyz": readyzHandler} {
+				w := httptest.NewRecorder()
+				handler(w, httptest.NewRequest("GET", path, nil))
+
+				expected := tt.healthz
+				if path == "/readyz" {
+					expected = tt.readyz
+				}
+				assert.Equal(t, expected, w.Code, path)
+				assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"), path)
+
+				var report HealthReport
+				if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report), path) {
+					assert.Equal(t, tt.started, report.Ready, path)
+					assert.Len(t, report.Pipelines, 1, path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// maximum time to wait for room in the queue of an agent
+var injectTimeout = 5 * time.Second
+
+// Inject pushes events into the queue of an agent of a running pipeline, as if
+// they were sent by its sources, and returns the number of events pushed. An
+// @timestamp given as a RFC3339 string is parsed, a missing one is now
+func (p *Pipeline) Inject(agentID int, events []map[string]interface{}) (int, error) {
+	a, ok := p.agents[agentID]
+	if !ok {
+		return 0, fmt.Errorf("agent %d not found in pipeline %s", agentID, p.Label)
+	}
+	if agentKind(a.Type) == "input" {
+		return 0, fmt.Errorf("agent %d of pipeline %s is an input, it receives no event", agentID, p.Label)
+	}
+	p.run.RLock()
+	defer p.run.RUnlock()
+	if a.packetChan == nil {
+		return 0, fmt.Errorf("agent %d of pipeline %s is not running", agentID, p.Label)
+	}
+
+	for i, fields := range events {
+		if err := a.inject(newPacket(fields).(*event)); err != nil {
+			return i, err
+		}
+	}
+	Log().Infof("%d event(s) injected into agent %s of pipeline %s", len(events), a.Label, p.Label)
+	return len(events), nil
+}
+
+// inject pushes an event into the queue of the agent, it fails when the agent
+// is stopped or its queue stays full
+func (a *Agent) inject(e *event) (err error) {
+	defer func() {
+		// the queue is closed when the agent stops
+		if r := recover(); r != nil {
+			err = fmt.Errorf("agent %d of pipeline %s is stopped", a.ID, a.PipelineName)
+		}
+	}()
+
+	timer := time.NewTimer(injectTimeout)
+	defer timer.Stop()
+	select {
+	case a.packetChan <- e:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("queue of agent %d of pipeline %s is full", a.ID, a.PipelineName)
+	}
+}
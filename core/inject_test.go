@@ -0,0 +1,60 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// injectPipeline returns a pipeline whose filter has a queue of 2 events
+func injectPipeline() (*Pipeline, *Agent) {
+	filter := newTestAgent(2, "filter_mutate", &fakeProcessor{})
+	filter.PipelineName = "web"
+	filter.packetChan = make(chan *event, 2)
+	return &Pipeline{Uuid: "p1", Label: "web", agents: map[int]*Agent{
+		1: newTestAgent(1, "input_stdin", &fakeProcessor{}),
+		2: filter,
+		3: newTestAgent(3, "output_stdout", &fakeProcessor{}),
+	}}, filter
+}
+
+func TestInject(t *testing.T) {
+	defer func(d time.Duration) { injectTimeout = d }(injectTimeout)
+	injectTimeout = 50 * time.Millisecond
+	p, filter := injectPipeline()
+
+	n, err := p.Inject(2, []map[string]interface{}{{"message": "one"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	e := <-filter.packetChan
+	assert.Equal(t, "one", e.Message())
+
+	// the queue has room for 2 events, the third one times out
+	n, err = p.Inject(2, []map[string]interface{}{{"message": "a"}, {"message": "b"}, {"message": "c"}})
+	assert.EqualError(t, err, "queue of agent 2 of pipeline web is full")
+	assert.Equal(t, 2, n)
+	assert.Len(t, filter.packetChan, 2)
+
+	// a stopped agent
+	close(filter.packetChan)
+	_, err = p.Inject(2, []map[string]interface{}{{"message": "one"}})
+	assert.EqualError(t, err, "agent 2 of pipeline web is stopped")
+}
+
+func TestInjectErrors(t *testing.T) {
+	p, _ := injectPipeline()
+	tests := []struct {
+		agentID int
+		err     string
+	}{
+		{4, "agent 4 not found in pipeline web"},
+		{1, "agent 1 of pipeline web is an input, it receives no event"},
+		{3, "agent 3 of pipeline web is not running"},
+	}
+	for _, tt := range tests {
+		n, err := p.Inject(tt.agentID, []map[string]interface{}{{"message": "one"}})
+		assert.EqualError(t, err, tt.err)
+		assert.Equal(t, 0, n)
+	}
+}
@@ -0,0 +1,223 @@
+// Package keystore stores secrets in a file encrypted with a master password.
+//
+// The whole content is sealed with AES-256-GCM, the key is derived from the
+// password with PBKDF2-SHA256 and a random salt stored along the data.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vjeantet/bitfan/commons"
+)
+
+// PASSWORD_ENV is the environment variable holding the master password
+const PASSWORD_ENV = "BITFAN_KEYSTORE_PASS"
+
+// keyIterations is the number of PBKDF2 iterations used to derive the key
+const keyIterations = 100000
+
+// ErrWrongPassword is returned when the keystore can not be decrypted
+var ErrWrongPassword = errors.New("keystore : wrong password or corrupted file")
+
+// file is the on disk format of the keystore
+type file struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Keystore holds secrets by name
+type Keystore struct {
+	path     string
+	password []byte
+
+	mu      sync.RWMutex
+	secrets map[string]string
+	modTime time.Time
+}
+
+// Open loads the keystore stored at path, an empty keystore is returned when
+// the file does not exist yet, it will be created on the first Save
+func Open(path string, password string) (*Keystore, error) {
+	if password == "" {
+		return nil, fmt.Errorf("keystore : empty password, set it with %s", PASSWORD_ENV)
+	}
+	k := &Keystore{
+		path:     path,
+		password: []byte(password),
+		secrets:  map[string]string{},
+	}
+	if err := k.load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Exists returns true when a keystore file exists at path
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Path returns the keystore file location
+func (k *Keystore) Path() string {
+	return k.path
+}
+
+// load reads and decrypts the keystore file
+func (k *Keystore) load() error {
+	fi, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	var f file
+	if err := json.Unmarshal(content, &f); err != nil {
+		return fmt.Errorf("keystore : %s is not a keystore - %v", k.path, err)
+	}
+
+	gcm, err := k.cipher(f.Salt)
+	if err != nil {
+		return err
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return ErrWrongPassword
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return ErrWrongPassword
+	}
+
+	k.secrets = secrets
+	k.modTime = fi.ModTime()
+	return nil
+}
+
+// reload loads the keystore again when the file changed since the last load,
+// it allows secrets added with the command line to be used by a running bitfan
+func (k *Keystore) reload() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	fi, err := os.Stat(k.path)
+	if err != nil || fi.ModTime().Equal(k.modTime) {
+		return
+	}
+	k.load()
+}
+
+// Save encrypts and writes the keystore to its file, readable by the owner only
+func (k *Keystore) Save() error {
+	k.mu.RLock()
+	plain, err := json.Marshal(k.secrets)
+	k.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	f := file{Version: 1, Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := k.cipher(f.Salt)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+
+	content, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+func (k *Keystore) cipher(salt []byte) (cipher.AEAD, error) {
+	key := commons.PBKDF2SHA256(k.password, salt, keyIterations)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get returns the value of the secret name
+func (k *Keystore) Get(name string) (string, bool) {
+	k.reload()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	v, ok := k.secrets[name]
+	return v, ok
+}
+
+// Set adds or replaces the secret name, call Save to persist it
+func (k *Keystore) Set(name string, value string) {
+	k.mu.Lock()
+	k.secrets[name] = value
+	k.mu.Unlock()
+}
+
+// Remove deletes the secret name, call Save to persist it
+func (k *Keystore) Remove(name string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.secrets[name]; !ok {
+		return false
+	}
+	delete(k.secrets, name)
+	return true
+}
+
+// Names returns the sorted names of all secrets
+func (k *Keystore) Names() []string {
+	k.reload()
+	k.mu.RLock()
+	names := make([]string, 0, len(k.secrets))
+	for name := range k.secrets {
+		names = append(names, name)
+	}
+	k.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Values returns the values of all secrets
+func (k *Keystore) Values() []string {
+	k.reload()
+	k.mu.RLock()
+	values := make([]string, 0, len(k.secrets))
+	for _, v := range k.secrets {
+		values = append(values, v)
+	}
+	k.mu.RUnlock()
+	return values
+}
@@ -0,0 +1,52 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenEmptyPassword(t *testing.T) {
+	_, err := Open("bitfan.keystore", "")
+	assert.Error(t, err)
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bitfan.keystore")
+
+	k, err := Open(path, "master")
+	if !assert.NoError(t, err) {
+		return
+	}
+	k.Set("DB_PASS", "s3cr3t")
+	k.Set("API_KEY", "abcdef")
+	assert.NoError(t, k.Save())
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "s3cr3t")
+
+	k, err = Open(path, "master")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"API_KEY", "DB_PASS"}, k.Names())
+	v, ok := k.Get("DB_PASS")
+	assert.True(t, ok)
+	assert.Equal(t, "s3cr3t", v)
+
+	assert.True(t, k.Remove("API_KEY"))
+	assert.False(t, k.Remove("API_KEY"))
+	assert.NoError(t, k.Save())
+
+	_, err = Open(path, "wrong")
+	assert.Equal(t, ErrWrongPassword, err)
+}
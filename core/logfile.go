@@ -0,0 +1,209 @@
+package core
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRotation configures when a log file is rotated and how many rotated
+// files are kept, zero values disable the related feature
+type LogRotation struct {
+	MaxSize    int64         // rotate when the file grows over MaxSize bytes
+	Every      time.Duration // rotate when the file is older than Every
+	MaxAge     time.Duration // remove rotated files older than MaxAge
+	MaxBackups int           // keep only MaxBackups rotated files
+	Compress   bool          // gzip rotated files
+}
+
+const rotatedTimeFormat = "20060102-150405"
+
+var errWriterClosed = errors.New("log file closed")
+
+// rotateWriter is an io.Writer appending to a file and rotating it
+type rotateWriter struct {
+	path     string
+	conf     LogRotation
+	onOpen   func(*os.File)
+	mu       sync.Mutex
+	f        *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+}
+
+func newRotateWriter(path string, conf LogRotation, onOpen func(*os.File)) (*rotateWriter, error) {
+	w := &rotateWriter{path: path, conf: conf, onOpen: onOpen}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.size = 0
+	w.openedAt = time.Now()
+	if fi, err := f.Stat(); err == nil {
+		w.size = fi.Size()
+		if w.size > 0 {
+			w.openedAt = fi.ModTime()
+		}
+	}
+	if w.onOpen != nil {
+		w.onOpen(f)
+	}
+	return nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	if w.shouldRotate(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) shouldRotate(n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.conf.MaxSize > 0 && w.size+n > w.conf.MaxSize {
+		return true
+	}
+	if w.conf.Every > 0 && time.Since(w.openedAt) >= w.conf.Every {
+		return true
+	}
+	return false
+}
+
+// rotate renames the current file with a timestamp suffix and opens a new one
+func (w *rotateWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(w.path)
+	base := strings.TrimSuffix(w.path, ext)
+	rotated := fmt.Sprintf("%s-%s%s", base, time.Now().Format(rotatedTimeFormat), ext)
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s-%s.%d%s", base, time.Now().Format(rotatedTimeFormat), i, ext)
+	}
+
+	if err := os.Rename(w.path, rotated); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	go func() {
+		if w.conf.Compress {
+			if err := gzipFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "log rotation : can not compress %s : %v\n", rotated, err)
+			}
+		}
+		w.cleanup(base, ext)
+	}()
+	return nil
+}
+
+// cleanup removes rotated files according to MaxAge and MaxBackups
+func (w *rotateWriter) cleanup(base, ext string) {
+	if w.conf.MaxAge <= 0 && w.conf.MaxBackups <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(base + "-*" + ext + "*")
+	if err != nil {
+		return
+	}
+
+	type rotatedFile struct {
+		path    string
+		modTime time.Time
+	}
+	files := []rotatedFile{}
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err == nil && !fi.IsDir() {
+			files = append(files, rotatedFile{m, fi.ModTime()})
+		}
+	}
+	// newest first
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	for i, f := range files {
+		if (w.conf.MaxBackups > 0 && i >= w.conf.MaxBackups) ||
+			(w.conf.MaxAge > 0 && time.Since(f.modTime) > w.conf.MaxAge) {
+			os.Remove(f.path)
+		}
+	}
+}
+
+func (w *rotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.f.Close()
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// rotatedFiles waits for n rotated files of the log file path and returns them
+func rotatedFiles(t *testing.T, path string, n int) []string {
+	ext := filepath.Ext(path)
+	pattern := strings.TrimSuffix(path, ext) + "-*" + ext + "*"
+	var matches []string
+	for i := 0; i < 200; i++ {
+		matches, _ = filepath.Glob(pattern)
+		if len(matches) == n {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func readLogFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestRotateWriterMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "bitfan.log")
+	w, err := newRotateWriter(path, LogRotation{MaxSize: 10}, nil)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	for _, line := range []string{"12345\n", "678\n", "abcdef\n", "a line longer than the max size\n"} {
+		_, err := w.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	// a line is never split, a file is only rotated when it is not empty
+	rotated := rotatedFiles(t, path, 2)
+	assert.Len(t, rotated, 2)
+	contents := []string{}
+	for _, r := range rotated {
+		contents = append(contents, readLogFile(t, r))
+	}
+	sort.Strings(contents)
+	assert.Equal(t, []string{"12345\n678\n", "abcdef\n"}, contents)
+	assert.Equal(t, "a line longer than the max size\n", readLogFile(t, path))
+}
+
+func TestRotateWriterAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitfan.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("12345678\n"), 0644))
+
+	w, err := newRotateWriter(path, LogRotation{MaxSize: 10}, nil)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	// the size of the existing file counts
+	w.Write([]byte("abc\n"))
+	assert.Len(t, rotatedFiles(t, path, 1), 1)
+	assert.Equal(t, "abc\n", readLogFile(t, path))
+}
+
+func TestRotateWriterMaxBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitfan.log")
+	w, err := newRotateWriter(path, LogRotation{MaxSize: 5, MaxBackups: 2}, nil)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		w.Write([]byte(line))
+		// distinct modification times of the rotated files
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rotated := rotatedFiles(t, path, 2)
+	assert.Len(t, rotated, 2)
+	contents := []string{}
+	for _, r := range rotated {
+		contents = append(contents, readLogFile(t, r))
+	}
+	sort.Strings(contents)
+	assert.Equal(t, []string{"four\n", "three\n"}, contents)
+	assert.Equal(t, "five\n", readLogFile(t, path))
+}
+
+func TestRotateWriterCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitfan.log")
+	w, err := newRotateWriter(path, LogRotation{MaxSize: 5, Compress: true}, nil)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	w.Write([]byte("first\n"))
+	w.Write([]byte("second\n"))
+
+	var rotated []string
+	for i := 0; i < 200; i++ {
+		if rotated = rotatedFiles(t, path, 1); len(rotated) == 1 && strings.HasSuffix(rotated[0], ".gz") {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Len(t, rotated, 1)
+	assert.True(t, strings.HasSuffix(rotated[0], ".log.gz"), rotated[0])
+
+	f, err := os.Open(rotated[0])
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", string(content))
+	assert.Equal(t, "second\n", readLogFile(t, path))
+}
+
+func TestRotateWriterClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bitfan.log")
+	w, err := newRotateWriter(path, LogRotation{}, nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+	_, err = w.Write([]byte("lost\n"))
+	assert.Equal(t, errWriterClosed, err)
+}
+
+func TestPipelineLogHookClose(t *testing.T) {
+	dir := t.TempDir()
+	h := &pipelineLogHook{dir: dir, writers: map[string]*rotateWriter{}}
+	l := logrus.New()
+	l.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+	fire := func(pipelineUUID, msg string) {
+		assert.NoError(t, h.Fire(l.WithField("pipeline_uuid", pipelineUUID).WithField("msg", msg)))
+	}
+
+	fire("p1", "started")
+	fire("p2", "started")
+	assert.Len(t, h.writers, 2)
+
+	w := h.writers["p1"]
+	assert.NoError(t, h.close("p1"))
+	assert.NoError(t, h.close("unknown"))
+	assert.Len(t, h.writers, 1)
+	_, err := w.Write([]byte("lost\n"))
+	assert.Equal(t, errWriterClosed, err)
+
+	// the next entry opens the file again
+	fire("p1", "restarted")
+	assert.Len(t, h.writers, 2)
+	content := readLogFile(t, filepath.Join(dir, "pipeline-p1.log"))
+	assert.Contains(t, content, "msg=started")
+	assert.Contains(t, content, "msg=restarted")
+	assert.NotContains(t, content, "lost")
+}
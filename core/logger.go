@@ -3,9 +3,11 @@ package core
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/sirupsen/logrus"
+	"github.com/vjeantet/bitfan/core/monitor"
 )
 
 var logger *Logger
@@ -14,6 +16,8 @@ func init() {
 	logrus.SetLevel(logrus.WarnLevel)
 	logrus.SetFormatter(&bitfanFormatter{formatter: &logrus.TextFormatter{}})
 	logger = NewLogger("core", nil)
+	logrus.AddHook(&redactHook{})
+	logrus.AddHook(monitor.NewLogHook())
 }
 
 type bitfanFormatter struct {
@@ -38,27 +42,135 @@ func Log() *Logger {
 }
 
 func setLogDebugMode() {
-	logrus.SetLevel(logrus.DebugLevel)
+	setBaseLogLevel(logrus.DebugLevel)
 }
 
 func setLogVerboseMode() {
-	logrus.SetLevel(logrus.InfoLevel)
+	setBaseLogLevel(logrus.InfoLevel)
 }
 
-func setLogOutputFile(fileLocation string) {
+// setLogFormat sets the log entries format, "json" or "text"
+func setLogFormat(format string) {
+	switch format {
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		logrus.SetFormatter(&bitfanFormatter{formatter: &logrus.TextFormatter{}})
+	}
+}
+
+func setLogOutputFile(fileLocation string, format string, rotation LogRotation) {
 	logrus.SetOutput(ioutil.Discard)
-	logrus.SetFormatter(&logrus.TextFormatter{DisableColors: true})
-	f, err := os.OpenFile(fileLocation, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if format != "json" {
+		logrus.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+	}
+	w, err := newRotateWriter(fileLocation, rotation, redirectStderr)
 	if err != nil {
 		Log().Errorf("Error while opening log file %v", err)
+		return
+	}
+	logrus.SetOutput(w)
+}
+
+// setLogPipelinesDir writes logs of each pipeline to its own file in dir,
+// in addition to the main log output
+func setLogPipelinesDir(dir string, rotation LogRotation) {
+	pipelineLogs = &pipelineLogHook{
+		dir:      dir,
+		rotation: rotation,
+		writers:  map[string]*rotateWriter{},
 	}
-	logrus.SetOutput(f)
+	logrus.AddHook(pipelineLogs)
+	Log().Debugf("pipelines logs written to %s", dir)
+}
+
+// pipelineLogs writes the pipelines log files, nil when they are disabled
+var pipelineLogs *pipelineLogHook
 
-	redirectStderr(f)
+// ClosePipelineLog closes the log file of a stopped or deleted pipeline, the
+// next entry of the pipeline opens it again
+func ClosePipelineLog(pipelineUUID string) {
+	if pipelineLogs == nil {
+		return
+	}
+	if err := pipelineLogs.close(pipelineUUID); err != nil {
+		Log().Errorf("can not close log file of pipeline %s : %v", pipelineUUID, err)
+	}
+}
+
+// pipelineLogHook routes log entries with a pipeline_uuid field to the pipeline's log file
+type pipelineLogHook struct {
+	dir      string
+	rotation LogRotation
+	mu       sync.Mutex
+	writers  map[string]*rotateWriter
+}
+
+func (h *pipelineLogHook) writer(pipelineUUID string) (*rotateWriter, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if w, ok := h.writers[pipelineUUID]; ok {
+		return w, nil
+	}
+	w, err := newRotateWriter(filepath.Join(h.dir, "pipeline-"+pipelineUUID+".log"), h.rotation, nil)
+	if err != nil {
+		return nil, err
+	}
+	h.writers[pipelineUUID] = w
+	return w, nil
+}
+
+// close closes and forgets the writer of the pipeline
+func (h *pipelineLogHook) close(pipelineUUID string) error {
+	h.mu.Lock()
+	w, ok := h.writers[pipelineUUID]
+	delete(h.writers, pipelineUUID)
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return w.Close()
+}
+
+// Fire is called when a log event is fired.
+func (h *pipelineLogHook) Fire(entry *logrus.Entry) error {
+	pipelineUUID, ok := entry.Data["pipeline_uuid"].(string)
+	if !ok || pipelineUUID == "" {
+		return nil
+	}
+
+	// format a copy, some formatters change the entry's message
+	e := *entry
+	e.Buffer = nil
+	serialized, err := entry.Logger.Formatter.Format(&e)
+	if err != nil {
+		return err
+	}
+
+	w, err := h.writer(pipelineUUID)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(serialized)
+	if err == errWriterClosed {
+		// closed meanwhile by ClosePipelineLog
+		if w, err = h.writer(pipelineUUID); err != nil {
+			return err
+		}
+		_, err = w.Write(serialized)
+	}
+	return err
+}
+
+// Levels returns the available logging levels.
+func (h *pipelineLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
 }
 
 type Logger struct {
 	e *logrus.Entry
+	// pipeline of the entries, its log level applies
+	pipeline string
 }
 
 func NewLogger(component string, data map[string]interface{}) *Logger {
@@ -66,29 +178,48 @@ func NewLogger(component string, data map[string]interface{}) *Logger {
 		data = map[string]interface{}{}
 	}
 	data["component"] = component
+	pipeline, _ := data["pipeline_uuid"].(string)
 	return &Logger{
-		e: logrus.WithFields(data),
+		e:        logrus.WithFields(data),
+		pipeline: pipeline,
 	}
 }
 
+// enabled tells if entries of the level are logged
+func (p *Logger) enabled(level logrus.Level) bool {
+	return level <= logLevelOf(p.pipeline)
+}
+
 func (p *Logger) Debug(args ...interface{}) {
-	p.e.Debug(args...)
+	if p.enabled(logrus.DebugLevel) {
+		p.e.Debug(args...)
+	}
 }
 func (p *Logger) Debugf(format string, args ...interface{}) {
-	p.e.Debugf(format, args...)
+	if p.enabled(logrus.DebugLevel) {
+		p.e.Debugf(format, args...)
+	}
 }
 func (p *Logger) Debugln(args ...interface{}) {
-	p.e.Debugln(args...)
+	if p.enabled(logrus.DebugLevel) {
+		p.e.Debugln(args...)
+	}
 }
 
 func (p *Logger) Error(args ...interface{}) {
-	p.e.Error(args...)
+	if p.enabled(logrus.ErrorLevel) {
+		p.e.Error(args...)
+	}
 }
 func (p *Logger) Errorf(format string, args ...interface{}) {
-	p.e.Errorf(format, args...)
+	if p.enabled(logrus.ErrorLevel) {
+		p.e.Errorf(format, args...)
+	}
 }
 func (p *Logger) Errorln(args ...interface{}) {
-	p.e.Errorln(args...)
+	if p.enabled(logrus.ErrorLevel) {
+		p.e.Errorln(args...)
+	}
 }
 
 func (p *Logger) Fatal(args ...interface{}) {
@@ -102,13 +233,19 @@ func (p *Logger) Fatalln(args ...interface{}) {
 }
 
 func (p *Logger) Info(args ...interface{}) {
-	p.e.Info(args...)
+	if p.enabled(logrus.InfoLevel) {
+		p.e.Info(args...)
+	}
 }
 func (p *Logger) Infof(format string, args ...interface{}) {
-	p.e.Infof(format, args...)
+	if p.enabled(logrus.InfoLevel) {
+		p.e.Infof(format, args...)
+	}
 }
 func (p *Logger) Infoln(args ...interface{}) {
-	p.e.Infoln(args...)
+	if p.enabled(logrus.InfoLevel) {
+		p.e.Infoln(args...)
+	}
 }
 
 func (p *Logger) Panic(args ...interface{}) {
@@ -122,31 +259,49 @@ func (p *Logger) Panicln(args ...interface{}) {
 }
 
 func (p *Logger) Print(args ...interface{}) {
-	p.e.Print(args...)
+	if p.enabled(logrus.InfoLevel) {
+		p.e.Print(args...)
+	}
 }
 func (p *Logger) Printf(format string, args ...interface{}) {
-	p.e.Printf(format, args...)
+	if p.enabled(logrus.InfoLevel) {
+		p.e.Printf(format, args...)
+	}
 }
 func (p *Logger) Println(args ...interface{}) {
-	p.e.Println(args...)
+	if p.enabled(logrus.InfoLevel) {
+		p.e.Println(args...)
+	}
 }
 
 func (p *Logger) Warn(args ...interface{}) {
-	p.e.Warn(args...)
+	if p.enabled(logrus.WarnLevel) {
+		p.e.Warn(args...)
+	}
 }
 
 func (p *Logger) Warnf(format string, args ...interface{}) {
-	p.e.Warnf(format, args...)
+	if p.enabled(logrus.WarnLevel) {
+		p.e.Warnf(format, args...)
+	}
 }
 func (p *Logger) Warning(args ...interface{}) {
-	p.e.Warning(args...)
+	if p.enabled(logrus.WarnLevel) {
+		p.e.Warning(args...)
+	}
 }
 func (p *Logger) Warningf(format string, args ...interface{}) {
-	p.e.Warningf(format, args...)
+	if p.enabled(logrus.WarnLevel) {
+		p.e.Warningf(format, args...)
+	}
 }
 func (p *Logger) Warningln(args ...interface{}) {
-	p.e.Warningln(args...)
+	if p.enabled(logrus.WarnLevel) {
+		p.e.Warningln(args...)
+	}
 }
 func (p *Logger) Warnln(args ...interface{}) {
-	p.e.Warnln(args...)
+	if p.enabled(logrus.WarnLevel) {
+		p.e.Warnln(args...)
+	}
 }
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// log levels set at runtime, the level of a pipeline overrides the global one
+var logLevels = struct {
+	sync.RWMutex
+	base      logrus.Level
+	pipelines map[string]logrus.Level
+	// changes reverted after a delay, by key
+	reverts map[string]*revert
+	// number of traced agents, their traces pass the global level
+	traces int
+}{
+	base:      logrus.WarnLevel,
+	pipelines: map[string]logrus.Level{},
+	reverts:   map[string]*revert{},
+}
+
+// revert restores a setting when its timer fires
+type revert struct {
+	timer   *time.Timer
+	restore func()
+}
+
+// LogLevels is the global log level and the levels of the pipelines
+type LogLevels struct {
+	Level     string            `json:"level"`
+	Pipelines map[string]string `json:"pipelines"`
+}
+
+// GetLogLevels returns the global log level and the levels of the pipelines
+func GetLogLevels() LogLevels {
+	logLevels.RLock()
+	defer logLevels.RUnlock()
+	l := LogLevels{Level: logLevels.base.String(), Pipelines: map[string]string{}}
+	for uuid, level := range logLevels.pipelines {
+		l.Pipelines[uuid] = level.String()
+	}
+	return l
+}
+
+// SetLogLevel changes the log level of a pipeline, or the global one when
+// pipelineUUID is empty. An empty level removes the level of the pipeline. The
+// previous level is restored after revertAfter, when it is not 0
+func SetLogLevel(pipelineUUID string, level string, revertAfter time.Duration) error {
+	var lvl logrus.Level
+	if level != "" {
+		var err error
+		if lvl, err = logrus.ParseLevel(level); err != nil {
+			return err
+		}
+	} else if pipelineUUID == "" {
+		return fmt.Errorf("a log level is required")
+	}
+
+	key := "log:" + pipelineUUID
+	logLevels.Lock()
+	restore := cancelRevert(key)
+	if restore == nil {
+		previous, ok := logLevels.pipelines[pipelineUUID]
+		if pipelineUUID == "" {
+			previous, ok = logLevels.base, true
+		}
+		restore = func() {
+			if !ok {
+				SetLogLevel(pipelineUUID, "", 0)
+				return
+			}
+			SetLogLevel(pipelineUUID, previous.String(), 0)
+		}
+	}
+
+	switch {
+	case pipelineUUID == "":
+		logLevels.base = lvl
+	case level == "":
+		delete(logLevels.pipelines, pipelineUUID)
+	default:
+		logLevels.pipelines[pipelineUUID] = lvl
+	}
+	applyLogLevels()
+	logLevels.Unlock()
+
+	switch {
+	case pipelineUUID == "":
+		Log().Warnf("log level set to %s", level)
+	case level == "":
+		Log().Warnf("log level of pipeline %s removed", pipelineUUID)
+	default:
+		Log().Warnf("log level of pipeline %s set to %s", pipelineUUID, level)
+	}
+	if revertAfter > 0 {
+		scheduleRevert(key, revertAfter, restore)
+	}
+	return nil
+}
+
+// cancelRevert cancels the pending revert of a setting and returns its
+// restore function, to restore the setting as it was before the first change.
+// The lock of logLevels is held
+func cancelRevert(key string) func() {
+	r, ok := logLevels.reverts[key]
+	if !ok {
+		return nil
+	}
+	r.timer.Stop()
+	delete(logLevels.reverts, key)
+	return r.restore
+}
+
+// scheduleRevert calls restore after delay
+func scheduleRevert(key string, delay time.Duration, restore func()) {
+	r := &revert{restore: restore}
+	logLevels.Lock()
+	defer logLevels.Unlock()
+	r.timer = time.AfterFunc(delay, func() {
+		logLevels.Lock()
+		if logLevels.reverts[key] != r {
+			// cancelled
+			logLevels.Unlock()
+			return
+		}
+		delete(logLevels.reverts, key)
+		logLevels.Unlock()
+		restore()
+	})
+	logLevels.reverts[key] = r
+}
+
+// setBaseLogLevel sets the global log level at startup
+func setBaseLogLevel(level logrus.Level) {
+	logLevels.Lock()
+	logLevels.base = level
+	applyLogLevels()
+	logLevels.Unlock()
+}
+
+// applyLogLevels lets logrus pass the most verbose level in use, and the
+// traces while an agent is traced, loggers filter the entries of each
+// pipeline. The lock of logLevels is held
+func applyLogLevels() {
+	level := logLevels.base
+	for _, l := range logLevels.pipelines {
+		if l > level {
+			level = l
+		}
+	}
+	if logLevels.traces > 0 && level < logrus.InfoLevel {
+		level = logrus.InfoLevel
+	}
+	logrus.SetLevel(level)
+}
+
+// logLevelOf returns the log level of a pipeline
+func logLevelOf(pipelineUUID string) logrus.Level {
+	logLevels.RLock()
+	defer logLevels.RUnlock()
+	if level, ok := logLevels.pipelines[pipelineUUID]; ok && pipelineUUID != "" {
+		return level
+	}
+	return logLevels.base
+}
+
+// SetTrace toggles the trace of the events of an agent of the pipeline, the
+// previous state is restored after revertAfter, when it is not 0
+func (p *Pipeline) SetTrace(agentID int, trace bool, revertAfter time.Duration) error {
+	a, ok := p.agents[agentID]
+	if !ok {
+		return fmt.Errorf("agent %d not found in pipeline %s", agentID, p.Label)
+	}
+
+	key := fmt.Sprintf("trace:%s:%d", p.Uuid, agentID)
+	logLevels.Lock()
+	restore := cancelRevert(key)
+	logLevels.Unlock()
+	if restore == nil {
+		previous := a.Tracing()
+		restore = func() { p.SetTrace(agentID, previous, 0) }
+	}
+	if revertAfter > 0 {
+		scheduleRevert(key, revertAfter, restore)
+	}
+
+	a.setTracing(trace)
+	Log().Infof("trace of agent %s of pipeline %s set to %t", a.Label, p.Label, trace)
+	return nil
+}
+
+// Tracing tells if the events of the agent are traced
+func (a *Agent) Tracing() bool {
+	return atomic.LoadInt32(&a.tracing) == 1
+}
+
+func (a *Agent) setTracing(trace bool) {
+	var v int32
+	if trace {
+		v = 1
+	}
+	if atomic.SwapInt32(&a.tracing, v) == v {
+		return
+	}
+	logLevels.Lock()
+	logLevels.traces += int(v)*2 - 1
+	applyLogLevels()
+	logLevels.Unlock()
+}
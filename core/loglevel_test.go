@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// withLogLevels restores the log levels and the log output after the test
+func withLogLevels(t *testing.T) *bytes.Buffer {
+	out := &bytes.Buffer{}
+	std := logrus.StandardLogger()
+	previous := std.Out
+	logrus.SetOutput(out)
+	t.Cleanup(func() {
+		logrus.SetOutput(previous)
+		logLevels.Lock()
+		logLevels.pipelines = map[string]logrus.Level{}
+		logLevels.Unlock()
+		setBaseLogLevel(logrus.WarnLevel)
+	})
+	return out
+}
+
+// waitLevel waits for the revert of the level of a pipeline
+func waitLevel(pipelineUUID string, level logrus.Level) logrus.Level {
+	for i := 0; i < 100 && logLevelOf(pipelineUUID) != level; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return logLevelOf(pipelineUUID)
+}
+
+func TestSetLogLevel(t *testing.T) {
+	withLogLevels(t)
+	p1 := NewLogger("pipeline", map[string]interface{}{"pipeline_uuid": "p1"})
+	p2 := NewLogger("pipeline", map[string]interface{}{"pipeline_uuid": "p2"})
+
+	assert.Error(t, SetLogLevel("", "", 0))
+	assert.Error(t, SetLogLevel("p1", "verbose", 0))
+
+	// the level of p1 overrides the global one for p1 only
+	assert.NoError(t, SetLogLevel("p1", "debug", 0))
+	assert.Equal(t, LogLevels{Level: "warning", Pipelines: map[string]string{"p1": "debug"}}, GetLogLevels())
+	assert.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+	assert.True(t, p1.enabled(logrus.DebugLevel))
+	assert.False(t, p2.enabled(logrus.InfoLevel))
+	assert.True(t, p2.enabled(logrus.WarnLevel))
+	assert.False(t, logger.enabled(logrus.InfoLevel))
+
+	assert.NoError(t, SetLogLevel("", "error", 0))
+	assert.False(t, p2.enabled(logrus.WarnLevel))
+	assert.True(t, p1.enabled(logrus.DebugLevel))
+
+	// without its level p1 follows the global one
+	assert.NoError(t, SetLogLevel("p1", "", 0))
+	assert.Equal(t, LogLevels{Level: "error", Pipelines: map[string]string{}}, GetLogLevels())
+	assert.False(t, p1.enabled(logrus.WarnLevel))
+	assert.Equal(t, logrus.ErrorLevel, logrus.GetLevel())
+}
+
+func TestSetLogLevelRevert(t *testing.T) {
+	withLogLevels(t)
+
+	assert.NoError(t, SetLogLevel("p1", "debug", 50*time.Millisecond))
+	// a change before the revert keeps the first previous level
+	assert.NoError(t, SetLogLevel("p1", "info", 50*time.Millisecond))
+	assert.Equal(t, logrus.InfoLevel, logLevelOf("p1"))
+	assert.Equal(t, logrus.WarnLevel, waitLevel("p1", logrus.WarnLevel))
+	assert.Equal(t, LogLevels{Level: "warning", Pipelines: map[string]string{}}, GetLogLevels())
+
+	assert.NoError(t, SetLogLevel("", "debug", 50*time.Millisecond))
+	assert.Equal(t, logrus.WarnLevel, waitLevel("", logrus.WarnLevel))
+	assert.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+
+	// a change without revert cancels the pending one
+	assert.NoError(t, SetLogLevel("p2", "debug", 50*time.Millisecond))
+	assert.NoError(t, SetLogLevel("p2", "error", 0))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, logrus.ErrorLevel, logLevelOf("p2"))
+}
+
+func TestSetTrace(t *testing.T) {
+	out := withLogLevels(t)
+	a := newTestAgent(1, "filter_mutate", &fakeProcessor{})
+	a.PipelineUUID, a.PipelineName = "p1", "web"
+	p := &Pipeline{Uuid: "p1", Label: "web", agents: map[int]*Agent{1: a}}
+
+	assert.EqualError(t, p.SetTrace(2, true, 0), "agent 2 not found in pipeline web")
+
+	// traces pass the global level
+	assert.NoError(t, p.SetTrace(1, true, 0))
+	assert.True(t, a.Tracing())
+	a.traceEvent("OUT", newPacket(map[string]interface{}{"message": "hello"}), 0)
+	assert.Contains(t, out.String(), "sent event by filter_mutate on pipeline 'web'")
+	logger.Infof("not a trace")
+	assert.NotContains(t, out.String(), "not a trace")
+
+	assert.NoError(t, p.SetTrace(1, false, 0))
+	assert.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+
+	// the trace stops after revertAfter
+	assert.NoError(t, p.SetTrace(1, true, 50*time.Millisecond))
+	assert.True(t, a.Tracing())
+	for i := 0; i < 100 && a.Tracing(); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.False(t, a.Tracing())
+	assert.Equal(t, logrus.WarnLevel, logrus.GetLevel())
+}
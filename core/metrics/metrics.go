@@ -1,5 +1,9 @@
 package metrics
 
+import "github.com/vjeantet/bitfan/commons"
+
+var Log commons.Logger
+
 // IStats interface to any metric collector
 type Metrics interface {
 	Increment(int, string, string) error
@@ -27,3 +31,41 @@ func (o *MetricsVoid) Increment(metric int, pipelineNamestring string, name stri
 	return nil
 }
 func (o *MetricsVoid) Set(metric int, pipelineNamestring string, name string, v int) error { return nil }
+
+// NewMulti returns a Metrics which forwards each value to all given Metrics
+func NewMulti(ms ...Metrics) MetricsMulti {
+	return MetricsMulti(ms)
+}
+
+type MetricsMulti []Metrics
+
+func (o MetricsMulti) Decrement(metric int, pipelineName string, name string) error {
+	for _, m := range o {
+		m.Decrement(metric, pipelineName, name)
+	}
+	return nil
+}
+func (o MetricsMulti) Increment(metric int, pipelineName string, name string) error {
+	for _, m := range o {
+		m.Increment(metric, pipelineName, name)
+	}
+	return nil
+}
+func (o MetricsMulti) Set(metric int, pipelineName string, name string, v int) error {
+	for _, m := range o {
+		m.Set(metric, pipelineName, name, v)
+	}
+	return nil
+}
+
+// Close closes each Metrics which need to flush its values
+func (o MetricsMulti) Close() error {
+	for _, m := range o {
+		if c, ok := m.(interface {
+			Close() error
+		}); ok {
+			c.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metricNames maps each metric to its exported name and kind
+var metricNames = map[int]struct {
+	Name string
+	Kind string
+	Help string
+}{
+	PROC_IN:            {"agent_packet_consumption", "counter", "packets consumed by processors"},
+	PROC_OUT:           {"agent_packet_production", "counter", "packets produced by processors"},
+	PACKET_DROP:        {"agent_packet_drop", "counter", "packets dropped by processors"},
+	CONNECTION_TRANSIT: {"connection_transit", "gauge", "packets in transit to processors"},
+}
+
+type counterKey struct {
+	metric   int
+	pipeline string
+	agent    string
+}
+
+type counterValue struct {
+	counterKey
+	value int64
+}
+
+// counters holds metrics values in memory, push based exporters
+// periodically flush a snapshot of them
+type counters struct {
+	mu     sync.Mutex
+	values map[counterKey]int64
+}
+
+func newCounters() *counters {
+	return &counters{values: map[counterKey]int64{}}
+}
+
+func (c *counters) add(metric int, pipelineName string, name string, n int64) {
+	c.mu.Lock()
+	c.values[counterKey{metric, pipelineName, name}] += n
+	c.mu.Unlock()
+}
+
+func (c *counters) set(metric int, pipelineName string, name string, v int64) {
+	c.mu.Lock()
+	c.values[counterKey{metric, pipelineName, name}] = v
+	c.mu.Unlock()
+}
+
+// snapshot returns values sorted by metric, pipeline and agent
+func (c *counters) snapshot() []counterValue {
+	c.mu.Lock()
+	values := make([]counterValue, 0, len(c.values))
+	for k, v := range c.values {
+		values = append(values, counterValue{k, v})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].metric != values[j].metric {
+			return values[i].metric < values[j].metric
+		}
+		if values[i].pipeline != values[j].pipeline {
+			return values[i].pipeline < values[j].pipeline
+		}
+		return values[i].agent < values[j].agent
+	})
+	return values
+}
+
+// sanitize makes a name usable as a dot separated path segment
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
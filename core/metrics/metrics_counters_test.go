@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// assertGolden compares content with the file testdata/name
+func assertGolden(t *testing.T, name string, content []byte) {
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(golden, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(expected), string(content))
+}
+
+// record sends the same values to m, whatever the exporter
+func record(m Metrics) {
+	for i := 0; i < 3; i++ {
+		m.Increment(PROC_IN, "web", "udp")
+	}
+	m.Increment(PROC_OUT, "web", "udp")
+	m.Increment(PROC_OUT, "web", "udp")
+	m.Increment(PACKET_DROP, "web", `drop "spam" \ filter`)
+	m.Set(CONNECTION_TRANSIT, "web", "stdout", 7)
+	m.Decrement(CONNECTION_TRANSIT, "web", "stdout")
+	m.Increment(PROC_IN, "api.v2", "http input")
+}
+
+func TestCountersSnapshot(t *testing.T) {
+	c := newCounters()
+	assert.Empty(t, c.snapshot())
+
+	c.add(PROC_OUT, "web", "udp", 2)
+	c.add(PROC_IN, "web", "udp", 3)
+	c.add(PROC_IN, "api", "http", 1)
+	c.add(PROC_IN, "web", "mutate", 1)
+	c.add(PROC_IN, "web", "mutate", -1)
+	c.set(CONNECTION_TRANSIT, "web", "stdout", 7)
+	c.set(CONNECTION_TRANSIT, "web", "stdout", 5)
+
+	// sorted by metric, pipeline and agent
+	assert.Equal(t, []counterValue{
+		{counterKey{PROC_IN, "api", "http"}, 1},
+		{counterKey{PROC_IN, "web", "mutate"}, 0},
+		{counterKey{PROC_IN, "web", "udp"}, 3},
+		{counterKey{PROC_OUT, "web", "udp"}, 2},
+		{counterKey{CONNECTION_TRANSIT, "web", "stdout"}, 5},
+	}, c.snapshot())
+}
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"udp":              "udp",
+		"input_udp-1":      "input_udp-1",
+		"api.v2":           "api_v2",
+		`drop "spam" \ it`: "drop__spam____it",
+		"événement":        "_v_nement",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, sanitize(name), name)
+	}
+}
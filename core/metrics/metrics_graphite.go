@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// metricsGraphite periodically pushes metrics to a graphite server
+// using the plaintext protocol over TCP
+type metricsGraphite struct {
+	*counters
+	address  string
+	prefix   string
+	interval time.Duration
+	conn     net.Conn
+	done     chan bool
+	// closing stops run once, later calls to Close do nothing
+	closing sync.Once
+}
+
+// NewGraphite returns a Metrics which sends values every interval to the
+// graphite server listening at address, metric paths are prefixed with prefix
+func NewGraphite(address string, prefix string, interval time.Duration) *metricsGraphite {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	g := &metricsGraphite{
+		counters: newCounters(),
+		address:  address,
+		prefix:   prefix,
+		interval: interval,
+		done:     make(chan bool),
+	}
+	go g.run()
+	return g
+}
+
+func (g *metricsGraphite) run() {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := g.flush(); err != nil {
+				Log.Warnf("graphite metrics - %v", err)
+			}
+		case <-g.done:
+			g.flush()
+			if g.conn != nil {
+				g.conn.Close()
+			}
+			close(g.done)
+			return
+		}
+	}
+}
+
+func (g *metricsGraphite) flush() error {
+	values := g.snapshot()
+	if len(values) == 0 {
+		return nil
+	}
+
+	if g.conn == nil {
+		conn, err := net.DialTimeout("tcp", g.address, g.interval)
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+
+	g.conn.SetWriteDeadline(time.Now().Add(g.interval))
+	if _, err := g.conn.Write(g.text(values, time.Now().Unix())); err != nil {
+		// reconnect on next flush
+		g.conn.Close()
+		g.conn = nil
+		return err
+	}
+	return nil
+}
+
+// text returns the values in the plaintext protocol, one "path value
+// timestamp" line each
+func (g *metricsGraphite) text(values []counterValue, now int64) []byte {
+	buf := &bytes.Buffer{}
+	for _, v := range values {
+		path := sanitize(v.pipeline) + "." + sanitize(v.agent) + "." + metricNames[v.metric].Name
+		if g.prefix != "" {
+			path = g.prefix + "." + path
+		}
+		fmt.Fprintf(buf, "%s %d %d\n", path, v.value, now)
+	}
+	return buf.Bytes()
+}
+
+func (g *metricsGraphite) Set(metric int, pipelineName string, name string, v int) error {
+	g.set(metric, pipelineName, name, int64(v))
+	return nil
+}
+
+func (g *metricsGraphite) Increment(metric int, pipelineName string, name string) error {
+	g.add(metric, pipelineName, name, 1)
+	return nil
+}
+
+func (g *metricsGraphite) Decrement(metric int, pipelineName string, name string) error {
+	g.add(metric, pipelineName, name, -1)
+	return nil
+}
+
+// Close sends the last values and closes the connection
+func (g *metricsGraphite) Close() error {
+	g.closing.Do(func() {
+		g.done <- true
+		<-g.done
+	})
+	return nil
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphiteText(t *testing.T) {
+	g := &metricsGraphite{counters: newCounters(), prefix: "bitfan"}
+	record(g)
+	assertGolden(t, "graphite.txt", g.text(g.snapshot(), 1500000000))
+
+	g.prefix = ""
+	assert.Equal(t, "web.udp.agent_packet_consumption 3 1500000000\n", string(g.text(g.snapshot()[1:2], 1500000000)))
+}
+
+func TestGraphiteFlush(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan []byte)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		content, _ := ioutil.ReadAll(conn)
+		received <- content
+	}()
+
+	g := NewGraphite(l.Addr().String(), "bitfan", time.Hour)
+	record(g)
+	// the last values are sent on close
+	assert.NoError(t, g.Close())
+	// closing again does nothing
+	assert.NoError(t, g.Close())
+
+	select {
+	case content := <-received:
+		// each line is "path value timestamp"
+		now := regexp.MustCompile(`(?m) \d+$`)
+		assertGolden(t, "graphite.txt", now.ReplaceAllLiteral(content, []byte(" 1500000000")))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no metrics received")
+	}
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsOpenMetricsFile periodically writes metrics in the OpenMetrics text
+// format to a file, to be collected by a node exporter textfile collector or
+// any agent able to read it
+type metricsOpenMetricsFile struct {
+	*counters
+	path     string
+	interval time.Duration
+	done     chan bool
+	// closing stops run once, later calls to Close do nothing
+	closing sync.Once
+}
+
+// NewOpenMetricsFile returns a Metrics which writes values to path every interval
+func NewOpenMetricsFile(path string, interval time.Duration) *metricsOpenMetricsFile {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	m := &metricsOpenMetricsFile{
+		counters: newCounters(),
+		path:     path,
+		interval: interval,
+		done:     make(chan bool),
+	}
+	go m.run()
+	return m
+}
+
+func (m *metricsOpenMetricsFile) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.write(); err != nil {
+				Log.Warnf("openmetrics file - %v", err)
+			}
+		case <-m.done:
+			m.write()
+			close(m.done)
+			return
+		}
+	}
+}
+
+// write replaces the file content atomically, readers never see a partial file
+func (m *metricsOpenMetricsFile) write() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(m.path), "."+filepath.Base(m.path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(m.text()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.Chmod(tmp.Name(), 0644)
+	return os.Rename(tmp.Name(), m.path)
+}
+
+func (m *metricsOpenMetricsFile) text() []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "# TYPE %s_runtime_goroutines_count gauge\n", namespace)
+	fmt.Fprintf(buf, "# HELP %s_runtime_goroutines_count Number of goroutines that currently exist.\n", namespace)
+	fmt.Fprintf(buf, "%s_runtime_goroutines_count %d\n", namespace, runtime.NumGoroutine())
+
+	lastMetric := 0
+	for _, v := range m.snapshot() {
+		desc := metricNames[v.metric]
+		name := namespace + "_" + desc.Name
+		if v.metric != lastMetric {
+			fmt.Fprintf(buf, "# TYPE %s %s\n", name, desc.Kind)
+			fmt.Fprintf(buf, "# HELP %s %s\n", name, desc.Help)
+			lastMetric = v.metric
+		}
+		if desc.Kind == "counter" {
+			name = name + "_total"
+		}
+		fmt.Fprintf(buf, "%s{pipeline=\"%s\",agent=\"%s\"} %d\n", name, escapeLabel(v.pipeline), escapeLabel(v.agent), v.value)
+	}
+	buf.WriteString("# EOF\n")
+	return buf.Bytes()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func (m *metricsOpenMetricsFile) Set(metric int, pipelineName string, name string, v int) error {
+	m.set(metric, pipelineName, name, int64(v))
+	return nil
+}
+
+func (m *metricsOpenMetricsFile) Increment(metric int, pipelineName string, name string) error {
+	m.add(metric, pipelineName, name, 1)
+	return nil
+}
+
+func (m *metricsOpenMetricsFile) Decrement(metric int, pipelineName string, name string) error {
+	m.add(metric, pipelineName, name, -1)
+	return nil
+}
+
+// Close writes the last values to the file
+func (m *metricsOpenMetricsFile) Close() error {
+	m.closing.Do(func() {
+		m.done <- true
+		<-m.done
+	})
+	return nil
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// goroutines matches the value of the goroutines gauge, which changes
+var goroutines = regexp.MustCompile(`(?m)^(bitfan_runtime_goroutines_count) \d+$`)
+
+func TestOpenMetricsText(t *testing.T) {
+	m := &metricsOpenMetricsFile{counters: newCounters()}
+	assert.Equal(t, "# TYPE bitfan_runtime_goroutines_count gauge\n"+
+		"# HELP bitfan_runtime_goroutines_count Number of goroutines that currently exist.\n"+
+		"bitfan_runtime_goroutines_count N\n"+
+		"# EOF\n", goroutines.ReplaceAllString(string(m.text()), "$1 N"))
+
+	record(m)
+	assertGolden(t, "openmetrics.txt", goroutines.ReplaceAllLiteral(m.text(), []byte("bitfan_runtime_goroutines_count N")))
+}
+
+func TestOpenMetricsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bitfan.prom")
+	m := NewOpenMetricsFile(path, time.Hour)
+	record(m)
+
+	// the last values are written on close
+	assert.NoError(t, m.Close())
+	// closing again does nothing
+	assert.NoError(t, m.Close())
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assertGolden(t, "openmetrics.txt", goroutines.ReplaceAllLiteral(content, []byte("bitfan_runtime_goroutines_count N")))
+
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+
+	// no temporary file is left
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
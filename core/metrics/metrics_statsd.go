@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"gopkg.in/alexcesaro/statsd.v2"
+)
+
+// metricsStatsd pushes each metric to a statsd server over UDP
+type metricsStatsd struct {
+	client *statsd.Client
+}
+
+// NewStatsd returns a Metrics which sends values to the statsd server
+// listening at address, bucket names are prefixed with prefix
+func NewStatsd(address string, prefix string) (*metricsStatsd, error) {
+	opts := []statsd.Option{
+		statsd.Address(address),
+		statsd.ErrorHandler(func(err error) {
+			Log.Warnf("statsd metrics - %v", err)
+		}),
+	}
+	if prefix != "" {
+		opts = append(opts, statsd.Prefix(prefix))
+	}
+
+	c, err := statsd.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &metricsStatsd{client: c}, nil
+}
+
+func (s *metricsStatsd) bucket(metric int, pipelineName string, name string) string {
+	return sanitize(pipelineName) + "." + sanitize(name) + "." + metricNames[metric].Name
+}
+
+func (s *metricsStatsd) Set(metric int, pipelineName string, name string, v int) error {
+	s.client.Gauge(s.bucket(metric, pipelineName, name), v)
+	return nil
+}
+
+func (s *metricsStatsd) Increment(metric int, pipelineName string, name string) error {
+	s.client.Increment(s.bucket(metric, pipelineName, name))
+	return nil
+}
+
+func (s *metricsStatsd) Decrement(metric int, pipelineName string, name string) error {
+	s.client.Count(s.bucket(metric, pipelineName, name), -1)
+	return nil
+}
+
+// Close flushes pending metrics and closes the connection
+func (s *metricsStatsd) Close() error {
+	s.client.Close()
+	return nil
+}
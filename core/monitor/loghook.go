@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// logHook publishes error log entries as KIND_LOG events
+type logHook struct{}
+
+// NewLogHook returns a logrus hook to add to the logger
+func NewLogHook() logrus.Hook {
+	return &logHook{}
+}
+
+// Fire is called when a log event is fired.
+func (l *logHook) Fire(entry *logrus.Entry) error {
+	if !Active() {
+		return nil
+	}
+
+	fields := map[string]interface{}{}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[k] = v
+	}
+	fields["level"] = entry.Level.String()
+	fields["message"] = entry.Message
+
+	Publish(KIND_LOG, fields)
+	return nil
+}
+
+// Levels returns the available logging levels.
+func (l *logHook) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.ErrorLevel,
+		logrus.FatalLevel,
+		logrus.PanicLevel,
+	}
+}
@@ -0,0 +1,92 @@
+// Package monitor publishes bitfan's internal events (agents stats, pipelines
+// lifecycle, scheduler ticks, error logs) to subscribers like the monitoring input.
+package monitor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kind of events
+const (
+	KIND_STATS    = "stats"
+	KIND_PIPELINE = "pipeline"
+	KIND_AGENT    = "agent"
+	KIND_TICK     = "tick"
+	KIND_LOG      = "log"
+)
+
+// Event is an internal event
+type Event struct {
+	Kind   string
+	Time   time.Time
+	Fields map[string]interface{}
+}
+
+// Subscription receives published events on C until Close is called
+type Subscription struct {
+	C     chan Event
+	kinds map[string]bool
+}
+
+var (
+	mu            sync.RWMutex
+	subscriptions = map[*Subscription]bool{}
+	active        int32
+)
+
+// Active returns true when someone listens to events, publishers should use
+// it to avoid computing events nobody will receive
+func Active() bool {
+	return atomic.LoadInt32(&active) > 0
+}
+
+// Subscribe returns a Subscription to events of the given kinds, all kinds when none given
+func Subscribe(buffer int, kinds ...string) *Subscription {
+	s := &Subscription{
+		C:     make(chan Event, buffer),
+		kinds: map[string]bool{},
+	}
+	for _, k := range kinds {
+		s.kinds[k] = true
+	}
+
+	mu.Lock()
+	subscriptions[s] = true
+	atomic.StoreInt32(&active, int32(len(subscriptions)))
+	mu.Unlock()
+	return s
+}
+
+// Close stops the subscription and closes its chan
+func (s *Subscription) Close() {
+	mu.Lock()
+	if _, ok := subscriptions[s]; ok {
+		delete(subscriptions, s)
+		close(s.C)
+	}
+	atomic.StoreInt32(&active, int32(len(subscriptions)))
+	mu.Unlock()
+}
+
+// Publish sends an event to all subscribers, it never blocks : when a
+// subscriber is too slow the event is dropped for it
+func Publish(kind string, fields map[string]interface{}) {
+	if !Active() {
+		return
+	}
+	e := Event{Kind: kind, Time: time.Now(), Fields: fields}
+
+	mu.RLock()
+	for s := range subscriptions {
+		if len(s.kinds) > 0 && !s.kinds[kind] {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+		}
+	}
+	mu.RUnlock()
+}
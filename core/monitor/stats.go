@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vjeantet/bitfan/core/metrics"
+)
+
+// AgentStats holds counters of an agent since bitfan started
+type AgentStats struct {
+	Pipeline   string
+	Agent      string
+	EventsIn   int64
+	EventsOut  int64
+	Dropped    int64
+	QueueDepth int
+	// cumulated time spent by the processor to handle received events
+	Latency time.Duration
+}
+
+type statsKey struct {
+	pipeline string
+	agent    string
+}
+
+// Stats is a metrics.Metrics collecting agents stats while the monitor is active
+type Stats struct {
+	mu     sync.Mutex
+	agents map[statsKey]*AgentStats
+}
+
+var stats = &Stats{agents: map[statsKey]*AgentStats{}}
+
+// Metrics returns the metrics.Metrics feeding agents stats
+func Metrics() metrics.Metrics {
+	return stats
+}
+
+func (s *Stats) get(pipelineName string, name string) *AgentStats {
+	k := statsKey{pipelineName, name}
+	a, ok := s.agents[k]
+	if !ok {
+		a = &AgentStats{Pipeline: pipelineName, Agent: name}
+		s.agents[k] = a
+	}
+	return a
+}
+
+func (s *Stats) Increment(metric int, pipelineName string, name string) error {
+	if !Active() {
+		return nil
+	}
+	s.mu.Lock()
+	a := s.get(pipelineName, name)
+	switch metric {
+	case metrics.PROC_IN:
+		a.EventsIn++
+	case metrics.PROC_OUT:
+		a.EventsOut++
+	case metrics.PACKET_DROP:
+		a.Dropped++
+	case metrics.CONNECTION_TRANSIT:
+		a.QueueDepth++
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Stats) Decrement(metric int, pipelineName string, name string) error {
+	if !Active() {
+		return nil
+	}
+	s.mu.Lock()
+	if metric == metrics.CONNECTION_TRANSIT {
+		s.get(pipelineName, name).QueueDepth--
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Stats) Set(metric int, pipelineName string, name string, v int) error {
+	if !Active() {
+		return nil
+	}
+	s.mu.Lock()
+	if metric == metrics.CONNECTION_TRANSIT {
+		s.get(pipelineName, name).QueueDepth = v
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// ObserveLatency adds the time spent by an agent to handle an event
+func ObserveLatency(pipelineName string, name string, d time.Duration) {
+	stats.mu.Lock()
+	stats.get(pipelineName, name).Latency += d
+	stats.mu.Unlock()
+}
+
+// Snapshot returns a copy of all agents stats
+func Snapshot() []AgentStats {
+	stats.mu.Lock()
+	all := make([]AgentStats, 0, len(stats.agents))
+	for _, a := range stats.agents {
+		all = append(all, *a)
+	}
+	stats.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Pipeline != all[j].Pipeline {
+			return all[i].Pipeline < all[j].Pipeline
+		}
+		return all[i].Agent < all[j].Agent
+	})
+	return all
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vjeantet/bitfan/core/monitor"
+)
+
+// pauseState holds the events sent by a paused agent
+type pauseState struct {
+	// 1 when paused, checked atomically on each event
+	paused int32
+
+	mu sync.Mutex
+	// closed on resume
+	resumed chan struct{}
+	// paused by the operator, the pause outlives the release of a stop and is
+	// restored when the agent starts again
+	held bool
+}
+
+func (s *pauseState) pause() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held = true
+	if s.resumed != nil {
+		return false
+	}
+	s.resumed = make(chan struct{})
+	atomic.StoreInt32(&s.paused, 1)
+	return true
+}
+
+func (s *pauseState) resume() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held = false
+	return s.releaseLocked()
+}
+
+// release lets the held events go when the agent stops, the pause is kept
+func (s *pauseState) release() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.releaseLocked()
+}
+
+func (s *pauseState) releaseLocked() bool {
+	if s.resumed == nil {
+		return false
+	}
+	atomic.StoreInt32(&s.paused, 0)
+	close(s.resumed)
+	s.resumed = nil
+	return true
+}
+
+// restore pauses again an agent paused before it stopped
+func (s *pauseState) restore() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held && s.resumed == nil {
+		s.resumed = make(chan struct{})
+		atomic.StoreInt32(&s.paused, 1)
+	}
+}
+
+// wait blocks until the agent is resumed
+func (s *pauseState) wait() {
+	if s == nil || atomic.LoadInt32(&s.paused) == 0 {
+		return
+	}
+	s.mu.Lock()
+	resumed := s.resumed
+	s.mu.Unlock()
+	if resumed != nil {
+		<-resumed
+	}
+}
+
+// Pause holds the events of all the inputs of the pipeline, the queues of the
+// other agents are still processed
+func (p *Pipeline) Pause() {
+	for _, a := range p.inputs() {
+		p.pauseAgent(a)
+	}
+}
+
+// Resume releases the inputs of the pipeline
+func (p *Pipeline) Resume() {
+	for _, a := range p.inputs() {
+		p.resumeAgent(a)
+	}
+}
+
+// PauseAgent holds the events of an input of the pipeline
+func (p *Pipeline) PauseAgent(agentID int) error {
+	a, err := p.input(agentID)
+	if err != nil {
+		return err
+	}
+	p.pauseAgent(a)
+	return nil
+}
+
+// ResumeAgent releases an input of the pipeline
+func (p *Pipeline) ResumeAgent(agentID int) error {
+	a, err := p.input(agentID)
+	if err != nil {
+		return err
+	}
+	p.resumeAgent(a)
+	return nil
+}
+
+// Paused tells if all the inputs of the pipeline are paused
+func (p *Pipeline) Paused() bool {
+	inputs := p.inputs()
+	for _, a := range inputs {
+		if !a.Paused() {
+			return false
+		}
+	}
+	return len(inputs) > 0
+}
+
+// PausedAgents returns the ids of the paused agents of the pipeline
+func (p *Pipeline) PausedAgents() []int {
+	ids := []int{}
+	for _, a := range p.agents {
+		if a.Paused() {
+			ids = append(ids, a.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (p *Pipeline) inputs() []*Agent {
+	inputs := []*Agent{}
+	for _, a := range p.agents {
+		if agentKind(a.Type) == "input" {
+			inputs = append(inputs, a)
+		}
+	}
+	return inputs
+}
+
+func (p *Pipeline) input(agentID int) (*Agent, error) {
+	a, ok := p.agents[agentID]
+	if !ok {
+		return nil, fmt.Errorf("agent %d not found in pipeline %s", agentID, p.Label)
+	}
+	if agentKind(a.Type) != "input" {
+		return nil, fmt.Errorf("agent %d of pipeline %s is not an input, only inputs are paused", agentID, p.Label)
+	}
+	return a, nil
+}
+
+func (p *Pipeline) pauseAgent(a *Agent) {
+	if a.pause() {
+		Log().Infof("agent %s of pipeline %s paused", a.Label, p.Label)
+		publishAgentAction(a, "paused")
+	}
+}
+
+func (p *Pipeline) resumeAgent(a *Agent) {
+	if a.resume() {
+		Log().Infof("agent %s of pipeline %s resumed", a.Label, p.Label)
+		publishAgentAction(a, "resumed")
+	}
+}
+
+func publishAgentAction(a *Agent, action string) {
+	monitor.Publish(monitor.KIND_AGENT, map[string]interface{}{
+		"action":          action,
+		"pipeline_uuid":   a.PipelineUUID,
+		"pipeline_label":  a.PipelineName,
+		"processor_label": a.Label,
+		"processor_type":  a.Type,
+	})
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// pausePipeline returns a running pipeline made of 2 inputs and a filter
+func pausePipeline() *Pipeline {
+	p := &Pipeline{Uuid: "p1", Label: "web", agents: map[int]*Agent{
+		1: newTestAgent(1, "input_stdin", &fakeProcessor{}),
+		2: newTestAgent(2, "input_udp", &fakeProcessor{}),
+		3: newTestAgent(3, "filter_mutate", &fakeProcessor{}),
+	}}
+	for _, a := range p.agents {
+		a.resetRunState()
+	}
+	return p
+}
+
+func TestPause(t *testing.T) {
+	p := pausePipeline()
+	assert.False(t, p.Paused())
+
+	assert.EqualError(t, p.PauseAgent(4), "agent 4 not found in pipeline web")
+	assert.EqualError(t, p.PauseAgent(3), "agent 3 of pipeline web is not an input, only inputs are paused")
+	assert.EqualError(t, p.ResumeAgent(3), "agent 3 of pipeline web is not an input, only inputs are paused")
+
+	// a pipeline is paused when all its inputs are paused
+	assert.NoError(t, p.PauseAgent(2))
+	assert.False(t, p.Paused())
+	assert.Equal(t, []int{2}, p.PausedAgents())
+	p.Pause()
+	assert.True(t, p.Paused())
+	assert.Equal(t, []int{1, 2}, p.PausedAgents())
+	assert.False(t, p.agents[1].pause())
+
+	assert.NoError(t, p.ResumeAgent(1))
+	assert.False(t, p.Paused())
+	p.Resume()
+	assert.Empty(t, p.PausedAgents())
+	assert.False(t, p.agents[1].resume())
+
+	// a pipeline without input is never paused
+	assert.False(t, (&Pipeline{agents: map[int]*Agent{}}).Paused())
+}
+
+// waiting tells if a sender of the agent waits after a delay, and returns a
+// channel closed once it is released
+func waiting(a *Agent) (bool, chan bool) {
+	released := make(chan bool)
+	go func() {
+		a.pauses.wait()
+		close(released)
+	}()
+	select {
+	case <-released:
+		return false, released
+	case <-time.After(50 * time.Millisecond):
+		return true, released
+	}
+}
+
+func TestPauseWait(t *testing.T) {
+	p := pausePipeline()
+	a := p.agents[1]
+
+	blocked, _ := waiting(a)
+	assert.False(t, blocked)
+
+	p.Pause()
+	blocked, released := waiting(a)
+	assert.True(t, blocked)
+	p.Resume()
+	<-released
+}
+
+func TestPauseKeptAcrossRestart(t *testing.T) {
+	p := pausePipeline()
+	a := p.agents[1]
+	assert.NoError(t, p.PauseAgent(1))
+	blocked, released := waiting(a)
+	assert.True(t, blocked)
+
+	// a stop releases the held events, the restart pauses the agent again
+	a.pauses.release()
+	<-released
+	assert.False(t, a.Paused())
+	a.resetRunState()
+	assert.True(t, a.Paused())
+	assert.Equal(t, []int{1}, p.PausedAgents())
+	blocked, released = waiting(a)
+	assert.True(t, blocked)
+
+	// a resumed agent is not paused again
+	assert.NoError(t, p.ResumeAgent(1))
+	<-released
+	a.pauses.release()
+	a.resetRunState()
+	assert.False(t, a.Paused())
+}
+
+func TestSupervisorRestartKeepsPause(t *testing.T) {
+	withTestStorage(t)
+	availableProcessorsFactory["input_test_pause"] = func() processors.Processor { return &fakeProcessor{} }
+	t.Cleanup(func() { delete(availableProcessorsFactory, "input_test_pause") })
+
+	p := &Pipeline{Uuid: t.Name(), Label: t.Name(), agents: map[int]*Agent{
+		1: {ID: 1, Label: "in", Type: "input_test_pause", PoolSize: 1},
+	}}
+	_, err := p.start()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		p.stop()
+		pipelines.Delete(p.Uuid)
+		unsupervise(p.Uuid)
+	})
+
+	p.Pause()
+	assert.NoError(t, p.restart())
+	assert.True(t, p.Paused())
+}
@@ -2,10 +2,12 @@ package core
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	fqdn "github.com/ShowMax/go-fqdn"
 	uuid "github.com/nu7hatch/gouuid"
+	"github.com/vjeantet/bitfan/core/monitor"
 	"github.com/vjeantet/bitfan/core/webhook"
 )
 
@@ -18,9 +20,16 @@ type Pipeline struct {
 	StartedAt          time.Time
 
 	Description string
+	// DependsOn are the uuids of the pipelines which must run before this one
+	DependsOn []string
 
 	Webhooks   []webhook.Hook
 	Schedulers []schedulerJob
+
+	supervisor *supervision
+	// run guards the queues, processors and outputs of the agents, built
+	// again on each start, from the api and the supervisor
+	run sync.RWMutex
 }
 
 func NewPipeline() *Pipeline {
@@ -43,14 +52,29 @@ func (p *Pipeline) AddAgent(a Agent) error {
 	return nil
 }
 
-// Start all agents, begin with last
+// Start starts the pipeline once the pipelines it depends on are ready
 func (p *Pipeline) Start() (string, error) {
+	if err := p.waitDependencies(dependencyTimeout); err != nil {
+		Log().Errorf("pipeline %s not started : %v", p.Label, err)
+		monitor.Publish(monitor.KIND_PIPELINE, map[string]interface{}{
+			"action":         "failed",
+			"pipeline_uuid":  p.Uuid,
+			"pipeline_label": p.Label,
+			"error":          err.Error(),
+		})
+		return "", err
+	}
+	return p.start()
+}
 
+func (p *Pipeline) start() (string, error) {
 	if _, ok := pipelines.Load(p.Uuid); ok {
 		// a pipeline with same uuid is already running
 		return "", fmt.Errorf("a pipeline with uuid %s is already running", p.Uuid)
 	}
-
+	// readers of the agents wait while they are built, the processors start
+	// without the lock as a start may take long
+	p.run.Lock()
 	//normalize
 	for i, _ := range p.agents {
 		p.agents[i].AgentRecipients = whoWaitForThisAgentID(p.agents[i].ID, p.agents)
@@ -63,7 +87,14 @@ func (p *Pipeline) Start() (string, error) {
 		Log().Debugf("%s Agent '%-d' ", agentConf.Type, agentConf.ID)
 		err := buildAgent(agentConf)
 		if err != nil {
+			p.run.Unlock()
 			Log().Errorf("%s Agent '%-d': %s", agentConf.Type, agentConf.ID, err.Error())
+			monitor.Publish(monitor.KIND_PIPELINE, map[string]interface{}{
+				"action":         "failed",
+				"pipeline_uuid":  p.Uuid,
+				"pipeline_label": p.Label,
+				"error":          err.Error(),
+			})
 			return "", err
 		}
 
@@ -77,14 +108,21 @@ func (p *Pipeline) Start() (string, error) {
 		}
 		Log().Debugf("%s Agent '%-d' configured", agentConf.Type, agentConf.ID)
 	}
+	p.StartedAt = time.Now()
+	p.run.Unlock()
 
 	orderedAgentConfList = Sort(p.agents, SortOutputsFirst)
 	for _, agentConf := range orderedAgentConfList {
 		Log().Debugf("start %d - %s", agentConf.ID, p.agents[agentConf.ID].Label)
 		p.agents[agentConf.ID].start()
 	}
-	p.StartedAt = time.Now()
 	pipelines.Store(p.Uuid, p)
+	p.watch()
+	monitor.Publish(monitor.KIND_PIPELINE, map[string]interface{}{
+		"action":         "started",
+		"pipeline_uuid":  p.Uuid,
+		"pipeline_label": p.Label,
+	})
 	return p.Uuid, nil
 }
 
@@ -96,11 +134,18 @@ func (p *Pipeline) stop() error {
 	orderedAgentConfList := Sort(p.agents, SortInputsFirst)
 	for _, agentConf := range orderedAgentConfList {
 		Log().Debugf("stop %d - %s", agentConf.ID, p.agents[agentConf.ID].Label)
-		p.agents[agentConf.ID].stop()
+		p.agents[agentConf.ID].stop(&p.run)
 	}
 	return nil
 }
 
+// Started returns the time of the last start of the pipeline
+func (p *Pipeline) Started() time.Time {
+	p.run.RLock()
+	defer p.run.RUnlock()
+	return p.StartedAt
+}
+
 func (p *Pipeline) Agents() map[int]*Agent {
 	return p.agents
 }
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// Graph is the agents of a pipeline and the connections between them
+type Graph struct {
+	UUID  string       `json:"uuid"`
+	Label string       `json:"label"`
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+// GraphNode is an agent of a pipeline graph
+type GraphNode struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	// Kind is input, filter or output
+	Kind   string `json:"kind"`
+	Source string `json:"source,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	// events received and sent since the pipeline started, set for the
+	// graph of a running pipeline only
+	EventsIn  *int64 `json:"events_in,omitempty"`
+	EventsOut *int64 `json:"events_out,omitempty"`
+}
+
+// GraphEdge is a connection from the port of an agent to another agent
+type GraphEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	Port int `json:"port"`
+	// Label is the condition of a when port, on_failure for the failure port
+	Label string `json:"label,omitempty"`
+}
+
+// Graph returns the graph of the pipeline, events adds the number of events
+// each agent received and sent
+func (p *Pipeline) Graph(events bool) *Graph {
+	g := &Graph{UUID: p.Uuid, Label: p.Label, Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+	dir := ""
+	if p.ConfigLocation != "" {
+		dir = filepath.Dir(p.ConfigLocation)
+	}
+
+	for _, a := range p.agents {
+		n := &GraphNode{
+			ID:     a.ID,
+			Label:  a.Label,
+			Type:   strings.TrimPrefix(strings.TrimPrefix(a.Type, "input_"), "output_"),
+			Kind:   agentKind(a.Type),
+			Source: a.Source,
+			Line:   a.Line,
+		}
+		if rel, err := filepath.Rel(dir, a.Source); dir != "" && err == nil && !strings.HasPrefix(rel, "..") {
+			n.Source = rel
+		}
+		if events {
+			in, out := a.Events()
+			n.EventsIn, n.EventsOut = &in, &out
+		}
+		g.Nodes = append(g.Nodes, n)
+
+		for _, source := range a.AgentSources {
+			e := &GraphEdge{From: source.AgentID, To: a.ID, Port: source.PortNumber}
+			if from, ok := p.agents[source.AgentID]; ok {
+				e.Label = portLabel(from, source.PortNumber)
+			}
+			g.Edges = append(g.Edges, e)
+		}
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		if g.Edges[i].Port != g.Edges[j].Port {
+			return g.Edges[i].Port < g.Edges[j].Port
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+func agentKind(agentType string) string {
+	switch {
+	case strings.HasPrefix(agentType, "input_"):
+		return "input"
+	case strings.HasPrefix(agentType, "output_"):
+		return "output"
+	}
+	return "filter"
+}
+
+// portLabel describes the events an agent sends on a port
+func portLabel(a *Agent, port int) string {
+	if port == processors.PORT_FAILURE {
+		return "on_failure"
+	}
+	if a.Type == "when" {
+		if expressions, ok := a.Options["expressions"].(map[int]string); ok {
+			if expressions[port] == "true" {
+				return "else"
+			}
+			return expressions[port]
+		}
+	}
+	if port != 0 {
+		return strconv.Itoa(port)
+	}
+	return ""
+}
+
+// text returns the lines of a node : its label, its type when it differs,
+// its configuration line and its events
+func (n *GraphNode) text() []string {
+	lines := []string{n.Label}
+	if n.Type != n.Label {
+		lines[0] = fmt.Sprintf("%s (%s)", n.Label, n.Type)
+	}
+	if n.Source != "" && n.Line > 0 {
+		lines = append(lines, fmt.Sprintf("%s:%d", n.Source, n.Line))
+	} else if n.Source != "" {
+		lines = append(lines, n.Source)
+	}
+	if n.EventsIn != nil && n.EventsOut != nil {
+		lines = append(lines, fmt.Sprintf("in %d / out %d", *n.EventsIn, *n.EventsOut))
+	}
+	return lines
+}
+
+// Dot returns the graph in the Graphviz DOT language
+func (g *Graph) Dot() string {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "digraph %s {\n", strconv.Quote(g.Label))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+	for _, n := range g.Nodes {
+		shape := ""
+		switch {
+		case n.Type == "when":
+			shape = ", shape=diamond, style=solid"
+		case n.Kind != "filter":
+			shape = ", style=\"rounded,bold\""
+		}
+		label := strings.Join(n.text(), "\n")
+		fmt.Fprintf(b, "  %d [label=%s%s];\n", n.ID, strconv.Quote(label), shape)
+	}
+	for _, e := range g.Edges {
+		if e.Label == "" {
+			fmt.Fprintf(b, "  %d -> %d;\n", e.From, e.To)
+			continue
+		}
+		style := ""
+		if e.Port == processors.PORT_FAILURE {
+			style = ", style=dashed, color=red"
+		}
+		fmt.Fprintf(b, "  %d -> %d [label=%s%s];\n", e.From, e.To, strconv.Quote(e.Label), style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid returns the graph as a Mermaid flowchart
+func (g *Graph) Mermaid() string {
+	b := &bytes.Buffer{}
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		label := mermaidText(strings.Join(n.text(), "<br/>"))
+		switch {
+		case n.Type == "when":
+			fmt.Fprintf(b, "  a%d{\"%s\"}\n", n.ID, label)
+		case n.Kind == "input":
+			fmt.Fprintf(b, "  a%d[/\"%s\"/]\n", n.ID, label)
+		case n.Kind == "output":
+			fmt.Fprintf(b, "  a%d[\\\"%s\"\\]\n", n.ID, label)
+		default:
+			fmt.Fprintf(b, "  a%d(\"%s\")\n", n.ID, label)
+		}
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Port == processors.PORT_FAILURE {
+			arrow = "-.->"
+		}
+		if e.Label == "" {
+			fmt.Fprintf(b, "  a%d %s a%d\n", e.From, arrow, e.To)
+			continue
+		}
+		fmt.Fprintf(b, "  a%d %s|\"%s\"| a%d\n", e.From, arrow, mermaidText(e.Label), e.To)
+	}
+	return b.String()
+}
+
+// mermaidText escapes the characters closing a Mermaid label
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;", "\n", " ").Replace(s)
+}
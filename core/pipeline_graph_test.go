@@ -0,0 +1,106 @@
+package core
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// assertGolden compares content with the file testdata/name
+func assertGolden(t *testing.T, name string, content []byte) {
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(golden, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(expected), string(content))
+}
+
+// graphPipeline reads stdin, parses lines and sends errors to elasticsearch
+// and a file, other events and failures to stdout
+func graphPipeline() *Pipeline {
+	when := map[int]string{0: `[status] == "error"`, 1: "true"}
+	agents := []*Agent{
+		{ID: 1, Label: "stdin", Type: "input_stdin", Source: "/etc/bitfan/main.conf", Line: 2},
+		{ID: 2, Label: "parse", Type: "grok", Source: "/etc/bitfan/main.conf", Line: 6,
+			AgentSources: PortList{{AgentID: 1}}},
+		{ID: 3, Label: "when", Type: "when", Source: "/etc/bitfan/main.conf", Line: 10,
+			Options: map[string]interface{}{"expressions": when}, AgentSources: PortList{{AgentID: 2}}},
+		{ID: 4, Label: "elasticsearch", Type: "output_elasticsearch", Source: "/etc/bitfan/outputs/es.conf", Line: 1,
+			AgentSources: PortList{{AgentID: 3}}},
+		{ID: 5, Label: "archive", Type: "output_file", Source: "/var/lib/shared.conf", Line: 3,
+			AgentSources: PortList{{AgentID: 3}}},
+		{ID: 6, Label: "stdout", Type: "output_stdout",
+			AgentSources: PortList{{AgentID: 3, PortNumber: 1}, {AgentID: 2, PortNumber: processors.PORT_FAILURE}}},
+	}
+
+	p := &Pipeline{Uuid: "graph", Label: "web logs", ConfigLocation: "/etc/bitfan/main.conf", agents: map[int]*Agent{}}
+	for _, a := range agents {
+		p.agents[a.ID] = a
+	}
+	return p
+}
+
+func TestGraph(t *testing.T) {
+	p := graphPipeline()
+	g := p.Graph(false)
+
+	assertGolden(t, "graph.dot", []byte(g.Dot()))
+	assertGolden(t, "graph.mmd", []byte(g.Mermaid()))
+
+	p.agents[1].eventsOut = 10
+	p.agents[2].eventsIn, p.agents[2].eventsOut = 10, 9
+	content, err := json.MarshalIndent(p.Graph(true), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "graph.json", append(content, '\n'))
+}
+
+func TestAgentKind(t *testing.T) {
+	tests := map[string]string{
+		"input_stdin":   "input",
+		"output_stdout": "output",
+		"grok":          "filter",
+		"when":          "filter",
+	}
+	for agentType, kind := range tests {
+		assert.Equal(t, kind, agentKind(agentType), agentType)
+	}
+}
+
+func TestPortLabel(t *testing.T) {
+	when := &Agent{Type: "when", Options: map[string]interface{}{
+		"expressions": map[int]string{0: `[status] == "error"`, 1: "[code] > 400", 2: "true"},
+	}}
+	tests := []struct {
+		name  string
+		agent *Agent
+		port  int
+		label string
+	}{
+		{"failure", &Agent{Type: "grok"}, processors.PORT_FAILURE, "on_failure"},
+		{"when failure", when, processors.PORT_FAILURE, "on_failure"},
+		{"if", when, 0, `[status] == "error"`},
+		{"else if", when, 1, "[code] > 400"},
+		{"else", when, 2, "else"},
+		{"when without expressions", &Agent{Type: "when"}, 1, "1"},
+		{"default port", &Agent{Type: "grok"}, 0, ""},
+		{"other port", &Agent{Type: "grok"}, 2, "2"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.label, portLabel(tt.agent, tt.port), tt.name)
+	}
+}
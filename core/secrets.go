@@ -0,0 +1,138 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vjeantet/bitfan/core/keystore"
+)
+
+// REDACTED replaces secret values in logs
+const REDACTED = "********"
+
+// secrets shorter than minRedactLength are not redacted, they would hide
+// too many unrelated words
+const minRedactLength = 3
+
+var myKeystore *keystore.Keystore
+
+var redacted = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+// setKeystore opens the keystore located at path with the password found in
+// the BITFAN_KEYSTORE_PASS env, its secrets are usable as ${secret:NAME}
+func setKeystore(path string) error {
+	password := os.Getenv(keystore.PASSWORD_ENV)
+	os.Unsetenv(keystore.PASSWORD_ENV)
+
+	if !keystore.Exists(path) {
+		Log().Debugf("no keystore found at %s", path)
+		return nil
+	}
+
+	k, err := keystore.Open(path, password)
+	if err != nil {
+		return err
+	}
+	myKeystore = k
+	Redact(k.Values()...)
+	Log().Debugf("keystore : %s", path)
+	return nil
+}
+
+// Secret returns the value of the keystore's secret name
+func Secret(name string) (string, error) {
+	if myKeystore == nil {
+		return "", errors.New("no keystore loaded")
+	}
+	value, ok := myKeystore.Get(name)
+	if !ok {
+		return "", errors.New("secret " + name + " not found in keystore")
+	}
+	// the secret may have been added to the keystore after bitfan started
+	Redact(value)
+	return value, nil
+}
+
+// Redact hides values from all log entries
+func Redact(values ...string) {
+	redacted.Lock()
+	for _, v := range values {
+		if len(v) >= minRedactLength {
+			redacted.values[v] = true
+		}
+	}
+	redacted.Unlock()
+}
+
+// redactHook replaces secret values found in log entries, it has to be the
+// first hook to fire
+type redactHook struct{}
+
+func (h *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactHook) Fire(entry *logrus.Entry) error {
+	redacted.RLock()
+	defer redacted.RUnlock()
+	if len(redacted.values) == 0 {
+		return nil
+	}
+
+	entry.Message = redactString(entry.Message)
+	// entry.Data is shared by all the entries of a logger, concurrent entries
+	// would write to the same map
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		data[k] = redactValue(v)
+	}
+	entry.Data = data
+	return nil
+}
+
+func redactString(s string) string {
+	for v := range redacted.values {
+		if strings.Contains(s, v) {
+			s = strings.Replace(s, v, REDACTED, -1)
+		}
+	}
+	return s
+}
+
+// redactValue returns v with secrets replaced, maps and slices are copied as
+// they may be the data of an event still flowing in the pipeline
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return redactString(t)
+	case error:
+		if s := t.Error(); redactString(s) != s {
+			return errors.New(redactString(s))
+		}
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			c[k] = redactValue(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i, e := range t {
+			c[i] = redactValue(e)
+		}
+		return c
+	case []string:
+		c := make([]string, len(t))
+		for i, e := range t {
+			c[i] = redactString(e)
+		}
+		return c
+	}
+	return v
+}
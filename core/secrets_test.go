@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/core/keystore"
+)
+
+func TestRedactValue(t *testing.T) {
+	Redact("t0ps3cret", "ab")
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"string", "password=t0ps3cret;", "password=" + REDACTED + ";"},
+		{"short secrets are kept", "ab cd", "ab cd"},
+		{"error", errors.New("login t0ps3cret refused"), errors.New("login " + REDACTED + " refused")},
+		{"number", 42, 42},
+		{
+			"map",
+			map[string]interface{}{"a": "t0ps3cret", "b": map[string]interface{}{"c": "x t0ps3cret"}},
+			map[string]interface{}{"a": REDACTED, "b": map[string]interface{}{"c": "x " + REDACTED}},
+		},
+		{"slice", []interface{}{"t0ps3cret", 1}, []interface{}{REDACTED, 1}},
+		{"strings", []string{"t0ps3cret", "ok"}, []string{REDACTED, "ok"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, redactValue(tt.value))
+		})
+	}
+
+	// events are copied, not redacted in place
+	event := map[string]interface{}{"a": "t0ps3cret"}
+	redactValue(event)
+	assert.Equal(t, "t0ps3cret", event["a"])
+}
+
+func TestRedactHook(t *testing.T) {
+	Redact("supersecret")
+	out := &bytes.Buffer{}
+	l := logrus.New()
+	l.Out = out
+	l.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+	l.Hooks.Add(&redactHook{})
+
+	// entries of a logger share its fields
+	e := l.WithFields(logrus.Fields{"password": "supersecret", "user": "bob"})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e.Warnf("login with supersecret")
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 1000)
+	assert.NotContains(t, out.String(), "supersecret")
+	assert.Equal(t, `level=warning msg="login with `+REDACTED+`" password="`+REDACTED+`" user=bob`, strings.TrimSpace(lines[0]))
+	assert.Equal(t, "supersecret", e.Data["password"])
+}
+
+func TestSecret(t *testing.T) {
+	defer func(k *keystore.Keystore) { myKeystore = k }(myKeystore)
+
+	myKeystore = nil
+	_, err := Secret("DB_PASS")
+	assert.EqualError(t, err, "no keystore loaded")
+
+	k, err := keystore.Open(filepath.Join(t.TempDir(), "bitfan.keystore"), "master")
+	assert.NoError(t, err)
+	k.Set("DB_PASS", "added-later")
+	myKeystore = k
+
+	value, err := Secret("DB_PASS")
+	assert.NoError(t, err)
+	assert.Equal(t, "added-later", value)
+	// the secret is redacted once used
+	assert.Equal(t, REDACTED, redactString("added-later"))
+
+	_, err = Secret("UNKNOWN")
+	assert.EqualError(t, err, "secret UNKNOWN not found in keystore")
+}
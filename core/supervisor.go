@@ -0,0 +1,344 @@
+package core
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/syncmap"
+
+	"github.com/vjeantet/bitfan/core/monitor"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// SupervisorOptions of the restarts of the failed agents and pipelines
+type SupervisorOptions struct {
+	// MaxAttempts is the number of restarts in a row before giving up, 0
+	// disables the supervisor
+	MaxAttempts int
+	// Backoff is the delay before the first restart, doubled after each
+	// attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// SupervisorState is the restarts of a pipeline and of its agents
+type SupervisorState struct {
+	// Restarts is the number of restarts since the pipeline started
+	Restarts int `json:"restarts"`
+	// Attempts is the number of restarts in a row, reset once the pipeline
+	// stays healthy
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at"`
+	// GaveUp is true once MaxAttempts restarts in a row failed
+	GaveUp bool `json:"gave_up,omitempty"`
+}
+
+// supervision of a pipeline
+type supervision struct {
+	sync.Mutex
+	state SupervisorState
+	// time of the next restart attempt
+	next time.Time
+	// stopped on purpose, no more restarts
+	stopped bool
+}
+
+// startFailure is the error of the last failed start of an agent, and the
+// panic which killed one of its workers
+type startFailure struct {
+	sync.Mutex
+	err   error
+	crash error
+}
+
+// reset forgets the failures of a previous run
+func (f *startFailure) reset() {
+	f.Lock()
+	f.err, f.crash = nil, nil
+	f.Unlock()
+}
+
+var (
+	// supervised pipelines, by uuid, including the ones whose restart failed
+	supervised  syncmap.Map = syncmap.Map{}
+	supervising sync.Mutex
+)
+
+// startSupervisor checks the supervised pipelines every second
+func startSupervisor(opt SupervisorOptions) {
+	if opt.MaxAttempts <= 0 {
+		return
+	}
+	if opt.Backoff <= 0 {
+		opt.Backoff = time.Second
+	}
+	if opt.MaxBackoff < opt.Backoff {
+		opt.MaxBackoff = opt.Backoff
+	}
+	Log().Debugf("supervisor started, %d attempts, backoff %s to %s", opt.MaxAttempts, opt.Backoff, opt.MaxBackoff)
+	go func() {
+		for now := range time.Tick(time.Second) {
+			if atomic.LoadInt32(&ready) == 0 {
+				continue
+			}
+			supervised.Range(func(key, value interface{}) bool {
+				value.(*Pipeline).supervise(now, opt)
+				return true
+			})
+		}
+	}()
+}
+
+// GetSupervisorState returns the supervisor state of a pipeline, running or
+// whose restart failed
+func GetSupervisorState(UUID string) (SupervisorState, bool) {
+	if p, ok := supervised.Load(UUID); ok {
+		s := p.(*Pipeline).supervision()
+		s.Lock()
+		defer s.Unlock()
+		return s.state, true
+	}
+	return SupervisorState{}, false
+}
+
+// watch registers a started pipeline, a pipeline started again by the
+// supervisor keeps its state
+func (p *Pipeline) watch() {
+	supervised.Store(p.Uuid, p)
+}
+
+// unsupervise forgets a pipeline stopped on purpose, it waits for a restart
+// in progress and tells if the pipeline was supervised
+func unsupervise(UUID string) bool {
+	p, ok := supervised.Load(UUID)
+	if !ok {
+		return false
+	}
+	supervised.Delete(UUID)
+	s := p.(*Pipeline).supervision()
+	s.Lock()
+	s.stopped = true
+	s.Unlock()
+
+	// started again, the pipeline starts over
+	supervising.Lock()
+	p.(*Pipeline).supervisor = nil
+	supervising.Unlock()
+	return true
+}
+
+func (p *Pipeline) supervision() *supervision {
+	supervising.Lock()
+	defer supervising.Unlock()
+	if p.supervisor == nil {
+		p.supervisor = &supervision{}
+	}
+	return p.supervisor
+}
+
+// supervise restarts the agents which failed to start and the pipeline when
+// an agent died, with backoff
+func (p *Pipeline) supervise(now time.Time, opt SupervisorOptions) {
+	s := p.supervision()
+	s.Lock()
+	defer s.Unlock()
+	if s.stopped {
+		return
+	}
+	// unsupervised since the tick loaded it
+	if current, ok := supervised.Load(p.Uuid); !ok || current != p {
+		return
+	}
+
+	failed, dead, err := p.failures()
+	if err == nil {
+		// healthy through the last backoff, the failures are over
+		if s.state.Attempts > 0 && now.After(s.next) {
+			Log().Infof("pipeline %s recovered after %d restart(s)", p.Label, s.state.Attempts)
+			s.state.Attempts = 0
+			s.state.GaveUp = false
+		}
+		return
+	}
+	if s.state.GaveUp || now.Before(s.next) {
+		return
+	}
+
+	s.state.LastError = err.Error()
+	s.state.LastErrorAt = now
+	if s.state.Attempts >= opt.MaxAttempts {
+		s.state.GaveUp = true
+		Log().Errorf("pipeline %s : giving up after %d restart(s) - %v", p.Label, s.state.Attempts, err)
+		p.publishSupervisor("gave_up", err)
+		return
+	}
+
+	s.state.Attempts++
+	s.state.Restarts++
+	backoff := opt.Backoff << uint(s.state.Attempts-1)
+	if backoff > opt.MaxBackoff || backoff <= 0 {
+		backoff = opt.MaxBackoff
+	}
+	s.next = now.Add(backoff)
+
+	if dead || len(failed) == 0 {
+		Log().Warnf("pipeline %s : restart %d/%d - %v", p.Label, s.state.Attempts, opt.MaxAttempts, err)
+		p.publishSupervisor("restarting", err)
+		if err := p.restart(); err != nil {
+			s.state.LastError = err.Error()
+			Log().Errorf("pipeline %s : restart failed, next attempt in %s - %v", p.Label, backoff, err)
+		}
+		return
+	}
+
+	for _, a := range failed {
+		Log().Warnf("pipeline %s : agent %s start %d/%d - %v", p.Label, a.Label, s.state.Attempts, opt.MaxAttempts, a.StartError())
+		if err := a.retryStart(); err != nil {
+			s.state.LastError = fmt.Sprintf("agent %s not started : %v", a.Label, err)
+			Log().Errorf("pipeline %s : agent %s not started, next attempt in %s - %v", p.Label, a.Label, backoff, err)
+		}
+	}
+	p.publishSupervisor("restarting", err)
+}
+
+// failures returns the agents which failed to start, whether an agent died
+// and the first failure found
+func (p *Pipeline) failures() (failed []*Agent, dead bool, err error) {
+	if running, ok := pipelines.Load(p.Uuid); !ok || running != p {
+		return nil, true, fmt.Errorf("pipeline %s is not running", p.Label)
+	}
+	p.run.RLock()
+	defer p.run.RUnlock()
+	for _, a := range Sort(p.agents, SortInputsFirst) {
+		if crash := a.Crash(); crash != nil {
+			dead = true
+			err = fmt.Errorf("agent %s crashed : %v", a.Label, crash)
+			return
+		}
+		if startErr := a.StartError(); startErr != nil {
+			failed = append(failed, a)
+			if err == nil {
+				err = fmt.Errorf("agent %s not started : %v", a.Label, startErr)
+			}
+			continue
+		}
+		select {
+		case <-a.Done:
+			dead = true
+			err = fmt.Errorf("agent %s stopped", a.Label)
+			return
+		default:
+		}
+		// an input down does not receive events any more
+		if hc, ok := a.processor.(processors.HealthChecker); ok && agentKind(a.Type) == "input" {
+			if h := hc.Health(); h.Status == processors.HEALTH_DOWN {
+				dead = true
+				err = fmt.Errorf("input %s is down : %s", a.Label, h.Message)
+				return
+			}
+		}
+	}
+	return
+}
+
+// restart stops the pipeline when it runs and starts it again
+func (p *Pipeline) restart() error {
+	if running, ok := pipelines.Load(p.Uuid); ok && running == p {
+		if err := p.stop(); err != nil {
+			return err
+		}
+		pipelines.Delete(p.Uuid)
+	}
+	// no wait for the dependencies, the next attempt checks them again
+	if err := p.waitDependencies(0); err != nil {
+		return err
+	}
+	if _, err := p.start(); err != nil {
+		return err
+	}
+	if paused := p.PausedAgents(); len(paused) > 0 {
+		Log().Warnf("pipeline %s restarted with its paused agents %v, resume them to receive events", p.Label, paused)
+	}
+	return nil
+}
+
+func (p *Pipeline) publishSupervisor(action string, err error) {
+	monitor.Publish(monitor.KIND_PIPELINE, map[string]interface{}{
+		"action":         action,
+		"pipeline_uuid":  p.Uuid,
+		"pipeline_label": p.Label,
+		"error":          err.Error(),
+	})
+}
+
+// StartError returns the error of the last failed start of the agent
+func (a *Agent) StartError() error {
+	if a.failure == nil {
+		return nil
+	}
+	a.failure.Lock()
+	defer a.failure.Unlock()
+	return a.failure.err
+}
+
+func (a *Agent) setStartError(err error) {
+	a.failure.Lock()
+	a.failure.err = err
+	a.failure.Unlock()
+}
+
+// Crash returns the panic which killed a worker of the agent
+func (a *Agent) Crash() error {
+	if a.failure == nil {
+		return nil
+	}
+	a.failure.Lock()
+	defer a.failure.Unlock()
+	return a.failure.crash
+}
+
+// recoverCrash records the panic of a goroutine of the agent, the supervisor
+// restarts its pipeline
+func (a *Agent) recoverCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := fmt.Errorf("panic : %v", r)
+	Log().Errorf("pipeline UUID '%s' agent '%s' crashed - %v\n%s", a.PipelineUUID, a.Label, err, debug.Stack())
+	a.failure.Lock()
+	a.failure.crash = err
+	a.failure.Unlock()
+	monitor.Publish(monitor.KIND_AGENT, map[string]interface{}{
+		"action":          "crashed",
+		"pipeline_uuid":   a.PipelineUUID,
+		"pipeline_label":  a.PipelineName,
+		"processor_label": a.Label,
+		"processor_type":  a.Type,
+		"error":           err.Error(),
+	})
+}
+
+// startProcessor starts the processor of the agent, a panic is returned as an error
+func (a *Agent) startProcessor() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic : %v", r)
+		}
+	}()
+	return a.processor.Start(newPacket(map[string]interface{}{"message": "start"}))
+}
+
+// retryStart starts again the processor of an agent which failed to start
+func (a *Agent) retryStart() error {
+	err := a.startProcessor()
+	a.setStartError(err)
+	if err == nil {
+		Log().Infof("pipeline UUID '%s' agent '%s' started", a.PipelineUUID, a.Label)
+	}
+	return err
+}
@@ -0,0 +1,265 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/core/metrics"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// fakeProcessor fails to start while startErrors is not empty and panics on
+// the event "panic"
+type fakeProcessor struct {
+	processors.Base
+	processors.HealthTracker
+	startErrors []error
+	starts      int
+}
+
+func (f *fakeProcessor) Start(e processors.IPacket) error {
+	f.starts++
+	if len(f.startErrors) == 0 {
+		return nil
+	}
+	err := f.startErrors[0]
+	f.startErrors = f.startErrors[1:]
+	return err
+}
+
+func (f *fakeProcessor) Receive(e processors.IPacket) error {
+	if e.Message() == "panic" {
+		panic("boom")
+	}
+	return nil
+}
+
+func newTestAgent(id int, agentType string, proc processors.Processor) *Agent {
+	return &Agent{
+		ID:        id,
+		Label:     agentType,
+		Type:      agentType,
+		processor: proc,
+		failure:   &startFailure{},
+		Done:      make(chan bool),
+	}
+}
+
+// runTestPipeline registers a running pipeline made of agents
+func runTestPipeline(t *testing.T, agents ...*Agent) *Pipeline {
+	p := &Pipeline{Uuid: t.Name(), Label: t.Name(), agents: map[int]*Agent{}}
+	for _, a := range agents {
+		p.agents[a.ID] = a
+	}
+	pipelines.Store(p.Uuid, p)
+	p.watch()
+	t.Cleanup(func() {
+		pipelines.Delete(p.Uuid)
+		unsupervise(p.Uuid)
+	})
+	return p
+}
+
+func TestSuperviseBackoffAndGiveUp(t *testing.T) {
+	err := errors.New("address already in use")
+	proc := &fakeProcessor{startErrors: []error{err, err, err, err}}
+	a := newTestAgent(1, "input_udp", proc)
+	a.setStartError(proc.Start(nil))
+	p := runTestPipeline(t, a)
+
+	opt := SupervisorOptions{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	t0 := time.Now()
+	state := func() SupervisorState {
+		s, ok := GetSupervisorState(p.Uuid)
+		assert.True(t, ok)
+		return s
+	}
+
+	tests := []struct {
+		at       time.Duration
+		attempts int
+		starts   int
+		gaveUp   bool
+	}{
+		{0, 1, 2, false},
+		{500 * time.Millisecond, 1, 2, false}, // backoff 1s
+		{time.Second, 2, 3, false},
+		{2 * time.Second, 2, 3, false}, // backoff 2s
+		{3 * time.Second, 3, 4, false},
+		{5 * time.Second, 3, 4, false}, // backoff 4s capped to 3s
+		{6 * time.Second, 3, 4, true},
+		{time.Minute, 3, 4, true},
+	}
+	for _, tt := range tests {
+		p.supervise(t0.Add(tt.at), opt)
+		s := state()
+		assert.Equal(t, tt.attempts, s.Attempts, "attempts at %s", tt.at)
+		assert.Equal(t, tt.attempts, s.Restarts, "restarts at %s", tt.at)
+		assert.Equal(t, tt.starts, proc.starts, "starts at %s", tt.at)
+		assert.Equal(t, tt.gaveUp, s.GaveUp, "gave up at %s", tt.at)
+	}
+	assert.Equal(t, "agent input_udp not started : address already in use", state().LastError)
+}
+
+func TestSuperviseRecovery(t *testing.T) {
+	proc := &fakeProcessor{startErrors: []error{errors.New("refused")}}
+	a := newTestAgent(1, "input_udp", proc)
+	a.setStartError(proc.Start(nil))
+	p := runTestPipeline(t, a)
+
+	opt := SupervisorOptions{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: time.Minute}
+	t0 := time.Now()
+
+	p.supervise(t0, opt) // started again
+	assert.NoError(t, a.StartError())
+
+	// healthy but still within the backoff
+	p.supervise(t0.Add(500*time.Millisecond), opt)
+	s, _ := GetSupervisorState(p.Uuid)
+	assert.Equal(t, 1, s.Attempts)
+
+	// healthy through the backoff, attempts are reset, restarts are kept
+	p.supervise(t0.Add(2*time.Second), opt)
+	s, _ = GetSupervisorState(p.Uuid)
+	assert.Equal(t, 0, s.Attempts)
+	assert.Equal(t, 1, s.Restarts)
+	assert.False(t, s.GaveUp)
+}
+
+func TestSuperviseStopped(t *testing.T) {
+	proc := &fakeProcessor{startErrors: []error{errors.New("refused"), errors.New("refused")}}
+	a := newTestAgent(1, "input_udp", proc)
+	a.setStartError(proc.Start(nil))
+	p := runTestPipeline(t, a)
+	s := p.supervision()
+
+	assert.True(t, unsupervise(p.Uuid))
+	assert.False(t, unsupervise(p.Uuid))
+
+	p.supervise(time.Now(), SupervisorOptions{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: time.Second})
+	assert.Equal(t, 1, proc.starts)
+	assert.Equal(t, 0, s.state.Attempts)
+	_, ok := GetSupervisorState(p.Uuid)
+	assert.False(t, ok)
+}
+
+func TestFailures(t *testing.T) {
+	input := &fakeProcessor{}
+	in := newTestAgent(1, "input_udp", input)
+	filter := newTestAgent(2, "filter_mutate", &fakeProcessor{})
+	p := runTestPipeline(t, in, filter)
+
+	failed, dead, err := p.failures()
+	assert.Empty(t, failed)
+	assert.False(t, dead)
+	assert.NoError(t, err)
+
+	// an input whose loop stopped
+	input.Watch(func() error { return errors.New("connection reset") })
+	for i := 0; i < 100 && input.Health().Status != processors.HEALTH_DOWN; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_, dead, err = p.failures()
+	assert.True(t, dead)
+	assert.EqualError(t, err, "input input_udp is down : connection reset")
+
+	// a crashed agent
+	block := make(chan bool)
+	defer close(block)
+	input.Watch(func() error {
+		<-block
+		return nil
+	})
+	filter.failure.crash = errors.New("panic : boom")
+	_, dead, err = p.failures()
+	assert.True(t, dead)
+	assert.EqualError(t, err, "agent filter_mutate crashed : panic : boom")
+	assert.Equal(t, processors.HEALTH_DOWN, filter.Health().Status)
+
+	pipelines.Delete(p.Uuid)
+	_, dead, err = p.failures()
+	assert.True(t, dead)
+	assert.Error(t, err)
+}
+
+func TestListenRecoversPanic(t *testing.T) {
+	if myMetrics == nil {
+		myMetrics = metrics.New()
+	}
+	a := newTestAgent(1, "filter_mutate", &fakeProcessor{})
+	a.packetChan = make(chan *event, 2)
+	a.packetChan <- newPacket(map[string]interface{}{"message": "ok"}).(*event)
+	a.packetChan <- newPacket(map[string]interface{}{"message": "panic"}).(*event)
+	close(a.packetChan)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	a.listen(wg)
+	wg.Wait()
+
+	assert.EqualError(t, a.Crash(), "panic : boom")
+	in, _ := a.Events()
+	assert.Equal(t, int64(1), in)
+}
+
+func TestStartProcessorRecoversPanic(t *testing.T) {
+	a := newTestAgent(1, "input_udp", &panicOnStart{})
+	assert.EqualError(t, a.retryStart(), "panic : no port")
+	assert.EqualError(t, a.StartError(), "panic : no port")
+}
+
+type panicOnStart struct {
+	processors.Base
+}
+
+func (p *panicOnStart) Start(e processors.IPacket) error {
+	panic("no port")
+}
+
+// TestRestartWhileReading restarts a pipeline while the api reads the state
+// of its agents, run it with -race
+func TestRestartWhileReading(t *testing.T) {
+	withTestStorage(t)
+	availableProcessorsFactory["test_restart"] = func() processors.Processor { return &fakeProcessor{} }
+	t.Cleanup(func() { delete(availableProcessorsFactory, "test_restart") })
+
+	p := &Pipeline{Uuid: t.Name(), Label: t.Name(), agents: map[int]*Agent{
+		1: {ID: 1, Label: "in", Type: "test_restart", PoolSize: 1},
+		2: {ID: 2, Label: "filter", Type: "test_restart", PoolSize: 1, Buffer: 10, AgentSources: PortList{{AgentID: 1}}},
+	}}
+	_, err := p.start()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		p.stop()
+		pipelines.Delete(p.Uuid)
+		unsupervise(p.Uuid)
+	})
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, p.restart())
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		p.Health()
+		p.Started()
+		p.failures()
+		// the agent may be stopped while it restarts
+		p.Inject(2, []map[string]interface{}{{"message": "hello"}})
+	}
+
+	assert.Equal(t, processors.HEALTH_UP, p.Health().Status)
+	n, err := p.Inject(2, []map[string]interface{}{{"message": "hello"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
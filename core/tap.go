@@ -0,0 +1,201 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vjeantet/bitfan/commons/expression"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+// TappedEvent is an event sent by a tapped agent
+type TappedEvent struct {
+	Time  time.Time              `json:"time"`
+	Port  int                    `json:"port"`
+	Event map[string]interface{} `json:"event"`
+	// Dropped is the number of events dropped since the previous one, over
+	// the rate or while the observer was late
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+// TapOptions of an observer of an agent
+type TapOptions struct {
+	// Filter keeps the events matching the expression, all events when nil
+	Filter *expression.Expression
+	// Rate is the maximum number of events by second, 0 is unlimited
+	Rate int
+	// Size of the buffer of events waiting for the observer
+	Size int
+}
+
+// Tap is a temporary observer of the events an agent sends, it never slows
+// down the agent : events are dropped when the observer is late
+type Tap struct {
+	agent   *Agent
+	opt     TapOptions
+	events  chan TappedEvent
+	dropped int64
+
+	mu     sync.Mutex
+	closed bool
+	// events sent during the current second
+	second int64
+	count  int
+}
+
+// agentTaps are the observers of an agent
+type agentTaps struct {
+	// number of observers, checked atomically on each event
+	count int32
+
+	sync.RWMutex
+	list []*Tap
+	// false while the agent is stopped
+	running bool
+}
+
+// Tap attaches an observer to the output ports of a running agent, the
+// observer must be closed when it is no more used
+func (p *Pipeline) Tap(agentID int, opt TapOptions) (*Tap, error) {
+	a, ok := p.agents[agentID]
+	if !ok {
+		return nil, fmt.Errorf("agent %d not found in pipeline %s", agentID, p.Label)
+	}
+	if opt.Size <= 0 {
+		opt.Size = 100
+	}
+
+	// a.taps is set once, before the pipeline first runs
+	taps := a.taps
+	if taps == nil {
+		return nil, fmt.Errorf("agent %d of pipeline %s is not running", agentID, p.Label)
+	}
+	taps.Lock()
+	defer taps.Unlock()
+	if !taps.running {
+		return nil, fmt.Errorf("agent %d of pipeline %s is not running", agentID, p.Label)
+	}
+	t := &Tap{agent: a, opt: opt, events: make(chan TappedEvent, opt.Size)}
+	taps.list = append(taps.list, t)
+	atomic.StoreInt32(&taps.count, int32(len(taps.list)))
+	return t, nil
+}
+
+// Events returns the events sent by the agent, the channel is closed when
+// the tap or the agent is closed
+func (t *Tap) Events() <-chan TappedEvent {
+	return t.events
+}
+
+// Dropped returns the number of events dropped since the previous call
+func (t *Tap) Dropped() int64 {
+	return atomic.SwapInt64(&t.dropped, 0)
+}
+
+// Close detaches the observer from the agent
+func (t *Tap) Close() {
+	taps := t.agent.taps
+	taps.Lock()
+	for i, o := range taps.list {
+		if o == t {
+			taps.list = append(taps.list[:i], taps.list[i+1:]...)
+			break
+		}
+	}
+	atomic.StoreInt32(&taps.count, int32(len(taps.list)))
+	taps.Unlock()
+	t.close()
+}
+
+func (t *Tap) close() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.events)
+	}
+	t.mu.Unlock()
+}
+
+// accept tells if the observer wants an event, within its filter and rate
+func (t *Tap) accept(fields map[string]interface{}, now time.Time) bool {
+	if t.opt.Filter != nil {
+		if ok, err := t.opt.Filter.Bool(fields); err != nil || !ok {
+			return false
+		}
+	}
+	if t.opt.Rate <= 0 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if second := now.Unix(); second != t.second {
+		t.second, t.count = second, 0
+	}
+	if t.count >= t.opt.Rate {
+		atomic.AddInt64(&t.dropped, 1)
+		return false
+	}
+	t.count++
+	return true
+}
+
+func (t *Tap) offer(e TappedEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.events <- e:
+	default:
+		atomic.AddInt64(&t.dropped, 1)
+	}
+}
+
+// active tells if the agent has observers
+func (taps *agentTaps) active() bool {
+	return taps != nil && atomic.LoadInt32(&taps.count) > 0
+}
+
+// send gives the observers a copy of an event the agent sends on a port
+func (taps *agentTaps) send(packet processors.IPacket, port int) {
+	now := time.Now()
+	fields := packet.Fields().Old()
+
+	taps.RLock()
+	defer taps.RUnlock()
+	var copied map[string]interface{}
+	for _, t := range taps.list {
+		if !t.accept(fields, now) {
+			continue
+		}
+		if copied == nil {
+			copied = packet.Clone().Fields().Old()
+		}
+		t.offer(TappedEvent{Time: now, Port: port, Event: copied})
+	}
+}
+
+// open accepts observers, when the agent starts
+func (taps *agentTaps) open() {
+	taps.Lock()
+	taps.running = true
+	taps.Unlock()
+}
+
+// closeAll detaches all the observers, when the agent stops
+func (taps *agentTaps) closeAll() {
+	if taps == nil {
+		return
+	}
+	taps.Lock()
+	for _, t := range taps.list {
+		t.close()
+	}
+	taps.list = nil
+	taps.running = false
+	atomic.StoreInt32(&taps.count, 0)
+	taps.Unlock()
+}
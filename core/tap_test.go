@@ -0,0 +1,189 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/commons/expression"
+)
+
+func compile(t *testing.T, source string) *expression.Expression {
+	x, err := expression.Compile(source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+func TestTapAccept(t *testing.T) {
+	t0 := time.Unix(1500000000, 0)
+	ok := map[string]interface{}{"status": 200}
+	ko := map[string]interface{}{"status": 500}
+
+	tests := []struct {
+		name    string
+		opt     TapOptions
+		fields  []map[string]interface{}
+		at      []time.Duration
+		accept  []bool
+		dropped int64
+	}{
+		{
+			"unlimited",
+			TapOptions{},
+			[]map[string]interface{}{ok, ko, ok},
+			[]time.Duration{0, 0, 0},
+			[]bool{true, true, true},
+			0,
+		},
+		{
+			"filter",
+			TapOptions{Filter: compile(t, `[status] == 200`)},
+			[]map[string]interface{}{ok, ko, {}, ok},
+			[]time.Duration{0, 0, 0, 0},
+			[]bool{true, false, false, true},
+			// filtered events are not dropped ones
+			0,
+		},
+		{
+			"rate by second",
+			TapOptions{Rate: 2},
+			[]map[string]interface{}{ok, ok, ok, ok, ok, ok},
+			[]time.Duration{0, 100 * time.Millisecond, 900 * time.Millisecond, time.Second, 1500 * time.Millisecond, 1600 * time.Millisecond},
+			[]bool{true, true, false, true, true, false},
+			2,
+		},
+		{
+			"filter before rate",
+			TapOptions{Rate: 1, Filter: compile(t, `[status] == 200`)},
+			[]map[string]interface{}{ko, ok, ko, ok},
+			[]time.Duration{0, 0, 0, 0},
+			[]bool{false, true, false, false},
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tap := &Tap{opt: tt.opt}
+			for i, fields := range tt.fields {
+				assert.Equal(t, tt.accept[i], tap.accept(fields, t0.Add(tt.at[i])), "event %d", i)
+			}
+			assert.Equal(t, tt.dropped, tap.Dropped())
+			assert.Equal(t, int64(0), tap.Dropped())
+		})
+	}
+}
+
+// openTaps returns the taps of a running agent
+func openTaps() (*Agent, *Pipeline) {
+	a := newTestAgent(1, "filter_mutate", &fakeProcessor{})
+	a.failure = nil
+	a.resetRunState()
+	return a, &Pipeline{Uuid: "p1", Label: "web", agents: map[int]*Agent{1: a}}
+}
+
+func TestAgentTapsSend(t *testing.T) {
+	a, p := openTaps()
+	all, err := p.Tap(1, TapOptions{Size: 2})
+	assert.NoError(t, err)
+	errors, err := p.Tap(1, TapOptions{Size: 10, Filter: compile(t, `[status] >= 500`)})
+	assert.NoError(t, err)
+	assert.True(t, a.taps.active())
+
+	for i, status := range []int{200, 500, 404} {
+		packet := newPacket(map[string]interface{}{"status": status, "n": i})
+		a.taps.send(packet, i)
+		// observers get a copy of the event
+		packet.Fields().SetValueForPath("changed", "status")
+	}
+
+	// all has room for 2 events, the third one is dropped
+	e := <-all.Events()
+	assert.Equal(t, 0, e.Port)
+	assert.EqualValues(t, 200, e.Event["status"])
+	e = <-all.Events()
+	assert.Equal(t, 1, e.Port)
+	assert.EqualValues(t, 500, e.Event["status"])
+	assert.Len(t, all.Events(), 0)
+	assert.Equal(t, int64(1), all.Dropped())
+
+	e = <-errors.Events()
+	assert.EqualValues(t, 500, e.Event["status"])
+	assert.Len(t, errors.Events(), 0)
+	assert.Equal(t, int64(0), errors.Dropped())
+
+	// a closed tap gets no more events
+	all.Close()
+	_, open := <-all.Events()
+	assert.False(t, open)
+	a.taps.send(newPacket(map[string]interface{}{"status": 503}), 0)
+	e = <-errors.Events()
+	assert.EqualValues(t, 503, e.Event["status"])
+
+	errors.Close()
+	assert.False(t, a.taps.active())
+	// closing twice is harmless
+	errors.Close()
+}
+
+func TestPipelineTap(t *testing.T) {
+	a, p := openTaps()
+
+	_, err := p.Tap(2, TapOptions{})
+	assert.EqualError(t, err, "agent 2 not found in pipeline web")
+
+	tap, err := p.Tap(1, TapOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, cap(tap.events))
+
+	// the agent stops, its taps are closed and no tap is accepted
+	taps := a.taps
+	a.taps.closeAll()
+	_, open := <-tap.Events()
+	assert.False(t, open)
+	assert.False(t, a.taps.active())
+	_, err = p.Tap(1, TapOptions{})
+	assert.EqualError(t, err, "agent 1 of pipeline web is not running")
+	tap.Close()
+
+	// the agent restarts with the same taps
+	a.resetRunState()
+	assert.True(t, taps == a.taps)
+	_, err = p.Tap(1, TapOptions{})
+	assert.NoError(t, err)
+
+	// an agent never started
+	p.agents[2] = newTestAgent(2, "filter_mutate", &fakeProcessor{})
+	_, err = p.Tap(2, TapOptions{})
+	assert.EqualError(t, err, "agent 2 of pipeline web is not running")
+}
+
+func TestTapWhileRestarting(t *testing.T) {
+	a, p := openTaps()
+	a.setStartError(errors.New("refused"))
+	a.pauses.pause()
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a.taps.closeAll()
+			a.resetRunState()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if tap, err := p.Tap(1, TapOptions{}); err == nil {
+			tap.Close()
+		}
+		a.StartError()
+		a.Paused()
+	}
+	<-done
+
+	// the failures of the previous run are over, its pause is kept
+	assert.NoError(t, a.StartError())
+	assert.True(t, a.Paused())
+}
@@ -16,6 +16,7 @@ import (
 type webHook struct {
 	pipelineLabel string
 	namespace     string
+	protections   []string
 	Hooks         []string
 }
 
@@ -25,6 +26,7 @@ type Hook struct {
 	Namespace    string
 	PipelineUUID string
 	Url          string
+	Protections  []string
 }
 
 var webHookMap = syncmap.Map{}
@@ -43,6 +45,7 @@ func WebHooks(uuid string) []Hook {
 				Description: value.(*Hook).Description,
 				Namespace:   value.(*Hook).Namespace,
 				Url:         value.(*Hook).Url,
+				Protections: value.(*Hook).Protections,
 			})
 		}
 		return true
@@ -50,6 +53,11 @@ func WebHooks(uuid string) []Hook {
 	return urls
 }
 
+// BaseURL returns the scheme and host where hooks are advertised
+func BaseURL() string {
+	return baseURL
+}
+
 func (w *webHook) buildURL(hookName string) string {
 	return strings.ToLower("/h/" + slug.Make(w.pipelineLabel) + "/" + slug.Make(hookName))
 }
@@ -58,6 +66,11 @@ func (w *webHook) buildShortURL(hookName string) string {
 	return strings.ToLower("/_/" + hookName)
 }
 
+// Protect sets the protections listed with the hooks added after the call
+func (w *webHook) Protect(protections []string) {
+	w.protections = protections
+}
+
 // Add a new route to a given http.HandlerFunc
 func (w *webHook) AddShort(hookName string, hf http.HandlerFunc) {
 
@@ -70,6 +83,7 @@ func (w *webHook) AddShort(hookName string, hf http.HandlerFunc) {
 		Namespace:    w.namespace,
 		PipelineUUID: w.pipelineLabel,
 		Url:          hUrl,
+		Protections:  w.protections,
 	})
 	Log.Infof("Hook [%s - %s] %s", w.pipelineLabel, w.namespace, baseURL+hUrl)
 }
@@ -86,6 +100,7 @@ func (w *webHook) Add(hookName string, hf http.HandlerFunc) {
 		Namespace:    w.namespace,
 		PipelineUUID: w.pipelineLabel,
 		Url:          hUrl,
+		Protections:  w.protections,
 	})
 	Log.Infof("Hook [%s - %s] %s", w.pipelineLabel, w.namespace, baseURL+hUrl)
 }
@@ -108,12 +123,17 @@ func (w *webHook) Unregister() {
 	}
 }
 
-func Handler(host string) http.Handler {
+// Handler serves hooks, secure is true when host is a https listener
+func Handler(host string, secure bool) http.Handler {
 	addrSpit := strings.Split(host, ":")
 	if addrSpit[0] == "0.0.0.0" {
 		addrSpit[0] = fqdn.Get()
 	}
-	baseURL = fmt.Sprintf("http://%s:%s", addrSpit[0], addrSpit[1])
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	baseURL = fmt.Sprintf("%s://%s:%s", scheme, addrSpit[0], addrSpit[1])
 
 	commonHandlers := alice.New(loggingHandler, recoverHandler)
 	return commonHandlers.ThenFunc(routerHandler)
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/vjeantet/bitfan/commons/manifest"
 	"github.com/vjeantet/bitfan/core"
 	"github.com/vjeantet/bitfan/entrypoint/parser"
 )
@@ -31,6 +32,17 @@ type Entrypoint struct {
 	Content      string
 	PipelineName string
 	PipelineUuid string
+
+	// Vars replace ${NAME} in the configuration and its used configurations, before environment variables
+	Vars map[string]string
+	// Workers of filters and outputs without a workers option, 0 keeps their default
+	Workers int
+	// BufferSize of processors queues, 0 keeps the default
+	BufferSize int
+	// Queue type between processors, @see manifest.QUEUE_* constants
+	Queue string
+	// DependsOn are the uuids of the pipelines which must run before this one
+	DependsOn []string
 }
 
 // List of Entrypoints
@@ -120,6 +132,7 @@ func (e *Entrypoint) Pipeline() (*core.Pipeline, error) {
 	if e.PipelineUuid != "" {
 		pipeline.Uuid = e.PipelineUuid
 	}
+	pipeline.DependsOn = e.DependsOn
 
 	switch e.Kind {
 	case CONTENT_INLINE:
@@ -149,6 +162,7 @@ func (e *Entrypoint) Pipeline() (*core.Pipeline, error) {
 	}
 
 	for _, a := range agents {
+		e.configureAgent(&a)
 		pipeline.AddAgent(a)
 	}
 
@@ -196,18 +210,41 @@ func (e *Entrypoint) agents() ([]core.Agent, error) {
 		return agents, err
 	}
 
-	agents, err = parser.BuildAgents(content, cwd, entrypointContent)
+	agents, err = parser.BuildAgents(content, cwd, e.entrypointContent)
+	for i := range agents {
+		if agents[i].Source == "" {
+			agents[i].Source = e.FullPath
+		}
+	}
 	return agents, err
 }
 
-func entrypointContent(path string, cwl string, options map[string]interface{}) ([]byte, string, error) {
-	e, err := New(path, cwl, CONTENT_REF)
+// configureAgent applies the entrypoint's workers, buffer size and queue to the agent
+func (e *Entrypoint) configureAgent(a *core.Agent) {
+	if _, ok := a.Options["workers"]; e.Workers > 0 && !ok && !strings.HasPrefix(a.Type, "input_") {
+		a.PoolSize = e.Workers
+	}
+	if e.BufferSize > 0 {
+		a.Buffer = e.BufferSize
+	}
+	if e.Queue == manifest.QUEUE_DIRECT {
+		a.Buffer = 0
+	}
+}
+
+// entrypointContent returns the content of a configuration used by the entrypoint's one
+func (e *Entrypoint) entrypointContent(path string, cwl string, options map[string]interface{}) ([]byte, string, error) {
+	used, err := New(path, cwl, CONTENT_REF)
 	if err != nil {
 		return nil, "", err
 	}
-	return e.content(options)
+	used.Vars = e.Vars
+	return used.content(options)
 }
 
+// secret returns the value of a keystore's secret
+var secret = core.Secret
+
 func (e *Entrypoint) content(options map[string]interface{}) ([]byte, string, error) {
 	var content []byte
 	var cwl string
@@ -249,8 +286,10 @@ func (e *Entrypoint) content(options map[string]interface{}) ([]byte, string, er
 
 	// find ${FOO:default value} and replace with
 	// var["FOO"] if found
+	// the entrypoint's var FOO if found
 	// environnement variaable FOO if env variable exists
 	// default value, empty when not provided
+	// ${secret:NAME} is replaced with the secret NAME of the keystore
 	contentString := string(content)
 	r, _ := regexp.Compile(`\${([a-zA-Z_\-0-9]+):?([^"'}]*)}`)
 	envVars := r.FindAllStringSubmatch(contentString, -1)
@@ -259,12 +298,25 @@ func (e *Entrypoint) content(options map[string]interface{}) ([]byte, string, er
 		varName := envVar[1]
 		varDefaultValue := envVar[2]
 
+		if varName == "secret" {
+			value, err := secret(varDefaultValue)
+			if err != nil {
+				return content, cwl, fmt.Errorf(`Error while resolving "%s" [%v]`, varText, err)
+			}
+			contentString = strings.Replace(contentString, varText, value, -1)
+			continue
+		}
+
 		if values, ok := options["var"]; ok {
 			if value, ok := values.(map[string]interface{})[varName]; ok {
 				contentString = strings.Replace(contentString, varText, value.(string), -1)
 				continue
 			}
 		}
+		if value, ok := e.Vars[varName]; ok {
+			contentString = strings.Replace(contentString, varText, value, -1)
+			continue
+		}
 		// Lookup for env
 		if value, found := os.LookupEnv(varName); found {
 			contentString = strings.Replace(contentString, varText, value, -1)
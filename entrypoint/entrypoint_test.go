@@ -1,6 +1,7 @@
 package entrypoint
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -232,6 +233,26 @@ func TestContentWithOptionsEnv(t *testing.T) {
 	assert.Regexp(t, `.*\["coucou:9200"\].*`, string(contentBytes))
 }
 
+func TestContentWithSecret(t *testing.T) {
+	defer func(s func(string) (string, error)) { secret = s }(secret)
+	secret = func(name string) (string, error) {
+		if name == "DB_PASS" {
+			return "s3cr3t", nil
+		}
+		return "", errors.New("secret " + name + " not found in keystore")
+	}
+	e, err := New(`output{sql { password => "${secret:DB_PASS}" dsn => "db:${secret:DB_PASS}@host" }}`, "", CONTENT_INLINE)
+	assert.NoError(t, err)
+	contentBytes, _, err := e.content(map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.Equal(t, `output{sql { password => "s3cr3t" dsn => "db:s3cr3t@host" }}`, string(contentBytes))
+
+	e, err = New(`output{sql { password => "${secret:UNKNOWN}" }}`, "", CONTENT_INLINE)
+	assert.NoError(t, err)
+	_, _, err = e.content(map[string]interface{}{})
+	assert.EqualError(t, err, `Error while resolving "${secret:UNKNOWN}" [secret UNKNOWN not found in keystore]`)
+}
+
 func TestPipelineWithUse(t *testing.T) {
 	e, err := New("testdata/use/main.conf", "", CONTENT_REF)
 	assert.NoError(t, err)
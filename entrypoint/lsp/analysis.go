@@ -0,0 +1,487 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/vjeantet/bitfan/entrypoint/parser/lint"
+	"github.com/vjeantet/bitfan/entrypoint/parser/logstash"
+	"github.com/vjeantet/bitfan/processors"
+	"github.com/vjeantet/bitfan/processors/doc"
+)
+
+// agentOptions are the options handled by bitfan for all processors
+var agentOptions = []*doc.ProcessorOption{
+	{Name: "Workers", Alias: "workers", Type: "int", Doc: "Number of workers processing events in parallel"},
+	{Name: "Interval", Alias: "interval", Type: "string", Doc: "Schedule of the processor, a number of seconds or a cron expression"},
+	{Name: "Trace", Alias: "trace", Type: "bool", Doc: "Log each event produced by the processor"},
+}
+
+// processorCode returns the code of the processor named name in a section
+func processorCode(section string, name string) string {
+	if section == "filter" {
+		return name
+	}
+	return section + "_" + name
+}
+
+// processorOptions returns the options of the processor by name, including
+// the common options it embeds and the agent options
+func processorOptions(d *doc.Processor) map[string]*doc.ProcessorOption {
+	options := map[string]*doc.ProcessorOption{}
+	if d.Options == nil {
+		return options
+	}
+	add := func(o *doc.ProcessorOption) {
+		name := o.Alias
+		if name == "" {
+			name = strings.ToLower(o.Name)
+		}
+		options[name] = o
+	}
+	for _, o := range d.Options.Options {
+		if o.Type == "processors.CommonOptions" {
+			for _, co := range processors.CommonOptionsDoc() {
+				add(co)
+			}
+			continue
+		}
+		add(o)
+	}
+	for _, o := range agentOptions {
+		add(o)
+	}
+	return options
+}
+
+// Diagnostics returns the parse error of the configuration, or the mistakes of
+// the processors options and the issues of the linter
+func Diagnostics(text string, docs map[string]*doc.Processor) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	config, err := logstash.NewParser(strings.NewReader(text)).Parse()
+	if err != nil {
+		d := Diagnostic{
+			Range:    lineRange(text, 1),
+			Severity: SEVERITY_ERROR,
+			Source:   "bitfan",
+			Message:  err.Error(),
+		}
+		if perr, ok := err.(*logstash.ParseError); ok {
+			d.Range = lineRange(text, perr.Line)
+			d.Message = perr.Reason
+		}
+		return append(diagnostics, d)
+	}
+
+	for _, name := range []string{"input", "filter", "output"} {
+		if section, ok := config.Sections[name]; ok {
+			diagnostics = append(diagnostics, validatePlugins(text, name, section.Plugins, docs)...)
+		}
+	}
+
+	issues := lint.Lint(config, func(code string) *doc.Processor {
+		return docs[code]
+	})
+	for _, issue := range issues {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    lineRange(text, issue.Line),
+			Severity: SEVERITY_INFORMATION,
+			Source:   "bitfan-lint",
+			Code:     issue.Rule,
+			Message:  issue.Message,
+		})
+	}
+	return diagnostics
+}
+
+// validatePlugins reports unknown processors, unknown options and missing
+// required options
+func validatePlugins(text string, section string, plugins map[int]*logstash.Plugin, docs map[string]*doc.Processor) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for i := 0; i < len(plugins); i++ {
+		plugin := plugins[i]
+		if plugin.Name == "when" {
+			for j := 0; j < len(plugin.When); j++ {
+				diagnostics = append(diagnostics, validatePlugins(text, section, plugin.When[j].Plugins, docs)...)
+			}
+			continue
+		}
+
+		if plugin.OnFailure != nil {
+			if section != "filter" {
+				diagnostics = append(diagnostics, Diagnostic{
+					Range:    lineRange(text, plugin.OnFailure.Line),
+					Severity: SEVERITY_ERROR,
+					Source:   "bitfan",
+					Message:  "on_failure is only supported by filters",
+				})
+			}
+			diagnostics = append(diagnostics, validatePlugins(text, section, plugin.OnFailure.Plugins, docs)...)
+		}
+
+		d, ok := docs[processorCode(section, plugin.Name)]
+		if !ok {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    lineRange(text, plugin.Line),
+				Severity: SEVERITY_ERROR,
+				Source:   "bitfan",
+				Message:  fmt.Sprintf("unknown %s processor %s", section, plugin.Name),
+			})
+			continue
+		}
+		if d.Options == nil {
+			continue
+		}
+
+		options := processorOptions(d)
+		set := map[string]bool{}
+		for j := 0; j < len(plugin.Settings); j++ {
+			s := plugin.Settings[j]
+			set[s.K] = true
+			if _, ok := options[s.K]; !ok {
+				diagnostics = append(diagnostics, Diagnostic{
+					Range:    lineRange(text, s.Line),
+					Severity: SEVERITY_WARNING,
+					Source:   "bitfan",
+					Message:  fmt.Sprintf("unknown option %s for processor %s", s.K, plugin.Name),
+				})
+			}
+		}
+		names := []string{}
+		for name, o := range options {
+			if o.Required && !set[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    lineRange(text, plugin.Line),
+				Severity: SEVERITY_ERROR,
+				Source:   "bitfan",
+				Message:  fmt.Sprintf("processor %s requires option %s", plugin.Name, name),
+			})
+		}
+	}
+	return diagnostics
+}
+
+// Complete returns the sections, the processors of the section, the options
+// of the processor or the possible values of the option at the position
+func Complete(text string, pos Position, docs map[string]*doc.Processor) []CompletionItem {
+	runes := []rune(text)
+	offset := positionOffset(runes, pos)
+	start, _ := wordAt(runes, offset)
+	prefix := string(runes[start:offset])
+	c := scan(runes, start)
+
+	items := []CompletionItem{}
+	if c.inComment {
+		return items
+	}
+	add := func(item CompletionItem) {
+		if strings.HasPrefix(item.Label, prefix) {
+			items = append(items, item)
+		}
+	}
+
+	f := c.frame()
+	switch {
+	case f == nil:
+		for _, name := range []string{"input", "filter", "output"} {
+			add(CompletionItem{Label: name, Kind: completionModule, InsertText: name + " {\n}"})
+		}
+
+	case (f.kind == frameSection || f.kind == frameWhen) && len(c.tokens) == 0:
+		for _, name := range processorNames(c.section(), docs) {
+			d := docs[processorCode(c.section(), name)]
+			add(CompletionItem{Label: name, Kind: completionClass, Detail: d.DocShort, Documentation: d.Doc})
+		}
+
+	case f.kind == framePlugin:
+		d, ok := docs[processorCode(c.section(), f.name)]
+		if !ok {
+			return items
+		}
+		options := processorOptions(d)
+		if key, isValue := c.valueOf(); isValue {
+			o, ok := options[key]
+			if !ok {
+				return items
+			}
+			values := o.PossibleValues
+			if o.Type == "bool" {
+				values = []string{"true", "false"}
+			}
+			for _, v := range values {
+				v = strings.Trim(v, `"`)
+				insert := v
+				if o.Type != "bool" && !c.inString {
+					insert = `"` + v + `"`
+				}
+				add(CompletionItem{Label: v, Kind: completionValue, InsertText: insert})
+			}
+			return items
+		}
+		if c.inString {
+			return items
+		}
+		names := []string{}
+		for name := range options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			o := options[name]
+			add(CompletionItem{Label: name, Kind: completionProperty, Detail: o.Type, Documentation: o.Doc, InsertText: name + " => "})
+		}
+		add(CompletionItem{Label: "codec", Kind: completionProperty, InsertText: "codec => "})
+		if c.section() == "filter" {
+			add(CompletionItem{Label: "on_failure", Kind: completionProperty, Documentation: "Plugins processing the events the processor failed to process", InsertText: "on_failure {\n}"})
+		}
+	}
+	return items
+}
+
+// processorNames returns the names of the processors of a section
+func processorNames(section string, docs map[string]*doc.Processor) []string {
+	names := []string{}
+	for code := range docs {
+		switch {
+		case strings.HasPrefix(code, "input_"):
+			if section == "input" {
+				names = append(names, strings.TrimPrefix(code, "input_"))
+			}
+		case strings.HasPrefix(code, "output_"):
+			if section == "output" {
+				names = append(names, strings.TrimPrefix(code, "output_"))
+			}
+		default:
+			if section == "filter" {
+				names = append(names, code)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HoverAt returns the doc of the processor or the option at the position
+func HoverAt(text string, pos Position, docs map[string]*doc.Processor) *Hover {
+	runes := []rune(text)
+	start, end := wordAt(runes, positionOffset(runes, pos))
+	if start == end {
+		return nil
+	}
+	word := string(runes[start:end])
+	c := scan(runes, start)
+	if c.inComment || c.inString {
+		return nil
+	}
+
+	f := c.frame()
+	switch {
+	case f == nil:
+		return nil
+	case (f.kind == frameSection || f.kind == frameWhen) && len(c.tokens) == 0:
+		if d, ok := docs[processorCode(c.section(), word)]; ok {
+			return &Hover{Contents: markupContent{Kind: "markdown", Value: processorMarkdown(word, d)}}
+		}
+	case f.kind == framePlugin:
+		if _, isValue := c.valueOf(); isValue {
+			return nil
+		}
+		if d, ok := docs[processorCode(c.section(), f.name)]; ok {
+			if o, ok := processorOptions(d)[word]; ok {
+				return &Hover{Contents: markupContent{Kind: "markdown", Value: optionMarkdown(word, o)}}
+			}
+		}
+	}
+	return nil
+}
+
+func processorMarkdown(name string, d *doc.Processor) string {
+	md := "**" + name + "**\n\n" + d.Doc
+	if d.Options == nil {
+		return md
+	}
+	md += "\n\n"
+	for _, o := range d.Options.Options {
+		if o.Type == "processors.CommonOptions" {
+			continue
+		}
+		name := o.Alias
+		if name == "" {
+			name = strings.ToLower(o.Name)
+		}
+		md += "* `" + name + "` " + o.Type
+		if o.Required {
+			md += ", required"
+		}
+		md += "\n"
+	}
+	return md
+}
+
+func optionMarkdown(name string, o *doc.ProcessorOption) string {
+	md := "**" + name + "** " + o.Type
+	if o.Required {
+		md += ", required"
+	}
+	if o.DefaultValue != nil {
+		md += fmt.Sprintf(", default `%v`", o.DefaultValue)
+	}
+	if o.Deprecated != "" {
+		md += "\n\nDeprecated, " + o.Deprecated
+	}
+	if o.Doc != "" {
+		md += "\n\n" + o.Doc
+	}
+	return md
+}
+
+// Definition returns the location of the configuration used by the path option
+// of a use or route processor at the position
+func Definition(uri string, text string, pos Position) *Location {
+	runes := []rune(text)
+	c := scan(runes, positionOffset(runes, pos))
+	f := c.frame()
+	if !c.inString || f == nil || f.kind != framePlugin || (f.name != "use" && f.name != "route") {
+		return nil
+	}
+	if key, isValue := c.valueOf(); !isValue || key != "path" {
+		return nil
+	}
+
+	path := c.value
+	if strings.Contains(path, "://") {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "file" {
+			return nil
+		}
+		path = filepath.Join(filepath.Dir(u.Path), path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return &Location{URI: (&url.URL{Scheme: "file", Path: path}).String()}
+}
+
+// Symbols returns the sections of the configuration with their processors and
+// conditionals
+func Symbols(text string) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	config, err := logstash.NewParser(strings.NewReader(text)).Parse()
+	if err != nil {
+		return symbols
+	}
+	for _, name := range []string{"input", "filter", "output"} {
+		section, ok := config.Sections[name]
+		if !ok {
+			continue
+		}
+		r := lineRange(text, section.Line)
+		symbols = append(symbols, DocumentSymbol{
+			Name:           name,
+			Kind:           symbolNamespace,
+			Range:          r,
+			SelectionRange: r,
+			Children:       pluginSymbols(text, section.Plugins),
+		})
+	}
+	return symbols
+}
+
+func pluginSymbols(text string, plugins map[int]*logstash.Plugin) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for i := 0; i < len(plugins); i++ {
+		plugin := plugins[i]
+		if plugin.Name != "when" {
+			r := lineRange(text, plugin.Line)
+			symbol := DocumentSymbol{
+				Name:           plugin.Name,
+				Detail:         plugin.Label,
+				Kind:           symbolFunction,
+				Range:          r,
+				SelectionRange: r,
+			}
+			if plugin.OnFailure != nil {
+				r := lineRange(text, plugin.OnFailure.Line)
+				symbol.Children = []DocumentSymbol{{
+					Name:           "on_failure",
+					Kind:           symbolOperator,
+					Range:          r,
+					SelectionRange: r,
+					Children:       pluginSymbols(text, plugin.OnFailure.Plugins),
+				}}
+			}
+			symbols = append(symbols, symbol)
+			continue
+		}
+		for j := 0; j < len(plugin.When); j++ {
+			w := plugin.When[j]
+			name := "else"
+			if j == 0 {
+				name = "if"
+			}
+			if w.Condition != "" {
+				name += " " + w.Condition
+			}
+			r := lineRange(text, w.Line)
+			symbols = append(symbols, DocumentSymbol{
+				Name:           name,
+				Kind:           symbolOperator,
+				Range:          r,
+				SelectionRange: r,
+				Children:       pluginSymbols(text, w.Plugins),
+			})
+		}
+	}
+	return symbols
+}
+
+// positionOffset returns the offset of a position in the text, characters are
+// counted as runes
+func positionOffset(runes []rune, pos Position) int {
+	line := 0
+	for i, r := range runes {
+		if line == pos.Line {
+			end := i
+			for end < len(runes) && runes[end] != '\n' {
+				end++
+			}
+			if i+pos.Character < end {
+				return i + pos.Character
+			}
+			return end
+		}
+		if r == '\n' {
+			line++
+		}
+	}
+	return len(runes)
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@'
+}
+
+// wordAt returns the bounds of the word at offset
+func wordAt(runes []rune, offset int) (int, int) {
+	start, end := offset, offset
+	for start > 0 && isWord(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isWord(runes[end]) {
+		end++
+	}
+	return start, end
+}
@@ -0,0 +1,297 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors/doc"
+)
+
+var testDocs = map[string]*doc.Processor{
+	"input_stdin": {Name: "stdin", Doc: "Read events from standard input", Options: &doc.ProcessorOptions{
+		Options: []*doc.ProcessorOption{
+			{Name: "processors.CommonOptions", Alias: ",squash", Type: "processors.CommonOptions"},
+		},
+	}},
+	"grok": {Name: "grok", Doc: "Parse arbitrary text", Options: &doc.ProcessorOptions{
+		Options: []*doc.ProcessorOption{
+			{Name: "processors.CommonOptions", Alias: ",squash", Type: "processors.CommonOptions"},
+			{Name: "BreakOnMatch", Alias: "break_on_match", Type: "bool", Doc: "Break on first match"},
+			{Name: "Match", Alias: "match", Type: "hash", Required: true, Doc: "A hash of matches"},
+			{Name: "TagOnFailure", Alias: "tag_on_failure", Type: "array"},
+		},
+	}},
+	"use": {Name: "use", Options: &doc.ProcessorOptions{
+		Options: []*doc.ProcessorOption{
+			{Name: "Path", Alias: "path", Type: "array", Required: true},
+		},
+	}},
+	"output_stdout": {Name: "stdout", Options: &doc.ProcessorOptions{
+		Options: []*doc.ProcessorOption{
+			{Name: "Codec", Alias: "codec", Type: "codec"},
+			{Name: "Format", Alias: "format", Type: "string", PossibleValues: []string{"line", "json"}},
+		},
+	}},
+}
+
+// at returns the position of the first "|" in text and the text without it
+func at(text string) (string, Position) {
+	i := strings.Index(text, "|")
+	before := text[:i]
+	line := strings.Count(before, "\n")
+	character := len([]rune(before[strings.LastIndex(before, "\n")+1:]))
+	return text[:i] + text[i+1:], Position{Line: line, Character: character}
+}
+
+func labels(items []CompletionItem) []string {
+	l := []string{}
+	for _, item := range items {
+		l = append(l, item.Label)
+	}
+	return l
+}
+
+func TestDiagnosticsParseError(t *testing.T) {
+	diagnostics := Diagnostics("input {\n  stdin {}\n}\nfilter {\n  grok { match => }\n}", testDocs)
+	if !assert.Len(t, diagnostics, 1) {
+		return
+	}
+	assert.Equal(t, SEVERITY_ERROR, diagnostics[0].Severity)
+	assert.Equal(t, 4, diagnostics[0].Range.Start.Line)
+}
+
+func TestDiagnosticsOptions(t *testing.T) {
+	diagnostics := Diagnostics(`input {
+  stdin { add_tag => ["a"] workers => 2 }
+}
+filter {
+  if [message] {
+    grok { tag_on_failure => ["_bad"] colour => "red" }
+  }
+  unknown {}
+}
+output {
+  stdout { codec => json }
+}`, testDocs)
+
+	messages := []string{}
+	for _, d := range diagnostics {
+		if d.Source == "bitfan" {
+			messages = append(messages, fmt.Sprintf("%d %d %s", d.Range.Start.Line, d.Severity, d.Message))
+		}
+	}
+	assert.Equal(t, []string{
+		"5 2 unknown option colour for processor grok",
+		"5 1 processor grok requires option match",
+		"7 1 unknown filter processor unknown",
+	}, messages)
+}
+
+func TestDiagnosticsLint(t *testing.T) {
+	diagnostics := Diagnostics(`filter {
+  grok "g" { match => { "message" => "%{WORD:verb}" } }
+  grok "g" { match => { "message" => "%{WORD:verb}" } tag_on_failure => [] }
+}`, testDocs)
+	codes := []string{}
+	for _, d := range diagnostics {
+		assert.Equal(t, SEVERITY_INFORMATION, d.Severity)
+		codes = append(codes, d.Code)
+	}
+	assert.Contains(t, codes, "duplicate-label")
+	assert.Contains(t, codes, "tag-on-failure")
+}
+
+func TestCompleteSections(t *testing.T) {
+	text, pos := at("input { stdin {} }\nf|")
+	assert.Equal(t, []string{"filter"}, labels(Complete(text, pos, testDocs)))
+}
+
+func TestCompleteProcessors(t *testing.T) {
+	text, pos := at("input {\n  |\n}")
+	assert.Equal(t, []string{"stdin"}, labels(Complete(text, pos, testDocs)))
+
+	text, pos = at("filter {\n  if [a] =~ /{/ {\n    g|\n  }\n}")
+	assert.Equal(t, []string{"grok"}, labels(Complete(text, pos, testDocs)))
+
+	text, pos = at("filter {\n  grok {}\n  u|")
+	assert.Equal(t, []string{"use"}, labels(Complete(text, pos, testDocs)))
+}
+
+func TestCompleteOptions(t *testing.T) {
+	text, pos := at("filter {\n  grok {\n    match => { \"message\" => \"{\" }\n    t|\n  }\n}")
+	items := Complete(text, pos, testDocs)
+	assert.Equal(t, []string{"tag_on_failure", "trace", "type"}, labels(items))
+	assert.Equal(t, "tag_on_failure => ", items[0].InsertText)
+
+	text, pos = at("filter {\n  grok { break_on_match => | }\n}")
+	assert.Equal(t, []string{"true", "false"}, labels(Complete(text, pos, testDocs)))
+
+	text, pos = at("output {\n  stdout { codec => json f| }\n}")
+	assert.Equal(t, []string{"format"}, labels(Complete(text, pos, testDocs)))
+
+	text, pos = at("output {\n  stdout { format => \"|\" }\n}")
+	items = Complete(text, pos, testDocs)
+	assert.Equal(t, []string{"line", "json"}, labels(items))
+	assert.Equal(t, "line", items[0].InsertText)
+
+	text, pos = at("filter {\n  grok { # m|\n}")
+	assert.Empty(t, Complete(text, pos, testDocs))
+}
+
+func TestOnFailure(t *testing.T) {
+	text := `input {
+  stdin { on_failure {} }
+}
+filter {
+  grok {
+    match => {}
+    on_failure {
+      unknown {}
+    }
+  }
+}`
+	messages := []string{}
+	for _, d := range Diagnostics(text, testDocs) {
+		if d.Source == "bitfan" {
+			messages = append(messages, fmt.Sprintf("%d %s", d.Range.Start.Line, d.Message))
+		}
+	}
+	assert.Equal(t, []string{
+		"1 on_failure is only supported by filters",
+		"7 unknown filter processor unknown",
+	}, messages)
+
+	symbols := Symbols(text)
+	if assert.Len(t, symbols, 2) && assert.Len(t, symbols[1].Children[0].Children, 1) {
+		assert.Equal(t, "on_failure", symbols[1].Children[0].Children[0].Name)
+		assert.Equal(t, "unknown", symbols[1].Children[0].Children[0].Children[0].Name)
+	}
+
+	completion, pos := at("filter {\n  grok {\n    on_failure {\n      g|\n    }\n  }\n}")
+	assert.Equal(t, []string{"grok"}, labels(Complete(completion, pos, testDocs)))
+	completion, pos = at("filter {\n  grok {\n    on_failure {}\n    o|\n  }\n}")
+	assert.Equal(t, []string{"on_failure"}, labels(Complete(completion, pos, testDocs)))
+}
+
+func TestHover(t *testing.T) {
+	text, pos := at("filter {\n  gr|ok { match => {} }\n}")
+	hover := HoverAt(text, pos, testDocs)
+	if !assert.NotNil(t, hover) {
+		return
+	}
+	assert.Contains(t, hover.Contents.Value, "Parse arbitrary text")
+	assert.Contains(t, hover.Contents.Value, "`match` hash, required")
+
+	text, pos = at("filter {\n  grok { mat|ch => {} }\n}")
+	hover = HoverAt(text, pos, testDocs)
+	if !assert.NotNil(t, hover) {
+		return
+	}
+	assert.Contains(t, hover.Contents.Value, "A hash of matches")
+
+	text, pos = at("filter {\n  grok { match => { \"mat|ch\" => \"\" } }\n}")
+	assert.Nil(t, HoverAt(text, pos, testDocs))
+}
+
+func TestDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitfan-lsp")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "sub.conf"), []byte("filter {}"), 0644)
+	uri := (&url.URL{Scheme: "file", Path: filepath.Join(dir, "main.conf")}).String()
+
+	text, pos := at("filter {\n  use { path => [\"sub.c|onf\"] }\n}")
+	location := Definition(uri, text, pos)
+	if !assert.NotNil(t, location) {
+		return
+	}
+	assert.Equal(t, (&url.URL{Scheme: "file", Path: filepath.Join(dir, "sub.conf")}).String(), location.URI)
+
+	text, pos = at("filter {\n  use { path => [\"miss|ing.conf\"] }\n}")
+	assert.Nil(t, Definition(uri, text, pos))
+
+	text, pos = at("filter {\n  grok { match => { \"sub.c|onf\" => \"\" } }\n}")
+	assert.Nil(t, Definition(uri, text, pos))
+}
+
+func TestSymbols(t *testing.T) {
+	symbols := Symbols(`input { stdin {} }
+filter {
+  if [a] == 1 {
+    grok "parse" { match => {} }
+  } else {
+    drop {}
+  }
+}`)
+	if !assert.Len(t, symbols, 2) {
+		return
+	}
+	assert.Equal(t, "input", symbols[0].Name)
+	assert.Equal(t, "stdin", symbols[0].Children[0].Name)
+	filter := symbols[1]
+	if !assert.Len(t, filter.Children, 2) {
+		return
+	}
+	assert.Equal(t, "if [a] == 1", filter.Children[0].Name)
+	assert.Equal(t, 2, filter.Children[0].Range.Start.Line)
+	assert.Equal(t, "grok", filter.Children[0].Children[0].Name)
+	assert.Equal(t, "parse", filter.Children[0].Children[0].Detail)
+	assert.Equal(t, "else", filter.Children[1].Name)
+	assert.Equal(t, 4, filter.Children[1].Range.Start.Line)
+}
+
+func message(content string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+func TestServer(t *testing.T) {
+	in := strings.Join([]string{
+		message(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`),
+		message(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.conf","text":"filter {\n  unknown {}\n}"}}}`),
+		message(`{"jsonrpc":"2.0","id":2,"method":"textDocument/completion","params":{"textDocument":{"uri":"file:///a.conf"},"position":{"line":1,"character":2}}}`),
+		message(`{"jsonrpc":"2.0","id":3,"method":"unknown/method"}`),
+		message(`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`),
+		message(`{"jsonrpc":"2.0","method":"exit"}`),
+	}, "")
+	out := &bytes.Buffer{}
+	if !assert.NoError(t, NewServer(strings.NewReader(in), out, testDocs).Run()) {
+		return
+	}
+
+	server := NewServer(out, nil, nil)
+	messages := []map[string]interface{}{}
+	for {
+		content, err := server.read()
+		if err != nil {
+			break
+		}
+		message := map[string]interface{}{}
+		json.Unmarshal(content, &message)
+		messages = append(messages, message)
+	}
+	if !assert.Len(t, messages, 5) {
+		return
+	}
+
+	assert.Equal(t, true, messages[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})["hoverProvider"])
+
+	assert.Equal(t, "textDocument/publishDiagnostics", messages[1]["method"])
+	diagnostics := messages[1]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, "unknown filter processor unknown", diagnostics[0].(map[string]interface{})["message"])
+	}
+
+	assert.Len(t, messages[2]["result"], 2)
+	assert.Equal(t, float64(codeMethodNotFound), messages[3]["error"].(map[string]interface{})["code"])
+	assert.Contains(t, messages[4], "result")
+}
@@ -0,0 +1,225 @@
+package lsp
+
+import "strings"
+
+type frameKind int
+
+const (
+	frameSection frameKind = iota
+	frameWhen
+	framePlugin
+	frameCodec
+	frameHash
+)
+
+// frame is a block opened by a curly brace
+type frame struct {
+	kind frameKind
+	name string
+	// tokens read in the block since the last nested block
+	tokens []string
+}
+
+// cursor describes where an offset stands in a configuration
+type cursor struct {
+	frames []*frame
+	// tokens of the innermost frame read before the offset
+	tokens    []string
+	inComment bool
+	inString  bool
+	// content of the string at the offset
+	value string
+}
+
+func (c *cursor) frame() *frame {
+	if len(c.frames) == 0 {
+		return nil
+	}
+	return c.frames[len(c.frames)-1]
+}
+
+// section returns the name of the section at the cursor
+func (c *cursor) section() string {
+	if len(c.frames) == 0 {
+		return ""
+	}
+	return c.frames[0].name
+}
+
+// valueOf returns the option key when the cursor stands at the value of a
+// setting
+func (c *cursor) valueOf() (string, bool) {
+	key := ""
+	state := 0 // 0 expects a key, 1 expects =>, 2 expects a value, 3 in an array
+	for _, tok := range c.tokens {
+		switch state {
+		case 0:
+			key, state = tok, 1
+		case 1:
+			if tok == "=>" {
+				state = 2
+			} else {
+				key = tok
+			}
+		case 2:
+			if tok == "[" {
+				state = 3
+			} else {
+				state = 0
+			}
+		case 3:
+			if tok == "]" {
+				state = 0
+			}
+		}
+	}
+	return key, state >= 2
+}
+
+// scan reads the configuration up to offset, skipping comments, strings and
+// regexps, and returns the blocks opened at offset
+func scan(runes []rune, offset int) *cursor {
+	c := &cursor{}
+	push := func(kind frameKind, name string) {
+		c.frames = append(c.frames, &frame{kind: kind, name: name})
+	}
+	tokens := func() []string {
+		if f := c.frame(); f != nil {
+			return f.tokens
+		}
+		return nil
+	}
+	add := func(tok string) {
+		if f := c.frame(); f != nil {
+			f.tokens = append(f.tokens, tok)
+		}
+	}
+
+	i := 0
+	for i < offset && i < len(runes) {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			i++
+
+		case r == '#':
+			end := i
+			for end < len(runes) && runes[end] != '\n' {
+				end++
+			}
+			if offset <= end {
+				c.inComment = true
+				return c
+			}
+			i = end
+
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end > len(runes) {
+				end = len(runes)
+			}
+			if offset <= end {
+				c.inString = true
+				c.value = strings.Replace(string(runes[i+1:end]), "\\"+string(r), string(r), -1)
+				c.tokens = tokens()
+				return c
+			}
+			add(string(runes[i : end+1]))
+			i = end + 1
+
+		case r == '/' && c.frame() != nil && (c.frame().kind == frameSection || c.frame().kind == frameWhen) &&
+			len(tokens()) > 0 && (tokens()[len(tokens())-1] == "=~" || tokens()[len(tokens())-1] == "!~"):
+			end := i + 1
+			for end < len(runes) && runes[end] != '/' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			add("regexp")
+			i = end + 1
+
+		case r == '{':
+			f := c.frame()
+			switch {
+			case f == nil:
+				name := ""
+				if len(c.tokens) > 0 {
+					name = c.tokens[0]
+				}
+				c.tokens = nil
+				push(frameSection, name)
+			case f.kind == frameSection || f.kind == frameWhen:
+				if len(f.tokens) > 0 && (f.tokens[0] == "if" || f.tokens[0] == "else") {
+					push(frameWhen, "")
+				} else if len(f.tokens) > 0 {
+					push(framePlugin, f.tokens[0])
+				} else {
+					push(framePlugin, "")
+				}
+			case f.kind == framePlugin && len(f.tokens) > 0 && f.tokens[len(f.tokens)-1] == "on_failure":
+				// an on_failure block holds plugins as a conditional branch
+				f.tokens = f.tokens[:len(f.tokens)-1]
+				push(frameWhen, "on_failure")
+			case f.kind == framePlugin && len(f.tokens) >= 3 &&
+				f.tokens[len(f.tokens)-3] == "codec" && f.tokens[len(f.tokens)-2] == "=>":
+				push(frameCodec, f.tokens[len(f.tokens)-1])
+			default:
+				push(frameHash, "")
+			}
+			i++
+
+		case r == '}':
+			if len(c.frames) > 0 {
+				c.frames = c.frames[:len(c.frames)-1]
+			}
+			if f := c.frame(); f != nil {
+				switch f.kind {
+				case frameSection, frameWhen:
+					f.tokens = nil
+				case framePlugin, frameHash:
+					// a closed hash is the value of the setting
+					if n := len(f.tokens); n > 0 && f.tokens[n-1] == "=>" {
+						f.tokens = append(f.tokens, "{}")
+					}
+				}
+			}
+			i++
+
+		case r == '[' || r == ']':
+			add(string(r))
+			i++
+
+		case r == ',' || r == ';':
+			i++
+
+		default:
+			end := i
+			for end < len(runes) && !strings.ContainsRune(" \t\r\n#\"'{}[],;", runes[end]) {
+				if runes[end] == '=' && end+1 < len(runes) && runes[end+1] == '>' {
+					if end == i {
+						end += 2
+					}
+					break
+				}
+				end++
+			}
+			if c.frame() == nil {
+				c.tokens = append(c.tokens, string(runes[i:end]))
+			} else {
+				add(string(runes[i:end]))
+			}
+			i = end
+		}
+	}
+	if c.frame() != nil {
+		c.tokens = c.frame().tokens
+	}
+	return c
+}
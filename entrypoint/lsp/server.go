@@ -0,0 +1,203 @@
+// Package lsp implements a Language Server Protocol server for bitfan
+// configuration files : diagnostics, completion of processors and options,
+// hover documentation, go-to-definition of used configurations and document
+// symbols.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/vjeantet/bitfan/processors/doc"
+)
+
+// Server serves one client on a reader and a writer, usually stdin and stdout
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*doc.Processor
+	// texts of the opened documents by URI
+	documents map[string]string
+	shutdown  bool
+}
+
+// NewServer returns a server using docs, processors docs by code, for
+// completion, hover and options validation
+func NewServer(in io.Reader, out io.Writer, docs map[string]*doc.Processor) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		docs:      docs,
+		documents: map[string]string{},
+	}
+}
+
+// Run serves requests until the client sends exit or closes the connection
+func (s *Server) Run() error {
+	for {
+		content, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(&req); err != nil {
+			return err
+		}
+	}
+}
+
+// read returns the content of the next message
+func (s *Server) read() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header - %v", err)
+	}
+	content := make([]byte, length)
+	_, err = io.ReadFull(s.in, content)
+	return content, err
+}
+
+func (s *Server) write(message interface{}) error {
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}) error {
+	return s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) handle(req *request) error {
+	if s.shutdown && req.ID != nil {
+		return s.replyError(req.ID, codeInvalidRequest, "server is shut down")
+	}
+
+	switch req.Method {
+	case "initialize":
+		return s.reply(req.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// documents are synced with their full content
+				"textDocumentSync":       1,
+				"completionProvider":     map[string]interface{}{},
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "bitfan"},
+		})
+	case "shutdown":
+		s.shutdown = true
+		return s.reply(req.ID, nil)
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params textDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.replyError(req.ID, codeInvalidParams, err.Error())
+		}
+		text := s.documents[params.TextDocument.URI]
+		switch req.Method {
+		case "textDocument/completion":
+			return s.reply(req.ID, Complete(text, params.Position, s.docs))
+		case "textDocument/hover":
+			if hover := HoverAt(text, params.Position, s.docs); hover != nil {
+				return s.reply(req.ID, hover)
+			}
+		case "textDocument/definition":
+			if location := Definition(params.TextDocument.URI, text, params.Position); location != nil {
+				return s.reply(req.ID, location)
+			}
+		}
+		return s.reply(req.ID, nil)
+	case "textDocument/documentSymbol":
+		var params textDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.replyError(req.ID, codeInvalidParams, err.Error())
+		}
+		return s.reply(req.ID, Symbols(s.documents[params.TextDocument.URI]))
+	}
+
+	// notifications without handler are ignored
+	if req.ID != nil {
+		return s.replyError(req.ID, codeMethodNotFound, "method not found : "+req.Method)
+	}
+	return nil
+}
+
+// update stores the document and publishes its diagnostics
+func (s *Server) update(uri string, text string) error {
+	s.documents[uri] = text
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: Diagnostics(text, s.docs),
+	})
+}
+
+// lineRange returns the range of a whole line, line is one based
+func lineRange(text string, line int) Range {
+	if line < 1 {
+		line = 1
+	}
+	lines := strings.Split(text, "\n")
+	end := 0
+	if line <= len(lines) {
+		end = len([]rune(strings.TrimRight(lines[line-1], "\r")))
+	}
+	return Range{
+		Start: Position{Line: line - 1},
+		End:   Position{Line: line - 1, Character: end},
+	}
+}
@@ -0,0 +1,32 @@
+package entrypoint
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vjeantet/bitfan/commons/manifest"
+)
+
+// FromManifest returns the entrypoint of a pipeline declared in the manifest,
+// with its stable UUID, its label and its settings
+func FromManifest(m *manifest.Manifest, p manifest.Pipeline) (*Entrypoint, error) {
+	path := m.Abs(p.Config[0])
+	if fi, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("pipeline %s : %v", p.ID, err)
+	} else if fi.IsDir() {
+		return nil, fmt.Errorf("pipeline %s : config %s is a directory", p.ID, p.Config[0])
+	}
+
+	loc, err := New(path, m.Dir(), CONTENT_REF_FS)
+	if err != nil {
+		return nil, err
+	}
+	loc.PipelineUuid = p.ID
+	loc.PipelineName = p.Label
+	loc.Vars = p.Vars
+	loc.Workers = p.Workers
+	loc.BufferSize = p.BufferSize
+	loc.Queue = p.Queue
+	loc.DependsOn = p.DependsOn
+	return loc, nil
+}
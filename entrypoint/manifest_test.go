@@ -0,0 +1,86 @@
+package entrypoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/commons/manifest"
+	"github.com/vjeantet/bitfan/core"
+)
+
+func agentsByType(pipeline *core.Pipeline) map[string]*core.Agent {
+	agents := map[string]*core.Agent{}
+	for _, a := range pipeline.Agents() {
+		agents[a.Type] = a
+	}
+	return agents
+}
+
+func TestFromManifest(t *testing.T) {
+	m, err := manifest.Load("testdata/manifest")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	e, err := FromManifest(m, m.Pipelines[0])
+	if !assert.NoError(t, err) {
+		return
+	}
+	pipeline, err := e.Pipeline()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "web", pipeline.Uuid)
+	assert.Equal(t, "Web", pipeline.Label)
+	assert.Empty(t, pipeline.DependsOn)
+	assert.Regexp(t, ".*/testdata/manifest/main.conf", pipeline.ConfigLocation)
+
+	agents := agentsByType(pipeline)
+	assert.Equal(t, 4, len(agents))
+	assert.Equal(t, 1, agents["input_stdin"].PoolSize)
+	assert.Equal(t, 4, agents["mutate"].PoolSize)
+	assert.Equal(t, 2, agents["uuid"].PoolSize)
+	assert.Equal(t, 4, agents["output_stdout"].PoolSize)
+	assert.Equal(t, 50, agents["mutate"].Buffer)
+
+	content, _, err := e.content(map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"message" => "from manifest"`)
+}
+
+func TestFromManifestDirectQueue(t *testing.T) {
+	m, err := manifest.Load("testdata/manifest")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	e, err := FromManifest(m, m.Pipelines[1])
+	if !assert.NoError(t, err) {
+		return
+	}
+	pipeline, err := e.Pipeline()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "direct", pipeline.Label)
+	assert.Equal(t, []string{"web"}, pipeline.DependsOn)
+
+	agents := agentsByType(pipeline)
+	assert.Equal(t, 0, agents["mutate"].Buffer)
+	assert.Equal(t, 2, agents["mutate"].PoolSize)
+
+	content, _, err := e.content(map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"message" => "default"`)
+}
+
+func TestFromManifestMissingConfig(t *testing.T) {
+	m, err := manifest.Load("testdata/manifest")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = FromManifest(m, manifest.Pipeline{ID: "missing", Config: manifest.StringList{"missing.conf"}})
+	assert.Error(t, err)
+	_, err = FromManifest(m, manifest.Pipeline{ID: "dir", Config: manifest.StringList{"."}})
+	assert.Error(t, err)
+}
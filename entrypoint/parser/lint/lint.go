@@ -0,0 +1,370 @@
+// Package lint reports mistakes of a logstash configuration the parser accepts :
+// deprecated options, processors without tag_on_failure nor on_failure block,
+// unreachable branches, duplicate labels and conditionals testing fields never
+// set upstream.
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vjeantet/bitfan/entrypoint/parser/logstash"
+	"github.com/vjeantet/bitfan/processors/doc"
+)
+
+// Rules of the issues
+const (
+	RULE_DEPRECATED      = "deprecated-option"
+	RULE_TAG_ON_FAILURE  = "tag-on-failure"
+	RULE_UNREACHABLE     = "unreachable-branch"
+	RULE_DUPLICATE_LABEL = "duplicate-label"
+	RULE_UNSET_FIELD     = "unset-field"
+)
+
+// Issue is a mistake found in a configuration
+type Issue struct {
+	Line    int
+	Rule    string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("line %d : %s (%s)", i.Line, i.Message, i.Rule)
+}
+
+// DocFunc returns the doc of a processor from its code, nil when the processor
+// is unknown
+type DocFunc func(code string) *doc.Processor
+
+// defaultFields are the fields of the events produced by inputs
+var defaultFields = []string{"message", "@timestamp", "@version", "tags", "type", "host", "path"}
+
+// knownInputs are the inputs producing events with only the default fields
+var knownInputs = map[string]bool{
+	"stdin":    true,
+	"file":     true,
+	"tail":     true,
+	"readfile": true,
+	"udp":      true,
+	"unix":     true,
+}
+
+// plainCodecs are the codecs decoding a message without adding fields
+var plainCodecs = map[string]bool{
+	"plain":     true,
+	"line":      true,
+	"multiline": true,
+}
+
+// Content lints the configuration content
+func Content(content []byte, docs DocFunc) ([]Issue, error) {
+	config, err := logstash.NewParser(bytes.NewReader(content)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return Lint(config, docs), nil
+}
+
+// Lint returns the issues of the configuration ordered by line, docs may be nil
+// to skip the checks of the processors options
+func Lint(config *logstash.Configuration, docs DocFunc) []Issue {
+	l := &linter{
+		docs:     docs,
+		issues:   []Issue{},
+		labels:   map[string]int{},
+		fields:   map[string]bool{},
+		reported: map[string]bool{},
+	}
+	for _, f := range defaultFields {
+		l.fields[f] = true
+	}
+	// without input, events come from another pipeline
+	if _, ok := config.Sections["input"]; !ok {
+		l.opaque = true
+	}
+
+	for _, name := range []string{"input", "filter", "output"} {
+		if section, ok := config.Sections[name]; ok {
+			l.plugins(name, section.Plugins)
+		}
+	}
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		return l.issues[i].Line < l.issues[j].Line
+	})
+	return l.issues
+}
+
+type linter struct {
+	docs   DocFunc
+	issues []Issue
+	labels map[string]int // line of the first plugin with the label
+	// fields known to be set upstream
+	fields map[string]bool
+	// opaque is true once a processor may set fields we can not tell
+	opaque   bool
+	reported map[string]bool
+}
+
+func (l *linter) add(line int, rule string, format string, a ...interface{}) {
+	l.issues = append(l.issues, Issue{
+		Line:    line,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (l *linter) plugins(kind string, plugins map[int]*logstash.Plugin) {
+	for i := 0; i < len(plugins); i++ {
+		if plugins[i].Name == "when" {
+			l.when(kind, plugins[i])
+			continue
+		}
+		l.plugin(kind, plugins[i])
+	}
+}
+
+// when checks the branches of a conditional, fields set in any branch are
+// considered set downstream
+func (l *linter) when(kind string, plugin *logstash.Plugin) {
+	tested := map[string]int{}
+	always := false
+	for i := 0; i < len(plugin.When); i++ {
+		w := plugin.When[i]
+		branch := "else"
+		if i == 0 {
+			branch = "if"
+		}
+		if w.Condition != "" {
+			branch += " " + w.Condition
+		}
+
+		switch line, ok := tested[w.Condition]; {
+		case always:
+			l.add(w.Line, RULE_UNREACHABLE, "%s is never reached, a previous branch always matches", branch)
+		case ok && w.Condition != "":
+			l.add(w.Line, RULE_UNREACHABLE, "%s is never reached, the same condition is tested line %d", branch, line)
+		}
+		tested[w.Condition] = w.Line
+		if w.Condition == "" || w.Condition == "true" {
+			always = true
+		}
+
+		l.checkFields(w.Line, w.Condition)
+		l.plugins(kind, w.Plugins)
+	}
+}
+
+func (l *linter) plugin(kind string, plugin *logstash.Plugin) {
+	if plugin.Label != "" {
+		if line, ok := l.labels[plugin.Label]; ok {
+			l.add(plugin.Line, RULE_DUPLICATE_LABEL, "label %s is already used line %d", plugin.Label, line)
+		} else {
+			l.labels[plugin.Label] = plugin.Line
+		}
+	}
+
+	settings := map[string]interface{}{}
+	for i := 0; i < len(plugin.Settings); i++ {
+		settings[plugin.Settings[i].K] = plugin.Settings[i].V
+	}
+
+	if d := l.doc(kind, plugin.Name); d != nil && d.Options != nil {
+		for i := 0; i < len(plugin.Settings); i++ {
+			s := plugin.Settings[i]
+			if o := option(d, s.K); o != nil && o.Deprecated != "" {
+				l.add(s.Line, RULE_DEPRECATED, "%s option %s is deprecated, %s", plugin.Name, s.K, o.Deprecated)
+			}
+		}
+		if _, ok := settings["tag_on_failure"]; !ok && kind == "filter" && plugin.OnFailure == nil && option(d, "tag_on_failure") != nil {
+			l.add(plugin.Line, RULE_TAG_ON_FAILURE, "%s has no tag_on_failure, its failures are only tagged with the default tag", plugin.Name)
+		}
+	}
+
+	l.produce(kind, plugin, settings)
+
+	if plugin.OnFailure != nil {
+		l.plugins(kind, plugin.OnFailure.Plugins)
+	}
+}
+
+func (l *linter) doc(kind string, name string) *doc.Processor {
+	if l.docs == nil {
+		return nil
+	}
+	code := kind + "_" + name
+	if kind == "filter" {
+		code = name
+	}
+	return l.docs(code)
+}
+
+// option returns the option of the processor named name
+func option(d *doc.Processor, name string) *doc.ProcessorOption {
+	for _, o := range d.Options.Options {
+		if o.Alias == name || (o.Alias == "" && strings.ToLower(o.Name) == name) {
+			return o
+		}
+	}
+	return nil
+}
+
+// produce records the fields set by the plugin, any plugin which is not known
+// makes the fields of the events unpredictable
+func (l *linter) produce(kind string, plugin *logstash.Plugin, settings map[string]interface{}) {
+	if fields, ok := settings["add_field"].(map[string]interface{}); ok {
+		for k := range fields {
+			l.set(k)
+		}
+	}
+
+	switch kind {
+	case "input":
+		if !knownInputs[plugin.Name] {
+			l.opaque = true
+		}
+		for i := 0; i < len(plugin.Codecs); i++ {
+			if !plainCodecs[plugin.Codecs[i].Name] {
+				l.opaque = true
+			}
+		}
+	case "filter":
+		switch plugin.Name {
+		case "drop", "sleep", "stdout", "split":
+		case "mutate":
+			if rename, ok := settings["rename"].(map[string]interface{}); ok {
+				for _, v := range rename {
+					if s, ok := v.(string); ok {
+						l.set(s)
+					}
+				}
+			}
+			if replace, ok := settings["replace"].(map[string]interface{}); ok {
+				for k := range replace {
+					l.set(k)
+				}
+			}
+		case "grok":
+			match, ok := settings["match"].(map[string]interface{})
+			if !ok {
+				l.opaque = true
+			}
+			for _, v := range match {
+				for _, pattern := range stringValues(v) {
+					// patterns used without field name may capture fields
+					if grokPattern.MatchString(pattern) {
+						l.opaque = true
+					}
+					for _, capture := range captures(pattern) {
+						l.set(capture)
+					}
+				}
+			}
+		case "date", "uuid":
+			if target, ok := settings["target"].(string); ok {
+				l.set(target)
+			}
+		case "geoip":
+			target, ok := settings["target"].(string)
+			if !ok {
+				target = "geoip"
+			}
+			l.set(target)
+		case "json", "kv":
+			if target, ok := settings["target"].(string); ok {
+				l.set(target)
+			} else {
+				l.opaque = true
+			}
+		default:
+			l.opaque = true
+		}
+	}
+}
+
+// set records a field, fields with a dynamic name make the fields of the events
+// unpredictable
+func (l *linter) set(name string) {
+	if strings.Contains(name, "%{") {
+		l.opaque = true
+		return
+	}
+	l.fields[fieldRoot(name)] = true
+}
+
+// checkFields reports the fields tested by the condition and never set upstream
+func (l *linter) checkFields(line int, condition string) {
+	if l.opaque {
+		return
+	}
+	for _, ref := range fieldRefs(condition) {
+		root := fieldRoot(ref)
+		if l.fields[root] || l.reported[root] {
+			continue
+		}
+		l.reported[root] = true
+		l.add(line, RULE_UNSET_FIELD, "field %s is tested but never set upstream", ref)
+	}
+}
+
+var (
+	grokPattern  = regexp.MustCompile(`%\{[^:}]+\}`)
+	grokCapture  = regexp.MustCompile(`%\{[^:}]+:([^:}]+)(:[^}]*)?\}`)
+	regexCapture = regexp.MustCompile(`\(\?P?<([^>]+)>`)
+	literals     = regexp.MustCompile(`"(\\.|[^"\\])*"|'(\\.|[^'\\])*'|([=!]~\s*)/(\\.|[^/\\])*/`)
+	fieldRef     = regexp.MustCompile(`(\[[^\[\],\s]+\])+`)
+)
+
+// captures returns the fields captured by a grok pattern
+func captures(pattern string) []string {
+	fields := []string{}
+	for _, m := range grokCapture.FindAllStringSubmatch(pattern, -1) {
+		fields = append(fields, m[1])
+	}
+	for _, m := range regexCapture.FindAllStringSubmatch(pattern, -1) {
+		fields = append(fields, m[1])
+	}
+	return fields
+}
+
+// fieldRefs returns the fields a condition refers to
+func fieldRefs(condition string) []string {
+	refs := []string{}
+	condition = literals.ReplaceAllString(condition, "$3")
+	for _, ref := range fieldRef.FindAllString(condition, -1) {
+		if strings.Trim(ref, "[]0123456789.-") == "" {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// fieldRoot returns the top level field of a field reference, [a][b] and a.b
+// are fields of a
+func fieldRoot(ref string) string {
+	ref = strings.TrimPrefix(ref, "[")
+	if i := strings.IndexAny(ref, "]."); i >= 0 {
+		return ref[:i]
+	}
+	return ref
+}
+
+func stringValues(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		values := []string{}
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
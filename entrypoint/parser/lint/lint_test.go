@@ -0,0 +1,160 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors/doc"
+)
+
+func testDocs(code string) *doc.Processor {
+	switch code {
+	case "grok":
+		return &doc.Processor{Name: "grok", Options: &doc.ProcessorOptions{
+			Options: []*doc.ProcessorOption{
+				{Name: "Match", Alias: "match"},
+				{Name: "TagOnFailure", Alias: "tag_on_failure"},
+				{Name: "Patterns", Alias: "patterns_dir", Deprecated: "use pattern_definitions"},
+			},
+		}}
+	case "mutate":
+		return &doc.Processor{Name: "mutate", Options: &doc.ProcessorOptions{
+			Options: []*doc.ProcessorOption{
+				{Name: "Rename"},
+			},
+		}}
+	}
+	return nil
+}
+
+func rules(issues []Issue) []string {
+	r := []string{}
+	for _, i := range issues {
+		r = append(r, i.Rule)
+	}
+	return r
+}
+
+func TestLintClean(t *testing.T) {
+	issues, err := Content([]byte(`
+input { stdin {} }
+filter {
+	grok { match => { "message" => "%{WORD:verb} %{NUMBER:size:int}" } tag_on_failure => ["_bad"] }
+	mutate { rename => { "size" => "bytes" } add_field => { "[meta][x]" => "1" } }
+	if [verb] == "GET" and [bytes] > 10 and [meta][x] {
+		drop {}
+	} else if "_bad" in [tags] {
+		drop {}
+	}
+}
+output { stdout {} }
+`), testDocs)
+	assert.NoError(t, err)
+	assert.Equal(t, []Issue{}, issues)
+}
+
+func TestLintDeprecatedAndTagOnFailure(t *testing.T) {
+	issues, _ := Content([]byte(`input { stdin {} }
+filter {
+	grok {
+		match => { "message" => "%{WORD:verb}" }
+		patterns_dir => "/tmp"
+	}
+}`), testDocs)
+	if !assert.Equal(t, []string{RULE_TAG_ON_FAILURE, RULE_DEPRECATED}, rules(issues)) {
+		return
+	}
+	assert.Equal(t, 3, issues[0].Line)
+	assert.Equal(t, 5, issues[1].Line)
+	assert.Contains(t, issues[1].Message, "use pattern_definitions")
+}
+
+func TestLintOnFailure(t *testing.T) {
+	issues, _ := Content([]byte(`input { stdin {} }
+filter {
+	grok {
+		match => { "message" => "%{WORD:verb}" }
+		on_failure {
+			grok { match => { "message" => "%{NUMBER:size}" } patterns_dir => "/tmp" }
+		}
+	}
+}`), testDocs)
+	if !assert.Equal(t, []string{RULE_DEPRECATED, RULE_TAG_ON_FAILURE}, rules(issues)) {
+		return
+	}
+	assert.Equal(t, 6, issues[0].Line)
+	assert.Equal(t, 6, issues[1].Line)
+}
+
+func TestLintUnreachable(t *testing.T) {
+	issues, _ := Content([]byte(`filter {
+	if [a] == 1 {
+		drop {}
+	} else if [a] == 1 {
+		drop {}
+	} else {
+		drop {}
+	} else {
+		drop {}
+	}
+}`), nil)
+	if !assert.Equal(t, []string{RULE_UNREACHABLE, RULE_UNREACHABLE}, rules(issues)) {
+		return
+	}
+	assert.Equal(t, 4, issues[0].Line)
+	assert.Contains(t, issues[0].Message, "line 2")
+	assert.Equal(t, 8, issues[1].Line)
+}
+
+func TestLintDuplicateLabels(t *testing.T) {
+	issues, _ := Content([]byte(`filter {
+	mutate "m" {}
+	mutate "m" {}
+}
+output {
+	stdout "m" {}
+}`), nil)
+	assert.Equal(t, []string{RULE_DUPLICATE_LABEL, RULE_DUPLICATE_LABEL}, rules(issues))
+}
+
+func TestLintUnsetFields(t *testing.T) {
+	issues, _ := Content([]byte(`input { stdin {} }
+filter {
+	if [verb] == "GET" and [message] =~ /[a]/ and "[b]" in [tags] {
+		mutate { add_field => { "c" => "1" } }
+	}
+	if [c] and [verb] {
+		drop {}
+	}
+}
+output {
+	if [status][code] == 200 { stdout {} }
+}`), testDocs)
+	if !assert.Equal(t, []string{RULE_UNSET_FIELD, RULE_UNSET_FIELD}, rules(issues)) {
+		return
+	}
+	assert.Equal(t, 3, issues[0].Line)
+	assert.Contains(t, issues[0].Message, "[verb]")
+	assert.Equal(t, 11, issues[1].Line)
+	assert.Contains(t, issues[1].Message, "[status][code]")
+}
+
+func TestLintUnsetFieldsAfterUnknownProducer(t *testing.T) {
+	issues, _ := Content([]byte(`input { stdin { codec => json } }
+filter {
+	if [verb] == "GET" { drop {} }
+}`), nil)
+	assert.Equal(t, []Issue{}, issues)
+
+	issues, _ = Content([]byte(`input { stdin {} }
+filter {
+	grok { match => { "message" => "%{COMBINEDAPACHELOG}" } }
+	if [verb] == "GET" { drop {} }
+}`), nil)
+	assert.Equal(t, []Issue{}, issues)
+}
+
+func TestLintParseError(t *testing.T) {
+	_, err := Content([]byte(`filter {`), nil)
+	assert.Error(t, err)
+}
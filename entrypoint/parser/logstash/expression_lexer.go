@@ -187,7 +187,7 @@ func lexIdent(l *lexer.L) lexer.StateFunc {
 		return lexIdent
 	}
 
-	l.Take("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz=!<>~*+-|&^")
+	l.Take("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz_=!<>~*+-|&^")
 
 	if isInSlice(strings.ToLower(l.Current()), COMPARATOR_SYMBOLS) {
 		cu := l.Current()
@@ -169,6 +169,10 @@ func TestExpressions(t *testing.T) {
 		`[way] !~ /(RECEIVE|SEND)/`,
 		`[way] !~ '(RECEIVE|SEND)'`,
 	)
+	check(t,
+		`cidr_match([ip], "10.0.0.0/8") and not is_null([host])`,
+		`cidr_match ( [ip] , '10.0.0.0/8' ) && ! is_null ( [host] )`,
+	)
 }
 
 func check(t *testing.T, lsExpression string, gvExpression string) {
@@ -113,8 +113,10 @@ func readToken(stream *lexerStream) (token, error) {
 			kind = TokenString
 
 			if tokenString == "if" {
+				start := stream.position
 				tokenString, _ = readUntilFalse(stream, true, false, true, true, isNotLeftBr)
 				tokenValue = tokenString
+				ret.Raw = string(stream.source[start:stream.position])
 				kind = TokenIf
 				break
 			}
@@ -125,8 +127,10 @@ func readToken(stream *lexerStream) (token, error) {
 				if stream.readCharacter() == ' ' {
 					if stream.readCharacter() == 'i' {
 						if stream.readCharacter() == 'f' {
+							start := stream.position
 							tokenString, _ = readUntilFalse(stream, true, false, true, false, isNotLeftBr)
 							tokenValue = tokenString
+							ret.Raw = string(stream.source[start:stream.position])
 							kind = TokenElseIf
 							break
 						}
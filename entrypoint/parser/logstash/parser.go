@@ -5,44 +5,75 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
 )
 
 type Parser struct {
 	l    *lexerStream
 	line int
 	col  int
+
+	comments []string // comments read since the last node
 }
 
+// Comments hold the text of the comments written before a node, EndComments
+// the ones written before the end of a block
 type Configuration struct {
-	Sections map[string]*Section
+	Sections    map[string]*Section
+	EndComments []string
 }
 
 type Section struct {
-	Name    string
-	Plugins map[int]*Plugin
+	Name        string
+	Plugins     map[int]*Plugin
+	Line        int
+	Comments    []string
+	EndComments []string
 }
 
 type Plugin struct {
-	Name     string
-	Label    string
-	Codecs   map[int]*Codec
-	Settings map[int]*Setting
-	When     map[int]*When // IF and ElseIF with order
+	Name        string
+	Label       string
+	Codecs      map[int]*Codec
+	Settings    map[int]*Setting
+	When        map[int]*When // IF and ElseIF with order
+	OnFailure   *OnFailure
+	Line        int
+	Comments    []string
+	EndComments []string
+}
+
+// OnFailure holds the plugins of an on_failure block, they process the events
+// the plugin failed to process
+type OnFailure struct {
+	Plugins     map[int]*Plugin
+	Line        int
+	Comments    []string
+	EndComments []string
 }
 
 type Codec struct {
-	Name     string
-	Settings map[int]*Setting
+	Name        string
+	Settings    map[int]*Setting
+	Comments    []string
+	EndComments []string
 }
 
 type When struct {
-	Expression string          // condition
-	Plugins    map[int]*Plugin // actions
+	Expression  string          // condition
+	Condition   string          // condition as written, empty for else
+	Plugins     map[int]*Plugin // actions
+	Line        int
+	Comments    []string
+	EndComments []string
 }
 
+// Comments of a setting include the ones written in its hash or array value
 type Setting struct {
-	K string
-	V interface{}
+	K        string
+	V        interface{}
+	Line     int
+	Comments []string
 }
 
 type ParseError struct {
@@ -91,6 +122,7 @@ func (p *Parser) Parse() (*Configuration, error) {
 
 		switch tok.Kind {
 		case TokenComment:
+			p.addComment(&tok)
 			continue
 		case TokenString:
 			var section *Section
@@ -102,10 +134,22 @@ func (p *Parser) Parse() (*Configuration, error) {
 		}
 
 	}
+	config.EndComments = p.takeComments()
 
 	return config, err
 }
 
+func (p *Parser) addComment(tok *token) {
+	p.comments = append(p.comments, strings.TrimRightFunc(tok.Value.(string), unicode.IsSpace))
+}
+
+// takeComments returns the comments read since the last node
+func (p *Parser) takeComments() []string {
+	comments := p.comments
+	p.comments = nil
+	return comments
+}
+
 func (p *Parser) parseSection(tok *token) (*Section, error) {
 	section := &Section{}
 	if tok.Value != "input" && tok.Value != "filter" && tok.Value != "output" {
@@ -114,6 +158,8 @@ func (p *Parser) parseSection(tok *token) (*Section, error) {
 
 	section.Name = tok.Value.(string)
 	section.Plugins = make(map[int]*Plugin)
+	section.Line = tok.Line
+	section.Comments = p.takeComments()
 
 	var err error
 	*tok, err = p.getToken(TokenLCurlyBrace)
@@ -129,11 +175,13 @@ func (p *Parser) parseSection(tok *token) (*Section, error) {
 		}
 
 		if tok.Kind == TokenRCurlyBrace {
+			section.EndComments = p.takeComments()
 			break
 		}
 
 		switch tok.Kind {
 		case TokenComment:
+			p.addComment(tok)
 			continue
 		case TokenString:
 			plugin, err := p.parsePlugin(tok)
@@ -157,6 +205,7 @@ func (p *Parser) parseSection(tok *token) (*Section, error) {
 				return section, err
 			}
 			plugin.When[0].Expression = "true"
+			plugin.When[0].Condition = ""
 			iWhen := len(section.Plugins[i-1].When)
 			section.Plugins[i-1].When[iWhen] = plugin.When[0]
 			continue
@@ -181,14 +230,19 @@ func (p *Parser) parseWHEN(tok *token) (*Plugin, error) {
 
 	var err error
 
-	expression, errc := toWhenExpression(tok.Value.(string))
+	// comments written within the condition are not part of the expression
+	condition, comments := splitCondition(tok.Raw)
+	expression, errc := toWhenExpression(condition)
 	if errc != nil {
 		return pluginWhen, newParseError(tok.Line, tok.Col, "Conditional expression parse error : "+errc.Error())
 	}
 
 	when := &When{
 		Expression: expression,
+		Condition:  condition,
 		Plugins:    map[int]*Plugin{},
+		Line:       tok.Line,
+		Comments:   append(p.takeComments(), comments...),
 	}
 
 	// si pas de { alors erreur
@@ -205,11 +259,13 @@ func (p *Parser) parseWHEN(tok *token) (*Plugin, error) {
 		}
 
 		if tok.Kind == TokenRCurlyBrace {
+			when.EndComments = p.takeComments()
 			break
 		}
 
 		switch tok.Kind {
 		case TokenComment:
+			p.addComment(tok)
 			continue
 		case TokenString:
 			plugin, err := p.parsePlugin(tok)
@@ -233,6 +289,7 @@ func (p *Parser) parseWHEN(tok *token) (*Plugin, error) {
 				return pluginWhen, err
 			}
 			plugin.When[0].Expression = "true"
+			plugin.When[0].Condition = ""
 			iWhen := len(when.Plugins[i-1].When)
 			when.Plugins[i-1].When[iWhen] = plugin.When[0]
 			continue
@@ -252,6 +309,54 @@ func (p *Parser) parseWHEN(tok *token) (*Plugin, error) {
 	return pluginWhen, err
 }
 
+// splitCondition returns the condition written in raw with its whitespaces
+// collapsed and the comments written within
+func splitCondition(raw string) (string, []string) {
+	var condition bytes.Buffer
+	comments := []string{}
+	var quote rune
+	space := false
+	runes := []rune(raw)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(runes) {
+				condition.WriteRune(c)
+				i++
+				c = runes[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && strings.HasSuffix(strings.TrimSpace(condition.String()), "~"):
+			quote = c
+		case c == '#':
+			end := i
+			for end < len(runes) && runes[end] != '\n' {
+				end++
+			}
+			comments = append(comments, strings.TrimRightFunc(string(runes[i+1:end]), unicode.IsSpace))
+			i = end
+			space = true
+			continue
+		case unicode.IsSpace(c):
+			space = true
+			continue
+		}
+		if space && condition.Len() > 0 {
+			condition.WriteRune(' ')
+		}
+		space = false
+		condition.WriteRune(c)
+	}
+	if len(comments) == 0 {
+		comments = nil
+	}
+	return condition.String(), comments
+}
+
 func (p *Parser) parsePlugin(tok *token) (*Plugin, error) {
 	var err error
 
@@ -259,6 +364,8 @@ func (p *Parser) parsePlugin(tok *token) (*Plugin, error) {
 	plugin.Name = tok.Value.(string)
 	plugin.Settings = map[int]*Setting{}
 	plugin.Codecs = map[int]*Codec{}
+	plugin.Line = tok.Line
+	plugin.Comments = p.takeComments()
 
 	*tok, err = p.getToken(TokenLCurlyBrace, TokenString)
 	if err != nil {
@@ -288,6 +395,7 @@ func (p *Parser) parsePlugin(tok *token) (*Plugin, error) {
 		}
 
 		if tok.Kind == TokenRCurlyBrace {
+			plugin.EndComments = p.takeComments()
 			break
 		}
 
@@ -295,9 +403,21 @@ func (p *Parser) parsePlugin(tok *token) (*Plugin, error) {
 		case TokenComma:
 			continue
 		case TokenComment:
+			p.addComment(tok)
 			continue
 		case TokenString:
 
+			if tok.Value == "on_failure" {
+				if plugin.OnFailure != nil {
+					return plugin, newParseError(tok.Line, tok.Col, "only one on_failure block is allowed by plugin")
+				}
+				plugin.OnFailure, err = p.parseOnFailure(tok)
+				if err != nil {
+					return plugin, err
+				}
+				continue
+			}
+
 			if tok.Value == "codec" {
 				codec, rewind, err := p.parseCodec(tok)
 				if err != nil {
@@ -326,11 +446,80 @@ func (p *Parser) parsePlugin(tok *token) (*Plugin, error) {
 	return plugin, err
 }
 
+func (p *Parser) parseOnFailure(tok *token) (*OnFailure, error) {
+	onFailure := &OnFailure{
+		Plugins:  map[int]*Plugin{},
+		Line:     tok.Line,
+		Comments: p.takeComments(),
+	}
+
+	var err error
+	*tok, err = p.getToken(TokenLCurlyBrace)
+	if err != nil {
+		return onFailure, err
+	}
+	i := 0
+	for {
+		*tok, err = p.getToken(TokenComment, TokenString, TokenRCurlyBrace, TokenIf, TokenElse, TokenElseIf)
+		if err != nil {
+			return onFailure, err
+		}
+
+		if tok.Kind == TokenRCurlyBrace {
+			onFailure.EndComments = p.takeComments()
+			break
+		}
+
+		switch tok.Kind {
+		case TokenComment:
+			p.addComment(tok)
+			continue
+		case TokenString:
+			plugin, err := p.parsePlugin(tok)
+			if err != nil {
+				return onFailure, err
+			}
+			onFailure.Plugins[i] = plugin
+			i = i + 1
+			continue
+		case TokenIf:
+			plugin, err := p.parseWHEN(tok)
+			if err != nil {
+				return onFailure, err
+			}
+			onFailure.Plugins[i] = plugin
+			i = i + 1
+			continue
+		case TokenElse:
+			plugin, err := p.parseWHEN(tok)
+			if err != nil {
+				return onFailure, err
+			}
+			plugin.When[0].Expression = "true"
+			plugin.When[0].Condition = ""
+			iWhen := len(onFailure.Plugins[i-1].When)
+			onFailure.Plugins[i-1].When[iWhen] = plugin.When[0]
+			continue
+		case TokenElseIf:
+			plugin, err := p.parseWHEN(tok)
+			if err != nil {
+				return onFailure, err
+			}
+			iWhen := len(onFailure.Plugins[i-1].When)
+			onFailure.Plugins[i-1].When[iWhen] = plugin.When[0]
+			continue
+		}
+	}
+
+	return onFailure, err
+}
+
 func (p *Parser) parseCodec(tok *token) (*Codec, *token, error) {
 	var err error
 
 	codec := &Codec{}
 	codec.Settings = map[int]*Setting{}
+	codec.Comments = p.takeComments()
 
 	*tok, err = p.getToken(TokenAssignment)
 	if err != nil {
@@ -358,6 +547,7 @@ func (p *Parser) parseCodec(tok *token) (*Codec, *token, error) {
 		}
 
 		if tok.Kind == TokenRCurlyBrace {
+			codec.EndComments = p.takeComments()
 			break
 		}
 
@@ -365,6 +555,7 @@ func (p *Parser) parseCodec(tok *token) (*Codec, *token, error) {
 		case TokenComma:
 			continue
 		case TokenComment:
+			p.addComment(tok)
 			continue
 		case TokenString:
 			setting, err := p.parseSetting(tok)
@@ -385,6 +576,8 @@ func (p *Parser) parseSetting(tok *token) (*Setting, error) {
 	setting := &Setting{}
 
 	setting.K = tok.Value.(string)
+	setting.Line = tok.Line
+	setting.Comments = p.takeComments()
 
 	var err error
 	*tok, err = p.getToken(TokenAssignment)
@@ -410,6 +603,8 @@ func (p *Parser) parseSetting(tok *token) (*Setting, error) {
 	case TokenLCurlyBrace:
 		setting.V, err = p.parseHash()
 	}
+	// comments of a hash or an array are kept with the setting
+	setting.Comments = append(setting.Comments, p.takeComments()...)
 
 	return setting, err
 
@@ -429,13 +624,16 @@ func (p *Parser) parseHash() (map[string]interface{}, error) {
 
 		switch tok.Kind {
 		case TokenComment:
+			p.addComment(&tok)
 			continue
 		case TokenString:
+			comments := p.takeComments()
 			set, err := p.parseSetting(&tok)
 			if err != nil {
 				return hash, err
 			}
 			hash[set.K] = set.V
+			p.comments = append(comments, set.Comments...)
 		}
 
 	}
@@ -458,6 +656,7 @@ func (p *Parser) parseArray() ([]interface{}, error) {
 
 		switch tok.Kind {
 		case TokenComment:
+			p.addComment(&tok)
 			continue
 		case TokenComma:
 			continue
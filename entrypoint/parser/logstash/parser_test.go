@@ -198,3 +198,30 @@ func TestParseIssue75(t *testing.T) {
 	assert.Equal(t, "'{' in [message]", conf.Sections["filter"].Plugins[2].When[0].Expression)
 	assert.NoError(t, err)
 }
+
+func TestParseOnFailure(t *testing.T) {
+	conf, err := NewParser(strings.NewReader(`filter {
+  grok {
+    match => { "message" => "%{WORD:verb}" }
+    on_failure {
+      mutate { add_tag => "unparsed" }
+      if [type] == "web" { drop {} }
+    }
+  }
+}`)).Parse()
+	if !assert.NoError(t, err) {
+		return
+	}
+	grok := conf.Sections["filter"].Plugins[0]
+	assert.Len(t, grok.Settings, 1)
+	if !assert.NotNil(t, grok.OnFailure) {
+		return
+	}
+	assert.Equal(t, 4, grok.OnFailure.Line)
+	assert.Len(t, grok.OnFailure.Plugins, 2)
+	assert.Equal(t, "mutate", grok.OnFailure.Plugins[0].Name)
+	assert.Equal(t, "when", grok.OnFailure.Plugins[1].Name)
+
+	_, err = NewParser(strings.NewReader(`filter { grok { on_failure {} on_failure {} } }`)).Parse()
+	assert.Error(t, err)
+}
@@ -0,0 +1,245 @@
+package logstash
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const printIndent = "  "
+
+// Format returns the configuration in its canonical form
+func Format(content []byte) ([]byte, error) {
+	config, err := NewParser(bytes.NewReader(content)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Fprint(&buf, config); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fprint writes the configuration in its canonical form : sections in the input,
+// filter, output order, blocks indented with two spaces, strings double quoted
+// and hash keys sorted
+func Fprint(w io.Writer, config *Configuration) error {
+	p := &printer{}
+	first := true
+	for _, name := range []string{"input", "filter", "output"} {
+		section, ok := config.Sections[name]
+		if !ok {
+			continue
+		}
+		if !first {
+			p.buf.WriteString("\n")
+		}
+		first = false
+		p.comments(section.Comments)
+		p.line("%s {", section.Name)
+		p.depth++
+		p.plugins(section.Plugins)
+		p.comments(section.EndComments)
+		p.depth--
+		p.line("}")
+	}
+	p.comments(config.EndComments)
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	buf   bytes.Buffer
+	depth int
+}
+
+func (p *printer) line(format string, a ...interface{}) {
+	p.buf.WriteString(strings.Repeat(printIndent, p.depth))
+	fmt.Fprintf(&p.buf, format, a...)
+	p.buf.WriteString("\n")
+}
+
+func (p *printer) comments(comments []string) {
+	for _, c := range comments {
+		p.line("%s", "#"+c)
+	}
+}
+
+func (p *printer) plugins(plugins map[int]*Plugin) {
+	for i := 0; i < len(plugins); i++ {
+		p.plugin(plugins[i])
+	}
+}
+
+func (p *printer) plugin(plugin *Plugin) {
+	if plugin.Name == "when" {
+		p.when(plugin)
+		return
+	}
+
+	p.comments(plugin.Comments)
+	head := plugin.Name
+	if plugin.Label != "" {
+		head += " " + quote(plugin.Label)
+	}
+	if len(plugin.Settings) == 0 && len(plugin.Codecs) == 0 && plugin.OnFailure == nil && len(plugin.EndComments) == 0 {
+		p.line("%s {}", head)
+		return
+	}
+
+	p.line("%s {", head)
+	p.depth++
+	p.settings(plugin.Settings)
+	for i := 0; i < len(plugin.Codecs); i++ {
+		p.codec(plugin.Codecs[i])
+	}
+	if plugin.OnFailure != nil {
+		p.onFailure(plugin.OnFailure)
+	}
+	p.comments(plugin.EndComments)
+	p.depth--
+	p.line("}")
+}
+
+func (p *printer) codec(codec *Codec) {
+	p.comments(codec.Comments)
+	if len(codec.Settings) == 0 && len(codec.EndComments) == 0 {
+		p.line("codec => %s", codec.Name)
+		return
+	}
+	p.line("codec => %s {", codec.Name)
+	p.depth++
+	p.settings(codec.Settings)
+	p.comments(codec.EndComments)
+	p.depth--
+	p.line("}")
+}
+
+func (p *printer) onFailure(onFailure *OnFailure) {
+	p.comments(onFailure.Comments)
+	if len(onFailure.Plugins) == 0 && len(onFailure.EndComments) == 0 {
+		p.line("on_failure {}")
+		return
+	}
+	p.line("on_failure {")
+	p.depth++
+	p.plugins(onFailure.Plugins)
+	p.comments(onFailure.EndComments)
+	p.depth--
+	p.line("}")
+}
+
+// when writes the if, else if and else branches of a conditional, comments of
+// else branches are written at the beginning of their block
+func (p *printer) when(plugin *Plugin) {
+	for i := 0; i < len(plugin.When); i++ {
+		w := plugin.When[i]
+		switch {
+		case i == 0:
+			p.comments(w.Comments)
+			p.line("if %s {", w.Condition)
+		case w.Condition == "":
+			p.depth--
+			p.line("} else {")
+		default:
+			p.depth--
+			p.line("} else if %s {", w.Condition)
+		}
+		p.depth++
+		if i > 0 {
+			p.comments(w.Comments)
+		}
+		p.plugins(w.Plugins)
+		p.comments(w.EndComments)
+	}
+	p.depth--
+	p.line("}")
+}
+
+func (p *printer) settings(settings map[int]*Setting) {
+	for i := 0; i < len(settings); i++ {
+		s := settings[i]
+		p.comments(s.Comments)
+		p.value(key(s.K)+" => ", s.V)
+	}
+}
+
+// value writes the value of a setting, a hash with more than one entry is
+// written on several lines
+func (p *printer) value(prefix string, v interface{}) {
+	hash, ok := v.(map[string]interface{})
+	if !ok || len(hash) == 0 {
+		p.line("%s%s", prefix, scalar(v))
+		return
+	}
+	keys := make([]string, 0, len(hash))
+	for k := range hash {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if _, nested := hash[keys[0]].(map[string]interface{}); len(keys) == 1 && !nested {
+		p.line("%s{ %s => %s }", prefix, quote(keys[0]), scalar(hash[keys[0]]))
+		return
+	}
+	p.line("%s{", prefix)
+	p.depth++
+	for _, k := range keys {
+		p.value(quote(k)+" => ", hash[k])
+	}
+	p.depth--
+	p.line("}")
+}
+
+func scalar(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return quote(t)
+	case bool:
+		return strconv.FormatBool(t)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		f := strconv.FormatFloat(t, 'f', -1, 64)
+		if !strings.Contains(f, ".") {
+			f += ".0"
+		}
+		return f
+	case []interface{}:
+		values := make([]string, len(t))
+		for i, e := range t {
+			values[i] = scalar(e)
+		}
+		if len(values) == 0 {
+			return "[]"
+		}
+		return "[ " + strings.Join(values, ", ") + " ]"
+	case map[string]interface{}:
+		return "{}"
+	}
+	return quote(fmt.Sprintf("%v", v))
+}
+
+// key returns the name of a setting, quoted when it is not a bare word
+func key(k string) string {
+	switch k {
+	case "", "if", "else", "true", "false":
+		return quote(k)
+	}
+	for i, c := range k {
+		if !isString(c) || (i == 0 && !unicode.IsLetter(c)) {
+			return quote(k)
+		}
+	}
+	return k
+}
+
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
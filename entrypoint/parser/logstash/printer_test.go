@@ -0,0 +1,139 @@
+package logstash
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	content := `# pipeline
+output { stdout { codec => json } }
+filter {
+	grok "parse" { match => { "message" => "%{WORD:verb}" } } # after grok
+	if [verb] == "GET"    and [message] =~ /\d+/ # get
+	{ mutate { add_field => { "b" => 'say "hi"' "a" => 1.0 } } }
+	else if [verb] == "POST" { drop{} }
+	else {
+		# other verbs
+		mutate { uppercase => ["verb",
+		# comment in array
+		"message"] }
+	}
+}
+input { stdin {} }
+`
+	expected := `input {
+  stdin {}
+}
+
+filter {
+  grok "parse" {
+    match => { "message" => "%{WORD:verb}" }
+  }
+  # after grok
+  # get
+  if [verb] == "GET" and [message] =~ /\d+/ {
+    mutate {
+      add_field => {
+        "a" => 1.0
+        "b" => "say \"hi\""
+      }
+    }
+  } else if [verb] == "POST" {
+    drop {}
+  } else {
+    # other verbs
+    mutate {
+      # comment in array
+      uppercase => [ "verb", "message" ]
+    }
+  }
+}
+
+# pipeline
+output {
+  stdout {
+    codec => json
+  }
+}
+`
+	formatted, err := Format([]byte(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, expected, string(formatted))
+}
+
+func TestFormatIsStable(t *testing.T) {
+	for _, name := range []string{"002", "003", "004", "005", "issue-75"} {
+		content, err := ioutil.ReadFile(filepath.Join("testdata", name+".conf"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		formatted, err := Format(content)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		again, err := Format(formatted)
+		assert.NoError(t, err, name)
+		assert.Equal(t, string(formatted), string(again), name)
+	}
+}
+
+func TestFormatKeepsValues(t *testing.T) {
+	content, _ := ioutil.ReadFile(filepath.Join("testdata", "005.conf"))
+	formatted, err := Format(content)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	before, _ := NewParser(bytes.NewReader(content)).Parse()
+	after, err := NewParser(bytes.NewReader(formatted)).Parse()
+	if !assert.NoError(t, err) {
+		return
+	}
+	for name, section := range before.Sections {
+		for i, plugin := range section.Plugins {
+			other := after.Sections[name].Plugins[i]
+			assert.Equal(t, plugin.Name, other.Name)
+			assert.Equal(t, plugin.Label, other.Label)
+			assert.Equal(t, len(plugin.When), len(other.When))
+			for j, s := range plugin.Settings {
+				assert.Equal(t, s.K, other.Settings[j].K)
+				assert.Equal(t, s.V, other.Settings[j].V)
+			}
+			for j, w := range plugin.When {
+				assert.Equal(t, w.Expression, other.When[j].Expression)
+			}
+		}
+	}
+}
+
+func TestFormatOnFailure(t *testing.T) {
+	formatted, err := Format([]byte(`filter { date { match => ["ts", "ISO8601"] # failed
+	on_failure { mutate { add_tag => "bad_date" } } } }`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `filter {
+  date {
+    match => [ "ts", "ISO8601" ]
+    # failed
+    on_failure {
+      mutate {
+        add_tag => "bad_date"
+      }
+    }
+  }
+}
+`, string(formatted))
+}
+
+func TestFormatError(t *testing.T) {
+	_, err := Format([]byte("input { stdin { } "))
+	assert.Error(t, err)
+}
@@ -9,6 +9,8 @@ type token struct {
 	Pos   int
 	Line  int
 	Col   int
+	// Raw is the source text of the condition of if and else if tokens
+	Raw string
 }
 
 // Represents all valid types of tokens that a token can be.
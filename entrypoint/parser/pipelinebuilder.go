@@ -3,10 +3,14 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
 	"strconv"
+	"strings"
 
+	"github.com/vjeantet/bitfan/commons/expression"
 	"github.com/vjeantet/bitfan/core"
 	"github.com/vjeantet/bitfan/entrypoint/parser/logstash"
+	"github.com/vjeantet/bitfan/processors"
 )
 
 var entryPointContent func(string, string, map[string]interface{}) ([]byte, string, error)
@@ -23,9 +27,24 @@ func parseConfigLocation(path string, options map[string]interface{}, pwd string
 	}
 
 	agents, err := buildAgents(content, cwd, pickSections...)
+	// agents of nested configurations are declared in the used file
+	for i := range agents {
+		if agents[i].Source == "" {
+			agents[i].Source = sourceLocation(path, cwd)
+		}
+	}
 	return agents, err
 }
 
+// sourceLocation returns the location of a used configuration, cwd is the
+// directory or url base it was read from
+func sourceLocation(path string, cwd string) string {
+	if strings.HasPrefix(cwd, "http://") || strings.HasPrefix(cwd, "https://") {
+		return strings.TrimSuffix(cwd, "/") + "/" + filepath.Base(path)
+	}
+	return filepath.Join(cwd, filepath.Base(path))
+}
+
 func BuildAgents(content []byte, pwd string, contentProvider func(string, string, map[string]interface{}) ([]byte, string, error)) ([]core.Agent, error) {
 	entryPointContent = contentProvider
 	return buildAgents(content, pwd)
@@ -99,6 +118,10 @@ func buildAgents(content []byte, pwd string, pickSections ...string) ([]core.Age
 func buildInputAgents(plugin *logstash.Plugin, lastOutPorts []core.Port, pwd string) ([]core.Agent, []core.Port, error) {
 	agent := newAgent(plugin, pwd, "input_")
 
+	if plugin.OnFailure != nil {
+		return nil, nil, fmt.Errorf("line %d : on_failure is only supported by filters", plugin.OnFailure.Line)
+	}
+
 	// If agent is a "use"
 	// build imported pipeline from path
 	// connect import plugin Xsource to imported pipeline output
@@ -164,6 +187,10 @@ func buildInputAgents(plugin *logstash.Plugin, lastOutPorts []core.Port, pwd str
 func buildOutputAgents(plugin *logstash.Plugin, lastOutPorts []core.Port, pwd string) ([]core.Agent, []core.Port, error) {
 	agent := newAgent(plugin, pwd, "output_")
 
+	if plugin.OnFailure != nil {
+		return nil, nil, fmt.Errorf("line %d : on_failure is only supported by filters", plugin.OnFailure.Line)
+	}
+
 	// if its a use plugin
 	// load filter and output parts of pipeline
 	// connect pipeline Xsource to lastOutPorts
@@ -244,6 +271,12 @@ func buildFilterAgents(plugin *logstash.Plugin, lastOutPorts []core.Port, pwd st
 	agent := newAgent(plugin, pwd, "")
 	agent.PoolSize = 2
 
+	if plugin.OnFailure != nil && (plugin.Name == "use" || plugin.Name == "route") {
+		return nil, nil, fmt.Errorf("line %d : on_failure is not supported by the %s processor", plugin.OnFailure.Line, plugin.Name)
+	}
+
+	setExpressionLines(&agent, plugin)
+
 	// handle use plugin
 	// If its a use agent
 	// build the filter part of the pipeline
@@ -357,6 +390,16 @@ func buildFilterAgents(plugin *logstash.Plugin, lastOutPorts []core.Port, pwd st
 		}
 	}
 
+	// failed events go through the on_failure plugins then rejoin the main flow
+	if plugin.OnFailure != nil {
+		failureAgents, failureOutPorts, err := buildOnFailureBranch(&agent, plugin.OnFailure)
+		if err != nil {
+			return nil, nil, err
+		}
+		agent_list = append(failureAgents, agent_list...)
+		newOutPorts = append(newOutPorts, failureOutPorts...)
+	}
+
 	// ajoute l'agent à la liste des agents
 	agent_list = append([]core.Agent{agent}, agent_list...)
 	return agent_list, newOutPorts, nil
@@ -384,6 +427,7 @@ func newAgent(plugin *logstash.Plugin, pwd string, labelPrefix string) core.Agen
 	agent.Buffer = 20
 	agent.PoolSize = 1
 	agent.Wd = pwd
+	agent.Line = plugin.Line
 
 	// Plugin configuration
 	agent.Options = map[string]interface{}{}
@@ -413,6 +457,27 @@ func newAgent(plugin *logstash.Plugin, pwd string, labelPrefix string) core.Agen
 	return agent
 }
 
+// setExpressionLines gives the route and eval processors the configuration
+// lines their expressions are written at
+func setExpressionLines(agent *core.Agent, plugin *logstash.Plugin) {
+	lines := map[string]int{}
+	for _, setting := range plugin.Settings {
+		switch {
+		case plugin.Name == "route" && setting.K == "condition":
+			lines["condition"] = setting.Line
+		case plugin.Name == "eval" && setting.K == "expressions":
+			if h, ok := setting.V.(map[string]interface{}); ok {
+				for key := range h {
+					lines[key] = setting.Line
+				}
+			}
+		}
+	}
+	if len(lines) > 0 {
+		agent.Options[expression.LINES_OPTION] = lines
+	}
+}
+
 func setAgentInterval(agent *core.Agent) {
 	interval := agent.Options["interval"]
 	switch t := interval.(type) {
@@ -452,17 +517,39 @@ func setAgentPoolSize(agent *core.Agent) {
 	return
 }
 
+func buildOnFailureBranch(agent *core.Agent, onFailure *logstash.OnFailure) ([]core.Agent, []core.Port, error) {
+	agent_list := []core.Agent{}
+	outPorts := []core.Port{
+		{AgentID: agent.ID, PortNumber: processors.PORT_FAILURE},
+	}
+	for pi := 0; pi < len(onFailure.Plugins); pi++ {
+		agents, ports, err := buildFilterAgents(onFailure.Plugins[pi], outPorts, agent.Wd)
+		if err != nil {
+			return nil, nil, err
+		}
+		outPorts = ports
+		agent_list = append(agents, agent_list...)
+	}
+	return agent_list, outPorts, nil
+}
+
 func buildWhenBranch(agent *core.Agent, Whens map[int]*logstash.When, sectionType string) ([]core.Agent, []core.Port, error) {
 	agent_list := []core.Agent{}
 	outPorts_when := []core.Port{}
 	// le plugin WHEn est $plugin
 	agent.Options["expressions"] = map[int]string{}
+	lines := map[string]int{}
+	agent.Options[expression.LINES_OPTION] = lines
+	if agent.Line == 0 && Whens[0] != nil {
+		agent.Line = Whens[0].Line
+	}
 	elseOK := false
 	// Loop over expressions in correct order
 	for expressionIndex := 0; expressionIndex < len(Whens); expressionIndex++ {
 		when := Whens[expressionIndex]
 		//	enregistrer l'expression dans la conf agent
 		agent.Options["expressions"].(map[int]string)[expressionIndex] = when.Expression
+		lines[strconv.Itoa(expressionIndex)] = when.Line
 		if when.Expression == "true" {
 			elseOK = true
 		}
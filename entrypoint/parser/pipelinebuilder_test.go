@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/core"
+	"github.com/vjeantet/bitfan/processors"
 )
 
 var tsURL = ""
@@ -71,6 +73,59 @@ func TestBuildAgentsUse(t *testing.T) {
 	assert.Equal(t, 35, len(agents))
 }
 
+func TestBuildAgentsSource(t *testing.T) {
+	f, _ := os.Open("testdata/use/main.conf")
+	ewl, _ := filepath.Abs(filepath.Dir(f.Name()))
+	defer f.Close()
+	responseData, _ := ioutil.ReadAll(f)
+
+	agents, err := BuildAgents(responseData, ewl, entrypointContentFS)
+	if !assert.NoError(t, err) {
+		return
+	}
+	sources := map[string]int{}
+	for _, a := range agents {
+		assert.NotZero(t, a.Line, a.Type)
+		sources[a.Source]++
+		if a.Type == "input_stdin" {
+			assert.Equal(t, 2, a.Line)
+		}
+	}
+	// agents of the main configuration get their source from the entrypoint
+	assert.Contains(t, sources, "")
+	assert.Contains(t, sources, filepath.Join(ewl, "subs", "input2.conf"))
+	assert.Contains(t, sources, filepath.Join(ewl, "subs", "use11.conf"))
+}
+
+func TestBuildAgentsOnFailure(t *testing.T) {
+	agents, err := BuildAgents([]byte(`input { stdin {} }
+filter {
+  grok {
+    match => { "message" => "%{WORD:verb}" }
+    on_failure {
+      mutate { add_tag => "unparsed" }
+    }
+  }
+  uuid { target => "id" }
+}
+output { stdout {} }`), ".", nil)
+	if !assert.NoError(t, err) || !assert.Len(t, agents, 5) {
+		return
+	}
+	byType := map[string]core.Agent{}
+	for _, a := range agents {
+		byType[a.Type] = a
+	}
+	grok, mutate, uuid := byType["grok"], byType["mutate"], byType["uuid"]
+	assert.Equal(t, core.PortList{{AgentID: grok.ID, PortNumber: processors.PORT_FAILURE}}, mutate.AgentSources)
+	assert.Len(t, uuid.AgentSources, 2)
+	assert.Contains(t, uuid.AgentSources, core.Port{AgentID: grok.ID, PortNumber: 0})
+	assert.Contains(t, uuid.AgentSources, core.Port{AgentID: mutate.ID, PortNumber: 0})
+
+	_, err = BuildAgents([]byte(`input { stdin { on_failure {} } }`), ".", nil)
+	assert.Error(t, err)
+}
+
 func entrypointContentFS(path string, cwl string, options map[string]interface{}) ([]byte, string, error) {
 	var content []byte
 	var ewl string
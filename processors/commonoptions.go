@@ -1,6 +1,9 @@
 package processors
 
-import "github.com/clbanning/mxj"
+import (
+	"github.com/clbanning/mxj"
+	"github.com/vjeantet/bitfan/processors/doc"
+)
 
 type CommonOptions struct {
 	// If this filter is successful, add any arbitrary fields to this event.
@@ -31,6 +34,19 @@ type CommonOptions struct {
 	Trace bool `mapstructure:"trace"`
 }
 
+// CommonOptionsDoc documents the options of CommonOptions, processors docs only
+// reference them
+func CommonOptionsDoc() []*doc.ProcessorOption {
+	return []*doc.ProcessorOption{
+		{Name: "AddField", Alias: "add_field", Type: "hash", Doc: "If this filter is successful, add any arbitrary fields to this event."},
+		{Name: "AddTag", Alias: "add_tag", Type: "array", Doc: "If this filter is successful, add arbitrary tags to the event. Tags can be dynamic and include parts of the event using the %{field} syntax."},
+		{Name: "Type", Alias: "type", Type: "string", Doc: "Add a type field to all events handled by this input"},
+		{Name: "RemoveField", Alias: "remove_field", Type: "array", Doc: "If this filter is successful, remove arbitrary fields from this event."},
+		{Name: "RemoveTag", Alias: "remove_tag", Type: "array", Doc: "If this filter is successful, remove arbitrary tags from the event. Tags can be dynamic and include parts of the event using the %{field} syntax."},
+		{Name: "Trace", Alias: "trace", Type: "bool", Doc: "Log each event produced by the processor (usefull while building or debugging a pipeline)"},
+	}
+}
+
 func (c *CommonOptions) ProcessCommonOptions(data *mxj.Map) {
 	if len(c.AddField) > 0 {
 		AddFields(c.AddField, data)
@@ -31,6 +31,9 @@ func removeSpecialComment(comment string) string {
 		if strings.HasPrefix(strings.ToLower(line), "@enum ") {
 			continue
 		}
+		if strings.HasPrefix(strings.ToLower(line), "@deprecated ") {
+			continue
+		}
 		if strings.HasPrefix(line, "go:generate") {
 			continue
 		}
@@ -117,94 +120,142 @@ func NewProcessor(pkgPath string) (*Processor, error) {
 		dp.Options.Options = []*ProcessorOption{}
 		for _, si := range v.Decl.Specs {
 			s := si.(*ast.TypeSpec)
+			dp.Options.Options = append(dp.Options.Options, structOptions(s.Type.(*ast.StructType))...)
+		}
+	}
+	return dp, nil
 
-			typ := s.Type.(*ast.StructType)
-			for _, field := range typ.Fields.List {
-				dpo := &ProcessorOption{}
+}
 
-				var fieldType string
-				fieldTags := map[string]string{}
+// structOptions returns the options described by the fields of an options struct, fields of
+// embedded processors' options structs (except CommonOptions) are inlined
+func structOptions(typ *ast.StructType) []*ProcessorOption {
+	options := []*ProcessorOption{}
+	for _, field := range typ.Fields.List {
+		if sel, ok := field.Type.(*ast.SelectorExpr); ok && len(field.Names) == 0 {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == "processors" && sel.Sel.Name != "CommonOptions" {
+				if embedded := processorsStruct(sel.Sel.Name); embedded != nil {
+					options = append(options, structOptions(embedded)...)
+					continue
+				}
+			}
+		}
 
-				customType := ""
-				if field.Doc != nil {
-					for _, c := range field.Doc.List {
-						if strings.HasPrefix(c.Text, "// @Default ") {
-							dpo.DefaultValue = strings.TrimPrefix(c.Text, "// @Default ")
-						}
-						if strings.HasPrefix(c.Text, "// @ExampleLS ") {
-							dpo.ExampleLS = strings.TrimPrefix(c.Text, "// @ExampleLS ")
-						}
-						if strings.HasPrefix(c.Text, "// @Type ") {
-							customType = strings.ToLower(strings.TrimPrefix(c.Text, "// @Type "))
-						}
+		dpo := &ProcessorOption{}
 
-						if strings.HasPrefix(c.Text, "// @Enum ") {
-							st := strings.ToLower(strings.TrimPrefix(c.Text, "// @Enum "))
-							dpo.PossibleValues = strings.Split(st, ",")
-						}
-					}
-				}
+		var fieldType string
+		fieldTags := map[string]string{}
 
-				switch t := field.Type.(type) {
-				case *ast.MapType:
-					fieldType = "map"
-					keyKind := t.Key.(*ast.Ident).Name
-					valueKind := "string"
-					fieldType = "map[" + keyKind + "]" + valueKind
-					fieldType = "hash"
-				case *ast.ArrayType:
-					fieldType = "array of " + t.Elt.(*ast.Ident).Name
-					fieldType = "array"
-				case *ast.Ident:
-					fieldType = t.Name
-				case *ast.SelectorExpr:
-					xKind := t.X.(*ast.Ident).Name
-					selKind := t.Sel.String()
-					fieldType = xKind + "." + selKind
-				default:
-					fieldType = "unknow"
-					pp.Println("field-->", field.Type)
+		customType := ""
+		if field.Doc != nil {
+			for _, c := range field.Doc.List {
+				if strings.HasPrefix(c.Text, "// @Default ") {
+					dpo.DefaultValue = strings.TrimPrefix(c.Text, "// @Default ")
+				}
+				if strings.HasPrefix(c.Text, "// @ExampleLS ") {
+					dpo.ExampleLS = strings.TrimPrefix(c.Text, "// @ExampleLS ")
+				}
+				if strings.HasPrefix(c.Text, "// @Deprecated ") {
+					dpo.Deprecated = strings.TrimPrefix(c.Text, "// @Deprecated ")
+				}
+				if strings.HasPrefix(c.Text, "// @Type ") {
+					customType = strings.ToLower(strings.TrimPrefix(c.Text, "// @Type "))
 				}
 
-				dpo.Doc = removeSpecialComment(field.Doc.Text())
-				if len(field.Names) == 0 {
-					dpo.Name = fieldType
-				} else {
-					dpo.Name = field.Names[0].String()
+				if strings.HasPrefix(c.Text, "// @Enum ") {
+					st := strings.ToLower(strings.TrimPrefix(c.Text, "// @Enum "))
+					dpo.PossibleValues = strings.Split(st, ",")
 				}
+			}
+		}
 
-				if field.Tag != nil {
-					if field.Tag.Value != "" {
-						r, _ := regexp.Compile(`([a-z]*):"([a-z_0-9,]*)"`)
-						for _, match := range r.FindAllStringSubmatch(field.Tag.Value, 5) {
-							fieldTags[match[1]] = match[2]
-						}
-					}
+		switch t := field.Type.(type) {
+		case *ast.MapType:
+			fieldType = "map"
+			keyKind := t.Key.(*ast.Ident).Name
+			valueKind := "string"
+			fieldType = "map[" + keyKind + "]" + valueKind
+			fieldType = "hash"
+		case *ast.ArrayType:
+			fieldType = "array of " + t.Elt.(*ast.Ident).Name
+			fieldType = "array"
+		case *ast.Ident:
+			fieldType = t.Name
+		case *ast.SelectorExpr:
+			xKind := t.X.(*ast.Ident).Name
+			selKind := t.Sel.String()
+			fieldType = xKind + "." + selKind
+		default:
+			fieldType = "unknow"
+			pp.Println("field-->", field.Type)
+		}
+
+		dpo.Doc = removeSpecialComment(field.Doc.Text())
+		if len(field.Names) == 0 {
+			dpo.Name = fieldType
+		} else {
+			dpo.Name = field.Names[0].String()
+		}
+
+		if field.Tag != nil {
+			if field.Tag.Value != "" {
+				r, _ := regexp.Compile(`([a-z]*):"([a-z_0-9,]*)"`)
+				for _, match := range r.FindAllStringSubmatch(field.Tag.Value, 5) {
+					fieldTags[match[1]] = match[2]
 				}
-				// pp.Println("field tag-->", field.Tag.Value)
-				dpo.Type = fieldType
-				if customType != "" {
-					dpo.Type = customType
+			}
+		}
+		// pp.Println("field tag-->", field.Tag.Value)
+		dpo.Type = fieldType
+		if customType != "" {
+			dpo.Type = customType
+		}
+
+		if _, ok := fieldTags["mapstructure"]; ok {
+			dpo.Alias = fieldTags["mapstructure"]
+		}
+		if _, ok := fieldTags["validate"]; ok {
+			validationTagValues := strings.Split(fieldTags["validate"], ",")
+			for _, validationTagValue := range validationTagValues {
+				if validationTagValue == "required" {
+					dpo.Required = true
 				}
+			}
+		}
+
+		options = append(options, dpo)
+	}
+	return options
+}
 
-				if _, ok := fieldTags["mapstructure"]; ok {
-					dpo.Alias = fieldTags["mapstructure"]
+// processorsStruct returns the struct named name declared in the processors package
+func processorsStruct(name string) *ast.StructType {
+	pkg, err := build.Import("github.com/vjeantet/bitfan/processors", "", build.FindOnly)
+	if err != nil {
+		return nil
+	}
+	pkgs, err := parser.ParseDir(token.NewFileSet(), pkg.Dir, isGoFile, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	for _, astPkg := range pkgs {
+		for _, f := range astPkg.Files {
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
 				}
-				if _, ok := fieldTags["validate"]; ok {
-					validationTagValues := strings.Split(fieldTags["validate"], ",")
-					for _, validationTagValue := range validationTagValues {
-						if validationTagValue == "required" {
-							dpo.Required = true
+				for _, spec := range gd.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == name {
+						if st, ok := ts.Type.(*ast.StructType); ok {
+							return st
 						}
 					}
 				}
-
-				dp.Options.Options = append(dp.Options.Options, dpo)
 			}
 		}
 	}
-	return dp, nil
-
+	return nil
 }
 
 func isGoFile(fi os.FileInfo) bool {
@@ -0,0 +1,214 @@
+package doc
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+const SCHEMA_DRAFT = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema describing the settings of a processor or a codec
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	MinProperties        int                `json:"minProperties,omitempty"`
+	MaxProperties        int                `json:"maxProperties,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Deprecated           bool               `json:"deprecated,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// JSONSchema returns the schema of the processor settings, common lists the
+// options of an embedded processors.CommonOptions, agent the options bitfan
+// handles for all processors and codecs the codecs usable by a codec option
+func (p *Processor) JSONSchema(common []*ProcessorOption, agent []*ProcessorOption, codecs map[string]*Codec) *Schema {
+	s := &Schema{
+		Schema:               SCHEMA_DRAFT,
+		Title:                p.Name,
+		Description:          p.DocShort,
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+	if s.Description == "" {
+		s.Description = p.Doc
+	}
+	// agent and common options never override the processor ones
+	options := append([]*ProcessorOption{}, agent...)
+	if p.Options != nil {
+		for _, o := range p.Options.Options {
+			if o.Type == "processors.CommonOptions" {
+				options = append(options, common...)
+			}
+		}
+		for _, o := range p.Options.Options {
+			if o.Type != "processors.CommonOptions" {
+				options = append(options, o)
+			}
+		}
+	}
+
+	for _, o := range options {
+		name := strings.ToLower(o.getIdentifier())
+		var ps *Schema
+		if o.Type == "codec" {
+			ps = codecSchema(codecs, enum(o.PossibleValues))
+		} else {
+			ps = typeSchema(o.Type)
+			ps.Enum = enum(o.PossibleValues)
+		}
+		ps.Description = o.Doc
+		ps.Default = jsonValue(o.DefaultValue)
+		if o.Deprecated != "" {
+			ps.Deprecated = true
+			ps.Description = strings.TrimSpace(ps.Description + "\n\nDeprecated, " + o.Deprecated)
+		}
+		s.Properties[name] = ps
+		if o.Required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// JSONSchema returns the schema of the codec settings, the options of its
+// decoder and encoder
+func (c *Codec) JSONSchema() *Schema {
+	s := &Schema{
+		Schema:      SCHEMA_DRAFT,
+		Title:       c.Name,
+		Description: c.DocShort,
+		Type:        "object",
+		Properties: map[string]*Schema{
+			"charset": {Type: "string", Description: "Charset of the encoded data", Default: "utf-8"},
+			"role":    {Type: "string", Description: "Use the codec only to decode or to encode", Enum: []interface{}{"decoder", "encoder"}},
+		},
+		AdditionalProperties: false,
+	}
+	if s.Description == "" {
+		s.Description = c.Doc
+	}
+
+	options := []*CodecOption{}
+	if c.Decoder != nil && c.Decoder.Options != nil {
+		options = append(options, c.Decoder.Options.Options...)
+	}
+	if c.Encoder != nil && c.Encoder.Options != nil {
+		options = append(options, c.Encoder.Options.Options...)
+	}
+	for _, o := range options {
+		name := o.Alias
+		if name == "" {
+			name = strings.ToLower(o.Name)
+		}
+		if _, ok := s.Properties[name]; ok {
+			continue
+		}
+		ps := typeSchema(o.Type)
+		ps.Description = o.Doc
+		ps.Default = jsonValue(o.DefaultValue)
+		ps.Enum = enum(o.PossibleValues)
+		s.Properties[name] = ps
+		if o.Required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// codecSchema accepts a codec name or a hash with the codec name as only key
+// and its settings as value, allowed restricts the codecs when not empty
+func codecSchema(codecs map[string]*Codec, allowed []interface{}) *Schema {
+	names := []string{}
+	for name := range codecs {
+		names = append(names, name)
+	}
+	if len(allowed) > 0 {
+		names = []string{}
+		for _, v := range allowed {
+			if name, ok := v.(string); ok && codecs[name] != nil {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	byName := &Schema{Type: "string"}
+	withSettings := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+		MinProperties:        1,
+		MaxProperties:        1,
+	}
+	for _, name := range names {
+		byName.Enum = append(byName.Enum, name)
+		cs := codecs[name].JSONSchema()
+		cs.Schema = ""
+		withSettings.Properties[name] = cs
+	}
+	return &Schema{OneOf: []*Schema{byName, withSettings}}
+}
+
+// typeSchema returns the schema of a documented option type
+func typeSchema(t string) *Schema {
+	zero := 0
+	switch t {
+	case "string", "location":
+		return &Schema{Type: "string"}
+	case "bool":
+		return &Schema{Type: "boolean"}
+	case "int", "int32", "int64":
+		return &Schema{Type: "integer"}
+	case "uint", "uint64":
+		return &Schema{Type: "integer", Minimum: &zero}
+	case "float32", "float64":
+		return &Schema{Type: "number"}
+	case "array":
+		return &Schema{Type: "array"}
+	case "hash", "amqp.Table":
+		return &Schema{Type: "object"}
+	case "time.Duration", "interval", "os.FileMode":
+		// a number of seconds, a cron expression or an octal mode
+		return &Schema{Type: []string{"integer", "string"}}
+	}
+	return &Schema{}
+}
+
+// jsonValue returns the value of a default value or a possible value written
+// as in a configuration, "\"line\"" is the string line
+func jsonValue(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(s), &value); err != nil {
+		if len(s) > 1 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+			return s[1 : len(s)-1]
+		}
+		return s
+	}
+	return value
+}
+
+func enum(values []string) []interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	e := []interface{}{}
+	for _, v := range values {
+		e = append(e, jsonValue(strings.TrimSpace(v)))
+	}
+	return e
+}
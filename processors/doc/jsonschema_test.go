@@ -0,0 +1,76 @@
+package doc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessorJSONSchema(t *testing.T) {
+	p := &Processor{
+		Name: "stdout",
+		Doc:  "Prints events",
+		Options: &ProcessorOptions{
+			Options: []*ProcessorOption{
+				{Name: "processors.CommonOptions", Alias: ",squash", Type: "processors.CommonOptions"},
+				{Name: "Codec", Alias: "codec", Type: "codec", DefaultValue: `"line"`, PossibleValues: []string{`"line"`, `"json"`, `"xml"`}},
+				{Name: "Mode", Alias: "mode", Type: "string", Required: true, PossibleValues: []string{`"a"`, `"b"`}},
+				{Name: "Retry", Type: "uint", DefaultValue: "3"},
+				{Name: "Timeout", Alias: "timeout", Type: "time.Duration", Deprecated: "use deadline"},
+			},
+		},
+	}
+	common := []*ProcessorOption{{Name: "AddTag", Alias: "add_tag", Type: "array"}}
+	agent := []*ProcessorOption{{Name: "Workers", Alias: "workers", Type: "int"}}
+	codecs := map[string]*Codec{
+		"line": {Name: "line", Encoder: &Encoder{Options: &CodecOptions{Options: []*CodecOption{
+			{Name: "Format", Alias: "format", Type: "string", DefaultValue: `"{{.message}}"`},
+		}}}},
+		"json": {Name: "json"},
+		"csv":  {Name: "csv"},
+	}
+
+	s := p.JSONSchema(common, agent, codecs)
+	assert.Equal(t, SCHEMA_DRAFT, s.Schema)
+	assert.Equal(t, "Prints events", s.Description)
+	assert.Equal(t, false, s.AdditionalProperties)
+	assert.Equal(t, []string{"mode"}, s.Required)
+	assert.Len(t, s.Properties, 6)
+
+	assert.Equal(t, "array", s.Properties["add_tag"].Type)
+	assert.Equal(t, "integer", s.Properties["workers"].Type)
+	assert.Equal(t, []interface{}{"a", "b"}, s.Properties["mode"].Enum)
+	assert.Equal(t, float64(3), s.Properties["retry"].Default)
+	assert.Equal(t, 0, *s.Properties["retry"].Minimum)
+	assert.True(t, s.Properties["timeout"].Deprecated)
+	assert.Contains(t, s.Properties["timeout"].Description, "use deadline")
+
+	codec := s.Properties["codec"]
+	assert.Equal(t, "line", codec.Default)
+	if !assert.Len(t, codec.OneOf, 2) {
+		return
+	}
+	assert.Equal(t, []interface{}{"json", "line"}, codec.OneOf[0].Enum)
+	assert.Len(t, codec.OneOf[1].Properties, 2)
+	assert.Equal(t, "{{.message}}", codec.OneOf[1].Properties["line"].Properties["format"].Default)
+
+	_, err := json.Marshal(s)
+	assert.NoError(t, err)
+}
+
+func TestCodecJSONSchema(t *testing.T) {
+	c := &Codec{
+		Name: "multiline",
+		Decoder: &Decoder{Options: &CodecOptions{Options: []*CodecOption{
+			{Name: "What", Alias: "what", Type: "string", PossibleValues: []string{"previous", "next"}},
+			{Name: "Pattern", Alias: "pattern", Type: "string", Required: true},
+		}}},
+	}
+	s := c.JSONSchema()
+	assert.Equal(t, "multiline", s.Title)
+	assert.Equal(t, []string{"pattern"}, s.Required)
+	assert.Equal(t, []interface{}{"previous", "next"}, s.Properties["what"].Enum)
+	assert.Contains(t, s.Properties, "charset")
+	assert.Contains(t, s.Properties, "role")
+}
@@ -76,6 +76,8 @@ type ProcessorOption struct {
 	PossibleValues []string
 	//LogstashExample
 	ExampleLS string
+	// Deprecated explains how to replace a deprecated option
+	Deprecated string
 }
 
 func (p *Processor) GenExample(kind string) []byte {
@@ -138,6 +140,9 @@ func (p *Processor) GenMarkdown(kind string) []byte {
 		}
 		g.Printf("* Value type is %s\n", o.Type)
 		g.Printf("* Default value is `%s`\n", o.getDefaultValue())
+		if o.Deprecated != "" {
+			g.Printf("* This setting is deprecated, %s\n", o.Deprecated)
+		}
 		g.Printf("\n%s\n\n", o.Doc)
 	}
 
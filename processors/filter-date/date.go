@@ -129,6 +129,8 @@ func (p *processor) Receive(e processors.IPacket) error {
 
 	if dated == false {
 		processors.AddTags(p.opt.TagOnFailure, e.Fields())
+		p.Send(e, processors.PORT_FAILURE)
+		return nil
 	}
 
 	p.Send(e, 0)
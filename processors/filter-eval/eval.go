@@ -18,26 +18,24 @@
 // * Prefixes: `!` `-` `~`
 // * Ternary conditional: `?` `:`
 // * Null coalescence: `??`
+// * Functions: `len` `lower` `upper` `trim` `contains` `starts_with` `ends_with` `replace` `split` `join` `first` `last` `match` `capture` `cidr_match` `now` `timestamp` `duration` `exists` `is_null` `coalesce` `string` `number` `bool` and type checks `is_string` `is_number` `is_bool` `is_list` `is_hash`
 //
 package evalprocessor
 
 import (
 	"bytes"
 	"fmt"
-	"reflect"
-	"strconv"
-	"strings"
 	"text/template"
 
 	"github.com/vjeantet/bitfan/commons"
+	"github.com/vjeantet/bitfan/commons/expression"
 	"github.com/vjeantet/bitfan/processors"
-	"gopkg.in/Knetic/govaluate.v3"
 )
 
 func New() processors.Processor {
 	return &processor{
 		opt:                 &options{},
-		compiledExpressions: map[string]*govaluate.EvaluableExpression{},
+		compiledExpressions: map[string]*expression.Expression{},
 		compiledTemplates:   map[string]*template.Template{},
 	}
 }
@@ -53,7 +51,7 @@ type processor struct {
 	processors.Base
 	opt *options
 
-	compiledExpressions map[string]*govaluate.EvaluableExpression
+	compiledExpressions map[string]*expression.Expression
 	compiledTemplates   map[string]*template.Template
 }
 
@@ -78,6 +76,7 @@ type options struct {
 func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) (err error) {
 	defaults := options{}
 	p.opt = &defaults
+	lines := expression.Lines(conf)
 	err = p.ConfigureAndValidate(ctx, conf, p.opt)
 
 	if len(p.opt.Expressions)+len(p.opt.Templates) == 0 {
@@ -99,9 +98,11 @@ func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]i
 
 	// Prepare expressions
 	for key, expressionString := range p.opt.Expressions {
-		if _, err = p.cacheExpression(key, expressionString.(string)); err != nil {
+		x, err := expression.Compile(fmt.Sprintf("%v", expressionString), lines[key])
+		if err != nil {
 			return err
 		}
+		p.compiledExpressions[key] = x
 	}
 
 	return err
@@ -126,47 +127,14 @@ func (p *processor) Receive(e processors.IPacket) (err error) {
 		e.Fields().SetValueForPath(buff.String(), key)
 	}
 
-	// govaluate expressions
-	for key, expression := range p.compiledExpressions {
-		parameters := EvaluatedParameters{}
-		for _, v := range expression.Tokens() {
-			if v.Kind == govaluate.VARIABLE {
-				path := v.Value.(string)
-				splits := strings.Split(path, ".")
-				arrIndex := 0
-				if len(splits) > 1 {
-					arrIndex, err = strconv.Atoi(splits[len(splits)-1])
-					if err == nil {
-						// array index ! rebuild path
-						path = strings.Join(splits[0:len(splits)-1], ".")
-					}
-				}
-
-				paramValue, err := e.Fields().ValueForPath(path)
-
-				if len(splits) > 1 {
-					switch v := paramValue.(type) {
-					case []interface{}:
-						paramValue = v[arrIndex]
-					case []string:
-						paramValue = v[arrIndex]
-					}
-				}
-
-				p.Logger.Debugf("paramValue-->%s", paramValue)
-				if err != nil {
-					continue
-				}
-				parameters[v.Value.(string)] = paramValue
-			}
-		}
-		resultRaw, err := expression.Eval(parameters)
-
+	// expressions
+	for key, x := range p.compiledExpressions {
+		value, err := x.Eval(*e.Fields())
 		if err != nil {
-			p.Logger.Errorf("error while evaluating `%s` with values `%s` ", expression.String(), e.Fields())
+			p.Logger.Errorf("error while evaluating `%s` with values `%s` : %v", x.Source, e.Fields(), err)
 			countError++
 		} else {
-			e.Fields().SetValueForPath(resultRaw, key)
+			e.Fields().SetValueForPath(value, key)
 		}
 	}
 
@@ -177,72 +145,3 @@ func (p *processor) Receive(e processors.IPacket) (err error) {
 	p.Send(e)
 	return nil
 }
-
-type EvaluatedParameters map[string]interface{}
-
-func (ep EvaluatedParameters) Get(key string) (interface{}, error) {
-	value, found := ep[key]
-
-	// return `false` if parameter does not exist or value is nil
-	if !found || value == nil {
-		return false, nil
-	}
-
-	// return []interface{} if parameter is a slice of non-interface type
-	// this is needed for govaluate to work with slices
-	if reflect.TypeOf(value).Kind() == reflect.Slice {
-		s := reflect.ValueOf(value)
-		interfaceSlice := make([]interface{}, s.Len())
-
-		for i := 0; i < s.Len(); i++ {
-			interfaceSlice[i] = s.Index(i).Interface()
-		}
-		return interfaceSlice, nil
-	}
-
-	return value, nil
-}
-
-func (p *processor) cacheExpression(index string, expressionValue string) (*govaluate.EvaluableExpression, error) {
-	functions := map[string]govaluate.ExpressionFunction{
-
-		"bool": func(args ...interface{}) (interface{}, error) {
-			if len(args) == 0 {
-				return false, nil
-			}
-			switch args[0].(type) {
-			case bool:
-				return args[0].(bool), nil
-			default:
-				return true, nil
-			}
-		},
-
-		"len": func(args ...interface{}) (interface{}, error) {
-			if len(args) == 0 {
-				return float64(0), nil
-			}
-			switch reflect.TypeOf(args[0]).Kind() {
-
-			case reflect.Slice:
-				v := reflect.ValueOf(args[0])
-				return (float64)(v.Len()), nil
-
-			case reflect.String:
-				length := len(args[0].(string))
-				return (float64)(length), nil
-
-			default:
-				return (float64)(1), nil
-			}
-		},
-	}
-
-	expression, err := govaluate.NewEvaluableExpressionWithFunctions(expressionValue, functions)
-	if err != nil {
-		return nil, err
-	}
-	p.compiledExpressions[index] = expression
-
-	return expression, nil
-}
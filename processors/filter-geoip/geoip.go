@@ -141,7 +141,7 @@ func (p *processor) Receive(e processors.IPacket) error {
 	ip, err := e.Fields().ValueForPathString(p.opt.Source)
 	if err != nil {
 		processors.AddTags(p.opt.TagOnFailure, e.Fields())
-		p.Send(e, 0)
+		p.Send(e, processors.PORT_FAILURE)
 		return nil
 	}
 
@@ -150,7 +150,7 @@ func (p *processor) Receive(e processors.IPacket) error {
 	cache, err := p.cache.Get(ip)
 	if err != nil {
 		processors.AddTags(p.opt.TagOnFailure, e.Fields())
-		p.Send(e, 0)
+		p.Send(e, processors.PORT_FAILURE)
 		return nil
 	}
 
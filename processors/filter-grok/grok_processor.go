@@ -158,6 +158,8 @@ func (p *processor) Receive(e processors.IPacket) error {
 
 	if !groked {
 		processors.AddTags(p.opt.TagOnFailure, e.Fields())
+		p.Send(e, processors.PORT_FAILURE)
+		return nil
 	}
 
 	p.Send(e, PORT_SUCCESS)
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/processors"
 	"github.com/vjeantet/bitfan/processors/doc"
 	"github.com/vjeantet/bitfan/processors/testutils"
 )
@@ -97,6 +98,8 @@ func TestReceiveFailure(t *testing.T) {
 
 	tags, _ := em.Fields().ValueForPath("tags")
 	assert.Contains(t, tags.([]string), "_grokparsefailure", "failure tag should be set")
+	assert.Equal(t, 1, ctx.SentPacketsCount(processors.PORT_FAILURE), "event should be sent on the failure port")
+	assert.Equal(t, 0, ctx.SentPacketsCount(PORT_SUCCESS))
 
 }
 
@@ -61,7 +61,7 @@ func (p *processor) Receive(e processors.IPacket) error {
 		}
 		newtags := append(tags.([]string), p.opt.TagOnFailure...)
 		e.Fields().SetValueForPath(newtags, "tags")
-		p.Send(e, PORT_SUCCESS)
+		p.Send(e, processors.PORT_FAILURE)
 		return nil
 	} else {
 		// Text
@@ -62,7 +62,7 @@ func (p *processor) Receive(e processors.IPacket) error {
 		if p.opt.SkipOnInvalidJson == false {
 			p.Logger.Warnf("error while unmarshalling data : %s", err.Error())
 			processors.AddTags(p.opt.TagOnFailure, e.Fields())
-			p.Send(e, 0)
+			p.Send(e, processors.PORT_FAILURE)
 			return nil
 		}
 		return nil
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/vjeantet/bitfan/processors"
 	"github.com/vjeantet/bitfan/processors/testutils"
 )
 
@@ -155,8 +156,8 @@ func TestInvalidJsonData(t *testing.T) {
 
 		p, _ := testutils.NewProcessor(New, conf)
 		p.Receive(event)
-		Convey("one event produced", func() {
-			So(p.SentPacketsCount(0), ShouldEqual, 1)
+		Convey("one event produced on the failure port", func() {
+			So(p.SentPacketsCount(processors.PORT_FAILURE), ShouldEqual, 1)
 		})
 
 		Convey("event tags field contains _jsonparsefailure", func() {
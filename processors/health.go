@@ -0,0 +1,116 @@
+package processors
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Health status
+const (
+	HEALTH_UP       = "up"
+	HEALTH_DEGRADED = "degraded"
+	HEALTH_DOWN     = "down"
+)
+
+// consecutive failures before a processor is reported down
+const healthDownThreshold = 5
+
+// Health describes the state of a processor and of its connection to a remote service
+type Health struct {
+	Status              string    `json:"status"`
+	Connected           bool      `json:"connected"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastFailure         time.Time `json:"last_failure"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Message             string    `json:"message,omitempty"`
+}
+
+// HealthChecker may be implemented by processors to report their health
+type HealthChecker interface {
+	Health() Health
+}
+
+// HealthTracker implements HealthChecker, processors embed it and call
+// Success and Failure each time they talk to their remote service
+type HealthTracker struct {
+	mu sync.Mutex
+	h  Health
+	// stopped is the error which ended a goroutine run with Watch
+	stopped error
+}
+
+// Success records a successful exchange with the remote service
+func (t *HealthTracker) Success() {
+	t.mu.Lock()
+	t.h.Connected = true
+	t.h.LastSuccess = time.Now()
+	t.h.ConsecutiveFailures = 0
+	t.h.Message = ""
+	t.mu.Unlock()
+}
+
+// Failure records a failed exchange with the remote service
+func (t *HealthTracker) Failure(err error) {
+	t.mu.Lock()
+	t.h.LastFailure = time.Now()
+	t.h.ConsecutiveFailures++
+	if err != nil {
+		t.h.Message = err.Error()
+	}
+	t.mu.Unlock()
+}
+
+// SetConnected records the connection state to the remote service
+func (t *HealthTracker) SetConnected(connected bool) {
+	t.mu.Lock()
+	t.h.Connected = connected
+	t.mu.Unlock()
+}
+
+// Watch runs fn in a goroutine, typically the loop of an input receiving
+// events, the processor is reported down when fn returns an error or panics
+func (t *HealthTracker) Watch(fn func() error) {
+	t.mu.Lock()
+	t.stopped = nil
+	t.mu.Unlock()
+
+	go func() {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic : %v", r)
+			}
+			if err != nil {
+				t.mu.Lock()
+				t.stopped = err
+				t.h.LastFailure = time.Now()
+				t.mu.Unlock()
+			}
+		}()
+		err = fn()
+	}()
+}
+
+// Health returns the tracked health, its status is down when a watched
+// goroutine stopped, otherwise it is computed from the number of consecutive
+// failures
+func (t *HealthTracker) Health() Health {
+	t.mu.Lock()
+	h := t.h
+	stopped := t.stopped
+	t.mu.Unlock()
+
+	switch {
+	case stopped != nil:
+		h.Status = HEALTH_DOWN
+		h.Message = stopped.Error()
+	case h.ConsecutiveFailures >= healthDownThreshold:
+		h.Status = HEALTH_DOWN
+	case h.ConsecutiveFailures > 0:
+		h.Status = HEALTH_DEGRADED
+	default:
+		h.Status = HEALTH_UP
+	}
+	return h
+}
@@ -0,0 +1,76 @@
+package processors
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthTracker(t *testing.T) {
+	ht := &HealthTracker{}
+	assert.Equal(t, HEALTH_UP, ht.Health().Status)
+	assert.False(t, ht.Health().Connected)
+
+	ht.Success()
+	assert.Equal(t, HEALTH_UP, ht.Health().Status)
+	assert.True(t, ht.Health().Connected)
+	assert.False(t, ht.Health().LastSuccess.IsZero())
+
+	ht.Failure(errors.New("connection refused"))
+	assert.Equal(t, HEALTH_DEGRADED, ht.Health().Status)
+	assert.Equal(t, 1, ht.Health().ConsecutiveFailures)
+	assert.Equal(t, "connection refused", ht.Health().Message)
+
+	for i := 0; i < healthDownThreshold; i++ {
+		ht.Failure(nil)
+	}
+	assert.Equal(t, HEALTH_DOWN, ht.Health().Status)
+
+	ht.Success()
+	assert.Equal(t, HEALTH_UP, ht.Health().Status)
+	assert.Equal(t, 0, ht.Health().ConsecutiveFailures)
+	assert.Equal(t, "", ht.Health().Message)
+}
+
+// waitHealth returns the health once its status is status or after a second
+func waitHealth(ht *HealthTracker, status string) Health {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && ht.Health().Status != status {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return ht.Health()
+}
+
+func TestHealthTrackerWatch(t *testing.T) {
+	ht := &HealthTracker{}
+	done := make(chan bool)
+	ht.Watch(func() error {
+		<-done
+		return nil
+	})
+	assert.Equal(t, HEALTH_UP, ht.Health().Status)
+	close(done)
+	assert.Equal(t, HEALTH_UP, waitHealth(ht, HEALTH_DOWN).Status)
+
+	ht.Watch(func() error { return errors.New("read: connection reset") })
+	h := waitHealth(ht, HEALTH_DOWN)
+	assert.Equal(t, HEALTH_DOWN, h.Status)
+	assert.Equal(t, "read: connection reset", h.Message)
+
+	// watching again starts over
+	block := make(chan bool)
+	defer close(block)
+	ht.Watch(func() error {
+		<-block
+		return nil
+	})
+	assert.Equal(t, HEALTH_UP, ht.Health().Status)
+
+	ht = &HealthTracker{}
+	ht.Watch(func() error { panic("boom") })
+	h = waitHealth(ht, HEALTH_DOWN)
+	assert.Equal(t, HEALTH_DOWN, h.Status)
+	assert.Equal(t, "panic : boom", h.Message)
+}
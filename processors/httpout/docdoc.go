@@ -5,6 +5,7 @@ import "github.com/vjeantet/bitfan/processors/doc"
 
 func (p *processor) Doc() *doc.Processor {
 	return &doc.Processor{
+  Behavior:   "",
   Name:       "httpoutprocessor",
   ImportPath: "github.com/vjeantet/bitfan/processors/httpout",
   Doc:        "Display on http the last received event\n\nURL is available as http://webhookhost/pipelineName/pluginLabel/URI\n\n* webhookhost is defined by bitfan at startup\n* pluginLabel is defined in pipeline configuration, it's the named processor if you put one, or `httpout` by default\n* URI is defined in plugin configuration (see below)",
@@ -12,6 +13,113 @@ func (p *processor) Doc() *doc.Processor {
   Options:    &doc.ProcessorOptions{
     Doc:     "",
     Options: []*doc.ProcessorOption{
+      &doc.ProcessorOption{
+        Name:           "HmacSecret",
+        Alias:          "hmac_secret",
+        Doc:            "Shared secret used to verify the HMAC signature of the request's body",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "HmacStyle",
+        Alias:          "hmac_style",
+        Doc:            "Signature format : \"github\" (sha256=<hex>), \"stripe\" (t=<timestamp>,v1=<hex>)\nor \"hex\" (<hex>)",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   "\"github\"",
+        PossibleValues: []string{
+          "\"github\"",
+          "\"stripe\"",
+          "\"hex\"",
+        },
+        ExampleLS: "",
+      },
+      &doc.ProcessorOption{
+        Name:           "HmacHeader",
+        Alias:          "hmac_header",
+        Doc:            "Header holding the signature, default is X-Hub-Signature-256 (github),\nStripe-Signature (stripe) or X-Signature (hex)",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "HmacAlgorithm",
+        Alias:          "hmac_algorithm",
+        Doc:            "Hash function of the signature",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   "\"sha256\"",
+        PossibleValues: []string{
+          "\"sha256\"",
+          "\"sha1\"",
+        },
+        ExampleLS: "",
+      },
+      &doc.ProcessorOption{
+        Name:           "BearerToken",
+        Alias:          "bearer_token",
+        Doc:            "Token expected in the \"Authorization: Bearer <token>\" header",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "BasicUser",
+        Alias:          "basic_user",
+        Doc:            "User expected with basic auth",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "BasicPassword",
+        Alias:          "basic_password",
+        Doc:            "Password expected with basic auth",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "IpAllow",
+        Alias:          "ip_allow",
+        Doc:            "IPs or CIDR networks allowed to call the hook",
+        Required:       false,
+        Type:           "array",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "ip_allow => [\"10.0.0.0/8\", \"192.168.1.12\"]",
+      },
+      &doc.ProcessorOption{
+        Name:           "RateLimit",
+        Alias:          "rate_limit",
+        Doc:            "Maximum number of requests per second, 0 means no limit",
+        Required:       false,
+        Type:           "float64",
+        DefaultValue:   "0",
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "RateBurst",
+        Alias:          "rate_burst",
+        Doc:            "Number of requests accepted in a burst over rate_limit",
+        Required:       false,
+        Type:           "int",
+        DefaultValue:   "1",
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
       &doc.ProcessorOption{
         Name:           "Codec",
         Alias:          "",
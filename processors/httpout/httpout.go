@@ -23,6 +23,9 @@ func New() processors.Processor {
 
 type options struct {
 
+	// Protections of the hook
+	processors.WebHookOptions `mapstructure:",squash"`
+
 	// The codec used for input data. Input codecs are a convenient method for decoding
 	// your data before it enters the input, without needing a separate filter in your bitfan pipeline
 	// @Default "json"
@@ -42,9 +45,10 @@ type options struct {
 type processor struct {
 	processors.Base
 
-	opt  *options
-	q    chan bool
-	host string
+	opt   *options
+	q     chan bool
+	host  string
+	guard *processors.WebHookGuard
 }
 
 func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) error {
@@ -67,11 +71,16 @@ func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]i
 		p.Logger.Warnf("can not get hostname : %v", err)
 	}
 
+	if p.guard, err = processors.NewWebHookGuard(p.opt.WebHookOptions, p.Logger); err != nil {
+		return err
+	}
+
 	return err
 }
 
 func (p *processor) Start(e processors.IPacket) error {
-	p.WebHook.Add(p.opt.Uri, p.HttpHandler)
+	p.WebHook.Protect(p.guard.Protections())
+	p.WebHook.Add(p.opt.Uri, p.guard.Wrap(p.HttpHandler))
 	return nil
 }
 
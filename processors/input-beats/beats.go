@@ -20,6 +20,7 @@ func New() processors.Processor {
 
 type processor struct {
 	processors.Base
+	processors.HealthTracker
 
 	server *v2.Server
 	opt    *options
@@ -132,7 +133,8 @@ func (p *processor) Start(e processors.IPacket) error {
 
 	p.server = server
 
-	go func() {
+	p.Watch(func() error {
+		defer close(p.q)
 		for batch := range p.server.ReceiveChan() {
 			batch.ACK()
 			events := batch.Events
@@ -150,8 +152,8 @@ func (p *processor) Start(e processors.IPacket) error {
 			}
 		}
 		p.Logger.Debug("received events acked and drained")
-		close(p.q)
-	}()
+		return nil
+	})
 
 	return nil
 }
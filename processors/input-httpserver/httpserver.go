@@ -34,6 +34,9 @@ func New() processors.Processor {
 type options struct {
 	processors.CommonOptions `mapstructure:",squash"`
 
+	// Protections of the hook
+	processors.WebHookOptions `mapstructure:",squash"`
+
 	// The codec used for input data. Input codecs are a convenient method for decoding
 	// your data before it enters the input, without needing a separate filter in your bitfan pipeline
 	//
@@ -60,9 +63,10 @@ type options struct {
 type processor struct {
 	processors.Base
 
-	opt  *options
-	q    chan bool
-	host string
+	opt   *options
+	q     chan bool
+	host  string
+	guard *processors.WebHookGuard
 }
 
 func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) error {
@@ -88,11 +92,16 @@ func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]i
 		p.opt.Codec.Dec = codecs.New("plain", nil, ctx.Log(), ctx.ConfigWorkingLocation())
 	}
 
+	if p.guard, err = processors.NewWebHookGuard(p.opt.WebHookOptions, p.Logger); err != nil {
+		return err
+	}
+
 	return err
 }
 func (p *processor) Start(e processors.IPacket) error {
 	p.q = make(chan bool)
-	p.WebHook.Add(p.opt.Uri, p.HttpHandler)
+	p.WebHook.Protect(p.guard.Protections())
+	p.WebHook.Add(p.opt.Uri, p.guard.Wrap(p.HttpHandler))
 	return nil
 }
 
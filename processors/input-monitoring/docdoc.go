@@ -0,0 +1,60 @@
+// Code generated by "bitfanDoc "; DO NOT EDIT
+package monitoringinput
+
+import "github.com/vjeantet/bitfan/processors/doc"
+
+func (p *processor) Doc() *doc.Processor {
+	return &doc.Processor{
+  Behavior:   "",
+  Name:       "monitoringinput",
+  ImportPath: "github.com/vjeantet/bitfan/processors/input-monitoring",
+  Doc:        "Produce events from bitfan's internals : periodic agents stats, pipelines\nlifecycle changes, scheduler ticks and error log entries.\n\nEach event has a `kind` field with one of \"stats\", \"pipeline\", \"agent\", \"tick\", \"log\" value.",
+  DocShort:   "",
+  Options:    &doc.ProcessorOptions{
+    Doc:     "",
+    Options: []*doc.ProcessorOption{
+      &doc.ProcessorOption{
+        Name:           "processors.CommonOptions",
+        Alias:          ",squash",
+        Doc:            "",
+        Required:       false,
+        Type:           "processors.CommonOptions",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "Kinds",
+        Alias:          "kinds",
+        Doc:            "Kinds of events to produce",
+        Required:       false,
+        Type:           "array",
+        DefaultValue:   "[\"stats\",\"pipeline\",\"agent\",\"tick\",\"log\"]",
+        PossibleValues: []string{},
+        ExampleLS:      "kinds => [\"stats\",\"log\"]",
+      },
+      &doc.ProcessorOption{
+        Name:           "Interval",
+        Alias:          "interval",
+        Doc:            "Use CRON or BITFAN notation to emit agents stats\nWhen omited, stats are emitted every 10 seconds",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "interval => \"@every 30s\"",
+      },
+      &doc.ProcessorOption{
+        Name:           "ExcludeSelf",
+        Alias:          "exclude_self",
+        Doc:            "Ignore lifecycle, tick and log events coming from the pipeline running this input",
+        Required:       false,
+        Type:           "bool",
+        DefaultValue:   "true",
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+    },
+  },
+  Ports: []*doc.ProcessorPort{},
+}
+}
\ No newline at end of file
@@ -0,0 +1,170 @@
+//go:generate bitfanDoc
+// Produce events from bitfan's internals : periodic agents stats, pipelines
+// lifecycle changes, scheduler ticks and error log entries.
+//
+// Each event has a `kind` field with one of "stats", "pipeline", "agent", "tick", "log" value.
+package monitoringinput
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vjeantet/bitfan/core/monitor"
+	"github.com/vjeantet/bitfan/processors"
+)
+
+func New() processors.Processor {
+	return &processor{opt: &options{}}
+}
+
+type options struct {
+	processors.CommonOptions `mapstructure:",squash"`
+
+	// Kinds of events to produce
+	// @Default ["stats","pipeline","agent","tick","log"]
+	// @ExampleLS kinds => ["stats","log"]
+	Kinds []string `mapstructure:"kinds"`
+
+	// Use CRON or BITFAN notation to emit agents stats
+	// When omited, stats are emitted every 10 seconds
+	// @ExampleLS interval => "@every 30s"
+	Interval string `mapstructure:"interval"`
+
+	// Ignore lifecycle, tick and log events coming from the pipeline running this input
+	// @Default true
+	ExcludeSelf bool `mapstructure:"exclude_self"`
+}
+
+type processor struct {
+	processors.Base
+	opt *options
+
+	sub       *monitor.Subscription
+	stats     bool
+	lastStats map[string]monitor.AgentStats
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	done      chan bool
+}
+
+func (p *processor) MaxConcurent() int { return 1 }
+
+func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) error {
+	defaults := options{
+		Kinds: []string{
+			monitor.KIND_STATS,
+			monitor.KIND_PIPELINE,
+			monitor.KIND_AGENT,
+			monitor.KIND_TICK,
+			monitor.KIND_LOG,
+		},
+		ExcludeSelf: true,
+	}
+	p.opt = &defaults
+	return p.ConfigureAndValidate(ctx, conf, p.opt)
+}
+
+func (p *processor) Start(e processors.IPacket) error {
+	p.lastStats = map[string]monitor.AgentStats{}
+	p.done = make(chan bool)
+
+	kinds := []string{}
+	for _, k := range p.opt.Kinds {
+		if k == monitor.KIND_STATS {
+			p.stats = true
+			continue
+		}
+		kinds = append(kinds, k)
+	}
+
+	// stats are collected only while someone subscribes
+	p.sub = monitor.Subscribe(1000, kinds...)
+	p.wg.Add(1)
+	go p.listen()
+
+	if p.stats && p.opt.Interval == "" {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			ticker := time.NewTicker(10 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					p.Tick(nil)
+				case <-p.done:
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// listen forwards internal events as bitfan events
+func (p *processor) listen() {
+	defer p.wg.Done()
+	for me := range p.sub.C {
+		if p.opt.ExcludeSelf && me.Fields["pipeline_uuid"] == p.PipelineUUID {
+			continue
+		}
+		fields := map[string]interface{}{}
+		for k, v := range me.Fields {
+			fields[k] = v
+		}
+		fields["kind"] = me.Kind
+		fields["@timestamp"] = me.Time
+		if _, ok := fields["message"]; !ok {
+			fields["message"] = ""
+		}
+		p.send(fields)
+	}
+}
+
+// Tick emits one stats event per agent
+func (p *processor) Tick(e processors.IPacket) error {
+	if !p.stats {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range monitor.Snapshot() {
+		last := p.lastStats[s.Pipeline+"/"+s.Agent]
+		p.lastStats[s.Pipeline+"/"+s.Agent] = s
+
+		inDelta := s.EventsIn - last.EventsIn
+		latency := 0.0
+		if inDelta > 0 {
+			latency = float64(s.Latency-last.Latency) / float64(inDelta) / float64(time.Millisecond)
+		}
+
+		p.send(map[string]interface{}{
+			"kind":             monitor.KIND_STATS,
+			"message":          "",
+			"pipeline_label":   s.Pipeline,
+			"processor_label":  s.Agent,
+			"events_in":        s.EventsIn,
+			"events_out":       s.EventsOut,
+			"events_in_delta":  inDelta,
+			"events_out_delta": s.EventsOut - last.EventsOut,
+			"dropped":          s.Dropped,
+			"queue_depth":      s.QueueDepth,
+			"latency_ms":       latency,
+		})
+	}
+	return nil
+}
+
+func (p *processor) send(fields map[string]interface{}) {
+	e := p.NewPacket(fields)
+	p.opt.ProcessCommonOptions(e.Fields())
+	p.Send(e)
+}
+
+func (p *processor) Stop(e processors.IPacket) error {
+	close(p.done)
+	p.sub.Close()
+	p.wg.Wait()
+	return nil
+}
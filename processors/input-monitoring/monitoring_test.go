@@ -0,0 +1,49 @@
+package monitoringinput
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/core/monitor"
+	"github.com/vjeantet/bitfan/processors/doc"
+	"github.com/vjeantet/bitfan/processors/testutils"
+)
+
+func TestNew(t *testing.T) {
+	p := New()
+	_, ok := p.(*processor)
+	assert.Equal(t, ok, true, "New() should return a processor")
+}
+func TestDoc(t *testing.T) {
+	assert.IsType(t, &doc.Processor{}, New().(*processor).Doc())
+}
+func TestMaxConcurent(t *testing.T) {
+	max := New().(*processor).MaxConcurent()
+	assert.Equal(t, 1, max, "this processor does not support concurency")
+}
+
+func TestPublishedEvents(t *testing.T) {
+	p := New().(*processor)
+	ctx := testutils.NewProcessorContext()
+	conf := map[string]interface{}{
+		"kinds":    []string{"pipeline"},
+		"interval": "@every 1h",
+	}
+	assert.NoError(t, p.Configure(ctx, conf), "configuration is correct, error should be nil")
+	assert.NoError(t, p.Start(nil))
+	assert.True(t, monitor.Active())
+
+	monitor.Publish(monitor.KIND_TICK, map[string]interface{}{"pipeline_uuid": "other"})
+	monitor.Publish(monitor.KIND_PIPELINE, map[string]interface{}{"pipeline_uuid": "other", "action": "started"})
+
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, p.Stop(nil))
+	assert.False(t, monitor.Active())
+
+	if assert.Equal(t, 1, ctx.SentPacketsCount(0)) {
+		e := ctx.SentPackets(0)[0]
+		assert.Equal(t, "pipeline", e.Fields().ValueOrEmptyForPathString("kind"))
+		assert.Equal(t, "started", e.Fields().ValueOrEmptyForPathString("action"))
+	}
+}
@@ -39,6 +39,7 @@ type options struct {
 
 type processor struct {
 	processors.Base
+	processors.HealthTracker
 
 	opt *options
 
@@ -88,7 +89,8 @@ func (p *processor) Start(e processors.IPacket) error {
 
 	p.s.Boot()
 
-	go func(channel syslog.LogPartsChannel) {
+	channel := p.ch
+	p.Watch(func() error {
 		for message := range channel {
 			// Use syslog timestamp as @timestamp field, with correct format
 			message["@timestamp"] = message["timestamp"].(time.Time)
@@ -98,7 +100,8 @@ func (p *processor) Start(e processors.IPacket) error {
 			p.opt.ProcessCommonOptions(ne.Fields())
 			p.Send(ne)
 		}
-	}(p.ch)
+		return nil
+	})
 
 	return nil
 }
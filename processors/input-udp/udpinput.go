@@ -2,6 +2,7 @@
 package udpinput
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
@@ -21,6 +22,7 @@ type options struct {
 
 type processor struct {
 	processors.Base
+	processors.HealthTracker
 
 	opt *options
 	uc  *net.UDPConn
@@ -57,14 +59,18 @@ func (p *processor) Start(e processors.IPacket) error {
 	}
 	p.uc = udpSock
 
-	go func(p *processor, conn *net.UDPConn) {
+	conn := p.uc
+	p.Watch(func() error {
 		buf := make([]byte, 65536)
 
 		for {
 			buflen, saddr, err := conn.ReadFromUDP(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
 			if err != nil {
 				p.Logger.Errorf("ReadFromUDP: %v input-udp goroutine exiting", err)
-				return
+				return err
 			}
 			ne := p.NewPacket(map[string]interface{}{
 				"message": string(buf[:buflen]),
@@ -74,7 +80,7 @@ func (p *processor) Start(e processors.IPacket) error {
 			p.opt.ProcessCommonOptions(ne.Fields())
 			p.Send(ne)
 		}
-	}(p, p.uc)
+	})
 
 	return nil
 }
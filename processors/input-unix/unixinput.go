@@ -2,6 +2,7 @@
 package unixinput
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -44,6 +45,7 @@ type options struct {
 
 type processor struct {
 	processors.Base
+	processors.HealthTracker
 
 	opt *options
 	ln  *net.UnixListener
@@ -92,22 +94,28 @@ func (p *processor) Start(e processors.IPacket) error {
 		if err := p.startServer(); err != nil {
 			return err
 		}
-		go func() {
+		ln := p.ln
+		p.Watch(func() error {
 			for {
-				conn, err := p.ln.AcceptUnix()
+				conn, err := ln.AcceptUnix()
+				if errors.Is(err, net.ErrClosed) {
+					return nil
+				}
 				if err != nil {
 					netErr, ok := err.(net.Error)
 					//If this is a timeout, then continue to wait for new connections
 					if ok && netErr.Timeout() && netErr.Temporary() {
 						continue
 					}
+					p.Logger.Errorf("AcceptUnix: %v input-unix goroutine exiting", err)
+					return err
 				}
 				if p.opt.DataTimeout > 0 {
 					conn.SetReadDeadline(time.Now().Add(p.opt.DataTimeout * time.Second))
 				}
 				go p.parse(conn)
 			}
-		}()
+		})
 	case "client":
 		go func() {
 			for {
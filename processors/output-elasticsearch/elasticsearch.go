@@ -21,6 +21,7 @@ func New() processors.Processor {
 
 type processor struct {
 	processors.Base
+	processors.HealthTracker
 
 	bulkProcessor6 *els6.BulkProcessor
 	client6        *els6.Client
@@ -208,11 +209,18 @@ RECONNECT:
 	}
 
 	if err != nil {
+		p.Failure(err)
 		return err
 	}
+	p.SetConnected(true)
+
 	fn := func(executionId int64, requests []els6.BulkableRequest, response *els6.BulkResponse, err error) {
 		p.Logger.Debugf("commited %d requests ", len(requests))
-
+		p.trackBulk(err, response != nil && response.Errors)
+	}
+	fn5 := func(executionId int64, requests []els5.BulkableRequest, response *els5.BulkResponse, err error) {
+		p.Logger.Debugf("commited %d requests ", len(requests))
+		p.trackBulk(err, response != nil && response.Errors)
 	}
 
 	switch p.opt.Version {
@@ -228,12 +236,26 @@ RECONNECT:
 			BulkActions(p.opt.FlushCount).
 			BulkSize(p.opt.FlushSize).
 			FlushInterval(time.Duration(p.opt.IdleFlushTime) * time.Second).
+			After(fn5).
 			Do(context.Background())
 	}
 
 	return err
 }
 
+// trackBulk updates the processor health with the result of a bulk request
+func (p *processor) trackBulk(err error, hasErrors bool) {
+	switch {
+	case err != nil:
+		p.SetConnected(false)
+		p.Failure(err)
+	case hasErrors:
+		p.Failure(fmt.Errorf("bulk request failed for some documents"))
+	default:
+		p.Success()
+	}
+}
+
 func (p *processor) checkIndex(name string) error {
 	// alreadyseen index ?
 	if p.lastIndex == name {
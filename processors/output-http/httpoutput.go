@@ -28,6 +28,7 @@ type processor struct {
 	httpClient *http.Client
 	muster     muster.Client
 	processors.Base
+	processors.HealthTracker
 	enc      codecs.Encoder
 	opt      *options
 	shutdown chan struct{}
@@ -203,9 +204,11 @@ func (b *batch) Fire(notifier muster.Notifier) {
 	for {
 		retry, err := b.send(body.Bytes())
 		if err == nil {
+			b.p.Success()
 			b.p.Logger.Debugf("Successfully sent %d messages", len(b.Items))
 			return
 		}
+		b.p.Failure(err)
 		if !retry {
 			b.p.Logger.Errorf("Lost %d messages. %v", len(b.Items), err)
 			return
@@ -15,3 +15,8 @@ type IPacket interface {
 type PacketBuilder func(map[string]interface{}) IPacket
 
 type PacketSender func(IPacket, ...int) bool
+
+// PORT_FAILURE is the port a processor sends the events it failed to process
+// to, they go through the on_failure block of the processor when it has one
+// and follow the main flow otherwise
+const PORT_FAILURE = -1
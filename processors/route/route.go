@@ -10,12 +10,8 @@
 package route
 
 import (
-	"fmt"
-
-	"reflect"
-
+	"github.com/vjeantet/bitfan/commons/expression"
 	"github.com/vjeantet/bitfan/processors"
-	"gopkg.in/Knetic/govaluate.v3"
 )
 
 const (
@@ -59,23 +55,34 @@ type processor struct {
 
 	opt *options
 
-	compiledExpression *govaluate.EvaluableExpression
+	compiledExpression *expression.Expression
 }
 
 func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) error {
 	p.opt = &options{
 		Fork: false,
 	}
-	return p.ConfigureAndValidate(ctx, conf, p.opt)
+	lines := expression.Lines(conf)
+	if err := p.ConfigureAndValidate(ctx, conf, p.opt); err != nil {
+		return err
+	}
+	if p.opt.Condition != "" {
+		x, err := expression.Compile(p.opt.Condition, lines["condition"])
+		if err != nil {
+			return err
+		}
+		p.compiledExpression = x
+	}
+	return nil
 }
 
 func (p *processor) Receive(e processors.IPacket) error {
 	result := true
 	if p.opt.Condition != "" {
 		var err error
-		result, err = p.assertExpressionWithFields(p.opt.Condition, e)
+		result, err = p.compiledExpression.Bool(*e.Fields())
 		if err != nil {
-			p.Logger.Errorf("When processor evaluation error : %v", err)
+			p.Logger.Errorf("Route processor evaluation error : %v", err)
 			return err
 		}
 	}
@@ -93,98 +100,3 @@ func (p *processor) Receive(e processors.IPacket) error {
 
 	return nil
 }
-
-func (p *processor) assertExpressionWithFields(expressionValue string, e processors.IPacket) (bool, error) {
-	expression, err := p.cacheExpression(expressionValue)
-	if err != nil {
-		return false, fmt.Errorf("conditional expression error : %v", err)
-	}
-	parameters := EvaluatedParameters{}
-	for _, v := range expression.Tokens() {
-		if v.Kind == govaluate.VARIABLE {
-			paramValue, err := e.Fields().ValueForPath(v.Value.(string))
-			if err != nil {
-				continue
-			}
-			parameters[v.Value.(string)] = paramValue
-		}
-	}
-	resultRaw, err := expression.Eval(parameters)
-
-	var result bool
-	switch resultRaw.(type) {
-	case bool:
-		result = resultRaw.(bool)
-	default:
-		result = true
-	}
-
-	return result, err
-}
-
-func (p *processor) cacheExpression(expressionValue string) (*govaluate.EvaluableExpression, error) {
-	if p.compiledExpression != nil {
-		return p.compiledExpression, nil
-	}
-
-	functions := map[string]govaluate.ExpressionFunction{
-
-		"bool": func(args ...interface{}) (interface{}, error) {
-			switch args[0].(type) {
-			case bool:
-				return args[0].(bool), nil
-			default:
-				return true, nil
-			}
-		},
-
-		"len": func(args ...interface{}) (interface{}, error) {
-			switch reflect.TypeOf(args[0]).Kind() {
-
-			case reflect.Slice:
-				v := reflect.ValueOf(args[0])
-				return (float64)(v.Len()), nil
-
-			case reflect.String:
-				length := len(args[0].(string))
-				return (float64)(length), nil
-
-			default:
-				return (float64)(1), nil
-			}
-		},
-	}
-
-	var err error
-	p.compiledExpression, err = govaluate.NewEvaluableExpressionWithFunctions(expressionValue, functions)
-	if err != nil {
-		return nil, err
-	}
-
-	return p.compiledExpression, nil
-}
-
-type EvaluatedParameters map[string]interface{}
-
-func (ep EvaluatedParameters) Get(key string) (interface{}, error) {
-	value, found := ep[key]
-
-	// return `false` if parameter does not exist or value is nil
-	if !found || value == nil {
-		return false, nil
-	}
-
-	// return []interface{} if parameter is a slice of non-interface type
-	// this is needed for govaluate to work with slices
-	if reflect.TypeOf(value).Kind() == reflect.Slice {
-		s := reflect.ValueOf(value)
-		interfaceSlice := make([]interface{}, s.Len())
-
-		for i := 0; i < s.Len(); i++ {
-			interfaceSlice[i] = s.Index(i).Interface()
-		}
-		return interfaceSlice, nil
-	}
-
-	return value, nil
-}
@@ -5,6 +5,7 @@ import "github.com/vjeantet/bitfan/processors/doc"
 
 func (p *processor) Doc() *doc.Processor {
 	return &doc.Processor{
+  Behavior:   "",
   Name:       "webfan",
   ImportPath: "github.com/vjeantet/bitfan/processors/webfan",
   Doc:        "Example\n```\ninput{\n  webhook{\n        uri => \"toto/titi\"\n        pipeline=> \"test.conf\"\n        codec => plain{\n            role => \"decoder\"\n        }\n        codec => plain{\n            role => \"encoder\"\n            format=> \"<h1>Hello {{.request.querystring.name}}</h1>\"\n        }\n        headers => {\n            \"Content-Type\" => \"text/html\"\n        }\n    }\n}\n```",
@@ -22,6 +23,113 @@ func (p *processor) Doc() *doc.Processor {
         PossibleValues: []string{},
         ExampleLS:      "",
       },
+      &doc.ProcessorOption{
+        Name:           "HmacSecret",
+        Alias:          "hmac_secret",
+        Doc:            "Shared secret used to verify the HMAC signature of the request's body",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "HmacStyle",
+        Alias:          "hmac_style",
+        Doc:            "Signature format : \"github\" (sha256=<hex>), \"stripe\" (t=<timestamp>,v1=<hex>)\nor \"hex\" (<hex>)",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   "\"github\"",
+        PossibleValues: []string{
+          "\"github\"",
+          "\"stripe\"",
+          "\"hex\"",
+        },
+        ExampleLS: "",
+      },
+      &doc.ProcessorOption{
+        Name:           "HmacHeader",
+        Alias:          "hmac_header",
+        Doc:            "Header holding the signature, default is X-Hub-Signature-256 (github),\nStripe-Signature (stripe) or X-Signature (hex)",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "HmacAlgorithm",
+        Alias:          "hmac_algorithm",
+        Doc:            "Hash function of the signature",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   "\"sha256\"",
+        PossibleValues: []string{
+          "\"sha256\"",
+          "\"sha1\"",
+        },
+        ExampleLS: "",
+      },
+      &doc.ProcessorOption{
+        Name:           "BearerToken",
+        Alias:          "bearer_token",
+        Doc:            "Token expected in the \"Authorization: Bearer <token>\" header",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "BasicUser",
+        Alias:          "basic_user",
+        Doc:            "User expected with basic auth",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "BasicPassword",
+        Alias:          "basic_password",
+        Doc:            "Password expected with basic auth",
+        Required:       false,
+        Type:           "string",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "IpAllow",
+        Alias:          "ip_allow",
+        Doc:            "IPs or CIDR networks allowed to call the hook",
+        Required:       false,
+        Type:           "array",
+        DefaultValue:   nil,
+        PossibleValues: []string{},
+        ExampleLS:      "ip_allow => [\"10.0.0.0/8\", \"192.168.1.12\"]",
+      },
+      &doc.ProcessorOption{
+        Name:           "RateLimit",
+        Alias:          "rate_limit",
+        Doc:            "Maximum number of requests per second, 0 means no limit",
+        Required:       false,
+        Type:           "float64",
+        DefaultValue:   "0",
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
+      &doc.ProcessorOption{
+        Name:           "RateBurst",
+        Alias:          "rate_burst",
+        Doc:            "Number of requests accepted in a burst over rate_limit",
+        Required:       false,
+        Type:           "int",
+        DefaultValue:   "1",
+        PossibleValues: []string{},
+        ExampleLS:      "",
+      },
       &doc.ProcessorOption{
         Name:           "Codec",
         Alias:          "",
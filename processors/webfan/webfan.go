@@ -39,6 +39,9 @@ func New() processors.Processor {
 type options struct {
 	processors.CommonOptions `mapstructure:",squash"`
 
+	// Protections of the hook
+	processors.WebHookOptions `mapstructure:",squash"`
+
 	// The codec used for posted data. Input codecs are a convenient method for decoding
 	// your data before it enters the pipeline, without needing a separate filter in your bitfan pipeline
 	//
@@ -64,9 +67,10 @@ type options struct {
 type processor struct {
 	processors.Base
 
-	opt *options
-	wg  *sync.WaitGroup
-	ep  *entrypoint.Entrypoint
+	opt   *options
+	wg    *sync.WaitGroup
+	ep    *entrypoint.Entrypoint
+	guard *processors.WebHookGuard
 }
 
 func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) error {
@@ -85,11 +89,16 @@ func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]i
 		p.opt.Codec.Dec = codecs.New("plain", nil, ctx.Log(), ctx.ConfigWorkingLocation())
 	}
 
+	if p.guard, err = processors.NewWebHookGuard(p.opt.WebHookOptions, p.Logger); err != nil {
+		return err
+	}
+
 	return err
 }
 func (p *processor) Start(e processors.IPacket) error {
 	p.wg = &sync.WaitGroup{}
-	p.WebHook.AddShort(p.opt.Uri, p.HttpHandler)
+	p.WebHook.Protect(p.guard.Protections())
+	p.WebHook.AddShort(p.opt.Uri, p.guard.Wrap(p.HttpHandler))
 
 	var err error
 	p.ep, err = entrypoint.New(p.opt.Pipeline, p.ConfigWorkingLocation, entrypoint.CONTENT_REF)
@@ -5,5 +5,7 @@ import "net/http"
 type WebHook interface {
 	Add(string, http.HandlerFunc)
 	AddShort(string, http.HandlerFunc)
+	// Protect sets the names of the protections guarding the hooks added after the call
+	Protect([]string)
 	Unregister()
 }
@@ -0,0 +1,339 @@
+package processors
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protections of a hook
+const (
+	WEBHOOK_PROTECTION_HMAC       = "hmac"
+	WEBHOOK_PROTECTION_BEARER     = "bearer"
+	WEBHOOK_PROTECTION_BASIC      = "basic"
+	WEBHOOK_PROTECTION_IP_ALLOW   = "ip_allow"
+	WEBHOOK_PROTECTION_RATE_LIMIT = "rate_limit"
+)
+
+// max age of a stripe signature's timestamp
+const stripeTolerance = 5 * time.Minute
+
+// max size of a body read to verify its signature
+const maxSignedBodySize = 10 << 20
+
+// WebHookOptions are options protecting the hooks of a processor, all
+// enabled protections must pass for a request to be handled
+type WebHookOptions struct {
+	// Shared secret used to verify the HMAC signature of the request's body
+	HmacSecret string `mapstructure:"hmac_secret"`
+
+	// Signature format : "github" (sha256=<hex>), "stripe" (t=<timestamp>,v1=<hex>)
+	// or "hex" (<hex>)
+	// @Default "github"
+	// @Enum "github","stripe","hex"
+	HmacStyle string `mapstructure:"hmac_style"`
+
+	// Header holding the signature, default is X-Hub-Signature-256 (github),
+	// Stripe-Signature (stripe) or X-Signature (hex)
+	HmacHeader string `mapstructure:"hmac_header"`
+
+	// Hash function of the signature
+	// @Default "sha256"
+	// @Enum "sha256","sha1"
+	HmacAlgorithm string `mapstructure:"hmac_algorithm"`
+
+	// Token expected in the "Authorization: Bearer <token>" header
+	BearerToken string `mapstructure:"bearer_token"`
+
+	// User expected with basic auth
+	BasicUser string `mapstructure:"basic_user"`
+
+	// Password expected with basic auth
+	BasicPassword string `mapstructure:"basic_password"`
+
+	// IPs or CIDR networks allowed to call the hook
+	// @ExampleLS ip_allow => ["10.0.0.0/8", "192.168.1.12"]
+	IpAllow []string `mapstructure:"ip_allow"`
+
+	// Maximum number of requests per second, 0 means no limit
+	// @Default 0
+	RateLimit float64 `mapstructure:"rate_limit"`
+
+	// Number of requests accepted in a burst over rate_limit
+	// @Default 1
+	RateBurst int `mapstructure:"rate_burst"`
+}
+
+// WebHookGuard checks requests according to WebHookOptions
+type WebHookGuard struct {
+	opt      WebHookOptions
+	logger   Logger
+	hashFunc func() hash.Hash
+	networks []*net.IPNet
+	limiter  *rateLimiter
+}
+
+// NewWebHookGuard validates options and returns the guard
+func NewWebHookGuard(opt WebHookOptions, logger Logger) (*WebHookGuard, error) {
+	g := &WebHookGuard{opt: opt, logger: logger}
+
+	if opt.HmacSecret != "" {
+		switch g.opt.HmacStyle {
+		case "", "github":
+			g.opt.HmacStyle = "github"
+			if g.opt.HmacHeader == "" {
+				g.opt.HmacHeader = "X-Hub-Signature-256"
+				if opt.HmacAlgorithm == "sha1" {
+					g.opt.HmacHeader = "X-Hub-Signature"
+				}
+			}
+		case "stripe":
+			if g.opt.HmacHeader == "" {
+				g.opt.HmacHeader = "Stripe-Signature"
+			}
+		case "hex":
+			if g.opt.HmacHeader == "" {
+				g.opt.HmacHeader = "X-Signature"
+			}
+		default:
+			return nil, fmt.Errorf("unknown hmac_style %s", opt.HmacStyle)
+		}
+
+		switch opt.HmacAlgorithm {
+		case "", "sha256":
+			g.opt.HmacAlgorithm = "sha256"
+			g.hashFunc = sha256.New
+		case "sha1":
+			g.hashFunc = sha1.New
+		default:
+			return nil, fmt.Errorf("unknown hmac_algorithm %s", opt.HmacAlgorithm)
+		}
+	}
+
+	if (opt.BasicUser == "") != (opt.BasicPassword == "") {
+		return nil, fmt.Errorf("basic_user and basic_password must be set together")
+	}
+
+	for _, a := range opt.IpAllow {
+		if !strings.Contains(a, "/") {
+			if strings.Contains(a, ":") {
+				a = a + "/128"
+			} else {
+				a = a + "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip_allow %s : %v", a, err)
+		}
+		g.networks = append(g.networks, n)
+	}
+
+	if opt.RateLimit < 0 {
+		return nil, fmt.Errorf("rate_limit can not be negative")
+	}
+	if opt.RateLimit > 0 {
+		burst := opt.RateBurst
+		if burst < 1 {
+			burst = 1
+		}
+		g.limiter = newRateLimiter(opt.RateLimit, burst)
+	}
+
+	return g, nil
+}
+
+// Protections returns the names of the enabled protections
+func (g *WebHookGuard) Protections() []string {
+	protections := []string{}
+	if g.opt.HmacSecret != "" {
+		protections = append(protections, WEBHOOK_PROTECTION_HMAC)
+	}
+	if g.opt.BearerToken != "" {
+		protections = append(protections, WEBHOOK_PROTECTION_BEARER)
+	}
+	if g.opt.BasicUser != "" {
+		protections = append(protections, WEBHOOK_PROTECTION_BASIC)
+	}
+	if len(g.networks) > 0 {
+		protections = append(protections, WEBHOOK_PROTECTION_IP_ALLOW)
+	}
+	if g.limiter != nil {
+		protections = append(protections, WEBHOOK_PROTECTION_RATE_LIMIT)
+	}
+	return protections
+}
+
+// Wrap returns a handler calling hf only for requests passing all protections
+func (g *WebHookGuard) Wrap(hf http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if code, err := g.check(w, r); err != nil {
+			g.logger.Warnf("webhook request from %s rejected : %v", r.RemoteAddr, err)
+			if code == http.StatusUnauthorized && g.opt.BasicUser != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="bitfan"`)
+			}
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		hf(w, r)
+	}
+}
+
+func (g *WebHookGuard) check(w http.ResponseWriter, r *http.Request) (int, error) {
+	if len(g.networks) > 0 && !g.allowedIP(r.RemoteAddr) {
+		return http.StatusForbidden, fmt.Errorf("ip not allowed")
+	}
+
+	if g.limiter != nil && !g.limiter.allow() {
+		return http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded")
+	}
+
+	if g.opt.BearerToken != "" {
+		// the scheme is case insensitive, the token is not
+		auth := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+		if len(auth) != 2 || !strings.EqualFold(auth[0], "Bearer") ||
+			subtle.ConstantTimeCompare([]byte(auth[1]), []byte(g.opt.BearerToken)) != 1 {
+			return http.StatusUnauthorized, fmt.Errorf("invalid bearer token")
+		}
+	}
+
+	if g.opt.BasicUser != "" {
+		user, password, _ := r.BasicAuth()
+		if subtle.ConstantTimeCompare([]byte(user), []byte(g.opt.BasicUser)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(g.opt.BasicPassword)) != 1 {
+			return http.StatusUnauthorized, fmt.Errorf("invalid basic auth credentials")
+		}
+	}
+
+	if g.opt.HmacSecret != "" {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+		if _, tooLarge := err.(*http.MaxBytesError); tooLarge {
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("body exceeds %d bytes", maxSignedBodySize)
+		}
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if err := g.verifySignature(r.Header.Get(g.opt.HmacHeader), body); err != nil {
+			return http.StatusUnauthorized, err
+		}
+	}
+
+	return 0, nil
+}
+
+func (g *WebHookGuard) allowedIP(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range g.networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *WebHookGuard) sign(payload []byte) string {
+	mac := hmac.New(g.hashFunc, []byte(g.opt.HmacSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (g *WebHookGuard) verifySignature(signature string, body []byte) error {
+	if signature == "" {
+		return fmt.Errorf("missing signature header %s", g.opt.HmacHeader)
+	}
+
+	var expected string
+	switch g.opt.HmacStyle {
+	case "github":
+		expected = g.opt.HmacAlgorithm + "=" + g.sign(body)
+	case "hex":
+		expected = g.sign(body)
+	case "stripe":
+		var timestamp string
+		var signatures []string
+		for _, part := range strings.Split(signature, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "t":
+				timestamp = kv[1]
+			case "v1":
+				signatures = append(signatures, kv[1])
+			}
+		}
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid signature timestamp")
+		}
+		if age := time.Since(time.Unix(ts, 0)); age > stripeTolerance || age < -stripeTolerance {
+			return fmt.Errorf("signature timestamp out of tolerance")
+		}
+		expected = g.sign(append([]byte(timestamp+"."), body...))
+		for _, s := range signatures {
+			if hmac.Equal([]byte(s), []byte(expected)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid signature")
+	}
+
+	if !hmac.Equal([]byte(strings.TrimSpace(signature)), []byte(expected)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// rateLimiter is a token bucket refilled with rate tokens per second
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (l *rateLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,141 @@
+package processors
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func guardedRecorder(t *testing.T, opt WebHookOptions, r *http.Request) *httptest.ResponseRecorder {
+	g, err := NewWebHookGuard(opt, logrus.New())
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	g.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})(w, r)
+	return w
+}
+
+func signature(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebHookGuardOpen(t *testing.T) {
+	g, err := NewWebHookGuard(WebHookOptions{}, logrus.New())
+	assert.NoError(t, err)
+	assert.Empty(t, g.Protections())
+
+	w := guardedRecorder(t, WebHookOptions{}, httptest.NewRequest("POST", "/h/p/events", strings.NewReader("data")))
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestWebHookGuardHmacGithub(t *testing.T) {
+	opt := WebHookOptions{HmacSecret: "secret"}
+
+	r := httptest.NewRequest("POST", "/h/p/events", strings.NewReader("data"))
+	r.Header.Set("X-Hub-Signature-256", "sha256="+signature("secret", "data"))
+	w := guardedRecorder(t, opt, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "data", w.Body.String(), "body is still readable by the handler")
+
+	r = httptest.NewRequest("POST", "/h/p/events", strings.NewReader("data"))
+	r.Header.Set("X-Hub-Signature-256", "sha256="+signature("other", "data"))
+	assert.Equal(t, 401, guardedRecorder(t, opt, r).Code)
+
+	r = httptest.NewRequest("POST", "/h/p/events", strings.NewReader("data"))
+	assert.Equal(t, 401, guardedRecorder(t, opt, r).Code)
+}
+
+func TestWebHookGuardHmacBodySize(t *testing.T) {
+	opt := WebHookOptions{HmacSecret: "secret"}
+	payload := strings.Repeat("a", maxSignedBodySize)
+
+	r := httptest.NewRequest("POST", "/h/p/events", strings.NewReader(payload))
+	r.Header.Set("X-Hub-Signature-256", "sha256="+signature("secret", payload))
+	assert.Equal(t, 200, guardedRecorder(t, opt, r).Code)
+
+	r = httptest.NewRequest("POST", "/h/p/events", strings.NewReader(payload+"a"))
+	r.Header.Set("X-Hub-Signature-256", "sha256="+signature("secret", payload+"a"))
+	assert.Equal(t, 413, guardedRecorder(t, opt, r).Code)
+}
+
+func TestWebHookGuardHmacStripe(t *testing.T) {
+	opt := WebHookOptions{HmacSecret: "secret", HmacStyle: "stripe"}
+	ts := fmt.Sprintf("%d", time.Now().Unix())
+
+	r := httptest.NewRequest("POST", "/h/p/events", strings.NewReader("data"))
+	r.Header.Set("Stripe-Signature", "t="+ts+",v1="+signature("secret", ts+".data"))
+	assert.Equal(t, 200, guardedRecorder(t, opt, r).Code)
+
+	old := fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix())
+	r = httptest.NewRequest("POST", "/h/p/events", strings.NewReader("data"))
+	r.Header.Set("Stripe-Signature", "t="+old+",v1="+signature("secret", old+".data"))
+	assert.Equal(t, 401, guardedRecorder(t, opt, r).Code)
+}
+
+func TestWebHookGuardBearerAndBasic(t *testing.T) {
+	r := httptest.NewRequest("GET", "/h/p/events", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	assert.Equal(t, 200, guardedRecorder(t, WebHookOptions{BearerToken: "token"}, r).Code)
+	r.Header.Set("Authorization", "bearer token")
+	assert.Equal(t, 200, guardedRecorder(t, WebHookOptions{BearerToken: "token"}, r).Code)
+	for _, auth := range []string{"Bearer bad", "token", "Basic token", "Bearertoken", "Bearer ", ""} {
+		r.Header.Set("Authorization", auth)
+		assert.Equal(t, 401, guardedRecorder(t, WebHookOptions{BearerToken: "token"}, r).Code, auth)
+	}
+
+	opt := WebHookOptions{BasicUser: "user", BasicPassword: "pass"}
+	r = httptest.NewRequest("GET", "/h/p/events", nil)
+	r.SetBasicAuth("user", "pass")
+	assert.Equal(t, 200, guardedRecorder(t, opt, r).Code)
+	r.SetBasicAuth("user", "bad")
+	w := guardedRecorder(t, opt, r)
+	assert.Equal(t, 401, w.Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	_, err := NewWebHookGuard(WebHookOptions{BasicUser: "user"}, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestWebHookGuardIpAllow(t *testing.T) {
+	opt := WebHookOptions{IpAllow: []string{"10.0.0.0/8", "192.168.1.12"}}
+
+	r := httptest.NewRequest("GET", "/h/p/events", nil)
+	r.RemoteAddr = "10.1.2.3:4567"
+	assert.Equal(t, 200, guardedRecorder(t, opt, r).Code)
+	r.RemoteAddr = "192.168.1.12:4567"
+	assert.Equal(t, 200, guardedRecorder(t, opt, r).Code)
+	r.RemoteAddr = "192.168.1.13:4567"
+	assert.Equal(t, 403, guardedRecorder(t, opt, r).Code)
+
+	_, err := NewWebHookGuard(WebHookOptions{IpAllow: []string{"nope"}}, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestWebHookGuardRateLimit(t *testing.T) {
+	g, err := NewWebHookGuard(WebHookOptions{RateLimit: 1, RateBurst: 2}, logrus.New())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{WEBHOOK_PROTECTION_RATE_LIMIT}, g.Protections())
+
+	h := g.Wrap(func(w http.ResponseWriter, r *http.Request) {})
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", "/h/p/events", nil))
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{200, 200, 429}, codes)
+}
@@ -34,6 +34,8 @@ func TestExpressionEvaluation(t *testing.T) {
 	checkTrue(t, event, `"foo" in ("foor", "foo","bar")`)
 	checkTrue(t, event, `!("foo"  in ("foos", "sfoo","bar"))`)
 	checkTrue(t, event, `[way] =~ '(RECEIVE|SEND)'`)
+	checkTrue(t, event, `is_null([testUnk]) && contains([tags], '_grokparsefailure')`)
+	checkTrue(t, event, `lower([way]) == 'send' && len([tags]) == 3`)
 	checkFalse(t, event, `!(true)`)
 	checkFalse(t, event, `"grokparsefailure" in [tags]`)
 	checkFalse(t, event, `"_mumu" in [tags]`)
@@ -2,14 +2,12 @@
 package when
 
 import (
-	"fmt"
-	"reflect"
 	"strconv"
 
 	"golang.org/x/sync/syncmap"
 
+	"github.com/vjeantet/bitfan/commons/expression"
 	"github.com/vjeantet/bitfan/processors"
-	"gopkg.in/Knetic/govaluate.v3"
 )
 
 type processor struct {
@@ -17,14 +15,14 @@ type processor struct {
 
 	opt                 *options
 	compiledExpressions *syncmap.Map
+	// configuration lines of expressions by index
+	lines map[string]int
 }
 
 type options struct {
 	Expressions map[int]string
 }
 
-type EvaluatedParameters map[string]interface{}
-
 func New() processors.Processor {
 	return &processor{
 		compiledExpressions: &syncmap.Map{},
@@ -33,6 +31,7 @@ func New() processors.Processor {
 }
 
 func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]interface{}) error {
+	p.lines = expression.Lines(conf)
 	switch v := conf["expressions"].(type) {
 	case map[string]interface{}:
 		conf["expressions"] = map[int]string{}
@@ -41,7 +40,17 @@ func (p *processor) Configure(ctx processors.ProcessorContext, conf map[string]i
 			conf["expressions"].(map[int]string)[ki] = e.(string)
 		}
 	}
-	return p.ConfigureAndValidate(ctx, conf, p.opt)
+	if err := p.ConfigureAndValidate(ctx, conf, p.opt); err != nil {
+		return err
+	}
+
+	// an invalid expression is never true, the pipeline still runs
+	for index, expressionValue := range p.opt.Expressions {
+		if _, err := p.cacheExpression(index, expressionValue); err != nil {
+			p.Logger.Warnf("When processor expression error : %v", err)
+		}
+	}
+	return nil
 }
 
 // comparison operators
@@ -65,7 +74,7 @@ func (p *processor) Receive(e processors.IPacket) error {
 		expressionValue := p.opt.Expressions[order]
 		result, err := p.assertExpressionWithFields(order, expressionValue, e)
 		if err != nil {
-			p.Logger.Warnf("When processor evaluation '%s' error : %v", expressionValue, err)
+			p.Logger.Warnf("When processor evaluation error : %v", err)
 			continue
 		}
 
@@ -78,114 +87,23 @@ func (p *processor) Receive(e processors.IPacket) error {
 }
 
 func (p *processor) assertExpressionWithFields(index int, expressionValue string, e processors.IPacket) (bool, error) {
-	expression, err := p.cacheExpression(index, expressionValue)
+	x, err := p.cacheExpression(index, expressionValue)
 	if err != nil {
-		return false, fmt.Errorf("conditional expression error : %v", err)
+		return false, err
 	}
-	parameters := EvaluatedParameters{}
-	for _, v := range expression.Tokens() {
-		if v.Kind == govaluate.VARIABLE {
-			paramValues, err := e.Fields().ValuesForPath(v.Value.(string))
-			if err != nil {
-				continue
-			}
-
-			var paramValue interface{}
-			switch len(paramValues) {
-			case 0:
-				paramValue = false
-			case 1:
-				paramValue = paramValues[0]
-			default:
-				paramValue = paramValues
-			}
-
-			parameters[v.Value.(string)] = paramValue
-		}
-	}
-
-	resultRaw, err := expression.Eval(parameters)
-
-	var result bool
-	switch resultRaw.(type) {
-	case bool:
-		result = resultRaw.(bool)
-	default:
-		result = true
-	}
-
-	return result, err
+	return x.Bool(*e.Fields())
 }
 
-func (p *processor) cacheExpression(index int, expressionValue string) (*govaluate.EvaluableExpression, error) {
-
-	if e, ok := p.compiledExpressions.Load(index); ok {
-		return e.(*govaluate.EvaluableExpression), nil
+func (p *processor) cacheExpression(index int, expressionValue string) (*expression.Expression, error) {
+	if x, ok := p.compiledExpressions.Load(index); ok {
+		return x.(*expression.Expression), nil
 	}
 
-	functions := map[string]govaluate.ExpressionFunction{
-
-		"bool": func(args ...interface{}) (interface{}, error) {
-			if len(args) == 0 {
-				return false, nil
-			}
-			switch args[0].(type) {
-			case bool:
-				return args[0].(bool), nil
-			default:
-				return true, nil
-			}
-		},
-
-		"len": func(args ...interface{}) (interface{}, error) {
-			if len(args) == 0 {
-				return float64(0), nil
-			}
-			switch reflect.TypeOf(args[0]).Kind() {
-
-			case reflect.Slice:
-				v := reflect.ValueOf(args[0])
-				return (float64)(v.Len()), nil
-
-			case reflect.String:
-				length := len(args[0].(string))
-				return (float64)(length), nil
-
-			default:
-				return (float64)(1), nil
-			}
-		},
-	}
-
-	expression, err := govaluate.NewEvaluableExpressionWithFunctions(expressionValue, functions)
+	x, err := expression.Compile(expressionValue, p.lines[strconv.Itoa(index)])
 	if err != nil {
 		return nil, err
 	}
+	p.compiledExpressions.Store(index, x)
 
-	p.compiledExpressions.Store(index, expression)
-
-	return expression, nil
-}
-
-func (ep EvaluatedParameters) Get(key string) (interface{}, error) {
-	value, found := ep[key]
-
-	// return `false` if parameter does not exist or value is nil
-	if !found || value == nil {
-		return false, nil
-	}
-
-	// return []interface{} if parameter is a slice of non-interface type
-	// this is needed for govaluate to work with slices
-	if reflect.TypeOf(value).Kind() == reflect.Slice {
-		s := reflect.ValueOf(value)
-		interfaceSlice := make([]interface{}, s.Len())
-
-		for i := 0; i < s.Len(); i++ {
-			interfaceSlice[i] = s.Index(i).Interface()
-		}
-		return interfaceSlice, nil
-	}
-
-	return value, nil
+	return x, nil
 }
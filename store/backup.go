@@ -0,0 +1,377 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	uuid "github.com/nu7hatch/gouuid"
+	"github.com/timshannon/bolthold"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/commons/depgraph"
+)
+
+// BACKUP_VERSION is the version of the backups format
+const BACKUP_VERSION = 1
+
+// Backup returns the stored pipelines with their assets, the envs and the xprocessors
+func (s *Store) Backup() models.Backup {
+	return models.Backup{
+		Version:     BACKUP_VERSION,
+		CreatedAt:   time.Now(),
+		Pipelines:   s.FindPipelines(true),
+		Envs:        s.FindEnvs(),
+		XProcessors: s.FindXProcessors(""),
+	}
+}
+
+// restoreOp writes a change of a restore
+type restoreOp func(tx *bolt.Tx) error
+
+// Restore stores the pipelines, envs and xprocessors of the backup and returns
+// the changes, nothing is changed in the store when dryRun is true.
+//
+// In merge mode items of the backup already stored are overwritten, skipped or,
+// for pipelines, imported with a new UUID according to conflict. In replace mode
+// they are overwritten and stored items missing from the backup are deleted.
+//
+// The changes are written in a single transaction, the store is left
+// unchanged when one of them fails.
+func (s *Store) Restore(b models.Backup, mode string, conflict string, dryRun bool) (models.RestoreReport, error) {
+	report := models.RestoreReport{
+		Mode:     mode,
+		Conflict: conflict,
+		DryRun:   dryRun,
+		Changes:  []models.RestoreChange{},
+	}
+
+	if mode != models.RESTORE_MERGE && mode != models.RESTORE_REPLACE {
+		return report, fmt.Errorf("unknown restore mode %s", mode)
+	}
+	if conflict != models.CONFLICT_OVERWRITE && conflict != models.CONFLICT_SKIP && conflict != models.CONFLICT_RENAME {
+		return report, fmt.Errorf("unknown conflict handling %s", conflict)
+	}
+	if err := b.Validate(); err != nil {
+		return report, err
+	}
+
+	ops := []restoreOp{}
+	if err := s.restorePipelines(b.Pipelines, &report, &ops); err != nil {
+		return report, err
+	}
+	s.restoreEnvs(b.Envs, &report, &ops)
+	s.restoreXProcessors(b.XProcessors, &report, &ops)
+	if dryRun {
+		return report, nil
+	}
+
+	if err := s.applyRestore(ops); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// applyRestore writes the changes of a restore in a single transaction
+func (s *Store) applyRestore(ops []restoreOp) error {
+	err := s.db.Bolt().Update(func(tx *bolt.Tx) error {
+		for _, op := range ops {
+			if err := op(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("nothing restored - %v", err)
+	}
+	// contents of the versions of deleted pipelines
+	if err := s.pruneAssetContents(); err != nil {
+		s.log.Error("Store : Restore - " + err.Error())
+	}
+	return nil
+}
+
+// conflictAction returns the action on an item of the backup already stored
+func conflictAction(mode string, conflict string) string {
+	switch {
+	case mode == models.RESTORE_REPLACE || conflict == models.CONFLICT_OVERWRITE:
+		return models.RESTORE_UPDATE
+	case conflict == models.CONFLICT_RENAME:
+		return models.RESTORE_RENAME
+	}
+	return models.RESTORE_SKIP
+}
+
+func (s *Store) restorePipelines(pipelines []models.Pipeline, report *models.RestoreReport, ops *[]restoreOp) error {
+	// dependencies of the pipelines once restored
+	stored := s.FindPipelines(false)
+	uuids := []string{}
+	deps := map[string][]string{}
+	for _, p := range stored {
+		uuids = append(uuids, p.Uuid)
+		deps[p.Uuid] = p.DependsOn
+	}
+	changed := []string{}
+
+	restored := map[string]bool{}
+	for _, p := range pipelines {
+		restored[p.Uuid] = true
+		change := models.RestoreChange{
+			Kind:   models.RESTORE_KIND_PIPELINE,
+			Uuid:   p.Uuid,
+			Label:  p.Label,
+			Action: models.RESTORE_CREATE,
+		}
+		current, err := s.FindOnePipelineByUUID(p.Uuid, false)
+		if err == nil {
+			change.Action = conflictAction(report.Mode, report.Conflict)
+		}
+		if change.Action == models.RESTORE_RENAME {
+			uid, _ := uuid.NewV4()
+			change.NewUuid = uid.String()
+			p.Uuid = change.NewUuid
+		}
+		report.Changes = append(report.Changes, change)
+
+		if change.Action == models.RESTORE_SKIP {
+			continue
+		}
+		if _, ok := deps[p.Uuid]; !ok {
+			uuids = append(uuids, p.Uuid)
+		}
+		deps[p.Uuid] = p.DependsOn
+		changed = append(changed, p.Uuid)
+		if report.DryRun {
+			continue
+		}
+
+		assets := make([]models.Asset, len(p.Assets))
+		keep := map[string]bool{}
+		for i, a := range p.Assets {
+			// an asset stored with the same UUID in another pipeline gets a new one
+			if stored, err := s.FindOneAssetByUUID(a.Uuid); a.Uuid == "" || change.Action == models.RESTORE_RENAME || (err == nil && stored.PipelineUUID != p.Uuid) {
+				uid, _ := uuid.NewV4()
+				a.Uuid = uid.String()
+			}
+			a.PipelineUUID = p.Uuid
+			a.Size = len(a.Value)
+			assets[i] = a
+			keep[a.Uuid] = true
+		}
+		p.Assets = assets
+
+		createdAt := time.Now()
+		obsolete := []string{}
+		if change.Action == models.RESTORE_UPDATE {
+			createdAt = current.CreatedAt
+			// stored assets missing from the backup
+			for _, a := range current.Assets {
+				if !keep[a.Uuid] {
+					obsolete = append(obsolete, a.Uuid)
+				}
+			}
+		}
+
+		sp, savs := storePipeline(&p, createdAt)
+		*ops = append(*ops, func(tx *bolt.Tx) error {
+			for _, assetUUID := range obsolete {
+				if err := s.db.TxDeleteMatching(tx, &StoreAsset{}, bolthold.Where(bolthold.Key).Eq(assetUUID)); err != nil {
+					return err
+				}
+			}
+			for _, sav := range savs {
+				if err := s.db.TxUpsert(tx, sav.Uuid, sav); err != nil {
+					return err
+				}
+			}
+			return s.db.TxUpsert(tx, sp.Uuid, sp)
+		})
+	}
+
+	if report.Mode != models.RESTORE_REPLACE {
+		return checkRestoredDependencies(uuids, deps, changed)
+	}
+	kept := []string{}
+	for _, id := range uuids {
+		if restored[id] {
+			kept = append(kept, id)
+		} else {
+			delete(deps, id)
+		}
+	}
+	if err := checkRestoredDependencies(kept, deps, changed); err != nil {
+		return err
+	}
+
+	for _, p := range stored {
+		if restored[p.Uuid] {
+			continue
+		}
+		report.Changes = append(report.Changes, models.RestoreChange{
+			Kind:   models.RESTORE_KIND_PIPELINE,
+			Uuid:   p.Uuid,
+			Label:  p.Label,
+			Action: models.RESTORE_DELETE,
+		})
+		pipelineUUID := p.Uuid
+		*ops = append(*ops, func(tx *bolt.Tx) error {
+			if err := s.db.TxDeleteMatching(tx, &StoreAsset{}, bolthold.Where("PipelineUUID").Eq(pipelineUUID)); err != nil {
+				return err
+			}
+			if err := s.db.TxDeleteMatching(tx, &StorePipelineVersion{}, bolthold.Where("PipelineUUID").Eq(pipelineUUID)); err != nil {
+				return err
+			}
+			return s.db.TxDelete(tx, pipelineUUID, &StorePipeline{})
+		})
+	}
+	return nil
+}
+
+// checkRestoredDependencies checks the pipelines the changed ones depend on
+// are restored or stored, and that pipelines do not depend on each other
+func checkRestoredDependencies(uuids []string, deps map[string][]string, changed []string) error {
+	for _, id := range changed {
+		for _, dep := range deps[id] {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("pipeline %s : depends_on pipeline %s not found", id, dep)
+			}
+		}
+	}
+	if _, err := depgraph.Sort(uuids, deps); err != nil {
+		return fmt.Errorf("depends_on : %v", err)
+	}
+	return nil
+}
+
+// restoreEnvs restores envs, an env is already stored when its UUID or its name is
+func (s *Store) restoreEnvs(envs []models.Env, report *models.RestoreReport, ops *[]restoreOp) {
+	stored := s.FindEnvs()
+	restored := map[string]bool{}
+	for _, e := range envs {
+		change := models.RestoreChange{
+			Kind:   models.RESTORE_KIND_ENV,
+			Uuid:   e.Uuid,
+			Label:  e.Name,
+			Action: models.RESTORE_CREATE,
+		}
+		restored[e.Uuid] = true
+
+		var current *models.Env
+		for i := range stored {
+			if stored[i].Uuid == e.Uuid || stored[i].Name == e.Name {
+				current = &stored[i]
+				restored[current.Uuid] = true
+				change.Action = conflictAction(report.Mode, report.Conflict)
+				break
+			}
+		}
+		// envs are identified by their name, they can not be renamed
+		if change.Action == models.RESTORE_RENAME {
+			change.Action = models.RESTORE_SKIP
+		}
+		report.Changes = append(report.Changes, change)
+
+		if report.DryRun || change.Action == models.RESTORE_SKIP {
+			continue
+		}
+		replaced := ""
+		if current != nil && current.Uuid != e.Uuid {
+			replaced = current.Uuid
+		}
+		se := storeEnv(&e)
+		*ops = append(*ops, func(tx *bolt.Tx) error {
+			if replaced != "" {
+				if err := s.db.TxDelete(tx, replaced, &StoreEnv{}); err != nil {
+					return err
+				}
+			}
+			return s.db.TxUpsert(tx, se.Uuid, se)
+		})
+	}
+
+	if report.Mode != models.RESTORE_REPLACE {
+		return
+	}
+	for _, e := range stored {
+		if restored[e.Uuid] {
+			continue
+		}
+		report.Changes = append(report.Changes, models.RestoreChange{
+			Kind:   models.RESTORE_KIND_ENV,
+			Uuid:   e.Uuid,
+			Label:  e.Name,
+			Action: models.RESTORE_DELETE,
+		})
+		envUUID := e.Uuid
+		*ops = append(*ops, func(tx *bolt.Tx) error {
+			return s.db.TxDelete(tx, envUUID, &StoreEnv{})
+		})
+	}
+}
+
+// restoreXProcessors restores xprocessors, a xprocessor is already stored when
+// its UUID or its label is
+func (s *Store) restoreXProcessors(xprocessors []models.XProcessor, report *models.RestoreReport, ops *[]restoreOp) {
+	stored := s.FindXProcessors("")
+	restored := map[string]bool{}
+	for _, xp := range xprocessors {
+		change := models.RestoreChange{
+			Kind:   models.RESTORE_KIND_XPROCESSOR,
+			Uuid:   xp.Uuid,
+			Label:  xp.Label,
+			Action: models.RESTORE_CREATE,
+		}
+		restored[xp.Uuid] = true
+
+		var current *models.XProcessor
+		for i := range stored {
+			if stored[i].Uuid == xp.Uuid || stored[i].Label == xp.Label {
+				current = &stored[i]
+				restored[current.Uuid] = true
+				change.Action = conflictAction(report.Mode, report.Conflict)
+				break
+			}
+		}
+		// xprocessors are used by their label, they can not be renamed
+		if change.Action == models.RESTORE_RENAME {
+			change.Action = models.RESTORE_SKIP
+		}
+		report.Changes = append(report.Changes, change)
+
+		if report.DryRun || change.Action == models.RESTORE_SKIP {
+			continue
+		}
+		replaced := ""
+		if current != nil && current.Uuid != xp.Uuid {
+			replaced = current.Uuid
+		}
+		sxp := storeXProcessor(&xp)
+		*ops = append(*ops, func(tx *bolt.Tx) error {
+			if replaced != "" {
+				if err := s.db.TxDelete(tx, replaced, &StoreXProcessor{}); err != nil {
+					return err
+				}
+			}
+			return s.db.TxUpsert(tx, sxp.Uuid, sxp)
+		})
+	}
+
+	if report.Mode != models.RESTORE_REPLACE {
+		return
+	}
+	for _, xp := range stored {
+		if restored[xp.Uuid] {
+			continue
+		}
+		report.Changes = append(report.Changes, models.RestoreChange{
+			Kind:   models.RESTORE_KIND_XPROCESSOR,
+			Uuid:   xp.Uuid,
+			Label:  xp.Label,
+			Action: models.RESTORE_DELETE,
+		})
+		xpUUID := xp.Uuid
+		*ops = append(*ops, func(tx *bolt.Tx) error {
+			return s.db.TxDelete(tx, xpUUID, &StoreXProcessor{})
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+func newTestStore(t *testing.T) *Store {
+	s, err := New(t.TempDir(), logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testPipeline(uuid, label string, assets ...string) models.Pipeline {
+	p := models.Pipeline{Uuid: uuid, Label: label}
+	for i, name := range assets {
+		a := models.Asset{Uuid: uuid + "-" + name, Name: name, Value: []byte(label + " " + name)}
+		if i == 0 {
+			a.Type = models.ASSET_TYPE_ENTRYPOINT
+		}
+		p.Assets = append(p.Assets, a)
+	}
+	return p
+}
+
+// seedStore stores the pipelines p1 and p3, the env HOST and the xprocessor grep
+func seedStore(s *Store) {
+	for _, p := range []models.Pipeline{
+		testPipeline("p1", "old", "main.conf", "extra.conf"),
+		testPipeline("p3", "other", "main.conf"),
+	} {
+		s.CreatePipeline(&p)
+	}
+	s.CreateEnv(&models.Env{Uuid: "e1", Name: "HOST", Value: "old"})
+	s.CreateXProcessor(&models.XProcessor{Uuid: "x1", Label: "grep", Command: "old"})
+}
+
+// testBackup updates p1, adds p2, the env HOST with another uuid and the
+// xprocessor grep
+func testBackup() models.Backup {
+	return models.Backup{
+		Pipelines: []models.Pipeline{
+			testPipeline("p1", "new", "main.conf"),
+			testPipeline("p2", "added", "main.conf"),
+		},
+		Envs:        []models.Env{{Uuid: "e2", Name: "HOST", Value: "new"}},
+		XProcessors: []models.XProcessor{{Uuid: "x1", Label: "grep", Command: "new"}},
+	}
+}
+
+// contents describes the stored items, pipelines with their assets
+func contents(s *Store) []string {
+	c := []string{}
+	for _, p := range s.FindPipelines(true) {
+		assets := []string{}
+		for _, a := range p.Assets {
+			assets = append(assets, fmt.Sprintf("%s=%s", a.Name, a.Value))
+		}
+		sort.Strings(assets)
+		c = append(c, fmt.Sprintf("pipeline %s %s [%s]", p.Uuid, p.Label, strings.Join(assets, " ")))
+	}
+	for _, e := range s.FindEnvs() {
+		c = append(c, fmt.Sprintf("env %s %s=%s", e.Uuid, e.Name, e.Value))
+	}
+	for _, xp := range s.FindXProcessors("") {
+		c = append(c, fmt.Sprintf("xprocessor %s %s=%s", xp.Uuid, xp.Label, xp.Command))
+	}
+	sort.Strings(c)
+	return c
+}
+
+func actions(report models.RestoreReport) []string {
+	a := []string{}
+	for _, c := range report.Changes {
+		a = append(a, c.Kind+" "+c.Uuid+" "+c.Action)
+	}
+	return a
+}
+
+func TestRestore(t *testing.T) {
+	seeded := []string{
+		"env e1 HOST=old",
+		"pipeline p1 old [extra.conf=old extra.conf main.conf=old main.conf]",
+		"pipeline p3 other [main.conf=other main.conf]",
+		"xprocessor x1 grep=old",
+	}
+
+	tests := []struct {
+		mode     string
+		conflict string
+		actions  []string
+		contents []string
+	}{
+		{
+			models.RESTORE_MERGE, models.CONFLICT_OVERWRITE,
+			[]string{"pipeline p1 update", "pipeline p2 create", "env e2 update", "xprocessor x1 update"},
+			[]string{
+				"env e2 HOST=new",
+				"pipeline p1 new [main.conf=new main.conf]",
+				"pipeline p2 added [main.conf=added main.conf]",
+				"pipeline p3 other [main.conf=other main.conf]",
+				"xprocessor x1 grep=new",
+			},
+		},
+		{
+			models.RESTORE_MERGE, models.CONFLICT_SKIP,
+			[]string{"pipeline p1 skip", "pipeline p2 create", "env e2 skip", "xprocessor x1 skip"},
+			[]string{
+				"env e1 HOST=old",
+				"pipeline p1 old [extra.conf=old extra.conf main.conf=old main.conf]",
+				"pipeline p2 added [main.conf=added main.conf]",
+				"pipeline p3 other [main.conf=other main.conf]",
+				"xprocessor x1 grep=old",
+			},
+		},
+		{
+			models.RESTORE_MERGE, models.CONFLICT_RENAME,
+			[]string{"pipeline p1 rename", "pipeline p2 create", "env e2 skip", "xprocessor x1 skip"},
+			[]string{
+				"env e1 HOST=old",
+				"pipeline <renamed> new [main.conf=new main.conf]",
+				"pipeline p1 old [extra.conf=old extra.conf main.conf=old main.conf]",
+				"pipeline p2 added [main.conf=added main.conf]",
+				"pipeline p3 other [main.conf=other main.conf]",
+				"xprocessor x1 grep=old",
+			},
+		},
+		{
+			// conflicting items are always overwritten
+			models.RESTORE_REPLACE, models.CONFLICT_SKIP,
+			[]string{"pipeline p1 update", "pipeline p2 create", "pipeline p3 delete", "env e2 update", "xprocessor x1 update"},
+			[]string{
+				"env e2 HOST=new",
+				"pipeline p1 new [main.conf=new main.conf]",
+				"pipeline p2 added [main.conf=added main.conf]",
+				"xprocessor x1 grep=new",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.conflict, func(t *testing.T) {
+			s := newTestStore(t)
+			seedStore(s)
+			assert.Equal(t, seeded, contents(s))
+
+			// a dry run reports the changes without writing them
+			report, err := s.Restore(testBackup(), tt.mode, tt.conflict, true)
+			assert.NoError(t, err)
+			assert.True(t, report.DryRun)
+			assert.Equal(t, tt.actions, actions(report))
+			assert.Equal(t, seeded, contents(s))
+
+			report, err = s.Restore(testBackup(), tt.mode, tt.conflict, false)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.actions, actions(report))
+
+			expected := tt.contents
+			if report.Changes[0].NewUuid != "" {
+				expected = strings.Split(strings.Replace(strings.Join(tt.contents, "\n"), "<renamed>", report.Changes[0].NewUuid, 1), "\n")
+				sort.Strings(expected)
+			}
+			assert.Equal(t, expected, contents(s))
+		})
+	}
+}
+
+func TestRestoreRenamedAssets(t *testing.T) {
+	s := newTestStore(t)
+	seedStore(s)
+
+	report, err := s.Restore(models.Backup{Pipelines: []models.Pipeline{testPipeline("p1", "new", "main.conf")}},
+		models.RESTORE_MERGE, models.CONFLICT_RENAME, false)
+	assert.NoError(t, err)
+
+	// the renamed pipeline does not share the assets of p1
+	renamed, err := s.FindOnePipelineByUUID(report.Changes[0].NewUuid, true)
+	assert.NoError(t, err)
+	original, err := s.FindOnePipelineByUUID("p1", true)
+	assert.NoError(t, err)
+	assert.NotEqual(t, original.Assets[0].Uuid, renamed.Assets[0].Uuid)
+	assert.Len(t, original.Assets, 2)
+}
+
+func TestRestoreErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		backup   models.Backup
+		mode     string
+		conflict string
+		err      string
+	}{
+		{"unknown mode", testBackup(), "append", models.CONFLICT_SKIP, "unknown restore mode append"},
+		{"unknown conflict", testBackup(), models.RESTORE_MERGE, "keep", "unknown conflict handling keep"},
+		{
+			"invalid uuid",
+			models.Backup{Pipelines: []models.Pipeline{
+				testPipeline("p2", "added", "main.conf"),
+				testPipeline("../p1", "escape", "main.conf"),
+			}},
+			models.RESTORE_REPLACE, models.CONFLICT_OVERWRITE,
+			`pipeline escape : invalid uuid "../p1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			seedStore(s)
+			before := contents(s)
+
+			_, err := s.Restore(tt.backup, tt.mode, tt.conflict, false)
+			assert.EqualError(t, err, tt.err)
+			assert.Equal(t, before, contents(s))
+		})
+	}
+}
+
+// dependent returns a pipeline depending on dependsOn
+func dependent(uuid string, dependsOn ...string) models.Pipeline {
+	p := testPipeline(uuid, uuid, "main.conf")
+	p.DependsOn = dependsOn
+	return p
+}
+
+func TestRestoreDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		pipelines []models.Pipeline
+		mode      string
+		conflict  string
+		err       string
+	}{
+		{"on a restored pipeline", []models.Pipeline{dependent("p2", "p4"), dependent("p4")},
+			models.RESTORE_MERGE, models.CONFLICT_OVERWRITE, ""},
+		{"on a stored pipeline", []models.Pipeline{dependent("p2", "p3")},
+			models.RESTORE_MERGE, models.CONFLICT_OVERWRITE, ""},
+		{"renamed", []models.Pipeline{dependent("p1", "p3")},
+			models.RESTORE_MERGE, models.CONFLICT_RENAME, ""},
+		{"unknown", []models.Pipeline{dependent("p2", "p4")},
+			models.RESTORE_MERGE, models.CONFLICT_OVERWRITE, "pipeline p2 : depends_on pipeline p4 not found"},
+		{"on a pipeline deleted by the restore", []models.Pipeline{dependent("p2", "p3")},
+			models.RESTORE_REPLACE, models.CONFLICT_OVERWRITE, "pipeline p2 : depends_on pipeline p3 not found"},
+		{"on itself", []models.Pipeline{dependent("p2", "p2")},
+			models.RESTORE_MERGE, models.CONFLICT_OVERWRITE, "depends_on : dependency cycle p2 -> p2"},
+		{"cycle in the backup", []models.Pipeline{dependent("p2", "p4"), dependent("p4", "p2")},
+			models.RESTORE_MERGE, models.CONFLICT_OVERWRITE, "depends_on : dependency cycle p2 -> p4 -> p2"},
+		{"cycle with a stored pipeline", []models.Pipeline{dependent("p1", "p2"), dependent("p2", "p3")},
+			models.RESTORE_MERGE, models.CONFLICT_OVERWRITE, "depends_on : dependency cycle p1 -> p2 -> p3 -> p1"},
+		{"skipped pipeline keeps its dependencies", []models.Pipeline{dependent("p3", "p2"), dependent("p2", "p3")},
+			models.RESTORE_MERGE, models.CONFLICT_SKIP, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			seedStore(s)
+			// p3 depends on p1
+			p3 := dependent("p3", "p1")
+			p3.Label = "other"
+			s.CreatePipeline(&p3)
+			before := contents(s)
+
+			for _, dryRun := range []bool{true, false} {
+				_, err := s.Restore(models.Backup{Pipelines: tt.pipelines}, tt.mode, tt.conflict, dryRun)
+				if tt.err == "" {
+					assert.NoError(t, err)
+					continue
+				}
+				assert.EqualError(t, err, tt.err)
+				assert.Equal(t, before, contents(s))
+			}
+		})
+	}
+}
+
+func TestApplyRestoreIsAtomic(t *testing.T) {
+	s := newTestStore(t)
+	seedStore(s)
+	before := contents(s)
+
+	// the planned changes followed by a failing one
+	report := models.RestoreReport{Mode: models.RESTORE_REPLACE, Conflict: models.CONFLICT_OVERWRITE}
+	ops := []restoreOp{}
+	assert.NoError(t, s.restorePipelines(testBackup().Pipelines, &report, &ops))
+	s.restoreEnvs(testBackup().Envs, &report, &ops)
+	assert.NotEmpty(t, ops)
+	ops = append(ops, func(tx *bolt.Tx) error { return errors.New("disk full") })
+
+	assert.EqualError(t, s.applyRestore(ops), "nothing restored - disk full")
+	assert.Equal(t, before, contents(s))
+}
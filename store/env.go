@@ -20,7 +20,12 @@ type StoreEnv struct {
 }
 
 func (s *Store) CreateEnv(xp *models.Env) {
-	sxp := &StoreEnv{
+	sxp := storeEnv(xp)
+	s.db.Upsert(sxp.Uuid, sxp)
+}
+
+func storeEnv(xp *models.Env) *StoreEnv {
+	return &StoreEnv{
 		Uuid:      xp.Uuid,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -29,8 +34,6 @@ func (s *Store) CreateEnv(xp *models.Env) {
 		Value:  xp.Value,
 		Secret: xp.Secret,
 	}
-
-	s.db.Upsert(sxp.Uuid, sxp)
 }
 
 func (s *Store) DeleteEnv(p *models.Env) {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/boltdb/bolt"
 	"github.com/timshannon/bolthold"
 	"github.com/vjeantet/bitfan/api/models"
 )
@@ -18,6 +19,8 @@ type StorePipeline struct {
 	Label       string `json:"label"`
 	Description string `json:"description"`
 	AutoStart   bool   `json:"auto_start" boltholdIndex:"AutoStart" mapstructure:"auto_start"`
+	// DependsOn are the uuids of the pipelines started before this one
+	DependsOn []string `json:"depends_on"`
 
 	// Assets
 	Assets []StoreAssetRef `json:"assets"`
@@ -48,6 +51,7 @@ func (s *Store) FindPipelinesWithAutoStart(withAssetValues bool) []models.Pipeli
 		tPipeline.Label = p.Label
 		tPipeline.Description = p.Description
 		tPipeline.AutoStart = p.AutoStart
+		tPipeline.DependsOn = p.DependsOn
 
 		for _, a := range p.Assets {
 			asset := models.Asset{
@@ -78,10 +82,20 @@ func (s *Store) FindPipelinesWithAutoStart(withAssetValues bool) []models.Pipeli
 }
 
 func (s *Store) FindOnePipelineByUUID(UUID string, withAssetValues bool) (models.Pipeline, error) {
+	var tPipeline models.Pipeline
+	err := s.db.Bolt().View(func(tx *bolt.Tx) error {
+		var err error
+		tPipeline, err = s.txFindOnePipelineByUUID(tx, UUID, withAssetValues)
+		return err
+	})
+	return tPipeline, err
+}
+
+func (s *Store) txFindOnePipelineByUUID(tx *bolt.Tx, UUID string, withAssetValues bool) (models.Pipeline, error) {
 	tPipeline := models.Pipeline{Uuid: UUID}
 
 	var sps []StorePipeline
-	err := s.db.Find(&sps, bolthold.Where(bolthold.Key).Eq(UUID))
+	err := s.db.TxFind(tx, &sps, bolthold.Where(bolthold.Key).Eq(UUID))
 	if err != nil {
 		return tPipeline, err
 	}
@@ -95,6 +109,7 @@ func (s *Store) FindOnePipelineByUUID(UUID string, withAssetValues bool) (models
 	tPipeline.Label = sps[0].Label
 	tPipeline.Description = sps[0].Description
 	tPipeline.AutoStart = sps[0].AutoStart
+	tPipeline.DependsOn = sps[0].DependsOn
 
 	for _, a := range sps[0].Assets {
 		asset := models.Asset{
@@ -105,7 +120,7 @@ func (s *Store) FindOnePipelineByUUID(UUID string, withAssetValues bool) (models
 
 		if withAssetValues {
 			var sas []StoreAsset
-			err := s.db.Find(&sas, bolthold.Where(bolthold.Key).Eq(a.Uuid))
+			err := s.db.TxFind(tx, &sas, bolthold.Where(bolthold.Key).Eq(a.Uuid))
 			if err != nil {
 				return tPipeline, err
 			}
@@ -123,15 +138,27 @@ func (s *Store) FindOnePipelineByUUID(UUID string, withAssetValues bool) (models
 }
 
 func (s *Store) CreatePipeline(p *models.Pipeline) {
+	sp, savs := storePipeline(p, time.Now())
+	for _, sav := range savs {
+		s.db.Upsert(sav.Uuid, sav)
+	}
+
+	s.db.Upsert(sp.Uuid, sp)
+}
+
+// storePipeline returns the pipeline and its assets as stored
+func storePipeline(p *models.Pipeline, createdAt time.Time) (*StorePipeline, []*StoreAsset) {
 	sp := &StorePipeline{
 		Uuid:        p.Uuid,
-		CreatedAt:   time.Now(),
+		CreatedAt:   createdAt,
 		UpdatedAt:   time.Now(),
 		Label:       p.Label,
 		Description: p.Description,
 		AutoStart:   p.AutoStart,
+		DependsOn:   p.DependsOn,
 	}
 
+	savs := []*StoreAsset{}
 	for _, a := range p.Assets {
 		sp.Assets = append(sp.Assets,
 			StoreAssetRef{
@@ -139,7 +166,7 @@ func (s *Store) CreatePipeline(p *models.Pipeline) {
 				Label: a.Name,
 				Type:  a.Type,
 			})
-		sav := &StoreAsset{
+		savs = append(savs, &StoreAsset{
 			Uuid:         a.Uuid,
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
@@ -149,11 +176,9 @@ func (s *Store) CreatePipeline(p *models.Pipeline) {
 			ContentType:  a.ContentType,
 			Value:        a.Value,
 			Size:         a.Size,
-		}
-		s.db.Upsert(sav.Uuid, sav)
+		})
 	}
-
-	s.db.Upsert(sp.Uuid, sp)
+	return sp, savs
 }
 
 func (s *Store) SavePipeline(p *models.Pipeline) {
@@ -164,6 +189,7 @@ func (s *Store) SavePipeline(p *models.Pipeline) {
 		Label:       p.Label,
 		Description: p.Description,
 		AutoStart:   p.AutoStart,
+		DependsOn:   p.DependsOn,
 	}
 
 	for _, a := range p.Assets {
@@ -206,6 +232,12 @@ func (s *Store) DeletePipeline(p *models.Pipeline) {
 		return
 	}
 
+	err = s.DeletePipelineVersions(p.Uuid)
+	if err != nil {
+		s.log.Error("Store : DeletePipeline - " + err.Error())
+		return
+	}
+
 }
 
 func (s *Store) FindPipelines(withAssetValues bool) []models.Pipeline {
@@ -227,6 +259,7 @@ func (s *Store) FindPipelines(withAssetValues bool) []models.Pipeline {
 		tPipeline.Label = p.Label
 		tPipeline.Description = p.Description
 		tPipeline.AutoStart = p.AutoStart
+		tPipeline.DependsOn = p.DependsOn
 
 		// for _, a := range p.Assets {
 		// 	tPipeline.Assets = append(tPipeline.Assets, models.Asset{
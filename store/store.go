@@ -64,8 +64,12 @@ func (s *Store) preparePipelineAssetExecutionStage(cwd string, tAssets *[]models
 
 func (s *Store) PreparePipelineExecutionStage(tPipeline *models.Pipeline) (string, error) {
 	//Save assets to cwd
-	cwd := s.PipelineTmpPath(tPipeline)
+	return s.PreparePipelineExecutionStageIn(s.PipelineTmpPath(tPipeline), tPipeline)
+}
 
+// PreparePipelineExecutionStageIn saves the assets of the pipeline to cwd and
+// returns the location of its entrypoint
+func (s *Store) PreparePipelineExecutionStageIn(cwd string, tPipeline *models.Pipeline) (string, error) {
 	s.log.Debugf("configuration %s storage to %s", tPipeline.Uuid, cwd)
 
 	// If Playground With Base
@@ -0,0 +1,332 @@
+package store
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/timshannon/bolthold"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/commons/manifest"
+)
+
+// StoreSyncState remembers pipelines synced from a manifest and their state
+// at the last sync, to detect changes made since in the store
+type StoreSyncState struct {
+	PipelineUUID string `boltholdKey:"PipelineUUID"`
+	Source       string `boltholdIndex:"Source"`
+	Hash         string
+	SyncedAt     time.Time
+}
+
+// PlanSync compares stored pipelines with the ones declared in the manifest
+// and returns the changes to apply, nothing is changed in the store
+func (s *Store) PlanSync(m *manifest.Manifest) (models.SyncPlan, error) {
+	plan := models.SyncPlan{
+		Source:   m.Path,
+		Revision: m.Revision(),
+		At:       time.Now(),
+		Changes:  []models.SyncChange{},
+	}
+
+	declared := map[string]bool{}
+	for _, mp := range m.Pipelines {
+		declared[mp.ID] = true
+
+		var sps []StorePipeline
+		if err := s.db.Find(&sps, bolthold.Where(bolthold.Key).Eq(mp.ID)); err != nil {
+			return plan, err
+		}
+
+		var current *models.Pipeline
+		if len(sps) > 0 {
+			p, err := s.FindOnePipelineByUUID(mp.ID, true)
+			if err != nil {
+				return plan, err
+			}
+			current = &p
+		}
+
+		desired, err := declaredPipeline(m, mp, current)
+		if err != nil {
+			return plan, err
+		}
+
+		change := models.SyncChange{
+			PipelineUUID: mp.ID,
+			Label:        mp.Label,
+			Pipeline:     desired,
+			Details:      []string{},
+		}
+
+		if current == nil {
+			change.Action = models.SYNC_CREATE
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		var state StoreSyncState
+		stateErr := s.db.Get(mp.ID, &state)
+		currentHash := pipelineHash(*current)
+		if stateErr == nil && state.Hash != currentHash {
+			change.Drift = true
+		}
+
+		if currentHash == pipelineHash(desired) {
+			change.Action = models.SYNC_UNCHANGED
+		} else {
+			change.Action = models.SYNC_UPDATE
+			change.Details = pipelineDiff(*current, desired)
+			if stateErr != nil {
+				change.Details = append(change.Details, "pipeline was not managed by a sync")
+			}
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	// pipelines previously synced from this manifest and no more declared
+	var states []StoreSyncState
+	err := s.db.Bolt().View(func(tx *bolt.Tx) error {
+		// the index is created with the first sync
+		if !s.db.IndexExists(tx, "StoreSyncState", "Source") {
+			return nil
+		}
+		return s.db.TxFind(tx, &states, bolthold.Where("Source").Eq(m.Path).Index("Source"))
+	})
+	if err != nil {
+		return plan, err
+	}
+	for _, state := range states {
+		if declared[state.PipelineUUID] {
+			continue
+		}
+		p, err := s.FindOnePipelineByUUID(state.PipelineUUID, true)
+		if err != nil {
+			continue
+		}
+		plan.Changes = append(plan.Changes, models.SyncChange{
+			PipelineUUID: p.Uuid,
+			Label:        p.Label,
+			Action:       models.SYNC_DELETE,
+			Drift:        pipelineHash(p) != state.Hash,
+			Details:      []string{"pipeline is no more declared"},
+			Pipeline:     p,
+		})
+	}
+
+	return plan, nil
+}
+
+// ApplySync creates, updates and deletes stored pipelines according to the
+// plan in a single transaction, nothing is changed when a change fails
+func (s *Store) ApplySync(plan models.SyncPlan) error {
+	deleted := false
+	err := s.db.Bolt().Update(func(tx *bolt.Tx) error {
+		for _, c := range plan.Changes {
+			p := c.Pipeline
+			var err error
+			switch c.Action {
+			case models.SYNC_CREATE, models.SYNC_UPDATE:
+				err = s.txSyncPipeline(tx, &p, plan.Source)
+			case models.SYNC_DELETE:
+				deleted = true
+				err = s.txDeleteSyncedPipeline(tx, p.Uuid)
+			}
+			if err != nil {
+				return fmt.Errorf("%s pipeline %s - %v", c.Action, p.Uuid, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("nothing synced - %v", err)
+	}
+	if deleted {
+		// contents of the versions of deleted pipelines
+		if err := s.pruneAssetContents(); err != nil {
+			s.log.Error("Store : ApplySync - " + err.Error())
+		}
+	}
+	return nil
+}
+
+// txSyncPipeline stores the pipeline with its assets and its sync state,
+// stored assets missing from p.Assets are deleted
+func (s *Store) txSyncPipeline(tx *bolt.Tx, p *models.Pipeline, source string) error {
+	var sps []StorePipeline
+	if err := s.db.TxFind(tx, &sps, bolthold.Where(bolthold.Key).Eq(p.Uuid)); err != nil {
+		return err
+	}
+
+	createdAt := time.Now()
+	if len(sps) > 0 {
+		createdAt = sps[0].CreatedAt
+		keep := map[string]bool{}
+		for _, a := range p.Assets {
+			keep[a.Uuid] = true
+		}
+		for _, a := range sps[0].Assets {
+			if keep[a.Uuid] {
+				continue
+			}
+			if err := s.db.TxDeleteMatching(tx, &StoreAsset{}, bolthold.Where(bolthold.Key).Eq(a.Uuid)); err != nil {
+				return err
+			}
+		}
+	}
+
+	sp, savs := storePipeline(p, createdAt)
+	for _, sav := range savs {
+		if err := s.db.TxUpsert(tx, sav.Uuid, sav); err != nil {
+			return err
+		}
+	}
+	if err := s.db.TxUpsert(tx, sp.Uuid, sp); err != nil {
+		return err
+	}
+
+	state := &StoreSyncState{
+		PipelineUUID: p.Uuid,
+		Source:       source,
+		Hash:         pipelineHash(*p),
+		SyncedAt:     time.Now(),
+	}
+	return s.db.TxUpsert(tx, state.PipelineUUID, state)
+}
+
+// txDeleteSyncedPipeline deletes the pipeline, its assets, its versions and
+// its sync state
+func (s *Store) txDeleteSyncedPipeline(tx *bolt.Tx, pipelineUUID string) error {
+	if err := s.db.TxDeleteMatching(tx, &StoreAsset{}, bolthold.Where("PipelineUUID").Eq(pipelineUUID)); err != nil {
+		return err
+	}
+	if err := s.db.TxDeleteMatching(tx, &StorePipelineVersion{}, bolthold.Where("PipelineUUID").Eq(pipelineUUID)); err != nil {
+		return err
+	}
+	if err := s.db.TxDeleteMatching(tx, &StorePipeline{}, bolthold.Where(bolthold.Key).Eq(pipelineUUID)); err != nil {
+		return err
+	}
+	return s.db.TxDeleteMatching(tx, &StoreSyncState{}, bolthold.Where(bolthold.Key).Eq(pipelineUUID))
+}
+
+// declaredPipeline builds the pipeline declared in the manifest, assets
+// already stored keep their UUID
+func declaredPipeline(m *manifest.Manifest, mp manifest.Pipeline, current *models.Pipeline) (models.Pipeline, error) {
+	p := models.Pipeline{
+		Uuid:        mp.ID,
+		Label:       mp.Label,
+		Description: mp.Description,
+		AutoStart:   mp.IsAutoStart(),
+		DependsOn:   mp.DependsOn,
+	}
+
+	base, names, err := m.Files(mp)
+	if err != nil {
+		return p, err
+	}
+
+	uuids := map[string]string{}
+	if current != nil {
+		for _, a := range current.Assets {
+			uuids[a.Name] = a.Uuid
+		}
+	}
+
+	for i, name := range names {
+		value, err := ioutil.ReadFile(filepath.Join(base, name))
+		if err != nil {
+			return p, err
+		}
+		name = filepath.ToSlash(name)
+
+		uuid, ok := uuids[name]
+		if !ok {
+			sum := sha1.Sum([]byte(name))
+			uuid = fmt.Sprintf("%s-%s", mp.ID, hex.EncodeToString(sum[:])[:12])
+		}
+
+		asset := models.Asset{
+			Uuid:         uuid,
+			PipelineUUID: mp.ID,
+			Name:         name,
+			Value:        value,
+			Size:         len(value),
+			ContentType:  http.DetectContentType(value),
+		}
+		if i == 0 {
+			asset.Type = models.ASSET_TYPE_ENTRYPOINT
+		}
+		p.Assets = append(p.Assets, asset)
+	}
+	return p, nil
+}
+
+// pipelineHash returns a hash of the pipeline's synced attributes and assets
+func pipelineHash(p models.Pipeline) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%t\x00", p.Label, p.Description, p.AutoStart)
+	// pipelines synced without dependencies keep their hash
+	if len(p.DependsOn) > 0 {
+		fmt.Fprintf(h, "%s\x00", strings.Join(p.DependsOn, ","))
+	}
+
+	assets := append([]models.Asset{}, p.Assets...)
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Name < assets[j].Name })
+	for _, a := range assets {
+		sum := sha256.Sum256(a.Value)
+		io.WriteString(h, a.Name+"\x00"+a.Type+"\x00"+hex.EncodeToString(sum[:])+"\x00")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// pipelineDiff describes the differences between two pipelines
+func pipelineDiff(from, to models.Pipeline) []string {
+	details := []string{}
+	if from.Label != to.Label {
+		details = append(details, fmt.Sprintf("label changed from %q to %q", from.Label, to.Label))
+	}
+	if from.Description != to.Description {
+		details = append(details, "description changed")
+	}
+	if from.AutoStart != to.AutoStart {
+		details = append(details, fmt.Sprintf("auto_start changed to %t", to.AutoStart))
+	}
+	if strings.Join(from.DependsOn, ",") != strings.Join(to.DependsOn, ",") {
+		details = append(details, fmt.Sprintf("depends_on changed to [%s]", strings.Join(to.DependsOn, ", ")))
+	}
+
+	fromAssets := map[string]models.Asset{}
+	for _, a := range from.Assets {
+		fromAssets[a.Name] = a
+	}
+	for _, a := range to.Assets {
+		previous, ok := fromAssets[a.Name]
+		delete(fromAssets, a.Name)
+		switch {
+		case !ok:
+			details = append(details, "asset "+a.Name+" added")
+		case string(previous.Value) != string(a.Value):
+			details = append(details, "asset "+a.Name+" modified")
+		case previous.Type != a.Type:
+			details = append(details, "asset "+a.Name+" type changed to "+a.Type)
+		}
+	}
+	removed := []string{}
+	for name := range fromAssets {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		details = append(details, "asset "+name+" removed")
+	}
+	return details
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/commons/manifest"
+)
+
+const testManifest = `
+pipelines:
+  - id: web
+    label: Web logs
+    config: web/main.conf
+  - id: mail
+    label: Mail logs
+    config: mail/main.conf
+`
+
+// writeManifest writes the files in dir and loads its manifest
+func writeManifest(t *testing.T, dir string, files map[string]string) *manifest.Manifest {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := manifest.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// syncActions describes the changes of a plan
+func syncActions(plan models.SyncPlan) []string {
+	a := []string{}
+	for _, c := range plan.Changes {
+		action := c.Action + " " + c.PipelineUUID
+		if c.Drift {
+			action += " drift"
+		}
+		if len(c.Details) > 0 {
+			action += " (" + strings.Join(c.Details, ", ") + ")"
+		}
+		a = append(a, action)
+	}
+	return a
+}
+
+func plan(t *testing.T, s *Store, m *manifest.Manifest) models.SyncPlan {
+	plan, err := s.PlanSync(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestSync(t *testing.T) {
+	s := newTestStore(t)
+	dir := t.TempDir()
+	m := writeManifest(t, dir, map[string]string{
+		manifest.FILENAME: testManifest,
+		"web/main.conf":   "web",
+		"mail/main.conf":  "mail",
+	})
+
+	// a plan changes nothing, a dry run only plans
+	created := plan(t, s, m)
+	assert.Equal(t, m.Path, created.Source)
+	assert.Equal(t, []string{"create web", "create mail"}, syncActions(created))
+	assert.Empty(t, contents(s))
+
+	assert.NoError(t, s.ApplySync(created))
+	assert.Equal(t, []string{
+		"pipeline mail Mail logs [main.conf=mail]",
+		"pipeline web Web logs [main.conf=web]",
+	}, contents(s))
+	assert.Equal(t, []string{"unchanged web", "unchanged mail"}, syncActions(plan(t, s, m)))
+
+	web, err := s.FindOnePipelineByUUID("web", false)
+	assert.NoError(t, err)
+
+	// the entrypoint keeps its uuid, the other files are added
+	m = writeManifest(t, dir, map[string]string{
+		"web/main.conf":     "web v2",
+		"web/patterns.grok": "patterns",
+	})
+	updated := plan(t, s, m)
+	assert.Equal(t, []string{
+		"update web (asset main.conf modified, asset patterns.grok added)",
+		"unchanged mail",
+	}, syncActions(updated))
+	assert.NoError(t, s.ApplySync(updated))
+	assert.Equal(t, []string{
+		"pipeline mail Mail logs [main.conf=mail]",
+		"pipeline web Web logs [main.conf=web v2 patterns.grok=patterns]",
+	}, contents(s))
+
+	webUpdated, err := s.FindOnePipelineByUUID("web", false)
+	assert.NoError(t, err)
+	assert.Equal(t, web.CreatedAt.Unix(), webUpdated.CreatedAt.Unix())
+	assert.Equal(t, web.Assets[0].Uuid, webUpdated.Assets[0].Uuid)
+
+	// files removed from the manifest are deleted
+	os.Remove(filepath.Join(dir, "web", "patterns.grok"))
+	assert.NoError(t, s.ApplySync(plan(t, s, m)))
+	assert.Equal(t, []string{
+		"pipeline mail Mail logs [main.conf=mail]",
+		"pipeline web Web logs [main.conf=web v2]",
+	}, contents(s))
+
+	// pipelines no more declared are deleted with their sync state
+	m = writeManifest(t, dir, map[string]string{
+		manifest.FILENAME: strings.SplitN(testManifest, "  - id: mail", 2)[0],
+	})
+	deleted := plan(t, s, m)
+	assert.Equal(t, []string{"unchanged web", "delete mail (pipeline is no more declared)"}, syncActions(deleted))
+	assert.NoError(t, s.ApplySync(deleted))
+	assert.Equal(t, []string{"pipeline web Web logs [main.conf=web v2]"}, contents(s))
+	assert.Error(t, s.db.Get("mail", &StoreSyncState{}))
+	assert.Equal(t, []string{"unchanged web"}, syncActions(plan(t, s, m)))
+}
+
+func TestPlanSyncDrift(t *testing.T) {
+	s := newTestStore(t)
+	m := writeManifest(t, t.TempDir(), map[string]string{
+		manifest.FILENAME: testManifest,
+		"web/main.conf":   "web",
+		"mail/main.conf":  "mail",
+	})
+	assert.NoError(t, s.ApplySync(plan(t, s, m)))
+
+	// web is changed in the store after the sync
+	web, err := s.FindOnePipelineByUUID("web", true)
+	assert.NoError(t, err)
+	web.Label = "Edited"
+	s.SavePipeline(&web)
+
+	assert.Equal(t, []string{
+		`update web drift (label changed from "Edited" to "Web logs")`,
+		"unchanged mail",
+	}, syncActions(plan(t, s, m)))
+
+	// a pipeline created outside a sync is not managed by it
+	s2 := newTestStore(t)
+	p := testPipeline("web", "Web logs", "main.conf")
+	p.AutoStart = true
+	s2.CreatePipeline(&p)
+	assert.Equal(t, []string{
+		"update web (asset main.conf modified, pipeline was not managed by a sync)",
+		"create mail",
+	}, syncActions(plan(t, s2, m)))
+}
+
+func TestApplySyncIsAtomic(t *testing.T) {
+	s := newTestStore(t)
+	m := writeManifest(t, t.TempDir(), map[string]string{
+		manifest.FILENAME: testManifest,
+		"web/main.conf":   "web",
+		"mail/main.conf":  "mail",
+	})
+	p := plan(t, s, m)
+
+	// the key of the second pipeline is too large for the store
+	p.Changes[1].Pipeline.Uuid = strings.Repeat("x", 40000)
+	err := s.ApplySync(p)
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "nothing synced - create pipeline xxx"), err.Error())
+	}
+	assert.Empty(t, contents(s))
+	assert.Equal(t, []string{"create web", "create mail"}, syncActions(plan(t, s, m)))
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	"github.com/vjeantet/bitfan/api/models"
+	"github.com/vjeantet/bitfan/commons"
+)
+
+// passwordIterations is the number of PBKDF2 iterations used to hash passwords
+const passwordIterations = 10000
+
+type StoreUser struct {
+	Uuid string `json:"uuid" boltholdKey:"Uuid"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name string `json:"name" boltholdIndex:"Name"`
+	Role string `json:"role"`
+
+	// only hashes of tokens and passwords are stored
+	TokenHash    string `json:"token_hash" boltholdIndex:"TokenHash"`
+	PasswordSalt string `json:"password_salt"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// CreateUser stores a new user, a token is generated and set to u.Token
+func (s *Store) CreateUser(u *models.User) error {
+	if _, err := s.findOneStoreUserByName(u.Name); err == nil {
+		return fmt.Errorf("user %s already exists", u.Name)
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	u.Token = token
+
+	su := &StoreUser{
+		Uuid:      u.Uuid,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      u.Name,
+		Role:      u.Role,
+		TokenHash: hashToken(token),
+	}
+	if err := su.setPassword(u.Password); err != nil {
+		return err
+	}
+	u.Password = ""
+	u.CreatedAt = su.CreatedAt
+	u.UpdatedAt = su.UpdatedAt
+
+	return s.db.Upsert(su.Uuid, su)
+}
+
+// SaveUser updates the user's name and role, and its password when u.Password is set,
+// a new token is generated and set to u.Token when renewToken is true
+func (s *Store) SaveUser(u *models.User, renewToken bool) error {
+	var su StoreUser
+	if err := s.db.Get(u.Uuid, &su); err != nil {
+		return fmt.Errorf("User %s not found", u.Uuid)
+	}
+	if other, err := s.findOneStoreUserByName(u.Name); err == nil && other.Uuid != su.Uuid {
+		return fmt.Errorf("user %s already exists", u.Name)
+	}
+
+	su.Name = u.Name
+	su.Role = u.Role
+	su.UpdatedAt = time.Now()
+
+	if u.Password != "" {
+		if err := su.setPassword(u.Password); err != nil {
+			return err
+		}
+		u.Password = ""
+	}
+
+	if renewToken {
+		token, err := randomHex(32)
+		if err != nil {
+			return err
+		}
+		su.TokenHash = hashToken(token)
+		u.Token = token
+	}
+
+	u.CreatedAt = su.CreatedAt
+	u.UpdatedAt = su.UpdatedAt
+	return s.db.Upsert(su.Uuid, &su)
+}
+
+func (s *Store) DeleteUser(u *models.User) {
+	err := s.db.Delete(u.Uuid, &StoreUser{})
+	if err != nil {
+		s.log.Error("Store : DeleteUser - " + err.Error())
+	}
+}
+
+func (s *Store) FindUsers() []models.User {
+	users := []models.User{}
+
+	var sus []StoreUser
+	err := s.db.Find(&sus, &bolthold.Query{})
+	if err != nil {
+		s.log.Error("Store : FindUsers " + err.Error())
+		return users
+	}
+	for _, su := range sus {
+		users = append(users, su.user())
+	}
+
+	return users
+}
+
+func (s *Store) FindOneUserByUUID(UUID string) (models.User, error) {
+	var sus []StoreUser
+	err := s.db.Find(&sus, bolthold.Where(bolthold.Key).Eq(UUID))
+	if err != nil {
+		return models.User{Uuid: UUID}, err
+	}
+	if len(sus) == 0 {
+		return models.User{Uuid: UUID}, fmt.Errorf("User %s not found", UUID)
+	}
+
+	return sus[0].user(), nil
+}
+
+// AuthenticateToken returns the user owning the token
+func (s *Store) AuthenticateToken(token string) (models.User, error) {
+	var sus []StoreUser
+	err := s.db.Find(&sus, bolthold.Where("TokenHash").Eq(hashToken(token)).Index("TokenHash"))
+	if err != nil {
+		return models.User{}, err
+	}
+	if len(sus) == 0 {
+		return models.User{}, fmt.Errorf("invalid token")
+	}
+	return sus[0].user(), nil
+}
+
+// AuthenticateBasic returns the user matching name and password
+func (s *Store) AuthenticateBasic(name, password string) (models.User, error) {
+	su, err := s.findOneStoreUserByName(name)
+	if err != nil || su.PasswordHash == "" {
+		return models.User{}, fmt.Errorf("invalid user or password")
+	}
+
+	salt, _ := hex.DecodeString(su.PasswordSalt)
+	hash := hex.EncodeToString(commons.PBKDF2SHA256([]byte(password), salt, passwordIterations))
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(su.PasswordHash)) != 1 {
+		return models.User{}, fmt.Errorf("invalid user or password")
+	}
+	return su.user(), nil
+}
+
+func (s *Store) findOneStoreUserByName(name string) (StoreUser, error) {
+	var sus []StoreUser
+	err := s.db.Find(&sus, bolthold.Where("Name").Eq(name).Index("Name"))
+	if err != nil {
+		return StoreUser{}, err
+	}
+	if len(sus) == 0 {
+		return StoreUser{}, fmt.Errorf("User %s not found", name)
+	}
+	return sus[0], nil
+}
+
+func (su *StoreUser) user() models.User {
+	return models.User{
+		Uuid:      su.Uuid,
+		Name:      su.Name,
+		Role:      su.Role,
+		CreatedAt: su.CreatedAt,
+		UpdatedAt: su.UpdatedAt,
+	}
+}
+
+// setPassword hashes password, an empty password disables basic auth
+func (su *StoreUser) setPassword(password string) error {
+	if password == "" {
+		su.PasswordSalt = ""
+		su.PasswordHash = ""
+		return nil
+	}
+	salt, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	rawSalt, _ := hex.DecodeString(salt)
+	su.PasswordSalt = salt
+	su.PasswordHash = hex.EncodeToString(commons.PBKDF2SHA256([]byte(password), rawSalt, passwordIterations))
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,309 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/timshannon/bolthold"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+type StorePipelineVersion struct {
+	Uuid         string `boltholdKey:"Uuid"`
+	PipelineUUID string `boltholdIndex:"VersionPipelineUUID"`
+	Number       int
+	CreatedAt    time.Time
+	Author       string
+	Action       string
+
+	Label       string
+	Description string
+	Assets      []StoreVersionAsset
+}
+
+type StoreVersionAsset struct {
+	Uuid        string
+	Label       string
+	Type        string
+	ContentType string
+	Size        int
+	Hash        string
+}
+
+// StoreAssetContent holds assets contents of versions, shared between
+// versions by their sha256 hash
+type StoreAssetContent struct {
+	Hash  string `boltholdKey:"Hash"`
+	Value []byte
+}
+
+// SavePipelineVersion records the current state of the pipeline as a new
+// version, nothing is recorded when it did not change since the last version.
+// The pipeline is read and its version written in a single transaction.
+func (s *Store) SavePipelineVersion(pipelineUUID string, author string, action string) (models.PipelineVersion, error) {
+	var saved StorePipelineVersion
+	err := s.db.Bolt().Update(func(tx *bolt.Tx) error {
+		p, err := s.txFindOnePipelineByUUID(tx, pipelineUUID, true)
+		if err != nil {
+			return err
+		}
+
+		sv := StorePipelineVersion{
+			Uuid:         fmt.Sprintf("%s-%d", pipelineUUID, time.Now().UnixNano()),
+			PipelineUUID: pipelineUUID,
+			Number:       1,
+			CreatedAt:    time.Now(),
+			Author:       author,
+			Action:       action,
+			Label:        p.Label,
+			Description:  p.Description,
+			Assets:       []StoreVersionAsset{},
+		}
+
+		for _, a := range p.Assets {
+			sum := sha256.Sum256(a.Value)
+			hash := hex.EncodeToString(sum[:])
+			if err := s.db.TxUpsert(tx, hash, &StoreAssetContent{Hash: hash, Value: a.Value}); err != nil {
+				return err
+			}
+			sv.Assets = append(sv.Assets, StoreVersionAsset{
+				Uuid:        a.Uuid,
+				Label:       a.Name,
+				Type:        a.Type,
+				ContentType: a.ContentType,
+				Size:        a.Size,
+				Hash:        hash,
+			})
+		}
+
+		svs, err := s.txFindStorePipelineVersions(tx, pipelineUUID)
+		if err != nil {
+			return err
+		}
+		if len(svs) > 0 {
+			last := svs[0]
+			if sameVersion(last, sv) {
+				saved = last
+				return nil
+			}
+			sv.Number = last.Number + 1
+		}
+
+		saved = sv
+		return s.db.TxInsert(tx, sv.Uuid, &sv)
+	})
+	if err != nil {
+		return models.PipelineVersion{}, err
+	}
+	return s.pipelineVersion(saved, false)
+}
+
+// sameVersion returns true when both versions hold the same pipeline and assets
+func sameVersion(a, b StorePipelineVersion) bool {
+	if a.Label != b.Label || a.Description != b.Description || len(a.Assets) != len(b.Assets) {
+		return false
+	}
+	for i := range a.Assets {
+		if a.Assets[i] != b.Assets[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// findStorePipelineVersions returns versions of the pipeline, newest first
+func (s *Store) findStorePipelineVersions(pipelineUUID string) ([]StorePipelineVersion, error) {
+	var svs []StorePipelineVersion
+	err := s.db.Bolt().View(func(tx *bolt.Tx) error {
+		var err error
+		svs, err = s.txFindStorePipelineVersions(tx, pipelineUUID)
+		return err
+	})
+	return svs, err
+}
+
+func (s *Store) txFindStorePipelineVersions(tx *bolt.Tx, pipelineUUID string) ([]StorePipelineVersion, error) {
+	var svs []StorePipelineVersion
+	err := s.db.TxFind(tx, &svs, bolthold.Where("PipelineUUID").Eq(pipelineUUID))
+	if err != nil {
+		return svs, err
+	}
+	sort.Slice(svs, func(i, j int) bool { return svs[i].Number > svs[j].Number })
+	return svs, nil
+}
+
+func (s *Store) pipelineVersion(sv StorePipelineVersion, withAssetValues bool) (models.PipelineVersion, error) {
+	v := models.PipelineVersion{
+		PipelineUUID: sv.PipelineUUID,
+		Number:       sv.Number,
+		CreatedAt:    sv.CreatedAt,
+		Author:       sv.Author,
+		Action:       sv.Action,
+		Label:        sv.Label,
+		Description:  sv.Description,
+		Assets:       []models.Asset{},
+	}
+	for _, a := range sv.Assets {
+		asset := models.Asset{
+			Uuid:         a.Uuid,
+			PipelineUUID: sv.PipelineUUID,
+			Name:         a.Label,
+			Type:         a.Type,
+			ContentType:  a.ContentType,
+			Size:         a.Size,
+		}
+		if withAssetValues {
+			var content StoreAssetContent
+			if err := s.db.Get(a.Hash, &content); err != nil {
+				return v, fmt.Errorf("content of asset %s in version %d not found - %v", a.Label, sv.Number, err)
+			}
+			asset.Value = content.Value
+		}
+		v.Assets = append(v.Assets, asset)
+	}
+	return v, nil
+}
+
+// FindPipelineVersions returns versions of the pipeline, newest first
+func (s *Store) FindPipelineVersions(pipelineUUID string, withAssetValues bool) ([]models.PipelineVersion, error) {
+	versions := []models.PipelineVersion{}
+	svs, err := s.findStorePipelineVersions(pipelineUUID)
+	if err != nil {
+		return versions, err
+	}
+	for _, sv := range svs {
+		v, err := s.pipelineVersion(sv, withAssetValues)
+		if err != nil {
+			return versions, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// FindOnePipelineVersion returns the version number of the pipeline
+func (s *Store) FindOnePipelineVersion(pipelineUUID string, number int, withAssetValues bool) (models.PipelineVersion, error) {
+	var svs []StorePipelineVersion
+	err := s.db.Find(&svs, bolthold.Where("PipelineUUID").Eq(pipelineUUID).And("Number").Eq(number))
+	if err != nil {
+		return models.PipelineVersion{}, err
+	}
+	if len(svs) == 0 {
+		return models.PipelineVersion{}, fmt.Errorf("Version %d of pipeline %s not found", number, pipelineUUID)
+	}
+	return s.pipelineVersion(svs[0], withAssetValues)
+}
+
+// FindAssetVersions returns versions of the pipeline where the asset was
+// added, renamed or modified, newest first, each one holds only the asset
+func (s *Store) FindAssetVersions(assetUUID string) ([]models.PipelineVersion, error) {
+	versions := []models.PipelineVersion{}
+
+	asset, err := s.FindOneAssetByUUID(assetUUID)
+	if err != nil {
+		return versions, err
+	}
+	svs, err := s.findStorePipelineVersions(asset.PipelineUUID)
+	if err != nil {
+		return versions, err
+	}
+
+	// walk from the oldest version to keep only changes
+	var previous *StoreVersionAsset
+	for i := len(svs) - 1; i >= 0; i-- {
+		var current *StoreVersionAsset
+		for j := range svs[i].Assets {
+			if svs[i].Assets[j].Uuid == assetUUID {
+				current = &svs[i].Assets[j]
+				break
+			}
+		}
+		if current != nil && (previous == nil || *previous != *current) {
+			sv := svs[i]
+			sv.Assets = []StoreVersionAsset{*current}
+			v, err := s.pipelineVersion(sv, false)
+			if err != nil {
+				return versions, err
+			}
+			versions = append([]models.PipelineVersion{v}, versions...)
+		}
+		previous = current
+	}
+	return versions, nil
+}
+
+// RestorePipelineVersion replaces the pipeline and its assets with the ones of the
+// version number, assets missing from the version are deleted
+func (s *Store) RestorePipelineVersion(pipelineUUID string, number int) (models.Pipeline, error) {
+	p, err := s.FindOnePipelineByUUID(pipelineUUID, false)
+	if err != nil {
+		return p, err
+	}
+	v, err := s.FindOnePipelineVersion(pipelineUUID, number, true)
+	if err != nil {
+		return p, err
+	}
+
+	keep := map[string]bool{}
+	for _, a := range v.Assets {
+		keep[a.Uuid] = true
+	}
+	for _, a := range p.Assets {
+		if !keep[a.Uuid] {
+			if err := s.db.Delete(a.Uuid, &StoreAsset{}); err != nil {
+				return p, err
+			}
+		}
+	}
+
+	p.Label = v.Label
+	p.Description = v.Description
+	p.Assets = v.Assets
+	for i := range p.Assets {
+		p.Assets[i].PipelineUUID = pipelineUUID
+	}
+	s.SavePipeline(&p)
+
+	return p, nil
+}
+
+// DeletePipelineVersions removes all versions of the pipeline and the
+// assets contents no more used by any version
+func (s *Store) DeletePipelineVersions(pipelineUUID string) error {
+	err := s.db.DeleteMatching(&StorePipelineVersion{}, bolthold.Where("PipelineUUID").Eq(pipelineUUID))
+	if err != nil {
+		return err
+	}
+	return s.pruneAssetContents()
+}
+
+// pruneAssetContents removes the assets contents no more used by any version
+func (s *Store) pruneAssetContents() error {
+	var svs []StorePipelineVersion
+	if err := s.db.Find(&svs, &bolthold.Query{}); err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, sv := range svs {
+		for _, a := range sv.Assets {
+			used[a.Hash] = true
+		}
+	}
+
+	var contents []StoreAssetContent
+	if err := s.db.Find(&contents, &bolthold.Query{}); err != nil {
+		return err
+	}
+	for _, c := range contents {
+		if !used[c.Hash] {
+			if err := s.db.Delete(c.Hash, &StoreAssetContent{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vjeantet/bitfan/api/models"
+)
+
+func versionNumbers(t *testing.T, s *Store, pipelineUUID string) []int {
+	versions, err := s.FindPipelineVersions(pipelineUUID, false)
+	assert.NoError(t, err)
+	numbers := []int{}
+	for _, v := range versions {
+		numbers = append(numbers, v.Number)
+	}
+	return numbers
+}
+
+func TestSavePipelineVersion(t *testing.T) {
+	s := newTestStore(t)
+	p := testPipeline("p1", "web", "main.conf")
+	s.CreatePipeline(&p)
+
+	v, err := s.SavePipelineVersion("p1", "bob", "created")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v.Number)
+	assert.Equal(t, "bob", v.Author)
+	assert.Equal(t, "created", v.Action)
+
+	// nothing changed, the last version is returned
+	v, err = s.SavePipelineVersion("p1", "alice", "saved")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v.Number)
+	assert.Equal(t, "bob", v.Author)
+
+	p.Assets[0].Value = []byte("changed")
+	p.Assets[0].PipelineUUID = "p1"
+	s.SavePipeline(&p)
+	v, err = s.SavePipelineVersion("p1", "alice", "updated")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v.Number)
+	assert.Equal(t, []int{2, 1}, versionNumbers(t, s, "p1"))
+
+	_, err = s.SavePipelineVersion("unknown", "bob", "created")
+	assert.Error(t, err)
+}
+
+func TestRestorePipelineVersion(t *testing.T) {
+	s := newTestStore(t)
+	p := testPipeline("p1", "v1", "main.conf", "extra.conf")
+	s.CreatePipeline(&p)
+	_, err := s.SavePipelineVersion("p1", "bob", "created")
+	assert.NoError(t, err)
+
+	// version 2 changes main.conf, removes extra.conf and adds new.conf
+	s.SaveAsset(&models.Asset{Uuid: "p1-main.conf", PipelineUUID: "p1", Name: "main.conf", Type: models.ASSET_TYPE_ENTRYPOINT, Value: []byte("v2 main.conf")})
+	s.DeleteAsset(&models.Asset{Uuid: "p1-extra.conf", PipelineUUID: "p1"})
+	s.CreateAsset(&models.Asset{Uuid: "p1-new.conf", PipelineUUID: "p1", Name: "new.conf", Value: []byte("v2 new.conf")})
+	_, err = s.SavePipelineVersion("p1", "bob", "updated")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pipeline p1 v1 [main.conf=v2 main.conf new.conf=v2 new.conf]"}, contents(s))
+
+	restored, err := s.RestorePipelineVersion("p1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", restored.Label)
+	assert.Equal(t, []string{"pipeline p1 v1 [extra.conf=v1 extra.conf main.conf=v1 main.conf]"}, contents(s))
+
+	// assets missing from the version are deleted
+	_, err = s.FindOneAssetByUUID("p1-new.conf")
+	assert.Error(t, err)
+	assets, err := s.FindAssetsByPipelineUUID("p1")
+	assert.NoError(t, err)
+	assert.Len(t, assets, 2)
+
+	// versions are kept, the deleted asset can be restored
+	assert.Equal(t, []int{2, 1}, versionNumbers(t, s, "p1"))
+	_, err = s.RestorePipelineVersion("p1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pipeline p1 v1 [main.conf=v2 main.conf new.conf=v2 new.conf]"}, contents(s))
+	_, err = s.FindOneAssetByUUID("p1-extra.conf")
+	assert.Error(t, err)
+}
+
+func TestRestorePipelineVersionErrors(t *testing.T) {
+	s := newTestStore(t)
+	p := testPipeline("p1", "v1", "main.conf")
+	s.CreatePipeline(&p)
+
+	_, err := s.RestorePipelineVersion("p1", 1)
+	assert.EqualError(t, err, "Version 1 of pipeline p1 not found")
+	_, err = s.RestorePipelineVersion("unknown", 1)
+	assert.EqualError(t, err, "Pipeline unknown not found")
+}
+
+func TestDeletePipelineVersions(t *testing.T) {
+	s := newTestStore(t)
+	for _, p := range []models.Pipeline{
+		testPipeline("p1", "same", "main.conf"),
+		testPipeline("p2", "same", "main.conf"),
+	} {
+		s.CreatePipeline(&p)
+	}
+	// both pipelines have an asset with the same content
+	s.SaveAsset(&models.Asset{Uuid: "p2-main.conf", PipelineUUID: "p2", Name: "main.conf", Type: models.ASSET_TYPE_ENTRYPOINT, Value: []byte("same main.conf")})
+	for _, uuid := range []string{"p1", "p2"} {
+		_, err := s.SavePipelineVersion(uuid, "bob", "created")
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, s.DeletePipelineVersions("p1"))
+	assert.Empty(t, versionNumbers(t, s, "p1"))
+
+	// the content is still used by p2
+	v, err := s.FindOnePipelineVersion("p2", 1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "same main.conf", string(v.Assets[0].Value))
+
+	assert.NoError(t, s.DeletePipelineVersions("p2"))
+	var contents []StoreAssetContent
+	assert.NoError(t, s.db.Find(&contents, nil))
+	assert.Empty(t, contents)
+}
@@ -29,7 +29,12 @@ type StoreXProcessor struct {
 }
 
 func (s *Store) CreateXProcessor(xp *models.XProcessor) {
-	sxp := &StoreXProcessor{
+	sxp := storeXProcessor(xp)
+	s.db.Upsert(sxp.Uuid, sxp)
+}
+
+func storeXProcessor(xp *models.XProcessor) *StoreXProcessor {
+	return &StoreXProcessor{
 		Uuid:      xp.Uuid,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -47,8 +52,6 @@ func (s *Store) CreateXProcessor(xp *models.XProcessor) {
 		OptionsCompositionTpl: xp.OptionsCompositionTpl,
 		HasDoc:                xp.HasDoc,
 	}
-
-	s.db.Upsert(sxp.Uuid, sxp)
 }
 
 func (s *Store) SaveXProcessor(xp *models.XProcessor) {